@@ -30,4 +30,11 @@ func envDescription(desc, env string) string {
 func initArgs(cmd *cobra.Command) {
 	initGeneralArgs(cmd)
 	initAppArgs(cmd)
+	initSecretsArgs(cmd)
+	initContainerArgs(cmd)
+	initAdminArgs(cmd)
+	initTracingArgs(cmd)
+	initAuditArgs(cmd)
+	initMaintenanceArgs(cmd)
+	initSelfUpdateArgs(cmd)
 }
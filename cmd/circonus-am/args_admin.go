@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/circonus/agent-manager/internal/config"
+	"github.com/circonus/agent-manager/internal/config/defaults"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/release"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// initAdminArgs adds local admin api args to the cobra command.
+func initAdminArgs(cmd *cobra.Command) {
+	{
+		const (
+			key          = keys.AdminEnable
+			longOpt      = "admin-enable"
+			envVar       = release.ENVPREFIX + "_ADMIN_ENABLE"
+			description  = "Enable local admin API"
+			defaultValue = defaults.AdminEnable
+		)
+
+		cmd.Flags().Bool(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.AdminSocket
+			longOpt      = "admin-socket"
+			envVar       = release.ENVPREFIX + "_ADMIN_SOCKET"
+			description  = "Local admin API unix socket (default etc/circonus-am.sock)"
+			defaultValue = ""
+		)
+
+		cmd.PersistentFlags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.PersistentFlags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.AdminTokenFile
+			longOpt      = "admin-token-file"
+			envVar       = release.ENVPREFIX + "_ADMIN_TOKEN_FILE"
+			description  = "Local admin API token file (default etc/.id/adm)"
+			defaultValue = ""
+		)
+
+		cmd.PersistentFlags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.PersistentFlags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+}
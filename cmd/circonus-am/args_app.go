@@ -1,6 +1,7 @@
 package main
 
 import (
+	"github.com/circonus/agent-manager/internal/config"
 	"github.com/circonus/agent-manager/internal/config/defaults"
 	"github.com/circonus/agent-manager/internal/config/keys"
 	"github.com/circonus/agent-manager/internal/release"
@@ -20,8 +21,8 @@ func initAppArgs(cmd *cobra.Command) {
 		)
 
 		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 	{
@@ -34,8 +35,8 @@ func initAppArgs(cmd *cobra.Command) {
 		)
 
 		cmd.Flags().Bool(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -48,7 +49,7 @@ func initAppArgs(cmd *cobra.Command) {
 		)
 
 		cmd.Flags().Bool(longOpt, defaultValue, description)
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -62,8 +63,23 @@ func initAppArgs(cmd *cobra.Command) {
 		)
 
 		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.APIAllowHTTP
+			longOpt      = "api-allow-http"
+			envVar       = release.ENVPREFIX + "_API_ALLOW_HTTP"
+			description  = "Allow an http (not https) API URL, e.g. for testing"
+			defaultValue = defaults.APIAllowHTTP
+		)
+
+		cmd.Flags().Bool(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -77,8 +93,8 @@ func initAppArgs(cmd *cobra.Command) {
 		)
 
 		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -92,8 +108,23 @@ func initAppArgs(cmd *cobra.Command) {
 		)
 
 		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.DiscoveryPollingInterval
+			longOpt      = "discovery-poll-interval"
+			envVar       = release.ENVPREFIX + "_DISCOVERY_POLL_INTERVAL"
+			description  = "Interval for discovering agents installed, removed or upgraded"
+			defaultValue = defaults.DiscoveryPollingInterval
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -102,13 +133,88 @@ func initAppArgs(cmd *cobra.Command) {
 			key          = keys.StatusPollingInterval
 			longOpt      = "status-poll-interval"
 			envVar       = release.ENVPREFIX + "_STATUS_POLL_INTERVAL"
-			description  = "Polling interval for gathering agent status"
+			description  = "Interval for reporting agent status (heartbeat when unchanged)"
 			defaultValue = defaults.StatusPollingInterval
 		)
 
 		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.StatusCheckInterval
+			longOpt      = "status-check-interval"
+			envVar       = release.ENVPREFIX + "_STATUS_CHECK_INTERVAL"
+			description  = "Interval for checking agent status locally, changes are reported immediately"
+			defaultValue = defaults.StatusCheckInterval
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.StatusReportTimeout
+			longOpt      = "status-report-timeout"
+			envVar       = release.ENVPREFIX + "_STATUS_REPORT_TIMEOUT"
+			description  = "Agent status is failed when no report is received within this time (Docker specific)"
+			defaultValue = defaults.StatusReportTimeout
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.PollJitter
+			longOpt      = "poll-jitter"
+			envVar       = release.ENVPREFIX + "_POLL_JITTER"
+			description  = "Randomize the action, status, tracker and discovery poll intervals by up to this fraction (0-0.5)"
+			defaultValue = defaults.PollJitter
+		)
+
+		cmd.Flags().Float64(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.SplayMax
+			longOpt      = "splay-max"
+			envVar       = release.ENVPREFIX + "_SPLAY_MAX"
+			description  = "Random delay, up to this, before applying config actions and commands (0s to disable)"
+			defaultValue = defaults.SplayMax
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.DrainTimeout
+			longOpt      = "drain-timeout"
+			envVar       = release.ENVPREFIX + "_DRAIN_TIMEOUT"
+			description  = "On shutdown, wait this long for actions in progress to finish"
+			defaultValue = defaults.DrainTimeout
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -123,8 +229,8 @@ func initAppArgs(cmd *cobra.Command) {
 		defaultValue := defaults.AWSEC2Tags
 
 		cmd.Flags().StringSlice(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -141,8 +247,8 @@ func initAppArgs(cmd *cobra.Command) {
 		defaultValue := defaults.Tags
 
 		cmd.Flags().StringSlice(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -159,8 +265,23 @@ func initAppArgs(cmd *cobra.Command) {
 		cmd.Flags().Bool(longOpt, defaultValue, envDescription(description, envVar))
 		flag := cmd.Flags().Lookup(longOpt)
 		flag.Hidden = true
-		bindFlagError(longOpt, viper.BindPFlag(key, flag))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, flag))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.SystemdDBus
+			longOpt      = "systemd-dbus"
+			envVar       = release.ENVPREFIX + "_SYSTEMD_DBUS"
+			description  = "Use systemd D-Bus API for agent service commands and status (linux)"
+			defaultValue = defaults.SystemdDBus
+		)
+
+		cmd.Flags().Bool(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -174,8 +295,8 @@ func initAppArgs(cmd *cobra.Command) {
 		)
 
 		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -190,8 +311,8 @@ func initAppArgs(cmd *cobra.Command) {
 		defaultValue := defaults.Agents
 
 		cmd.Flags().StringSlice(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -205,8 +326,8 @@ func initAppArgs(cmd *cobra.Command) {
 		)
 
 		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -220,8 +341,8 @@ func initAppArgs(cmd *cobra.Command) {
 		)
 
 		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -235,8 +356,8 @@ func initAppArgs(cmd *cobra.Command) {
 		)
 
 		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -250,8 +371,8 @@ func initAppArgs(cmd *cobra.Command) {
 		)
 
 		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -265,8 +386,8 @@ func initAppArgs(cmd *cobra.Command) {
 		)
 
 		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -280,8 +401,8 @@ func initAppArgs(cmd *cobra.Command) {
 		)
 
 		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -296,8 +417,8 @@ func initAppArgs(cmd *cobra.Command) {
 		defaultValue := defaults.ServerUseTLS
 
 		cmd.Flags().Bool(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -311,8 +432,8 @@ func initAppArgs(cmd *cobra.Command) {
 		)
 
 		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -326,8 +447,20 @@ func initAppArgs(cmd *cobra.Command) {
 		)
 
 		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		// NOTE: no command line option, token should not be visible in process list
+		const (
+			key          = keys.ServerConfigToken
+			envVar       = release.ENVPREFIX + "_SERVER_CONFIG_TOKEN"
+			defaultValue = ""
+		)
+
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 }
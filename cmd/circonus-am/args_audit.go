@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/circonus/agent-manager/internal/config"
+	"github.com/circonus/agent-manager/internal/config/defaults"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/release"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// initAuditArgs adds audit log args to the cobra command.
+func initAuditArgs(cmd *cobra.Command) {
+	{
+		const (
+			key          = keys.AuditEnable
+			longOpt      = "audit-enable"
+			envVar       = release.ENVPREFIX + "_AUDIT_ENABLE"
+			description  = "Record changes made on the host in the audit log"
+			defaultValue = defaults.AuditEnable
+		)
+
+		cmd.Flags().Bool(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.AuditFile
+			longOpt      = "audit-file"
+			envVar       = release.ENVPREFIX + "_AUDIT_FILE"
+			description  = "Audit log file (default etc/audit/audit.log)"
+			defaultValue = ""
+		)
+
+		cmd.PersistentFlags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.PersistentFlags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.AuditMaxSize
+			longOpt      = "audit-max-size"
+			envVar       = release.ENVPREFIX + "_AUDIT_MAX_SIZE"
+			description  = "Rotate the audit log at this size"
+			defaultValue = defaults.AuditMaxSize
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.AuditMaxFiles
+			longOpt      = "audit-max-files"
+			envVar       = release.ENVPREFIX + "_AUDIT_MAX_FILES"
+			description  = "Number of rotated audit log files to keep"
+			defaultValue = defaults.AuditMaxFiles
+		)
+
+		cmd.Flags().Int(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/circonus/agent-manager/internal/config"
+	"github.com/circonus/agent-manager/internal/config/defaults"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/release"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// initContainerArgs adds container engine integration args to the cobra command.
+func initContainerArgs(cmd *cobra.Command) {
+	{
+		const (
+			key          = keys.ContainerEngineSocket
+			longOpt      = "container-engine-socket"
+			envVar       = release.ENVPREFIX + "_CONTAINER_ENGINE_SOCKET"
+			description  = "Docker/Podman engine API socket, reload agent containers and read their state (Docker specific)"
+			defaultValue = ""
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.ContainerLabel
+			longOpt      = "container-label"
+			envVar       = release.ENVPREFIX + "_CONTAINER_LABEL"
+			description  = "Label identifying agent containers, value is the agent type (Docker specific)"
+			defaultValue = defaults.ContainerLabel
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.ContainerReload
+			longOpt      = "container-reload"
+			envVar       = release.ENVPREFIX + "_CONTAINER_RELOAD"
+			description  = "Agent container reload method on config change (restart|signal|exec) (Docker specific)"
+			defaultValue = defaults.ContainerReload
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+}
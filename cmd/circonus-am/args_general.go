@@ -1,6 +1,7 @@
 package main
 
 import (
+	"github.com/circonus/agent-manager/internal/config"
 	"github.com/circonus/agent-manager/internal/config/defaults"
 	"github.com/circonus/agent-manager/internal/config/keys"
 	"github.com/circonus/agent-manager/internal/release"
@@ -17,7 +18,7 @@ func initGeneralArgs(cmd *cobra.Command) {
 			description = "config file (default: " + defaults.ConfigFile + "|.json|.toml)"
 		)
 
-		cmd.Flags().StringVarP(&cfgFile, longOpt, shortOpt, "", description)
+		cmd.PersistentFlags().StringVarP(&cfgFile, longOpt, shortOpt, "", description)
 	}
 
 	{
@@ -31,7 +32,22 @@ func initGeneralArgs(cmd *cobra.Command) {
 
 		cmd.Flags().BoolP(longOpt, shortOpt, defaultValue, description)
 
-		if err := viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)); err != nil {
+		if err := config.BindFlag(key, cmd.Flags().Lookup(longOpt)); err != nil {
+			bindFlagError(longOpt, err)
+		}
+	}
+
+	{
+		const (
+			key          = keys.CheckConfig
+			longOpt      = "check-config"
+			defaultValue = false
+			description  = "Validate the configuration and exit (non-zero if invalid)"
+		)
+
+		cmd.Flags().Bool(longOpt, defaultValue, description)
+
+		if err := config.BindFlag(key, cmd.Flags().Lookup(longOpt)); err != nil {
 			bindFlagError(longOpt, err)
 		}
 	}
@@ -47,8 +63,8 @@ func initGeneralArgs(cmd *cobra.Command) {
 		)
 
 		cmd.Flags().BoolP(longOpt, shortOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -62,8 +78,8 @@ func initGeneralArgs(cmd *cobra.Command) {
 		)
 
 		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
-		bindEnvError(envVar, viper.BindEnv(key, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 
@@ -76,7 +92,22 @@ func initGeneralArgs(cmd *cobra.Command) {
 		)
 
 		cmd.Flags().Bool(longOpt, defaultValue, description)
-		bindFlagError(longOpt, viper.BindPFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.ConfigWatch
+			longOpt      = "config-watch"
+			envVar       = release.ENVPREFIX + "_CONFIG_WATCH"
+			description  = "Reload the config file when it changes (also reloaded on SIGHUP)"
+			defaultValue = defaults.ConfigWatch
+		)
+
+		cmd.Flags().Bool(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
 		viper.SetDefault(key, defaultValue)
 	}
 }
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/circonus/agent-manager/internal/config"
+	"github.com/circonus/agent-manager/internal/config/defaults"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/release"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// initMaintenanceArgs adds host maintenance args to the cobra command.
+func initMaintenanceArgs(cmd *cobra.Command) {
+	{
+		const (
+			key          = keys.MaintenanceEnable
+			longOpt      = "maintenance"
+			envVar       = release.ENVPREFIX + "_MAINTENANCE"
+			description  = "Host maintenance, defer config installs and agent commands, do not report drift"
+			defaultValue = defaults.MaintenanceEnable
+		)
+
+		cmd.Flags().Bool(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.MaintenanceUntil
+			longOpt      = "maintenance-until"
+			envVar       = release.ENVPREFIX + "_MAINTENANCE_UNTIL"
+			description  = "End --maintenance after a duration (e.g. 2h) or at an RFC3339 time"
+			defaultValue = ""
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.MaintenanceFile
+			longOpt      = "maintenance-file"
+			envVar       = release.ENVPREFIX + "_MAINTENANCE_FILE"
+			description  = "Maintenance marker file, the host is in maintenance while it exists (default etc/maintenance)"
+			defaultValue = ""
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+}
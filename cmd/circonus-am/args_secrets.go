@@ -0,0 +1,131 @@
+package main
+
+import (
+	"github.com/circonus/agent-manager/internal/config"
+	"github.com/circonus/agent-manager/internal/config/defaults"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/release"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// initSecretsArgs adds secret provider args to the cobra command.
+func initSecretsArgs(cmd *cobra.Command) {
+	{
+		const (
+			key          = keys.SecretsCacheTTL
+			longOpt      = "secrets-cache-ttl"
+			envVar       = release.ENVPREFIX + "_SECRETS_CACHE_TTL"
+			description  = "How long resolved secrets are cached (0s to disable)"
+			defaultValue = defaults.SecretsCacheTTL
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.SecretsFileBasePath
+			longOpt      = "secrets-file-base-path"
+			envVar       = release.ENVPREFIX + "_SECRETS_FILE_BASE_PATH"
+			description  = "Restrict file secret references to this directory (default etc/secrets, / for any file)"
+			defaultValue = defaults.SecretsFileBasePath
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key         = keys.SecretsEnvAllow
+			longOpt     = "secrets-env-allow"
+			envVar      = release.ENVPREFIX + "_SECRETS_ENV_ALLOW"
+			description = "Environment variable name patterns env secret references may use"
+		)
+
+		defaultValue := defaults.SecretsEnvAllow
+
+		cmd.Flags().StringSlice(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.SecretsVaultAddress
+			longOpt      = "secrets-vault-address"
+			envVar       = release.ENVPREFIX + "_SECRETS_VAULT_ADDRESS"
+			description  = "Vault (KV v2 compatible) address for vault secret references"
+			defaultValue = ""
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		// NOTE: no command line option, token should not be visible in process list
+		const (
+			key          = keys.SecretsVaultToken
+			envVar       = release.ENVPREFIX + "_SECRETS_VAULT_TOKEN"
+			defaultValue = ""
+		)
+
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.SecretsVaultTokenFile
+			longOpt      = "secrets-vault-token-file"
+			envVar       = release.ENVPREFIX + "_SECRETS_VAULT_TOKEN_FILE"
+			description  = "File containing Vault token (e.g. vault agent sink)"
+			defaultValue = ""
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.SecretsVaultMount
+			longOpt      = "secrets-vault-mount"
+			envVar       = release.ENVPREFIX + "_SECRETS_VAULT_MOUNT"
+			description  = "Vault KV v2 mount path"
+			defaultValue = defaults.SecretsVaultMount
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.SecretsVaultNamespace
+			longOpt      = "secrets-vault-namespace"
+			envVar       = release.ENVPREFIX + "_SECRETS_VAULT_NAMESPACE"
+			description  = "Vault namespace"
+			defaultValue = ""
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+}
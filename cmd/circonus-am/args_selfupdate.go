@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/circonus/agent-manager/internal/config"
+	"github.com/circonus/agent-manager/internal/config/defaults"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/release"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// initSelfUpdateArgs adds self-update args to the cobra command.
+func initSelfUpdateArgs(cmd *cobra.Command) {
+	{
+		const (
+			key          = keys.SelfUpdateEnable
+			longOpt      = "self-update"
+			envVar       = release.ENVPREFIX + "_SELF_UPDATE"
+			description  = "Allow self-update command actions (requires --self-update-public-key)"
+			defaultValue = defaults.SelfUpdateEnable
+		)
+
+		cmd.Flags().Bool(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.SelfUpdatePublicKey
+			longOpt      = "self-update-public-key"
+			envVar       = release.ENVPREFIX + "_SELF_UPDATE_PUBLIC_KEY"
+			description  = "Base64 ed25519 public key release artifacts must be signed with"
+			defaultValue = ""
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.SelfUpdateHealthTimeout
+			longOpt      = "self-update-health-timeout"
+			envVar       = release.ENVPREFIX + "_SELF_UPDATE_HEALTH_TIMEOUT"
+			description  = "Time the new binary has to complete a successful action poll, before rolling back"
+			defaultValue = defaults.SelfUpdateHealthTimeout
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.SelfUpdateRestart
+			longOpt      = "self-update-restart"
+			envVar       = release.ENVPREFIX + "_SELF_UPDATE_RESTART"
+			description  = "Command restarting the manager through the service manager after a self-update"
+			defaultValue = defaults.SelfUpdateRestart
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/circonus/agent-manager/internal/config"
+	"github.com/circonus/agent-manager/internal/config/defaults"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/release"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// initTracingArgs adds OpenTelemetry tracing args to the cobra command.
+func initTracingArgs(cmd *cobra.Command) {
+	{
+		const (
+			key          = keys.TracingExporter
+			longOpt      = "tracing-exporter"
+			envVar       = release.ENVPREFIX + "_TRACING_EXPORTER"
+			description  = "Trace exporter for action spans (none|otlp|stdout|file)"
+			defaultValue = defaults.TracingExporter
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.TracingEndpoint
+			longOpt      = "tracing-endpoint"
+			envVar       = release.ENVPREFIX + "_TRACING_ENDPOINT"
+			description  = "OTLP/HTTP endpoint URL for the otlp exporter (default OTEL_EXPORTER_OTLP_ENDPOINT or http://localhost:4318)"
+			defaultValue = ""
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.TracingFile
+			longOpt      = "tracing-file"
+			envVar       = release.ENVPREFIX + "_TRACING_FILE"
+			description  = "File the file exporter appends spans to (JSON)"
+			defaultValue = ""
+		)
+
+		cmd.Flags().String(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+
+	{
+		const (
+			key          = keys.TracingSampleRatio
+			longOpt      = "tracing-sample-ratio"
+			envVar       = release.ENVPREFIX + "_TRACING_SAMPLE_RATIO"
+			description  = "Fraction of action traces sampled (0-1)"
+			defaultValue = defaults.TracingSampleRatio
+		)
+
+		cmd.Flags().Float64(longOpt, defaultValue, envDescription(description, envVar))
+		bindFlagError(longOpt, config.BindFlag(key, cmd.Flags().Lookup(longOpt)))
+		bindEnvError(envVar, config.BindEnv(key, envVar))
+		viper.SetDefault(key, defaultValue)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/circonus/agent-manager/internal/audit"
+	"github.com/spf13/cobra"
+)
+
+// auditAnchor is the audit log position reported to the API, to verify against.
+var auditAnchor audit.Anchor
+
+// initAuditCmd returns the audit command, for working with the local audit log.
+func initAuditCmd() *cobra.Command {
+	a := &cobra.Command{
+		Use:   "audit",
+		Short: "Local audit log of changes made on the host",
+	}
+
+	verify := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the audit log hash chain (including rotated files)",
+		Args:  cobra.NoArgs,
+		Run:   ctlRun(auditVerify),
+	}
+
+	verify.Flags().BoolVar(&ctlJSON, "json", false, "Output JSON")
+	verify.Flags().Uint64Var(&auditAnchor.Seq, "anchor-seq", 0, "Check the chain includes this entry (audit seq reported to the API)")
+	verify.Flags().StringVar(&auditAnchor.Hash, "anchor-hash", "", "Hash of the anchored entry (audit hash reported to the API)")
+
+	a.AddCommand(verify)
+
+	return a
+}
+
+func auditVerify(_ *cobra.Command, _ []string) error {
+	var (
+		result *audit.VerifyResult
+		err    error
+	)
+
+	if auditAnchor.Seq > 0 {
+		if auditAnchor.Hash == "" {
+			return fmt.Errorf("--anchor-hash required with --anchor-seq")
+		}
+
+		result, err = audit.VerifyAnchor(audit.File(), auditAnchor)
+	} else {
+		result, err = audit.Verify(audit.File())
+	}
+
+	if ctlJSON && result != nil {
+		if perr := printJSON(result); perr != nil {
+			return perr
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !ctlJSON {
+		fmt.Printf("OK: %d entries (seq %d-%d) in %s\n",
+			result.Entries, result.FirstSeq, result.LastSeq, strings.Join(result.Files, ", "))
+
+		if result.Anchored {
+			fmt.Printf("OK: includes anchored entry %d\n", auditAnchor.Seq)
+		}
+	}
+
+	return nil
+}
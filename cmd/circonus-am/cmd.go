@@ -2,9 +2,12 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 
+	"github.com/circonus/agent-manager/internal/config"
 	"github.com/circonus/agent-manager/internal/config/defaults"
 	"github.com/circonus/agent-manager/internal/config/keys"
 	"github.com/circonus/agent-manager/internal/manager"
@@ -28,6 +31,12 @@ func initCmd() *cobra.Command {
 				return
 			}
 
+			if viper.GetBool(keys.CheckConfig) {
+				checkConfig()
+
+				return
+			}
+
 			if viper.ConfigFileUsed() == "" {
 				log.Warn().Str("default", filepath.Join(defaults.EtcPath, release.NAME+".yaml")).Msg("no config file found/used")
 			} else {
@@ -40,6 +49,8 @@ func initCmd() *cobra.Command {
 			viper.Set(keys.ManagerIDFile, defaults.ManagerIDFile)
 			viper.Set(keys.RefreshTokenFile, defaults.RefreshTokenFile)
 			viper.Set(keys.MachineIDFile, defaults.MachineIDFile)
+			viper.Set(keys.DeferredFile, defaults.DeferredFile)
+			viper.Set(keys.SelfUpdateFile, defaults.SelfUpdateFile)
 
 			m, err := manager.New()
 			if err != nil {
@@ -54,5 +65,27 @@ func initCmd() *cobra.Command {
 
 	initArgs(cmd)
 
+	cmd.AddCommand(initCtlCmd(), initAuditCmd())
+
 	return cmd
 }
+
+// checkConfig validates the configuration, listing any problems, exits non-zero if invalid.
+func checkConfig() {
+	cfgFile := viper.ConfigFileUsed()
+	if cfgFile == "" {
+		cfgFile = "none, defaults/flags/environment only"
+	}
+
+	if err := config.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "config invalid (%s):\n", cfgFile)
+
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(os.Stderr, "  - %s\n", line)
+		}
+
+		os.Exit(1)
+	}
+
+	fmt.Printf("config OK (%s)\n", cfgFile)
+}
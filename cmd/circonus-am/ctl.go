@@ -0,0 +1,580 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/admin"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+)
+
+const ctlTimeout = 5 * time.Minute
+
+var ctlJSON bool
+
+// initCtlCmd returns the ctl command, subcommands talk to the running manager via the local admin api.
+func initCtlCmd() *cobra.Command {
+	ctl := &cobra.Command{
+		Use:   "ctl",
+		Short: "Inspect and control the running manager",
+		Long:  `Inspect and control the running manager via the local admin API (see --admin-socket)`,
+	}
+
+	ctl.PersistentFlags().BoolVar(&ctlJSON, "json", false, "Output JSON")
+
+	ctl.AddCommand(
+		&cobra.Command{
+			Use:   "status",
+			Short: "Last status reported for each agent",
+			Args:  cobra.NoArgs,
+			Run:   ctlRun(ctlStatus),
+		},
+		&cobra.Command{
+			Use:   "agents",
+			Short: "Installed agents",
+			Args:  cobra.NoArgs,
+			Run:   ctlRun(ctlAgents),
+		},
+		&cobra.Command{
+			Use:   "configs",
+			Short: "Tracked agent config files and checksums",
+			Args:  cobra.NoArgs,
+			Run:   ctlRun(ctlConfigs),
+		},
+		&cobra.Command{
+			Use:   "diff <agent>",
+			Short: "Differences between the applied and current agent config files",
+			Args:  cobra.ExactArgs(1),
+			Run:   ctlRun(ctlDiff),
+		},
+		&cobra.Command{
+			Use:   "poll-now",
+			Short: "Poll for actions now",
+			Args:  cobra.NoArgs,
+			Run:   ctlRun(ctlPollNow),
+		},
+		&cobra.Command{
+			Use:   "restart <agent>",
+			Short: "Restart an agent",
+			Args:  cobra.ExactArgs(1),
+			Run:   ctlRun(ctlRestart),
+		},
+		&cobra.Command{
+			Use:   "refresh-inventory",
+			Short: "Fetch the agent inventory and check for installed agents",
+			Args:  cobra.NoArgs,
+			Run:   ctlRun(ctlRefreshInventory),
+		},
+		&cobra.Command{
+			Use:   "deferred",
+			Short: "Actions deferred (maintenance or outside a change window) and waiting to be applied",
+			Args:  cobra.NoArgs,
+			Run:   ctlRun(ctlDeferred),
+		},
+		ctlLogsCmd(),
+		ctlMaintenanceCmd(),
+	)
+
+	return ctl
+}
+
+// ctlRun reports errors for humans rather than as a fatal log message.
+func ctlRun(fn func(*cobra.Command, []string) error) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		if err := fn(cmd, args); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func ctlClient() (*admin.Client, error) {
+	token, err := admin.ReadToken(admin.TokenFile())
+	if err != nil {
+		return nil, err
+	}
+
+	return admin.NewClient(admin.SocketPath(), token), nil
+}
+
+func ctlContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, tcancel := context.WithTimeout(ctx, ctlTimeout)
+
+	return ctx, func() {
+		tcancel()
+		cancel()
+	}
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(v)
+}
+
+func newTable(header ...string) *tabwriter.Writer {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	return tw
+}
+
+func shortSum(s string) string {
+	if len(s) > 12 {
+		return s[:12]
+	}
+
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+func ctlStatus(_ *cobra.Command, _ []string) error {
+	c, err := ctlClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := ctlContext()
+	defer cancel()
+
+	statuses, err := c.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	if ctlJSON {
+		return printJSON(statuses)
+	}
+
+	tw := newTable("AGENT", "ID", "STATUS", "SUBSTATUS", "HEALTHY", "REPORTED")
+
+	for _, s := range statuses {
+		healthy := "-"
+		if h := s.Status.StatusData.Health; h != nil {
+			healthy = fmt.Sprintf("%t", h.Healthy)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.AgentType, s.AgentID, s.Status.Status, s.Status.StatusData.SubStatus, healthy,
+			s.Reported.Local().Format(time.RFC3339))
+	}
+
+	return tw.Flush()
+}
+
+func ctlAgents(_ *cobra.Command, _ []string) error {
+	c, err := ctlClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := ctlContext()
+	defer cancel()
+
+	installed, err := c.Agents(ctx)
+	if err != nil {
+		return err
+	}
+
+	if ctlJSON {
+		return printJSON(installed)
+	}
+
+	tw := newTable("AGENT", "ID")
+
+	for _, a := range installed {
+		fmt.Fprintf(tw, "%s\t%s\n", a.AgentTypeID, a.AgentID)
+	}
+
+	return tw.Flush()
+}
+
+func ctlConfigs(_ *cobra.Command, _ []string) error {
+	c, err := ctlClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := ctlContext()
+	defer cancel()
+
+	configs, err := c.Configs(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	if ctlJSON {
+		return printJSON(configs)
+	}
+
+	tw := newTable("AGENT", "PATH", "APPLIED SUM", "CURRENT SUM", "STATE")
+
+	for _, ci := range configs {
+		state := "current"
+
+		switch {
+		case ci.Error != "":
+			state = "error: " + ci.Error
+		case ci.Checksum == "":
+			state = "untracked"
+		case ci.Modified:
+			state = "modified"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", ci.Agent, ci.Path, shortSum(ci.Checksum), shortSum(ci.CurrentChecksum), state)
+	}
+
+	return tw.Flush()
+}
+
+func ctlDiff(_ *cobra.Command, args []string) error {
+	c, err := ctlClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := ctlContext()
+	defer cancel()
+
+	configs, err := c.Configs(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	if ctlJSON {
+		return printJSON(configs)
+	}
+
+	if len(configs) == 0 {
+		return fmt.Errorf("no configs found for %s", args[0])
+	}
+
+	for _, ci := range configs {
+		if !ci.Modified {
+			fmt.Printf("%s: no changes\n", ci.Path)
+
+			continue
+		}
+
+		if ci.Current == "" && ci.Error != "" {
+			fmt.Printf("%s: %s\n", ci.Path, ci.Error)
+
+			continue
+		}
+
+		// the current config has secret values replaced with the applied references
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(ci.Tracked),
+			B:        difflib.SplitLines(ci.Current),
+			FromFile: ci.Path + " (applied " + shortSum(ci.Checksum) + ")",
+			ToFile:   ci.Path + " (current " + shortSum(ci.CurrentChecksum) + ")",
+			Context:  3,
+		})
+		if err != nil {
+			return fmt.Errorf("diff %s: %w", ci.Path, err)
+		}
+
+		if diff == "" {
+			// only the resolved secrets differ
+			fmt.Printf("%s: no changes\n", ci.Path)
+
+			continue
+		}
+
+		fmt.Print(diff)
+	}
+
+	return nil
+}
+
+func ctlPollNow(_ *cobra.Command, _ []string) error {
+	c, err := ctlClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := ctlContext()
+	defer cancel()
+
+	if err := c.PollNow(ctx); err != nil {
+		return err
+	}
+
+	return ctlDone("poll complete")
+}
+
+func ctlRestart(_ *cobra.Command, args []string) error {
+	c, err := ctlClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := ctlContext()
+	defer cancel()
+
+	result, err := c.Command(ctx, args[0], "restart")
+	if err != nil {
+		return err
+	}
+
+	if ctlJSON {
+		return printJSON(result)
+	}
+
+	if result.Output != "" {
+		fmt.Println(strings.TrimSpace(result.Output))
+	}
+
+	if result.Error != "" {
+		return fmt.Errorf("restart %s (exit code %d): %s", args[0], result.ExitCode, result.Error)
+	}
+
+	fmt.Printf("%s restarted\n", args[0])
+
+	return nil
+}
+
+func ctlRefreshInventory(_ *cobra.Command, _ []string) error {
+	c, err := ctlClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := ctlContext()
+	defer cancel()
+
+	if err := c.RefreshInventory(ctx); err != nil {
+		return err
+	}
+
+	return ctlDone("inventory refreshed")
+}
+
+func ctlDone(msg string) error {
+	if ctlJSON {
+		return printJSON(map[string]string{"result": msg})
+	}
+
+	fmt.Println(msg)
+
+	return nil
+}
+
+func ctlMaintenanceCmd() *cobra.Command {
+	var until, reason string
+
+	cmd := &cobra.Command{
+		Use:   "maintenance",
+		Short: "Host maintenance state and deferred actions",
+		Long: `Host maintenance state and deferred actions. While the host is in maintenance
+config installs and agent start/stop/restart/reload commands are deferred, and
+config drift is not reported. Deferred actions are applied, in order, when it ends.`,
+		Args: cobra.NoArgs,
+		Run: ctlRun(func(_ *cobra.Command, _ []string) error {
+			return ctlMaintenance(func(ctx context.Context, c *admin.Client) (*admin.MaintenanceInfo, error) {
+				return c.Maintenance(ctx)
+			})
+		}),
+	}
+
+	on := &cobra.Command{
+		Use:   "on",
+		Short: "Put the host in maintenance",
+		Args:  cobra.NoArgs,
+		Run: ctlRun(func(_ *cobra.Command, _ []string) error {
+			return ctlMaintenance(func(ctx context.Context, c *admin.Client) (*admin.MaintenanceInfo, error) {
+				return c.MaintenanceOn(ctx, until, reason)
+			})
+		}),
+	}
+
+	on.Flags().StringVar(&until, "until", "", "End maintenance after a duration (e.g. 2h) or at an RFC3339 time")
+	on.Flags().StringVar(&reason, "reason", "", "Why the host is in maintenance")
+
+	off := &cobra.Command{
+		Use:   "off",
+		Short: "End maintenance, deferred actions are applied",
+		Args:  cobra.NoArgs,
+		Run: ctlRun(func(_ *cobra.Command, _ []string) error {
+			return ctlMaintenance(func(ctx context.Context, c *admin.Client) (*admin.MaintenanceInfo, error) {
+				return c.MaintenanceOff(ctx)
+			})
+		}),
+	}
+
+	cmd.AddCommand(on, off)
+
+	return cmd
+}
+
+func ctlMaintenance(fn func(context.Context, *admin.Client) (*admin.MaintenanceInfo, error)) error {
+	c, err := ctlClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := ctlContext()
+	defer cancel()
+
+	info, err := fn(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	if ctlJSON {
+		return printJSON(info)
+	}
+
+	if !info.Active {
+		fmt.Println("maintenance: off")
+	} else {
+		fmt.Printf("maintenance: on (%s) since %s\n", info.Source, info.Since.Local().Format(time.RFC3339))
+
+		if !info.Until.IsZero() {
+			fmt.Printf("until: %s\n", info.Until.Local().Format(time.RFC3339))
+		}
+
+		if info.Reason != "" {
+			fmt.Printf("reason: %s\n", info.Reason)
+		}
+	}
+
+	return printDeferred(info.Deferred)
+}
+
+func ctlDeferred(_ *cobra.Command, _ []string) error {
+	c, err := ctlClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := ctlContext()
+	defer cancel()
+
+	state, err := c.Deferred(ctx)
+	if err != nil {
+		return err
+	}
+
+	if ctlJSON {
+		return printJSON(state)
+	}
+
+	if state.Maintenance.Active {
+		fmt.Println("maintenance: on (see ctl maintenance)")
+	} else {
+		fmt.Println("maintenance: off")
+	}
+
+	switch {
+	case !state.ChangeWindow.Configured:
+		fmt.Println("change window: none configured (always open)")
+	case state.ChangeWindow.Open:
+		fmt.Println("change window: open")
+	case state.ChangeWindow.Next.IsZero():
+		fmt.Println("change window: closed")
+	default:
+		fmt.Printf("change window: closed, next opens %s\n", state.ChangeWindow.Next.Local().Format(time.RFC3339))
+	}
+
+	return printDeferred(state.Deferred)
+}
+
+func printDeferred(deferred []admin.DeferredInfo) error {
+	if len(deferred) == 0 {
+		fmt.Println("deferred actions: none")
+
+		return nil
+	}
+
+	fmt.Println()
+
+	tw := newTable("RECEIVED", "REASON", "ACTION", "TYPE", "ITEMS")
+
+	for _, d := range deferred {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			d.Received.Local().Format(time.RFC3339), d.Reason, d.ActionID, d.Type, strings.Join(d.Items, ", "))
+	}
+
+	return tw.Flush()
+}
+
+func ctlLogsCmd() *cobra.Command {
+	var (
+		follow bool
+		lines  int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "logs",
+		Short: "Recent manager log messages",
+		Args:  cobra.NoArgs,
+		Run: ctlRun(func(_ *cobra.Command, _ []string) error {
+			c, err := ctlClient()
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			if ctlJSON {
+				return c.Logs(ctx, lines, follow, os.Stdout)
+			}
+
+			return c.Logs(ctx, lines, follow, newLogFormatter(os.Stdout))
+		}),
+	}
+
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Follow new log messages")
+	cmd.Flags().IntVarP(&lines, "lines", "n", 100, "Number of recent log messages")
+
+	return cmd
+}
+
+// logFormatter formats json log lines for humans, buffering partial lines.
+type logFormatter struct {
+	out zerolog.ConsoleWriter
+	buf []byte
+}
+
+func newLogFormatter(w io.Writer) *logFormatter {
+	return &logFormatter{out: zerolog.ConsoleWriter{Out: w, TimeFormat: time.RFC3339}}
+}
+
+func (f *logFormatter) Write(p []byte) (int, error) {
+	f.buf = append(f.buf, p...)
+
+	for {
+		i := bytes.IndexByte(f.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := f.buf[:i+1]
+
+		if _, err := f.out.Write(line); err != nil {
+			// not a log event, pass it through as is
+			_, _ = f.out.Out.Write(line)
+		}
+
+		f.buf = f.buf[i+1:]
+	}
+
+	return len(p), nil
+}
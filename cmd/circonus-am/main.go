@@ -4,12 +4,13 @@
 package main
 
 import (
-	"fmt"
+	"io"
 	stdlog "log"
 	"os"
 	"path/filepath"
 	"runtime"
 
+	"github.com/circonus/agent-manager/internal/admin"
 	"github.com/circonus/agent-manager/internal/config"
 	"github.com/circonus/agent-manager/internal/config/defaults"
 	"github.com/circonus/agent-manager/internal/config/keys"
@@ -25,7 +26,8 @@ var cfgFile string
 func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-	zlog := zerolog.New(zerolog.SyncWriter(os.Stderr)).With().Timestamp().Logger()
+	// recent log messages are also kept for the admin api (circonus-am ctl logs)
+	zlog := zerolog.New(zerolog.SyncWriter(io.MultiWriter(os.Stderr, admin.Logs))).With().Timestamp().Logger()
 	log.Logger = zlog
 
 	stdlog.SetFlags(0)
@@ -62,6 +64,9 @@ func initConfig() {
 
 	viper.AutomaticEnv()
 
+	// a reloaded config file is applied over the same defaults, flags and env vars
+	config.SetBaseline()
+
 	if err := viper.ReadInConfig(); err != nil {
 		f := viper.ConfigFileUsed()
 		if f != "" {
@@ -73,6 +78,8 @@ func initConfig() {
 		// if a config file was used, ensure the etc path(s) are set accordingly.
 		config.SetPathsBasedOnConfigFile(filepath.Dir(viper.ConfigFileUsed()))
 	}
+
+	config.SetRunning(viper.GetViper())
 }
 
 // initApp initializes the application components.
@@ -87,47 +94,11 @@ func initLogging() error {
 	//
 	if viper.GetBool(keys.LogPretty) {
 		if runtime.GOOS != "windows" {
-			log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout})
+			log.Logger = log.Output(zerolog.SyncWriter(io.MultiWriter(zerolog.ConsoleWriter{Out: os.Stdout}, admin.Logs)))
 		} else {
 			log.Warn().Msg("log-pretty not applicable on this platform")
 		}
 	}
 
-	//
-	// Enable debug logging if requested
-	//
-	if viper.GetBool(keys.Debug) {
-		viper.Set(keys.LogLevel, "debug")
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
-
-		return nil
-	}
-
-	//
-	// otherwise, set custom level if specified
-	//
-	if viper.IsSet(keys.LogLevel) {
-		level := viper.GetString(keys.LogLevel)
-
-		switch level {
-		case "panic":
-			zerolog.SetGlobalLevel(zerolog.PanicLevel)
-		case "fatal":
-			zerolog.SetGlobalLevel(zerolog.FatalLevel)
-		case "error":
-			zerolog.SetGlobalLevel(zerolog.ErrorLevel)
-		case "warn":
-			zerolog.SetGlobalLevel(zerolog.WarnLevel)
-		case "info":
-			zerolog.SetGlobalLevel(zerolog.InfoLevel)
-		case "debug":
-			zerolog.SetGlobalLevel(zerolog.DebugLevel)
-		case "disabled":
-			zerolog.SetGlobalLevel(zerolog.Disabled)
-		default:
-			return fmt.Errorf("unknown log level (%s)", level)
-		}
-	}
-
-	return nil
+	return config.SetLogLevel(viper.GetViper())
 }
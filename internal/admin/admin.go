@@ -0,0 +1,184 @@
+// Package admin provides the local, authenticated, admin API for the running manager.
+// It is served on a unix socket by default, requests must include the token from the
+// admin token file (readable only by the manager's user) as a bearer token.
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/agents"
+	"github.com/circonus/agent-manager/internal/audit"
+	"github.com/circonus/agent-manager/internal/config/defaults"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const (
+	tokenLen       = 32
+	handlerTimeout = 5 * time.Minute // commands and polls may take a while
+)
+
+type Server struct {
+	srv          *http.Server
+	actionPoller *agents.ActionPoller
+	statusPoller *agents.StatusPoller
+	token        string
+	socket       string
+}
+
+// SocketPath returns the admin API unix socket path.
+func SocketPath() string {
+	if s := viper.GetString(keys.AdminSocket); s != "" {
+		return s
+	}
+
+	return defaults.AdminSocket
+}
+
+// TokenFile returns the admin API token file path.
+func TokenFile() string {
+	if f := viper.GetString(keys.AdminTokenFile); f != "" {
+		return f
+	}
+
+	return defaults.AdminTokenFile
+}
+
+// ReadToken returns the admin API token.
+func ReadToken(file string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("reading admin token: %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("invalid admin token (empty)")
+	}
+
+	return token, nil
+}
+
+// loadToken reads the admin token, creating one if it does not exist.
+func loadToken(file string) (string, error) {
+	token, err := ReadToken(file)
+	if err == nil {
+		return token, nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	buf := make([]byte, tokenLen)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generating admin token: %w", err)
+	}
+
+	token = hex.EncodeToString(buf)
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return "", fmt.Errorf("creating admin token dir: %w", err)
+	}
+
+	if err := os.WriteFile(file, []byte(token), 0o600); err != nil {
+		return "", fmt.Errorf("writing admin token: %w", err)
+	}
+
+	return token, nil
+}
+
+func New(actionPoller *agents.ActionPoller, statusPoller *agents.StatusPoller) (*Server, error) {
+	token, err := loadToken(TokenFile())
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		actionPoller: actionPoller,
+		statusPoller: statusPoller,
+		token:        token,
+		socket:       SocketPath(),
+	}
+
+	s.srv = &http.Server{
+		Handler:           s.auth(s.routes()),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	return s, nil
+}
+
+func (s *Server) Start(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// remove a stale socket from a previous run
+	if err := os.Remove(s.socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing admin socket: %w", err)
+	}
+
+	l, err := net.Listen("unix", s.socket)
+	if err != nil {
+		return fmt.Errorf("admin listener: %w", err)
+	}
+
+	if err := os.Chmod(s.socket, 0o600); err != nil {
+		l.Close()
+
+		return fmt.Errorf("admin socket permissions: %w", err)
+	}
+
+	log.Info().Str("socket", s.socket).Msg("starting admin api")
+
+	if err := s.srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error().Err(err).Msg("admin api serve")
+	}
+
+	return nil
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	log.Info().Msg("shutting down admin api")
+
+	toctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if err := s.srv.Shutdown(toctx); err != nil {
+		log.Error().Err(err).Msg("admin api shutdown")
+	}
+
+	_ = os.Remove(s.socket)
+
+	return nil
+}
+
+// auth verifies the bearer token on every request.
+func (s *Server) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+
+			return
+		}
+
+		log.Debug().Str("method", r.Method).Str("url", r.URL.String()).Msg("admin request")
+
+		next.ServeHTTP(w, r.WithContext(audit.WithSource(r.Context(), audit.SourceAdmin)))
+	})
+}
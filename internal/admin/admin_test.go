@@ -0,0 +1,193 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/circonus/agent-manager/internal/config/defaults"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/registration"
+	"github.com/circonus/agent-manager/internal/secrets"
+	"github.com/circonus/agent-manager/internal/tracker"
+	"github.com/spf13/viper"
+)
+
+func TestLoadToken(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ".id", "adm")
+
+	token, err := loadToken(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(token) != tokenLen*2 {
+		t.Fatalf("unexpected token length %d", len(token))
+	}
+
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fi.Mode().Perm() != 0o600 {
+		t.Fatalf("unexpected token file mode %v", fi.Mode().Perm())
+	}
+
+	again, err := loadToken(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again != token {
+		t.Fatal("expected existing token to be reused")
+	}
+}
+
+func TestServer(t *testing.T) {
+	origEtc := defaults.EtcPath
+	defaults.EtcPath = t.TempDir()
+
+	defer func() { defaults.EtcPath = origEtc }()
+
+	if err := registration.SaveInstalledAgents(registration.Agents{{AgentID: "abc", AgentTypeID: "telegraf"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{token: "test"}
+	ts := httptest.NewServer(s.auth(s.routes()))
+
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"no token", http.MethodGet, "/v1/agents", "", http.StatusUnauthorized},
+		{"invalid token", http.MethodGet, "/v1/agents", "foo", http.StatusUnauthorized},
+		{"agents", http.MethodGet, "/v1/agents", "test", http.StatusOK},
+		{"agents (method)", http.MethodPost, "/v1/agents", "test", http.StatusMethodNotAllowed},
+		{"status", http.MethodGet, "/v1/status", "test", http.StatusOK},
+		{"poll (no poller)", http.MethodPost, "/v1/poll", "test", http.StatusServiceUnavailable},
+		{"command (invalid path)", http.MethodPost, "/v1/agents/telegraf", "test", http.StatusNotFound},
+		{"deferred", http.MethodGet, "/v1/deferred", "test", http.StatusOK},
+		{"maintenance", http.MethodGet, "/v1/maintenance", "test", http.StatusOK},
+		{"maintenance (invalid until)", http.MethodPost, "/v1/maintenance?until=tomorrow", "test", http.StatusBadRequest},
+		{"maintenance (method)", http.MethodPut, "/v1/maintenance", "test", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status code = %d, want %d", resp.StatusCode, tt.want)
+			}
+
+			if tt.path == "/v1/agents" && resp.StatusCode == http.StatusOK {
+				var installed registration.Agents
+				if err := json.NewDecoder(resp.Body).Decode(&installed); err != nil {
+					t.Fatal(err)
+				}
+
+				if len(installed) != 1 || installed[0].AgentTypeID != "telegraf" {
+					t.Fatalf("unexpected agents %+v", installed)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigInfoRedacted(t *testing.T) {
+	origEtc := defaults.EtcPath
+	defaults.EtcPath = t.TempDir()
+
+	defer func() { defaults.EtcPath = origEtc }()
+
+	if err := registration.SaveInstalledAgents(registration.Agents{{AgentID: "abc", AgentTypeID: "telegraf"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	viper.Set(keys.SecretsCacheTTL, "1m")
+	defer viper.Set(keys.SecretsCacheTTL, "")
+
+	viper.Set(keys.SecretsEnvAllow, []string{"CAM_TEST_*"})
+	defer viper.Set(keys.SecretsEnvAllow, nil)
+
+	secrets.Reset()
+	defer secrets.Reset()
+
+	t.Setenv("CAM_TEST_PASSWORD", "hunter2")
+
+	file := filepath.Join(defaults.EtcPath, "telegraf.conf")
+
+	tests := []struct {
+		name        string
+		tracked     string
+		current     string
+		wantCurrent string
+		wantErr     bool
+	}{
+		{
+			name:        "secret resolved",
+			tracked:     "password = \"${secret:env:CAM_TEST_PASSWORD}\"\n",
+			current:     "password = \"hunter2\"\n",
+			wantCurrent: "password = \"${secret:env:CAM_TEST_PASSWORD}\"\n",
+		},
+		{
+			name:    "secret unresolvable",
+			tracked: "password = \"${secret:env:CAM_TEST_MISSING}\"\n",
+			current: "password = \"hunter2\"\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(file, []byte(tt.current), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tracker.UpdateConfig("telegraf", "cfg1", file, []byte(tt.tracked)); err != nil {
+				t.Fatal(err)
+			}
+
+			ci := configInfo(context.Background(), "telegraf", "cfg1", file, true)
+
+			if ci.Tracked != tt.tracked {
+				t.Fatalf("tracked = %q, want %q", ci.Tracked, tt.tracked)
+			}
+
+			if ci.Current != tt.wantCurrent {
+				t.Fatalf("current = %q, want %q", ci.Current, tt.wantCurrent)
+			}
+
+			if (ci.Error != "") != tt.wantErr {
+				t.Fatalf("error = %q, wantErr %v", ci.Error, tt.wantErr)
+			}
+		})
+	}
+}
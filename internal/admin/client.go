@@ -0,0 +1,200 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/circonus/agent-manager/internal/agents"
+	"github.com/circonus/agent-manager/internal/inventory"
+	"github.com/circonus/agent-manager/internal/registration"
+)
+
+// Client talks to the admin API of the running manager.
+type Client struct {
+	http  *http.Client
+	token string
+}
+
+// NewClient returns a client for the admin API on the unix socket.
+func NewClient(socket, token string) *Client {
+	return &Client{
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+		token: token,
+	}
+}
+
+func (c *Client) Agents(ctx context.Context) (registration.Agents, error) {
+	var installed registration.Agents
+
+	return installed, c.call(ctx, http.MethodGet, "/v1/agents", &installed)
+}
+
+func (c *Client) Inventory(ctx context.Context) (map[string]inventory.Agent, error) {
+	var inv map[string]inventory.Agent
+
+	return inv, c.call(ctx, http.MethodGet, "/v1/inventory", &inv)
+}
+
+func (c *Client) Configs(ctx context.Context, agent string) ([]ConfigInfo, error) {
+	path := "/v1/configs"
+	if agent != "" {
+		path += "?agent=" + url.QueryEscape(agent)
+	}
+
+	var configs []ConfigInfo
+
+	return configs, c.call(ctx, http.MethodGet, path, &configs)
+}
+
+func (c *Client) Status(ctx context.Context) ([]agents.AgentStatus, error) {
+	var statuses []agents.AgentStatus
+
+	return statuses, c.call(ctx, http.MethodGet, "/v1/status", &statuses)
+}
+
+func (c *Client) Command(ctx context.Context, agent, command string) (*CommandResult, error) {
+	var result CommandResult
+
+	path := "/v1/agents/" + url.PathEscape(agent) + "/" + url.PathEscape(command)
+
+	return &result, c.call(ctx, http.MethodPost, path, &result)
+}
+
+func (c *Client) PollNow(ctx context.Context) error {
+	return c.call(ctx, http.MethodPost, "/v1/poll", nil)
+}
+
+func (c *Client) Deferred(ctx context.Context) (*DeferredState, error) {
+	var state DeferredState
+
+	return &state, c.call(ctx, http.MethodGet, "/v1/deferred", &state)
+}
+
+func (c *Client) Maintenance(ctx context.Context) (*MaintenanceInfo, error) {
+	var info MaintenanceInfo
+
+	return &info, c.call(ctx, http.MethodGet, "/v1/maintenance", &info)
+}
+
+// MaintenanceOn turns maintenance on, until (a duration or RFC3339 time) and reason are optional.
+func (c *Client) MaintenanceOn(ctx context.Context, until, reason string) (*MaintenanceInfo, error) {
+	q := url.Values{}
+	if until != "" {
+		q.Set("until", until)
+	}
+
+	if reason != "" {
+		q.Set("reason", reason)
+	}
+
+	path := "/v1/maintenance"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+
+	var info MaintenanceInfo
+
+	return &info, c.call(ctx, http.MethodPost, path, &info)
+}
+
+func (c *Client) MaintenanceOff(ctx context.Context) (*MaintenanceInfo, error) {
+	var info MaintenanceInfo
+
+	return &info, c.call(ctx, http.MethodDelete, "/v1/maintenance", &info)
+}
+
+func (c *Client) RefreshInventory(ctx context.Context) error {
+	return c.call(ctx, http.MethodPost, "/v1/inventory/refresh", nil)
+}
+
+// Logs copies the recent log lines to w, following new lines until ctx is done if follow is set.
+func (c *Client) Logs(ctx context.Context, lines int, follow bool, w io.Writer) error {
+	q := url.Values{}
+	q.Set("lines", strconv.Itoa(lines))
+	q.Set("follow", strconv.FormatBool(follow))
+
+	resp, err := c.do(ctx, http.MethodGet, "/v1/logs?"+q.Encode())
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("reading logs: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string) (*http.Response, error) {
+	// NOTE: the host is ignored, requests go to the unix socket.
+	req, err := http.NewRequestWithContext(ctx, method, "http://admin"+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling admin api (is the manager running?): %w", err)
+	}
+
+	return resp, nil
+}
+
+func (c *Client) call(ctx context.Context, method, path string, result any) error {
+	resp, err := c.do(ctx, method, path)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("parsing response: %w", err)
+	}
+
+	return nil
+}
+
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+
+	var apiErr struct {
+		Error string `json:"error"`
+	}
+
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+		return fmt.Errorf("admin api: %s", apiErr.Error)
+	}
+
+	return fmt.Errorf("non-200 response -- status: %s, body: %s", resp.Status, string(body))
+}
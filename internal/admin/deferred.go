@@ -0,0 +1,79 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/agents"
+	"github.com/circonus/agent-manager/internal/maintenance"
+	"github.com/circonus/agent-manager/internal/window"
+)
+
+// DeferredState is why changes are deferred and the actions waiting to be applied.
+type DeferredState struct {
+	Deferred     []DeferredInfo     `json:"deferred"`
+	ChangeWindow window.State       `json:"change_window"`
+	Maintenance  maintenance.Status `json:"maintenance"`
+}
+
+// DeferredInfo summarizes a deferred action (config contents are not included).
+type DeferredInfo struct {
+	Received time.Time `json:"received"`
+	Reason   string    `json:"reason"`
+	ActionID string    `json:"action_id,omitempty"`
+	Type     string    `json:"type"`
+	Items    []string  `json:"items"` // "<agent> <path>" for configs, "<agent> <command>" for commands
+}
+
+// GET /v1/deferred -- deferred actions, maintenance and change window state.
+func (s *Server) handleDeferred(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	deferred, err := deferredInfo()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	writeJSON(w, DeferredState{
+		Deferred:     deferred,
+		ChangeWindow: window.Current(time.Now()),
+		Maintenance:  maintenance.Get(),
+	})
+}
+
+func deferredInfo() ([]DeferredInfo, error) {
+	infos := []DeferredInfo{}
+
+	items, err := agents.DeferredActions()
+	if err != nil {
+		return infos, err
+	}
+
+	for _, item := range items {
+		di := DeferredInfo{
+			Received: item.Received,
+			Reason:   item.Reason,
+			ActionID: item.Action.ID,
+			Type:     item.Action.Type,
+			Items:    []string{},
+		}
+
+		for agent, configs := range item.Action.Configs {
+			for _, c := range configs {
+				di.Items = append(di.Items, agent+" "+c.Path)
+			}
+		}
+
+		for _, c := range item.Action.Commands {
+			di.Items = append(di.Items, c.Agent+" "+c.Command)
+		}
+
+		infos = append(infos, di)
+	}
+
+	return infos, nil
+}
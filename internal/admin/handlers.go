@@ -0,0 +1,322 @@
+package admin
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/circonus/agent-manager/internal/agents"
+	"github.com/circonus/agent-manager/internal/env"
+	"github.com/circonus/agent-manager/internal/inventory"
+	"github.com/circonus/agent-manager/internal/registration"
+	"github.com/circonus/agent-manager/internal/secrets"
+	"github.com/circonus/agent-manager/internal/tracker"
+	"github.com/rs/zerolog/log"
+)
+
+// ConfigInfo is the tracked state of an agent config file.
+type ConfigInfo struct {
+	Agent           string `json:"agent"`
+	ID              string `json:"id"`
+	Path            string `json:"path"`
+	AssignmentID    string `json:"assignment_id,omitempty"`
+	Checksum        string `json:"checksum,omitempty"`         // when applied
+	CurrentChecksum string `json:"current_checksum,omitempty"` // file on disk now
+	Error           string `json:"error,omitempty"`
+	Tracked         string `json:"tracked,omitempty"` // config as applied (secret refs unresolved)
+	Current         string `json:"current,omitempty"` // file on disk now, secret values replaced with the tracked refs
+	Modified        bool   `json:"modified"`
+	Applied         bool   `json:"applied"`
+}
+
+// CommandResult is the result of running an agent command.
+type CommandResult struct {
+	Agent    string `json:"agent"`
+	Command  string `json:"command"`
+	Output   string `json:"output"`
+	Error    string `json:"error,omitempty"`
+	ExitCode int    `json:"exit_code"`
+}
+
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, http.TimeoutHandler(h, handlerTimeout, "admin handler timeout"))
+	}
+
+	handle("/v1/agents", s.handleAgents)
+	handle("/v1/agents/", s.handleAgentCommand)
+	handle("/v1/inventory", s.handleInventory)
+	handle("/v1/inventory/refresh", s.handleInventoryRefresh)
+	handle("/v1/configs", s.handleConfigs)
+	handle("/v1/status", s.handleStatus)
+	handle("/v1/poll", s.handlePoll)
+	handle("/v1/maintenance", s.handleMaintenance)
+	handle("/v1/deferred", s.handleDeferred)
+
+	// streams, no timeout
+	mux.HandleFunc("/v1/logs", s.handleLogs)
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warn().Err(err).Msg("admin api encoding response")
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		writeError(w, http.StatusMethodNotAllowed, errors.New(http.StatusText(http.StatusMethodNotAllowed)))
+
+		return false
+	}
+
+	return true
+}
+
+// GET /v1/agents -- installed agents.
+func (s *Server) handleAgents(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	installed, err := registration.LoadInstalledAgents()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		writeError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	if installed == nil {
+		installed = registration.Agents{}
+	}
+
+	writeJSON(w, installed)
+}
+
+// POST /v1/agents/<agent>/<start|stop|restart|reload|status|version> -- run agent command.
+func (s *Server) handleAgentCommand(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/agents/"), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("expected /v1/agents/<agent>/<command>"))
+
+		return
+	}
+
+	agent, command := parts[0], parts[1]
+
+	log.Info().Str("agent", agent).Str("command", command).Msg("admin api agent command")
+
+	output, code, err := agents.RunAgentCommand(r.Context(), agent, command)
+
+	result := CommandResult{
+		Agent:    agent,
+		Command:  command,
+		Output:   string(output),
+		ExitCode: code,
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	writeJSON(w, result)
+}
+
+// GET /v1/inventory -- agent definitions for this platform.
+func (s *Server) handleInventory(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	inv, err := inventory.LoadAgents()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	platformAgents, ok := inv[env.GetPlatform()]
+	if !ok {
+		platformAgents = map[string]inventory.Agent{}
+	}
+
+	writeJSON(w, platformAgents)
+}
+
+// POST /v1/inventory/refresh -- fetch the inventory and check for installed agents.
+func (s *Server) handleInventoryRefresh(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	log.Info().Msg("admin api inventory refresh")
+
+	if err := inventory.FetchAgents(r.Context()); err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("refreshing agent list: %w", err))
+
+		return
+	}
+
+	if err := inventory.CheckForAgents(r.Context()); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("checking for installed agents: %w", err))
+
+		return
+	}
+
+	writeJSON(w, map[string]string{"result": "OK"})
+}
+
+// GET /v1/configs[?agent=<agent>] -- tracked config files and checksums, with
+// contents when limited to a single agent.
+func (s *Server) handleConfigs(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	only := r.URL.Query().Get("agent")
+
+	installed, err := registration.LoadInstalledAgents()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		writeError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	configs := []ConfigInfo{}
+
+	for _, a := range installed {
+		if only != "" && a.AgentTypeID != only {
+			continue
+		}
+
+		agent, err := inventory.GetAgent(a.AgentTypeID)
+		if err != nil {
+			continue
+		}
+
+		for cfgID, path := range agent.ConfigFiles {
+			configs = append(configs, configInfo(r.Context(), a.AgentTypeID, cfgID, path, only != ""))
+		}
+	}
+
+	sort.Slice(configs, func(i, j int) bool {
+		if configs[i].Agent == configs[j].Agent {
+			return configs[i].Path < configs[j].Path
+		}
+
+		return configs[i].Agent < configs[j].Agent
+	})
+
+	writeJSON(w, configs)
+}
+
+func configInfo(ctx context.Context, agent, cfgID, path string, contents bool) ConfigInfo {
+	ci := ConfigInfo{Agent: agent, ID: cfgID, Path: path}
+
+	if sum, err := tracker.Checksum(path); err == nil {
+		ci.CurrentChecksum = sum
+	} else {
+		ci.Error = err.Error()
+	}
+
+	t, err := tracker.Load(agent, path)
+	if err != nil {
+		ci.Error = err.Error()
+
+		return ci
+	}
+
+	ci.AssignmentID = t.AssignmentID
+	ci.Checksum = t.S
+	ci.Modified = t.Modified || (t.S != "" && ci.CurrentChecksum != "" && t.S != ci.CurrentChecksum)
+	ci.Applied = t.Applied
+
+	if contents {
+		tracked, err := base64.StdEncoding.DecodeString(t.D)
+		if err != nil {
+			ci.Error = fmt.Sprintf("decoding tracked config: %s", err)
+
+			return ci
+		}
+
+		ci.Tracked = string(tracked)
+
+		current, err := os.ReadFile(path)
+		if err != nil {
+			return ci
+		}
+
+		// the file has the secrets resolved, never return their values
+		redacted, err := secrets.Redact(ctx, current, tracked)
+		if err != nil {
+			ci.Error = fmt.Sprintf("current config not shown, redacting secrets: %s", err)
+
+			return ci
+		}
+
+		ci.Current = string(redacted)
+	}
+
+	return ci
+}
+
+// GET /v1/status -- last status reported for each agent.
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	if s.statusPoller == nil {
+		writeJSON(w, []agents.AgentStatus{})
+
+		return
+	}
+
+	writeJSON(w, s.statusPoller.LastStatus())
+}
+
+// POST /v1/poll -- poll for actions now.
+func (s *Server) handlePoll(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	if s.actionPoller == nil {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("action poller not running"))
+
+		return
+	}
+
+	log.Info().Msg("admin api poll now")
+
+	if err := s.actionPoller.PollNow(r.Context()); err != nil {
+		writeError(w, http.StatusBadGateway, err)
+
+		return
+	}
+
+	writeJSON(w, map[string]string{"result": "OK"})
+}
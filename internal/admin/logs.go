@@ -0,0 +1,158 @@
+package admin
+
+import (
+	"bufio"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+const (
+	logBufferLines     = 1000
+	defaultLogLines    = 100
+	logSubscriberQueue = 256
+)
+
+// Logs keeps the most recent log lines for the admin API, add it to the
+// logger's output (e.g. io.MultiWriter) to capture them.
+var Logs = newLogBuffer(logBufferLines)
+
+type logBuffer struct {
+	subs  map[chan []byte]struct{}
+	lines [][]byte
+	next  int
+	full  bool
+	sync.Mutex
+}
+
+func newLogBuffer(size int) *logBuffer {
+	return &logBuffer{
+		lines: make([][]byte, size),
+		subs:  make(map[chan []byte]struct{}),
+	}
+}
+
+// Write stores the log line (zerolog writes one event per call) and sends it to
+// any followers, slow followers miss lines rather than blocking logging.
+func (b *logBuffer) Write(p []byte) (int, error) {
+	line := make([]byte, len(p))
+	copy(line, p)
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.lines[b.next] = line
+	b.next = (b.next + 1) % len(b.lines)
+
+	if b.next == 0 {
+		b.full = true
+	}
+
+	for c := range b.subs {
+		select {
+		case c <- line:
+		default:
+		}
+	}
+
+	return len(p), nil
+}
+
+// Tail returns up to the last n log lines.
+func (b *logBuffer) Tail(n int) [][]byte {
+	b.Lock()
+	defer b.Unlock()
+
+	count := b.next
+	if b.full {
+		count = len(b.lines)
+	}
+
+	if n <= 0 || n > count {
+		n = count
+	}
+
+	tail := make([][]byte, 0, n)
+
+	for i := n; i > 0; i-- {
+		idx := (b.next - i + len(b.lines)) % len(b.lines)
+		tail = append(tail, b.lines[idx])
+	}
+
+	return tail
+}
+
+func (b *logBuffer) subscribe() chan []byte {
+	c := make(chan []byte, logSubscriberQueue)
+
+	b.Lock()
+	b.subs[c] = struct{}{}
+	b.Unlock()
+
+	return c
+}
+
+func (b *logBuffer) unsubscribe(c chan []byte) {
+	b.Lock()
+	delete(b.subs, c)
+	b.Unlock()
+}
+
+// GET /v1/logs[?lines=<n>][&follow=true] -- recent log lines (json, one per line),
+// optionally streaming new lines until the client disconnects.
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	n := defaultLogLines
+
+	if v := r.URL.Query().Get("lines"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			n = i
+		}
+	}
+
+	follow, _ := strconv.ParseBool(r.URL.Query().Get("follow"))
+
+	var c chan []byte
+	if follow {
+		// subscribe before reading the tail so no lines are missed
+		c = Logs.subscribe()
+		defer Logs.unsubscribe(c)
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	bw := bufio.NewWriter(w)
+
+	for _, line := range Logs.Tail(n) {
+		_, _ = bw.Write(line)
+	}
+
+	_ = bw.Flush()
+
+	if !follow {
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case line := <-c:
+			if _, err := w.Write(line); err != nil {
+				return
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLogBufferTail(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes int
+		n      int
+		want   []string
+	}{
+		{"empty", 0, 10, []string{}},
+		{"partial", 2, 10, []string{"0", "1"}},
+		{"partial limit", 3, 2, []string{"1", "2"}},
+		{"all", 3, 0, []string{"0", "1", "2"}},
+		{"wrapped", 6, 10, []string{"2", "3", "4", "5"}},
+		{"wrapped limit", 6, 3, []string{"3", "4", "5"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			b := newLogBuffer(4)
+
+			for i := 0; i < tt.writes; i++ {
+				_, _ = fmt.Fprint(b, i)
+			}
+
+			tail := b.Tail(tt.n)
+			if len(tail) != len(tt.want) {
+				t.Fatalf("Tail() = %q, want %q", tail, tt.want)
+			}
+
+			for i := range tail {
+				if string(tail[i]) != tt.want[i] {
+					t.Fatalf("Tail() = %q, want %q", tail, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLogBufferSubscribe(t *testing.T) {
+	b := newLogBuffer(4)
+
+	c := b.subscribe()
+
+	_, _ = b.Write([]byte("line"))
+
+	if got := string(<-c); got != "line" {
+		t.Fatalf("subscriber got %q", got)
+	}
+
+	b.unsubscribe(c)
+
+	_, _ = b.Write([]byte("again"))
+
+	select {
+	case line := <-c:
+		t.Fatalf("unexpected line after unsubscribe %q", line)
+	default:
+	}
+}
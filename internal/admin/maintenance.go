@@ -0,0 +1,81 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/maintenance"
+	"github.com/rs/zerolog/log"
+)
+
+// MaintenanceInfo is the maintenance state and the actions deferred.
+type MaintenanceInfo struct {
+	Deferred []DeferredInfo `json:"deferred"`
+	maintenance.Status
+}
+
+// GET    /v1/maintenance -- maintenance state and deferred actions.
+// POST   /v1/maintenance[?until=<duration|RFC3339>&reason=<text>] -- turn maintenance on.
+// DELETE /v1/maintenance -- turn maintenance off, deferred actions are applied.
+func (s *Server) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		until, err := maintenance.ParseUntil(r.URL.Query().Get("until"), time.Now())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+
+			return
+		}
+
+		if _, err := maintenance.Enable(r.Context(), until, r.URL.Query().Get("reason")); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+
+			return
+		}
+	case http.MethodDelete:
+		if err := maintenance.Disable(r.Context()); err != nil {
+			code := http.StatusInternalServerError
+			if errors.Is(err, maintenance.ErrConfigured) {
+				code = http.StatusConflict
+			}
+
+			writeError(w, code, err)
+
+			return
+		}
+
+		if s.actionPoller != nil {
+			// apply the deferred actions now rather than on the next poll
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), handlerTimeout)
+				defer cancel()
+
+				if err := s.actionPoller.PollNow(ctx); err != nil {
+					log.Warn().Err(err).Msg("admin api poll after maintenance")
+				}
+			}()
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New(http.StatusText(http.StatusMethodNotAllowed)))
+
+		return
+	}
+
+	info, err := maintenanceInfo()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	writeJSON(w, info)
+}
+
+func maintenanceInfo() (MaintenanceInfo, error) {
+	deferred, err := deferredInfo()
+
+	return MaintenanceInfo{Status: maintenance.Get(), Deferred: deferred}, err
+}
@@ -3,83 +3,193 @@ package agents
 import (
 	"context"
 	"encoding/base64"
+	"fmt"
+	"strings"
 
-	"github.com/circonus/agent-manager/internal/env"
+	"github.com/circonus/agent-manager/internal/install"
 	"github.com/circonus/agent-manager/internal/inventory"
+	"github.com/circonus/agent-manager/internal/metrics"
+	"github.com/circonus/agent-manager/internal/tracing"
 	"github.com/rs/zerolog/log"
 )
 
 const (
-	START     = "start"
-	STOP      = "stop"
-	RESTART   = "restart"
-	STATUS    = "status"
-	RELOAD    = "reload"
-	INVENTORY = "inventory"
-	VERSION   = "version"
+	START      = "start"
+	STOP       = "stop"
+	RESTART    = "restart"
+	STATUS     = "status"
+	RELOAD     = "reload"
+	INVENTORY  = "inventory"
+	VERSION    = "version"
+	INSTALL    = install.Install
+	UPGRADE    = install.Upgrade
+	UNINSTALL  = install.Uninstall
+	SELFUPDATE = "self_update"
 )
 
 func runCommands(ctx context.Context, action Action) error {
-	agents, err := inventory.LoadAgents()
+	agents, err := inventory.PlatformAgents()
 	if err != nil {
 		return err
 	}
 
-	platform := env.GetPlatform()
+	failed := 0
+	packages := 0
 
 	for _, command := range action.Commands {
-		switch command.Command {
-		case INVENTORY:
+		if command.Command == INVENTORY {
 			if err := inventory.FetchAgents(ctx); err != nil {
 				log.Error().Err(err).Msg("refreshing agent list")
+
+				failed++
 			} else if err := inventory.CheckForAgents(ctx); err != nil {
 				log.Error().Err(err).Msg("checking for installed agents")
+
+				failed++
 			}
-		case START:
-			a, ok := agents[platform][command.Agent]
-			if ok {
-				runCommand(ctx, a.Start, command.ID)
+
+			continue
+		}
+
+		if command.Command == SELFUPDATE {
+			if err := runSelfUpdate(ctx, command); err != nil {
+				failed++
 			}
+
+			continue
+		}
+
+		a, ok := agents[command.Agent]
+		if !ok {
+			continue
+		}
+
+		// errors are logged and reported by runCommand/cmdReload
+		var err error
+
+		switch command.Command {
+		case START:
+			err = runCommand(ctx, a.Start, command)
 		case STOP:
-			a, ok := agents[platform][command.Agent]
-			if ok {
-				runCommand(ctx, a.Stop, command.ID)
-			}
+			err = runCommand(ctx, a.Stop, command)
 		case RESTART:
-			a, ok := agents[platform][command.Agent]
-			if ok {
-				runCommand(ctx, a.Restart, command.ID)
-			}
+			err = runCommand(ctx, a.Restart, command)
 		case RELOAD:
-			a, ok := agents[platform][command.Agent]
-			if ok {
-				cmdReload(ctx, a, command)
-			}
+			err = cmdReload(ctx, a, command)
 		case STATUS:
-			a, ok := agents[platform][command.Agent]
-			if ok {
-				runCommand(ctx, a.Status, command.ID)
-			}
+			err = runCommand(ctx, a.Status, command)
 		case VERSION:
-			a, ok := agents[platform][command.Agent]
-			if ok {
-				runCommand(ctx, a.Version, command.ID)
+			err = runCommand(ctx, a.Version, command)
+		case INSTALL, UPGRADE, UNINSTALL:
+			err = runPackage(ctx, a, command)
+			if err == nil {
+				packages++
 			}
 		}
+
+		if err != nil {
+			failed++
+		}
+	}
+
+	if packages > 0 {
+		// report the agents now installed, with their versions
+		if err := inventory.CheckForAgents(ctx); err != nil {
+			log.Error().Err(err).Msg("checking for installed agents")
+
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d command(s) failed", failed)
 	}
 
 	return nil
 }
 
-func runCommand(ctx context.Context, cmd, id string) {
-	output, code, err := execute(ctx, cmd)
+// RunAgentCommand runs a start, stop, restart, reload, status or version command for the
+// installed agent type, outside of an action (e.g. from the local admin API).
+func RunAgentCommand(ctx context.Context, agentType, command string) ([]byte, int, error) {
+	output, code, err := agentCommand(ctx, agentType, command)
+	metrics.Command(agentType, command, code)
+
+	return output, code, err
+}
+
+func agentCommand(ctx context.Context, agentType, command string) ([]byte, int, error) {
+	agents, err := inventory.PlatformAgents()
+	if err != nil {
+		return nil, -1, err
+	}
+
+	a, ok := agents[agentType]
+	if !ok {
+		return nil, -1, fmt.Errorf("agent %s not found in inventory", agentType)
+	}
+
+	var cmd string
+
+	switch command {
+	case START:
+		cmd = a.Start
+	case STOP:
+		cmd = a.Stop
+	case RESTART:
+		cmd = a.Restart
+	case STATUS:
+		cmd = a.Status
+	case VERSION:
+		cmd = a.Version
+	case RELOAD:
+		cmd = a.Reload
+
+		switch {
+		case strings.ToLower(a.Reload) == RESTART:
+			cmd = a.Restart
+		case strings.HasPrefix(strings.ToLower(a.Reload), "http"):
+			parts := strings.SplitN(a.Reload, "|", 4)
+			if len(parts) != 4 {
+				return nil, -1, fmt.Errorf("invalid reload http setting (%s)", a.Reload)
+			}
+
+			body, err := httpReload(ctx, strings.ToUpper(parts[1]), parts[2], parts[3])
+			if err != nil {
+				return body, -1, err
+			}
+
+			return body, 0, nil
+		}
+	default:
+		return nil, -1, fmt.Errorf("unsupported command (%s)", command)
+	}
+
+	if cmd == "" {
+		return nil, -1, fmt.Errorf("no %s command defined for %s", command, agentType)
+	}
+
+	return executeCommand(ctx, cmd)
+}
+
+// runCommand executes cmd for the agent command, sending the result if it is
+// part of an action (has an id).
+func runCommand(ctx context.Context, cmd string, command Command) error {
+	ctx, span := tracing.StartSpan(ctx, "command",
+		tracing.AttrAgentType.String(command.Agent),
+		tracing.AttrCommand.String(command.Command))
+
+	output, code, err := executeCommand(ctx, cmd)
+	span.SetAttributes(tracing.AttrExitCode.Int(code))
+	tracing.End(span, err)
 	if err != nil {
 		log.Warn().Err(err).Str("output", string(output)).Int("exit_code", code).Str("cmd", cmd).Msg("command failed")
 	}
 
-	if id != "" {
+	metrics.Command(command.Agent, command.Command, code)
+
+	if command.ID != "" {
 		result := CommandResult{
-			ID: id,
+			ID: command.ID,
 			CommandData: CommandData{
 				ExitCode: code,
 			},
@@ -93,8 +203,10 @@ func runCommand(ctx context.Context, cmd, id string) {
 			result.CommandData.Output = base64.StdEncoding.EncodeToString(output)
 		}
 
-		if err = sendCommandResult(ctx, result); err != nil {
+		if err := sendCommandResult(ctx, result); err != nil {
 			log.Error().Err(err).Msg("command result")
 		}
 	}
+
+	return err
 }
@@ -0,0 +1,71 @@
+package agents
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/circonus/agent-manager/internal/install"
+	"github.com/circonus/agent-manager/internal/inventory"
+	"github.com/circonus/agent-manager/internal/metrics"
+	"github.com/circonus/agent-manager/internal/tracing"
+	"github.com/rs/zerolog/log"
+)
+
+// runPackage installs, upgrades or uninstalls the agent using the package definition
+// in the inventory, sending the result if it is part of an action (has an id). The
+// agent is stopped before it is uninstalled, and restarted after a tarball upgrade
+// (packages restart it in their scripts).
+func runPackage(ctx context.Context, a inventory.Agent, command Command) error {
+	ctx, span := tracing.StartSpan(ctx, "command",
+		tracing.AttrAgentType.String(command.Agent),
+		tracing.AttrCommand.String(command.Command))
+
+	if command.Command == UNINSTALL && a.Stop != "" {
+		if output, _, err := executeCommand(ctx, a.Stop); err != nil {
+			log.Debug().Err(err).Str("output", string(output)).Str("agent", command.Agent).Msg("stopping agent before uninstall")
+		}
+	}
+
+	output, code, err := install.Run(ctx, command.Agent, command.Command, a.Package)
+
+	if err == nil && command.Command == UPGRADE && a.Restart != "" && install.Tarball(a.Package) {
+		var out []byte
+
+		out, code, err = executeCommand(ctx, a.Restart)
+		output = append(output, out...)
+	}
+
+	span.SetAttributes(tracing.AttrExitCode.Int(code))
+	tracing.End(span, err)
+
+	if err != nil {
+		log.Warn().Err(err).Str("output", string(output)).Int("exit_code", code).Str("agent", command.Agent).Str("cmd", command.Command).Msg("package command failed")
+	} else {
+		log.Info().Str("agent", command.Agent).Str("cmd", command.Command).Msg("package command completed")
+	}
+
+	metrics.Command(command.Agent, command.Command, code)
+
+	if command.ID != "" {
+		result := CommandResult{
+			ID: command.ID,
+			CommandData: CommandData{
+				ExitCode: code,
+			},
+		}
+
+		if err != nil {
+			result.CommandData.Error = err.Error()
+		}
+
+		if len(output) > 0 {
+			result.CommandData.Output = base64.StdEncoding.EncodeToString(output)
+		}
+
+		if err := sendCommandResult(ctx, result); err != nil {
+			log.Error().Err(err).Msg("command result")
+		}
+	}
+
+	return err
+}
@@ -10,6 +10,8 @@ import (
 	"strings"
 
 	"github.com/circonus/agent-manager/internal/inventory"
+	"github.com/circonus/agent-manager/internal/metrics"
+	"github.com/circonus/agent-manager/internal/secrets"
 	"github.com/rs/zerolog/log"
 )
 
@@ -17,12 +19,15 @@ import (
 //       1. as part of installing a new configuration (most common)
 //       2. as a direct action command (least common, restart would probably be used instead)
 
-func cmdReload(ctx context.Context, a inventory.Agent, command Command) {
+func cmdReload(ctx context.Context, a inventory.Agent, command Command) error {
 	switch {
 	case a.Reload == "":
-		return
+		return nil
 	case strings.ToLower(a.Reload) == RESTART:
-		runCommand(ctx, a.Restart, command.ID)
+		err := runCommand(ctx, a.Restart, command)
+		metrics.ConfigReload(command.Agent, RESTART, err)
+
+		return err
 	case strings.HasPrefix(strings.ToLower(a.Reload), "http"):
 		// http|method|body|url -- e.g. for fluent-bit "http|post||http://localhost:2020/api/v2/reload"
 		// fluent-bit -- https://docs.fluentbit.io/manual/administration/hot-reload#via-http
@@ -30,18 +35,23 @@ func cmdReload(ctx context.Context, a inventory.Agent, command Command) {
 		if len(parts) != 4 {
 			log.Warn().Str("reload", a.Reload).Msg("invalid reload http setting")
 
-			return
+			err := fmt.Errorf("invalid reload http setting (%s)", a.Reload)
+			metrics.ConfigReload(command.Agent, "http", err)
+
+			return err
 		}
 
 		method := strings.ToUpper(parts[1])
 		body := parts[2]
 		rawURL := parts[3]
 
-		respBody, err := httpReloadRequest(ctx, method, body, rawURL)
+		respBody, err := httpReload(ctx, method, body, rawURL)
 		if err != nil {
 			log.Warn().Err(err).Str("reload", a.Reload).Msg("http reload failed")
 		}
 
+		metrics.ConfigReload(command.Agent, "http", err)
+
 		if command.ID != "" {
 			result := CommandResult{
 				ID: command.ID,
@@ -57,15 +67,35 @@ func cmdReload(ctx context.Context, a inventory.Agent, command Command) {
 				result.CommandData.Output = base64.StdEncoding.EncodeToString(respBody)
 			}
 
-			if err = sendCommandResult(ctx, result); err != nil {
+			if err := sendCommandResult(ctx, result); err != nil {
 				log.Error().Err(err).Msg("command result")
 			}
 		}
+
+		return err
 	default:
-		runCommand(ctx, a.Reload, command.ID)
+		err := runCommand(ctx, a.Reload, command)
+		metrics.ConfigReload(command.Agent, "command", err)
+
+		return err
 	}
 }
 
+// httpReload resolves any secret references in the body and url before making the request.
+func httpReload(ctx context.Context, method, body, rawURL string) ([]byte, error) {
+	body, err := secrets.ResolveString(ctx, body)
+	if err != nil {
+		return nil, fmt.Errorf("resolving body secrets: %w", err)
+	}
+
+	rawURL, err = secrets.ResolveString(ctx, rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("resolving url secrets: %w", err)
+	}
+
+	return httpReloadRequest(ctx, method, body, rawURL)
+}
+
 func httpReloadRequest(ctx context.Context, method, body, rawURL string) ([]byte, error) {
 	_, err := url.Parse(rawURL)
 	if err != nil {
@@ -0,0 +1,190 @@
+package agents
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/metrics"
+	"github.com/circonus/agent-manager/internal/release"
+	"github.com/circonus/agent-manager/internal/selfupdate"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// selfUpdateRetry is how often the health check poll is retried after a self-update.
+const selfUpdateRetry = 10 * time.Second
+
+// runSelfUpdate downloads, verifies and installs the release then restarts the
+// manager through the service manager. The result is sent once the new binary has
+// passed the health check (see ConfirmSelfUpdate), or now if the update fails.
+func runSelfUpdate(ctx context.Context, command Command) error {
+	err := selfUpdate(ctx, command)
+	if err != nil {
+		log.Error().Err(err).Msg("self-update")
+
+		metrics.Command(release.NAME, SELFUPDATE, -1)
+
+		sendSelfUpdateResult(ctx, command.ID, "", err)
+	}
+
+	return err
+}
+
+func selfUpdate(ctx context.Context, command Command) error {
+	if err := selfupdate.Enabled(); err != nil {
+		return err
+	}
+
+	if command.Release == nil {
+		return fmt.Errorf("no release in self-update command")
+	}
+
+	if selfupdate.Running(command.Release.Version) {
+		return fmt.Errorf("already running %s", release.VERSION)
+	}
+
+	file, err := selfupdate.Prepare(ctx, *command.Release)
+	if err != nil {
+		return err
+	}
+
+	if err := selfupdate.Install(ctx, file, *command.Release, command.ID); err != nil {
+		return err
+	}
+
+	restart := viper.GetString(keys.SelfUpdateRestart)
+
+	log.Info().Str("cmd", restart).Msg("restarting to complete self-update")
+
+	if output, _, err := executeCommand(ctx, restart); err != nil {
+		err = fmt.Errorf("restarting (%s): %w", string(output), err)
+
+		s, lerr := selfupdate.Load()
+		if lerr != nil || s == nil {
+			return errors.Join(err, lerr)
+		}
+
+		if rerr := selfupdate.Rollback(ctx, s, err); rerr != nil {
+			return errors.Join(err, rerr)
+		}
+
+		return errors.Join(err, selfupdate.Remove())
+	}
+
+	metrics.Command(release.NAME, SELFUPDATE, 0)
+
+	return nil
+}
+
+// ConfirmSelfUpdate completes a self-update after the restart. The new binary has to
+// complete a successful action poll (credentials valid, API reachable) within the
+// health timeout, otherwise the previous binary is restored and the manager restarted.
+// The result is sent for the command which requested the update, by the new binary or,
+// after a rollback, by the previous one.
+func (p *ActionPoller) ConfirmSelfUpdate(ctx context.Context) {
+	s, err := selfupdate.Load()
+	if err != nil {
+		log.Error().Err(err).Msg("self-update state")
+
+		return
+	}
+
+	if s == nil {
+		return
+	}
+
+	if s.State != selfupdate.StatePending || !selfupdate.Running(s.To) {
+		// the previous binary is running, the update was rolled back
+		reason := s.Error
+		if reason == "" {
+			reason = "not running after restart"
+		}
+
+		sendSelfUpdateResult(ctx, s.CommandID, "", fmt.Errorf("self-update to %s failed, running %s: %s", s.To, release.VERSION, reason))
+
+		if err := selfupdate.Remove(); err != nil {
+			log.Error().Err(err).Msg("self-update state")
+		}
+
+		return
+	}
+
+	timeout, err := time.ParseDuration(viper.GetString(keys.SelfUpdateHealthTimeout))
+	if err != nil {
+		log.Error().Err(err).Msg("self-update health timeout, using 2m")
+
+		timeout = 2 * time.Minute
+	}
+
+	if err := p.healthy(ctx, timeout); err != nil {
+		if ctx.Err() != nil {
+			return // shutting down, checked again on the next start
+		}
+
+		if err := selfupdate.Rollback(ctx, s, err); err != nil {
+			log.Error().Err(err).Msg("self-update rollback")
+
+			return
+		}
+
+		if output, _, err := executeCommand(ctx, viper.GetString(keys.SelfUpdateRestart)); err != nil {
+			log.Error().Err(err).Str("output", string(output)).Msg("restarting previous binary after self-update rollback")
+		}
+
+		return
+	}
+
+	if err := selfupdate.Complete(ctx, s); err != nil {
+		log.Error().Err(err).Msg("self-update state")
+	}
+
+	log.Info().Str("from", s.From).Str("to", s.To).Msg("self-update complete")
+
+	sendSelfUpdateResult(ctx, s.CommandID, fmt.Sprintf("updated from %s to %s", s.From, s.To), nil)
+}
+
+// healthy polls for actions until a poll succeeds or the timeout.
+func (p *ActionPoller) healthy(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		err := p.PollNow(ctx)
+		if err == nil {
+			return nil
+		}
+
+		log.Warn().Err(err).Msg("self-update health check")
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("no successful action poll within %s: %w", timeout, err)
+		case <-time.After(selfUpdateRetry):
+		}
+	}
+}
+
+func sendSelfUpdateResult(ctx context.Context, id, output string, err error) {
+	if id == "" {
+		return
+	}
+
+	result := CommandResult{ID: id}
+
+	if err != nil {
+		result.CommandData.Error = err.Error()
+		result.CommandData.ExitCode = -1
+	}
+
+	if output != "" {
+		result.CommandData.Output = base64.StdEncoding.EncodeToString([]byte(output))
+	}
+
+	if err := sendCommandResult(ctx, result); err != nil {
+		log.Error().Err(err).Msg("command result")
+	}
+}
@@ -0,0 +1,100 @@
+package agents
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/circonus/agent-manager/internal/config/defaults"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/env"
+	"github.com/circonus/agent-manager/internal/inventory"
+	"github.com/circonus/agent-manager/internal/registration"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestAgentCommandDetectedPath(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir := t.TempDir()
+	origEtc := defaults.EtcPath
+	defaults.EtcPath = dir
+
+	defer func() { defaults.EtcPath = origEtc }()
+
+	viper.Set(keys.InventoryFile, filepath.Join(dir, "inventory.yaml"))
+	defer viper.Set(keys.InventoryFile, "")
+
+	// no native service manager, commands run in a shell
+	svcMgrOnce.Do(func() {})
+
+	defer func() { svcMgr = nil }()
+
+	svcMgr = nil
+
+	// the agent is installed in a non-default location, the inventory binary does not exist
+	ran := filepath.Join(dir, "ran")
+	detected := filepath.Join(dir, "opt", "foo")
+
+	if err := os.MkdirAll(filepath.Dir(detected), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(detected, []byte("#!/bin/sh\necho \"$@\" >> "+ran+"\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	err := inventory.SaveAgents(inventory.Agents{env.GetPlatform(): {
+		"foo": {
+			Binary:  "/usr/bin/foo",
+			Start:   "/usr/bin/foo start",
+			Reload:  "/usr/bin/foo reload",
+			Version: "/usr/bin/foo version",
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := registration.SaveInstalledAgents(registration.Agents{{AgentID: "abc", AgentTypeID: "foo", Path: detected}}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	if _, _, err := agentCommand(ctx, "foo", VERSION); err != nil {
+		t.Fatalf("agentCommand() %s", err)
+	}
+
+	if err := runCommands(ctx, Action{Commands: []Command{{Agent: "foo", Command: START}}}); err != nil {
+		t.Fatalf("runCommands() %s", err)
+	}
+
+	agents, err := inventory.PlatformAgents()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"version", "start"}
+
+	// installConfigs reloads the agent with the platform agents (containers are signaled instead)
+	if !env.IsRunningInDocker() {
+		if err := reloadAgent(ctx, agents, "foo", nil); err != nil {
+			t.Fatalf("reloadAgent() %s", err)
+		}
+
+		want = append(want, "reload")
+	}
+
+	data, err := os.ReadFile(ran)
+	if err != nil {
+		t.Fatalf("detected binary not run: %s", err)
+	}
+
+	if got := strings.Fields(string(data)); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("detected binary ran %v, want %v", got, want)
+	}
+}
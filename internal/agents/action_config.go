@@ -2,94 +2,193 @@ package agents
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 
 	"github.com/circonus/agent-manager/internal/env"
 	"github.com/circonus/agent-manager/internal/inventory"
+	"github.com/circonus/agent-manager/internal/metrics"
+	"github.com/circonus/agent-manager/internal/secrets"
 	"github.com/circonus/agent-manager/internal/server"
+	"github.com/circonus/agent-manager/internal/tracing"
 	"github.com/circonus/agent-manager/internal/tracker"
 	"github.com/rs/zerolog/log"
 )
 
-func installConfigs(ctx context.Context, action Action) {
-	agents, err := inventory.LoadAgents()
+// installConfigs returns an error if any of the configs could not be installed,
+// individual failures are reported in the config results.
+func installConfigs(ctx context.Context, action Action) error {
+	agents, err := inventory.PlatformAgents()
 	if err != nil {
 		log.Warn().Err(err).Msg("unable to load agents, skipping configs")
 
-		return
+		return fmt.Errorf("loading agents: %w", err)
 	}
 
-	platform := env.GetPlatform()
+	failed := 0
 
 	for agentID, configs := range action.Configs {
-		for _, config := range configs {
-			log.Debug().Str("path", config.Path).Str("contents", config.Contents).Msg("incoming contents")
+		checksums := make([]string, 0, len(configs))
 
-			data, err := base64.StdEncoding.DecodeString(config.Contents)
+		for _, config := range configs {
+			sum, err := installConfig(ctx, agentID, config)
 			if err != nil {
-				result := ConfigResult{
-					ID: config.ID,
-					ConfigData: ConfigData{
-						WriteResult: err.Error(),
-					},
-				}
-
-				if err = sendConfigResult(ctx, result); err != nil {
-					log.Error().Err(err).Msg("config result")
-				}
+				failed++
 
 				continue
 			}
 
-			log.Debug().Str("path", config.Path).Str("contents", string(data)).Msg("decoded contents")
+			checksums = append(checksums, sum)
+		}
+
+		if err := reloadAgent(ctx, agents, agentID, checksums); err != nil {
+			failed++
+		}
+	}
 
-			if err := writeConfig(config.Path, data); err != nil {
-				result := ConfigResult{
-					ID:     config.ID,
-					Status: STATUS_ERROR,
-					Info:   err.Error(),
-					ConfigData: ConfigData{
-						WriteResult: err.Error(),
-					},
-				}
+	if failed > 0 {
+		return fmt.Errorf("%d config install(s) or reload(s) failed", failed)
+	}
 
-				if err := sendConfigResult(ctx, result); err != nil {
-					log.Error().Err(err).Msg("config result")
-				}
+	return nil
+}
 
-				continue
-			}
+// installConfig decodes, resolves secrets and writes the config, sends the result and
+// updates tracking. Returns the checksum of the config written.
+func installConfig(ctx context.Context, agentID string, config Config) (sum string, err error) {
+	ctx, span := tracing.StartSpan(ctx, "config.install",
+		tracing.AttrAgentType.String(agentID),
+		tracing.AttrAssignmentID.String(config.ID),
+		tracing.AttrConfigPath.String(config.Path))
+	defer func() { tracing.End(span, err) }()
 
-			result := ConfigResult{
-				ID:     config.ID,
-				Status: STATUS_ACTIVE,
-				ConfigData: ConfigData{
-					WriteResult: "OK",
-				},
-			}
+	log.Debug().Str("path", config.Path).Str("contents", config.Contents).Msg("incoming contents")
 
-			if err := sendConfigResult(ctx, result); err != nil {
-				log.Error().Err(err).Msg("config result")
-			}
+	_, dspan := tracing.StartSpan(ctx, "config.decode")
+	data, err := base64.StdEncoding.DecodeString(config.Contents)
+	tracing.End(dspan, err)
 
-			// save config hash as current.
-			if err := tracker.UpdateConfig(agentID, config.ID, config.Path, data); err != nil {
-				log.Error().Err(err).Msg("updating config tracking data")
-			}
+	if err != nil {
+		result := ConfigResult{
+			ID: config.ID,
+			ConfigData: ConfigData{
+				WriteResult: err.Error(),
+			},
 		}
 
-		if env.IsRunningInDocker() {
-			server.AddConfigUpdate(agentID)
-		} else {
-			agent, ok := agents[platform][agentID]
-			if !ok {
-				log.Warn().Str("platform", platform).Str("agent", agentID).
-					Msg("unable to find agent definition for reload, skipping")
+		if err := sendConfigResult(ctx, result); err != nil {
+			log.Error().Err(err).Msg("config result")
+		}
 
-				continue
+		return "", err
+	}
+
+	log.Debug().Str("path", config.Path).Str("contents", string(data)).Msg("decoded contents")
+
+	// resolve any secret references locally, the resolved contents are only
+	// written to the agent's config file -- tracking keeps the original.
+	sctx, sspan := tracing.StartSpan(ctx, "config.resolve_secrets")
+	resolved, err := secrets.Resolve(sctx, data)
+	tracing.End(sspan, err)
+
+	if err != nil {
+		sendConfigError(ctx, config.ID, err)
+
+		return "", err
+	}
+
+	_, wspan := tracing.StartSpan(ctx, "config.write")
+	err = writeConfig(ctx, agentID, config.ID, config.Path, resolved)
+	tracing.End(wspan, err)
+	metrics.ConfigWrite(agentID, err)
+
+	if err != nil {
+		sendConfigError(ctx, config.ID, err)
+
+		return "", err
+	}
+
+	result := ConfigResult{
+		ID:     config.ID,
+		Status: STATUS_ACTIVE,
+		ConfigData: ConfigData{
+			WriteResult: "OK",
+		},
+	}
+
+	if err := sendConfigResult(ctx, result); err != nil {
+		log.Error().Err(err).Msg("config result")
+	}
+
+	// save config hash as current.
+	_, tspan := tracing.StartSpan(ctx, "tracker.update")
+	terr := tracker.UpdateConfig(agentID, config.ID, config.Path, data)
+	tracing.End(tspan, terr)
+
+	if terr != nil {
+		log.Error().Err(terr).Msg("updating config tracking data")
+	}
+
+	s := sha256.Sum256(resolved)
+
+	return hex.EncodeToString(s[:]), nil
+}
+
+func sendConfigError(ctx context.Context, id string, err error) {
+	result := ConfigResult{
+		ID:     id,
+		Status: STATUS_ERROR,
+		Info:   err.Error(),
+		ConfigData: ConfigData{
+			WriteResult: err.Error(),
+		},
+	}
+
+	if err := sendConfigResult(ctx, result); err != nil {
+		log.Error().Err(err).Msg("config result")
+	}
+}
+
+// reloadAgent has the agent load its new config(s), checksums are of the configs written.
+func reloadAgent(ctx context.Context, agents map[string]inventory.Agent, agentID string, checksums []string) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "config.reload", tracing.AttrAgentType.String(agentID))
+	defer func() { tracing.End(span, err) }()
+
+	if env.IsRunningInDocker() {
+		if c := engine(); c != nil {
+			reloaded, rerr := reloadContainers(ctx, c, agentID)
+			metrics.ConfigReload(agentID, "container", rerr)
+
+			if rerr == nil {
+				return nil
+			}
+
+			if reloaded > 0 {
+				// the health check signals every replica, the containers reloaded would
+				// reload again -- the containers which failed are reported instead
+				log.Error().Err(rerr).Str("agent", agentID).Int("reloaded", reloaded).Msg("reloading agent containers")
+
+				return fmt.Errorf("reloading %s containers: %w", agentID, rerr)
 			}
 
-			cmdReload(ctx, agent, Command{})
+			log.Warn().Err(rerr).Str("agent", agentID).Msg("reloading agent containers, signaling via health check")
 		}
+
+		server.AddConfigUpdate(agentID, checksums...)
+		metrics.ConfigReload(agentID, "health_check", nil)
+
+		return nil
 	}
+
+	agent, ok := agents[agentID]
+	if !ok {
+		log.Warn().Str("platform", env.GetPlatform()).Str("agent", agentID).
+			Msg("unable to find agent definition for reload, skipping")
+
+		return nil
+	}
+
+	return cmdReload(ctx, agent, Command{Agent: agentID, Command: RELOAD})
 }
@@ -2,36 +2,115 @@ package agents
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/heartbeat"
+	"github.com/circonus/agent-manager/internal/metrics"
+	"github.com/circonus/agent-manager/internal/splay"
+	"github.com/circonus/agent-manager/internal/tracing"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 )
 
 // manages polling for actions
 
+// drainGrace is how long to wait for cancelled actions to return, and the minimum
+// time allowed for flushing pending results, when draining.
+const drainGrace = 5 * time.Second
+
+var errPollerStopped = errors.New("action poller stopped")
+
 type ActionPoller struct {
-	interval time.Duration
+	run       context.Context    // actions in progress, only cancelled if draining times out
+	abort     context.CancelFunc // cancels actions in progress
+	now       chan chan error
+	intervals chan time.Duration // new interval, applied by the poll loop
+	done      chan struct{}      // closed when the poll loop exits
+	interval  time.Duration
 }
 
 func NewActionPoller() (*ActionPoller, error) {
-	pi := viper.GetString(keys.ActionPollingInterval)
+	i, err := actionPollingInterval(viper.GetViper())
+	if err != nil {
+		return nil, err
+	}
+
+	run, abort := context.WithCancel(context.Background())
+
+	return &ActionPoller{
+		run:       run,
+		abort:     abort,
+		interval:  i,
+		now:       make(chan chan error),
+		intervals: make(chan time.Duration, 1),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+func actionPollingInterval(v *viper.Viper) (time.Duration, error) {
+	pi := v.GetString(keys.ActionPollingInterval)
 
 	i, err := time.ParseDuration(pi)
 	if err != nil {
-		return nil, fmt.Errorf("parsing polling interval: %w", err)
+		return 0, fmt.Errorf("parsing polling interval: %w", err)
+	}
+
+	return i, nil
+}
+
+// Reconfigure applies the polling interval setting from v (e.g. after a config reload).
+func (p *ActionPoller) Reconfigure(v *viper.Viper) error {
+	i, err := actionPollingInterval(v)
+	if err != nil {
+		return err
+	}
+
+	// only the latest setting matters
+	select {
+	case <-p.intervals:
+	default:
+	}
+
+	p.intervals <- i
+
+	return nil
+}
+
+// PollNow triggers an immediate poll for actions, waiting for it to complete.
+func (p *ActionPoller) PollNow(ctx context.Context) error {
+	done := make(chan error, 1)
+
+	select {
+	case p.now <- done:
+	case <-p.done:
+		return errPollerStopped
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 
-	return &ActionPoller{interval: i}, nil
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
+// Start polls for actions until the context is done. Actions in progress are not
+// cancelled with the context, see Drain.
 func (p *ActionPoller) Start(ctx context.Context) {
+	defer close(p.done)
+
 	log.Info().Str("interval", p.interval.String()).Msg("starting action poller")
 
+	// a splay before applying changes ends on shutdown, the changes are not applied
+	run := splay.WithStop(p.run, ctx.Done())
+
 	for {
-		t := time.NewTimer(p.interval)
+		t := time.NewTimer(splay.Jitter(p.interval))
 		select {
 		case <-ctx.Done():
 			if !t.Stop() {
@@ -39,12 +118,100 @@ func (p *ActionPoller) Start(ctx context.Context) {
 			}
 
 			return
+		case i := <-p.intervals:
+			if !t.Stop() {
+				<-t.C
+			}
+
+			if i != p.interval {
+				log.Info().Str("interval", i.String()).Msg("action poller interval changed")
+			}
+
+			p.interval = i
+		case done := <-p.now:
+			if !t.Stop() {
+				<-t.C
+			}
+
+			log.Info().Msg("checking for new actions (poll now)")
+
+			done <- p.poll(run)
 		case <-t.C:
 			log.Debug().Msg("checking for new actions")
 
-			if err := getActions(ctx); err != nil {
-				log.Error().Err(err).Msg("getting actions")
-			}
+			_ = p.poll(run) // logged by poll
 		}
 	}
 }
+
+// Drain waits for the actions in progress to finish once Start's context is done,
+// cancelling them after the timeout, then sends any pending results.
+func (p *ActionPoller) Drain(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	var err error
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case <-p.done:
+	case <-t.C:
+		err = fmt.Errorf("actions in progress not finished after %s, cancelled", timeout)
+
+		p.abort()
+
+		select {
+		case <-p.done:
+		case <-time.After(drainGrace):
+			err = fmt.Errorf("actions in progress not finished after %s, not responding to cancel", timeout)
+		}
+	}
+
+	p.abort()
+
+	remaining := time.Until(deadline)
+	if remaining < drainGrace {
+		remaining = drainGrace
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), remaining)
+	defer cancel()
+
+	if ferr := pending.flush(ctx); ferr != nil {
+		err = errors.Join(err, ferr)
+	}
+
+	if n := pending.len(); n > 0 {
+		log.Warn().Int("results", n).Msg("unsent action results discarded")
+	}
+
+	return err
+}
+
+// poll sends any pending results and applies deferred actions (when no longer in
+// maintenance), then gets and performs any actions, recording the outcome.
+func (p *ActionPoller) poll(ctx context.Context) error {
+	start := time.Now()
+
+	if err := pending.flush(ctx); err != nil {
+		log.Warn().Err(err).Msg("pending action results")
+	}
+
+	if err := applyDeferred(ctx); err != nil {
+		log.Error().Err(err).Msg("applying deferred actions")
+	}
+
+	ctx, span := tracing.StartSpan(ctx, "actions.poll")
+	err := getActions(ctx)
+	tracing.End(span, err)
+
+	metrics.ActionPoll(start, err)
+	heartbeat.Ran(heartbeat.ActionPoll, err)
+
+	if err != nil {
+		log.Error().Err(err).Msg("getting actions")
+	}
+
+	return err
+}
@@ -0,0 +1,146 @@
+package agents
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/spf13/viper"
+)
+
+func TestSendActionResultPending(t *testing.T) {
+	var status atomic.Int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer ts.Close()
+
+	viper.Set(keys.APIURL, ts.URL)
+	viper.Set(keys.APIToken, testAuthToken)
+
+	pending = &pendingResults{}
+
+	tests := []struct {
+		name        string
+		status      int
+		wantErr     string
+		wantPending int
+	}{
+		{name: "server error kept", status: http.StatusServiceUnavailable, wantErr: "will retry", wantPending: 1},
+		{name: "client error dropped", status: http.StatusBadRequest, wantErr: "400", wantPending: 1},
+		{name: "ok", status: http.StatusOK, wantPending: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status.Store(int32(tt.status))
+
+			err := sendActionResult(context.Background(), []byte(`{}`))
+
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error (%s)", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+
+			if n := pending.len(); n != tt.wantPending {
+				t.Fatalf("pending = %d, want %d", n, tt.wantPending)
+			}
+		})
+	}
+
+	if err := FlushResults(context.Background()); err != nil {
+		t.Fatalf("unexpected flush error (%s)", err)
+	}
+
+	if n := pending.len(); n != 0 {
+		t.Fatalf("pending = %d after flush, want 0", n)
+	}
+}
+
+func TestActionPollerDrain(t *testing.T) {
+	tests := []struct {
+		name    string
+		delay   time.Duration // time to respond to the action request
+		timeout time.Duration
+		wantErr string
+	}{
+		{name: "finishes", delay: 100 * time.Millisecond, timeout: 5 * time.Second},
+		{name: "cancelled", delay: time.Minute, timeout: 100 * time.Millisecond, wantErr: "cancelled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{}, 1)
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				started <- struct{}{}
+
+				select {
+				case <-time.After(tt.delay):
+				case <-r.Context().Done():
+					return
+				}
+
+				_, _ = w.Write([]byte(`[]`))
+			}))
+			defer ts.Close()
+
+			viper.Set(keys.APIURL, ts.URL)
+			viper.Set(keys.APIToken, testAuthToken)
+			viper.Set(keys.ActionPollingInterval, "1h")
+
+			pending = &pendingResults{}
+
+			p, err := NewActionPoller()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			go p.Start(ctx)
+
+			polled := make(chan error, 1)
+
+			go func() { polled <- p.PollNow(context.Background()) }()
+
+			<-started
+			cancel() // stop taking new actions, the one in progress continues
+
+			err = p.Drain(tt.timeout)
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error (%s)", err)
+				}
+
+				if perr := <-polled; perr != nil {
+					t.Fatalf("poll in progress failed (%s)", perr)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+
+			if perr := <-polled; perr == nil {
+				t.Fatal("expected cancelled poll to fail")
+			}
+
+			if err := p.PollNow(context.Background()); err == nil {
+				t.Fatal("expected poll after drain to fail")
+			}
+		})
+	}
+}
@@ -9,8 +9,13 @@ import (
 	"net/http"
 	"net/url"
 
+	"github.com/circonus/agent-manager/internal/audit"
 	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/metrics"
 	"github.com/circonus/agent-manager/internal/registration"
+	"github.com/circonus/agent-manager/internal/selfupdate"
+	"github.com/circonus/agent-manager/internal/splay"
+	"github.com/circonus/agent-manager/internal/tracing"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 )
@@ -22,8 +27,10 @@ const (
 	CONFIG  = "config"
 	COMMAND = "command"
 
-	STATUS_ACTIVE = "active"
-	STATUS_ERROR  = "error"
+	STATUS_ACTIVE         = "active"
+	STATUS_ERROR          = "error"
+	STATUS_DEFERRED       = "deferred"       // host in maintenance
+	STATUS_PENDING_WINDOW = "pending-window" // config waiting for the next change window
 )
 
 type Actions []Action
@@ -39,9 +46,10 @@ type Action struct {
 // how to restart an agent is in the agent inventory.
 // agent status would be the result of running `systemctl status <agent>`.
 type Command struct {
-	ID      string `json:"id"      yaml:"id"`
-	Agent   string `json:"agent"   yaml:"agent"`
-	Command string `json:"command" yaml:"command"`
+	Release *selfupdate.Release `json:"release,omitempty" yaml:"release,omitempty"` // self_update
+	ID      string              `json:"id"                yaml:"id"`
+	Agent   string              `json:"agent"             yaml:"agent"`
+	Command string              `json:"command"           yaml:"command"`
 }
 
 // Contest should be base64 encoded.
@@ -62,7 +70,7 @@ type Result struct {
 // reload result will be empty or base64 encoded as it may be multi-line output.
 type ConfigResult struct {
 	ID         string     `json:"config_assignment_id" yaml:"config_assignment_id"`
-	Status     string     `json:"status"               yaml:"status"` // STATUS_ACTIVE or STATUS_ERROR
+	Status     string     `json:"status"               yaml:"status"` // STATUS_ACTIVE, STATUS_ERROR, STATUS_DEFERRED or STATUS_PENDING_WINDOW
 	Info       string     `json:"info,omitempty"       yaml:"info,omitempty"`
 	ConfigData ConfigData `json:"data,omitempty"       yaml:"data,omitempty"`
 }
@@ -75,7 +83,7 @@ type ConfigData struct {
 // Output will be base64 encoded.
 type CommandResult struct {
 	ID          string      `json:"id"     yaml:"id"`
-	Status      string      `json:"status" yaml:"status"` // active or error
+	Status      string      `json:"status" yaml:"status"` // active, error or deferred
 	CommandData CommandData `json:"data"   yaml:"data"`
 }
 
@@ -86,74 +94,138 @@ type CommandData struct {
 }
 
 func getActions(ctx context.Context) error {
+	body, err := fetchActions(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, span := tracing.StartSpan(ctx, "actions.parse")
+	actions, err := ParseAPIActions(body)
+	span.SetAttributes(tracing.AttrActionCount.Int(len(actions)))
+	tracing.End(span, err)
+
+	if len(actions) == 0 {
+		log.Debug().Msg("no actions available")
+
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("parsing api actions: %w", err)
+	}
+
+	if err := splay.Wait(ctx); err != nil {
+		return fmt.Errorf("splay, actions not performed: %w", err)
+	}
+
+	for _, action := range actions {
+		performAction(ctx, action)
+	}
+
+	return nil
+}
+
+func fetchActions(ctx context.Context) (body []byte, err error) {
+	ctx, span := tracing.StartSpan(ctx, "actions.fetch")
+	defer func() { tracing.End(span, err) }()
+
 	token := viper.GetString(keys.APIToken)
 	if token == "" {
-		return fmt.Errorf("invalid api token (empty)")
+		return nil, fmt.Errorf("invalid api token (empty)")
 	}
 
 	reqURL, err := url.JoinPath(viper.GetString(keys.APIURL), "agent", "update")
 	if err != nil {
-		return fmt.Errorf("req url: %w", err)
+		return nil, fmt.Errorf("req url: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
 	if err != nil {
-		return fmt.Errorf("creating request: %w", err)
+		return nil, fmt.Errorf("creating request: %w", err)
 	}
 
 	req.Header.Add("Authorization", token)
+	tracing.Inject(ctx, req.Header)
 
 	client := &http.Client{}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("calling actions endpoint: %w", err)
+		metrics.APIError("actions", 0)
+
+		return nil, fmt.Errorf("calling actions endpoint: %w", err)
 	}
 
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	body, err = io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("reading response body: %w", err)
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		metrics.APIError("actions", resp.StatusCode)
 	}
 
 	if resp.StatusCode == http.StatusUnauthorized {
 		if err := registration.RefreshRegistration(ctx); err != nil {
-			return fmt.Errorf("new token: %w", err)
+			return nil, fmt.Errorf("new token: %w", err)
 		}
 
-		return fmt.Errorf("token expired, refreshed")
+		return nil, fmt.Errorf("token expired, refreshed")
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("non-200 response -- status: %s, body: %s", resp.Status, string(body))
+		return nil, fmt.Errorf("non-200 response -- status: %s, body: %s", resp.Status, string(body))
 	}
 
-	actions, err := ParseAPIActions(body)
-	if len(actions) == 0 {
-		log.Debug().Msg("no actions available")
+	return body, nil
+}
 
-		return nil
+// performAction performs the action, the parts which would change the host while it
+// is in maintenance, or configs outside a change window, are deferred.
+func performAction(ctx context.Context, action Action) {
+	now, later, reason := deferral(action)
+	if later != nil {
+		deferAction(ctx, *later, reason)
 	}
 
-	if err != nil {
-		return fmt.Errorf("parsing api actions: %w", err)
+	if now != nil {
+		runAction(ctx, *now)
 	}
+}
 
-	for _, action := range actions {
-		switch action.Type {
-		case CONFIG:
-			installConfigs(ctx, action)
-		case COMMAND:
-			if err := runCommands(ctx, action); err != nil {
-				log.Error().Err(err).Msg("running commands")
-			}
-		default:
-			log.Warn().Str("action_type", action.Type).Msg("unknown action type, skipping")
+func runAction(ctx context.Context, action Action) {
+	ctx = audit.WithSource(ctx, audit.SourceAction+":"+action.ID)
+
+	ctx, span := tracing.StartSpan(ctx, "action",
+		tracing.AttrActionType.String(action.Type),
+		tracing.AttrActionID.String(action.ID))
+
+	var err error
+
+	switch action.Type {
+	case CONFIG:
+		err = installConfigs(ctx, action)
+		if err != nil {
+			log.Error().Err(err).Msg("installing configs")
 		}
+
+		metrics.ActionResult(action.Type, err)
+	case COMMAND:
+		err = runCommands(ctx, action)
+		if err != nil {
+			log.Error().Err(err).Msg("running commands")
+		}
+
+		metrics.ActionResult(action.Type, err)
+	default:
+		log.Warn().Str("action_type", action.Type).Msg("unknown action type, skipping")
+
+		metrics.Action(action.Type, "skipped")
 	}
 
-	return nil
+	tracing.End(span, err)
 }
 
 func sendConfigResult(ctx context.Context, r ConfigResult) error {
@@ -176,45 +248,67 @@ func sendCommandResult(ctx context.Context, r CommandResult) error {
 	return sendActionResult(ctx, data)
 }
 
-func sendActionResult(ctx context.Context, data []byte) error {
+// sendActionResult sends the result, if it cannot be sent now it is kept for retry.
+func sendActionResult(ctx context.Context, data []byte) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "actions.result")
+	defer func() { tracing.End(span, err) }()
+
+	retry, err := postActionResult(ctx, data)
+	if err != nil && retry {
+		pending.add(data)
+
+		return fmt.Errorf("%w (will retry)", err)
+	}
+
+	return err
+}
+
+// postActionResult sends the result, retry is true if the error is transient.
+func postActionResult(ctx context.Context, data []byte) (retry bool, err error) {
 	token := viper.GetString(keys.APIToken)
 	if token == "" {
-		return fmt.Errorf("invalid api token (empty)")
+		return false, fmt.Errorf("invalid api token (empty)")
 	}
 
 	reqURL, err := url.JoinPath(viper.GetString(keys.APIURL), "agent", "update")
 	if err != nil {
-		return fmt.Errorf("req url: %w", err)
+		return false, fmt.Errorf("req url: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, bytes.NewReader(data))
 	if err != nil {
-		return fmt.Errorf("creating request: %w", err)
+		return false, fmt.Errorf("creating request: %w", err)
 	}
 
 	req.Header.Add("Authorization", token)
+	tracing.Inject(ctx, req.Header)
 
 	client := &http.Client{}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("calling actions endpoint: %w", err)
+		metrics.APIError("action_result", 0)
+
+		return true, fmt.Errorf("calling actions endpoint: %w", err)
 	}
 
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("reading response body: %w", err)
+		return false, fmt.Errorf("reading response body: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("non-200 response -- status: %s, body: %s", resp.Status, string(body))
+		metrics.APIError("action_result", resp.StatusCode)
+
+		return resp.StatusCode >= http.StatusInternalServerError,
+			fmt.Errorf("non-200 response -- status: %s, body: %s", resp.Status, string(body))
 	}
 
 	if len(body) > 0 {
 		log.Debug().RawJSON("body", body).Msg("action result response")
 	}
 
-	return nil
+	return false, nil
 }
@@ -7,9 +7,21 @@ import (
 	"fmt"
 	"os/exec"
 	"time"
+
+	"github.com/circonus/agent-manager/internal/audit"
 )
 
+// execute runs a command which changes the host, it is recorded in the audit log.
 func execute(ctx context.Context, command string) ([]byte, int, error) {
+	start := time.Now()
+	output, exitCode, err := query(ctx, command)
+	auditCommand(ctx, command, exitCode, time.Since(start), err)
+
+	return output, exitCode, err
+}
+
+// query runs a read-only command (e.g. status checks), it is not audited.
+func query(ctx context.Context, command string) ([]byte, int, error) {
 	c, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
@@ -22,3 +34,18 @@ func execute(ctx context.Context, command string) ([]byte, int, error) {
 
 	return output, cmd.ProcessState.ExitCode(), nil
 }
+
+func auditCommand(ctx context.Context, command string, exitCode int, d time.Duration, err error) {
+	e := audit.Entry{
+		Event:    audit.EventCommand,
+		Command:  command,
+		ExitCode: audit.ExitCode(exitCode),
+		Duration: d.String(),
+	}
+
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	audit.Record(ctx, e)
+}
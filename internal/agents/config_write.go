@@ -1,11 +1,38 @@
 package agents
 
 import (
+	"context"
+	"errors"
 	"os"
 	"syscall"
+
+	"github.com/circonus/agent-manager/internal/audit"
 )
 
-func writeConfig(path string, data []byte) error {
+// writeConfig writes the agent config, recording the change in the audit log.
+func writeConfig(ctx context.Context, agentID, assignmentID, path string, data []byte) (err error) {
+	e := audit.Entry{
+		Event:        audit.EventConfigWrite,
+		Agent:        agentID,
+		AssignmentID: assignmentID,
+		Path:         path,
+		NewChecksum:  audit.Checksum(data),
+	}
+
+	defer func() {
+		if err != nil {
+			e.Error = err.Error()
+		}
+
+		audit.Record(ctx, e)
+	}()
+
+	if old, rerr := os.ReadFile(path); rerr == nil {
+		e.OldChecksum = audit.Checksum(old)
+	} else if !errors.Is(rerr, os.ErrNotExist) {
+		e.Detail = "unable to read previous config: " + rerr.Error()
+	}
+
 	perms := os.FileMode(0o640)
 
 	f, err := os.Stat(path)
@@ -17,6 +44,10 @@ func writeConfig(path string, data []byte) error {
 		return err
 	}
 
+	if f == nil {
+		return nil
+	}
+
 	fileSys := f.Sys()
 	if s, ok := fileSys.(*syscall.Stat_t); ok {
 		if err := os.Chown(path, int(s.Uid), int(s.Gid)); err != nil {
@@ -0,0 +1,205 @@
+package agents
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/container"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Container mode, optional integration with the Docker/Podman engine API to reload
+// agent containers on config changes and read their state for status.
+
+const (
+	reloadRestart = "restart"
+	reloadSignal  = "signal"
+	reloadExec    = "exec"
+
+	defaultReloadSignal  = "SIGHUP"
+	containerStopTimeout = 10 * time.Second
+)
+
+var (
+	engineClient *container.Client
+	engineOnce   sync.Once
+
+	errNoContainers = errors.New("no agent containers found")
+)
+
+// containerSettings are the per agent type overrides (container.agents.<agent_type>).
+type containerSettings struct {
+	Reload string   `yaml:"reload"`
+	Signal string   `yaml:"signal"`
+	Exec   []string `yaml:"exec"`
+}
+
+// engine returns the container engine API client, nil if not configured.
+func engine() *container.Client {
+	engineOnce.Do(func() {
+		socket := viper.GetString(keys.ContainerEngineSocket)
+		if socket == "" {
+			return
+		}
+
+		log.Info().Str("socket", socket).Msg("using container engine api")
+
+		engineClient = container.New(socket)
+	})
+
+	return engineClient
+}
+
+func containerSettingsFor(agentType string) containerSettings {
+	cs := containerSettings{
+		Reload: viper.GetString(keys.ContainerReload),
+		Signal: defaultReloadSignal,
+	}
+
+	local, ok := viper.GetStringMap(keys.ContainerAgents)[agentType]
+	if !ok {
+		return cs
+	}
+
+	data, err := yaml.Marshal(local)
+	if err == nil {
+		err = yaml.Unmarshal(data, &cs)
+	}
+
+	if err != nil {
+		log.Warn().Err(err).Str("agent", agentType).Msg("invalid container agent settings, ignoring")
+	}
+
+	if cs.Signal == "" {
+		cs.Signal = defaultReloadSignal
+	}
+
+	return cs
+}
+
+// agentContainers returns the containers labeled as running the agent type.
+func agentContainers(ctx context.Context, c *container.Client, agentType string) ([]container.Container, error) {
+	containers, err := c.List(ctx, viper.GetString(keys.ContainerLabel), agentType)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(containers) == 0 {
+		return nil, errNoContainers
+	}
+
+	return containers, nil
+}
+
+// reloadContainers reloads all of the agent's containers via the engine API, using
+// the configured method (restart, signal or exec). Returns the number of containers
+// reloaded, with an error for any which could not be.
+func reloadContainers(ctx context.Context, c *container.Client, agentType string) (int, error) {
+	containers, err := agentContainers(ctx, c, agentType)
+	if err != nil {
+		return 0, err
+	}
+
+	cs := containerSettingsFor(agentType)
+
+	var errs []error
+
+	reloaded := 0
+
+	for _, ctr := range containers {
+		var err error
+
+		switch cs.Reload {
+		case reloadSignal:
+			err = c.Kill(ctx, ctr.ID, cs.Signal)
+		case reloadExec:
+			if len(cs.Exec) == 0 {
+				err = fmt.Errorf("no exec command defined for %s", agentType)
+
+				break
+			}
+
+			var output []byte
+
+			output, _, err = c.Exec(ctx, ctr.ID, cs.Exec)
+			if len(output) > 0 {
+				log.Debug().Str("agent", agentType).Str("container", ctr.ID).Str("output", string(output)).Msg("exec reload")
+			}
+		case reloadRestart:
+			err = c.Restart(ctx, ctr.ID, containerStopTimeout)
+		default:
+			err = fmt.Errorf("unknown reload method")
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", ctr.ID, cs.Reload, err))
+
+			continue
+		}
+
+		reloaded++
+
+		log.Info().
+			Str("agent", agentType).
+			Str("container", ctr.ID).
+			Str("reload", cs.Reload).
+			Msg("reloaded agent container")
+	}
+
+	return reloaded, errors.Join(errs...)
+}
+
+// engineStatus derives the agent status from the state of its containers, the agent
+// is running only if all of its containers are running (and healthy, if they have a
+// health check).
+func engineStatus(ctx context.Context, c *container.Client, agentType string) (StatusResult, error) {
+	containers, err := agentContainers(ctx, c, agentType)
+	if err != nil {
+		return StatusResult{}, err
+	}
+
+	states := make([]*container.Inspect, 0, len(containers))
+	running := 0
+	status := statusRunning
+
+	for _, ctr := range containers {
+		inspect, err := c.Inspect(ctx, ctr.ID)
+		if err != nil {
+			return StatusResult{}, err
+		}
+
+		states = append(states, inspect)
+
+		switch {
+		case inspect.State.Running && (inspect.State.Health == nil || inspect.State.Health.Status != "unhealthy"):
+			running++
+		case inspect.State.Running || inspect.State.Restarting || inspect.State.ExitCode != 0 || inspect.State.OOMKilled:
+			status = statusFailed
+		default:
+			if status != statusFailed {
+				status = statusStopped
+			}
+		}
+	}
+
+	result := StatusResult{
+		Status: status,
+		StatusData: StatusData{
+			SubStatus: fmt.Sprintf("%d/%d containers running", running, len(containers)),
+		},
+	}
+
+	if data, err := json.Marshal(states); err == nil {
+		result.StatusData.RawResult = base64.StdEncoding.EncodeToString(data)
+	}
+
+	return result, nil
+}
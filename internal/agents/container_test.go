@@ -0,0 +1,285 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/circonus/agent-manager/internal/config/defaults"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/container"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+// fakeEngine serves the containers (id -> inspect state json) labeled as telegraf on a
+// unix socket, reloads of the failing containers return an error.
+func fakeEngine(t *testing.T, states map[string]string, failing map[string]bool, calls *[]string) *container.Client {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "engine.sock")
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { //nolint:gosec
+		if r.URL.Path == "/containers/json" {
+			var filters map[string][]string
+			if err := json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+
+				return
+			}
+
+			list := []container.Container{}
+
+			if reflect.DeepEqual(filters["label"], []string{defaults.ContainerLabel + "=telegraf"}) {
+				for id := range states {
+					list = append(list, container.Container{ID: id})
+				}
+			}
+
+			sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+			_ = json.NewEncoder(w).Encode(list)
+
+			return
+		}
+
+		// /containers/<id>/<op>
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/containers/"), "/")
+		if len(parts) != 2 {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		id, op := parts[0], parts[1]
+
+		state, ok := states[id]
+		if !ok {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		switch op {
+		case "json":
+			_, _ = w.Write([]byte(`{"Id":"` + id + `","State":` + state + `}`))
+		case "kill", "restart":
+			mu.Lock()
+			*calls = append(*calls, op+" "+id)
+			mu.Unlock()
+
+			if failing[id] {
+				http.Error(w, `{"message":"container is not running"}`, http.StatusConflict)
+
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	})}
+
+	go func() { _ = srv.Serve(l) }()
+
+	t.Cleanup(func() { _ = srv.Close() })
+
+	return container.New(socket)
+}
+
+const (
+	stateRunning   = `{"Status":"running","Running":true}`
+	stateHealthy   = `{"Status":"running","Running":true,"Health":{"Status":"healthy"}}`
+	stateUnhealthy = `{"Status":"running","Running":true,"Health":{"Status":"unhealthy"}}`
+	stateStopped   = `{"Status":"exited","ExitCode":0}`
+	stateCrashed   = `{"Status":"exited","ExitCode":1}`
+)
+
+func TestReloadContainers(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(keys.ContainerLabel, defaults.ContainerLabel)
+
+	defer func() {
+		viper.Set(keys.ContainerLabel, "")
+		viper.Set(keys.ContainerReload, "")
+	}()
+
+	tests := []struct {
+		failing      map[string]bool
+		states       map[string]string
+		name         string
+		agent        string
+		reload       string
+		wantCalls    []string
+		wantReloaded int
+		wantErr      bool
+	}{
+		{
+			name:         "restart all",
+			agent:        "telegraf",
+			reload:       reloadRestart,
+			states:       map[string]string{"c1": stateRunning, "c2": stateRunning},
+			wantReloaded: 2,
+			wantCalls:    []string{"restart c1", "restart c2"},
+		},
+		{
+			name:         "signal all",
+			agent:        "telegraf",
+			reload:       reloadSignal,
+			states:       map[string]string{"c1": stateRunning, "c2": stateRunning},
+			wantReloaded: 2,
+			wantCalls:    []string{"kill c1", "kill c2"},
+		},
+		{
+			name:         "partial failure",
+			agent:        "telegraf",
+			reload:       reloadSignal,
+			states:       map[string]string{"c1": stateRunning, "c2": stateStopped},
+			failing:      map[string]bool{"c2": true},
+			wantReloaded: 1,
+			wantCalls:    []string{"kill c1", "kill c2"},
+			wantErr:      true,
+		},
+		{
+			name:      "all failed",
+			agent:     "telegraf",
+			reload:    reloadSignal,
+			states:    map[string]string{"c1": stateStopped},
+			failing:   map[string]bool{"c1": true},
+			wantCalls: []string{"kill c1"},
+			wantErr:   true,
+		},
+		{
+			name:    "exec without command",
+			agent:   "telegraf",
+			reload:  reloadExec,
+			states:  map[string]string{"c1": stateRunning},
+			wantErr: true,
+		},
+		{
+			name:    "no containers",
+			agent:   "fluent-bit",
+			reload:  reloadRestart,
+			states:  map[string]string{"c1": stateRunning},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+
+			c := fakeEngine(t, tt.states, tt.failing, &calls)
+
+			viper.Set(keys.ContainerReload, tt.reload)
+
+			reloaded, err := reloadContainers(context.Background(), c, tt.agent)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reloadContainers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if reloaded != tt.wantReloaded {
+				t.Fatalf("reloadContainers() reloaded = %d, want %d", reloaded, tt.wantReloaded)
+			}
+
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Fatalf("engine calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestEngineStatus(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(keys.ContainerLabel, defaults.ContainerLabel)
+	defer viper.Set(keys.ContainerLabel, "")
+
+	tests := []struct {
+		states        map[string]string
+		wantErr       error
+		name          string
+		agent         string
+		wantStatus    string
+		wantSubStatus string
+	}{
+		{
+			name:          "running",
+			agent:         "telegraf",
+			states:        map[string]string{"c1": stateRunning, "c2": stateHealthy},
+			wantStatus:    statusRunning,
+			wantSubStatus: "2/2 containers running",
+		},
+		{
+			name:          "unhealthy",
+			agent:         "telegraf",
+			states:        map[string]string{"c1": stateHealthy, "c2": stateUnhealthy},
+			wantStatus:    statusFailed,
+			wantSubStatus: "1/2 containers running",
+		},
+		{
+			name:          "stopped",
+			agent:         "telegraf",
+			states:        map[string]string{"c1": stateRunning, "c2": stateStopped},
+			wantStatus:    statusStopped,
+			wantSubStatus: "1/2 containers running",
+		},
+		{
+			name:          "crashed",
+			agent:         "telegraf",
+			states:        map[string]string{"c1": stateStopped, "c2": stateCrashed},
+			wantStatus:    statusFailed,
+			wantSubStatus: "0/2 containers running",
+		},
+		{
+			name:    "no containers",
+			agent:   "fluent-bit",
+			states:  map[string]string{"c1": stateRunning},
+			wantErr: errNoContainers,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+
+			c := fakeEngine(t, tt.states, nil, &calls)
+
+			result, err := engineStatus(context.Background(), c, tt.agent)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("engineStatus() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if result.Status != tt.wantStatus || result.StatusData.SubStatus != tt.wantSubStatus {
+				t.Fatalf("engineStatus() = %s (%s), want %s (%s)",
+					result.Status, result.StatusData.SubStatus, tt.wantStatus, tt.wantSubStatus)
+			}
+
+			if result.StatusData.RawResult == "" {
+				t.Fatal("engineStatus() no raw result")
+			}
+		})
+	}
+}
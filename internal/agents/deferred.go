@@ -0,0 +1,373 @@
+package agents
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/config/defaults"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/maintenance"
+	"github.com/circonus/agent-manager/internal/metrics"
+	"github.com/circonus/agent-manager/internal/splay"
+	"github.com/circonus/agent-manager/internal/window"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// actions which would change the host are deferred while it is in maintenance, and
+// config actions outside a change window. They are kept on disk (so they survive a
+// restart) and applied, in the order received, once maintenance ends or the next
+// window opens.
+
+// deferral reasons.
+const (
+	DeferMaintenance = "maintenance"
+	DeferWindow      = "window"
+)
+
+// DeferredAction is an action waiting to be applied.
+type DeferredAction struct {
+	Received time.Time `json:"received" yaml:"received"`
+	Reason   string    `json:"reason"   yaml:"reason"`
+	Action   Action    `json:"action"   yaml:"action"`
+}
+
+type deferredQueue struct {
+	sync.Mutex
+}
+
+var deferred = &deferredQueue{}
+
+func deferredFile() string {
+	if f := viper.GetString(keys.DeferredFile); f != "" {
+		return f
+	}
+
+	return defaults.DeferredFile
+}
+
+// DeferredActions returns the actions waiting to be applied, oldest first.
+func DeferredActions() ([]DeferredAction, error) {
+	deferred.Lock()
+	defer deferred.Unlock()
+
+	return deferred.load()
+}
+
+func (q *deferredQueue) load() ([]DeferredAction, error) {
+	data, err := os.ReadFile(deferredFile())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []DeferredAction{}, nil
+		}
+
+		return nil, fmt.Errorf("reading deferred actions: %w", err)
+	}
+
+	var items []DeferredAction
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("parsing deferred actions: %w", err)
+	}
+
+	return items, nil
+}
+
+// save writes the queue atomically, it contains config contents so is only readable by the owner.
+func (q *deferredQueue) save(items []DeferredAction) error {
+	file := deferredFile()
+
+	counts := map[string]int{DeferMaintenance: 0, DeferWindow: 0}
+	for _, item := range items {
+		counts[item.Reason]++
+	}
+
+	for reason, n := range counts {
+		metrics.DeferredActions(reason, n)
+	}
+
+	if len(items) == 0 {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("removing deferred actions: %w", err)
+		}
+
+		return nil
+	}
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		return fmt.Errorf("marshal deferred actions: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return fmt.Errorf("creating deferred actions: %w", err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("writing deferred actions: %w", err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("syncing deferred actions: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing deferred actions: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("saving deferred actions: %w", err)
+	}
+
+	return nil
+}
+
+func (q *deferredQueue) add(item DeferredAction) error {
+	q.Lock()
+	defer q.Unlock()
+
+	items, err := q.load()
+	if err != nil {
+		return err
+	}
+
+	return q.save(append(items, item))
+}
+
+// at returns the deferred action at i, nil if there is none.
+func (q *deferredQueue) at(i int) (*DeferredAction, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	items, err := q.load()
+	if err != nil || i >= len(items) {
+		return nil, err
+	}
+
+	return &items[i], nil
+}
+
+// update replaces the deferred action at i.
+func (q *deferredQueue) update(i int, item DeferredAction) error {
+	q.Lock()
+	defer q.Unlock()
+
+	items, err := q.load()
+	if err != nil || i >= len(items) {
+		return err
+	}
+
+	items[i] = item
+
+	return q.save(items)
+}
+
+// remove drops the deferred action at i, once it has been applied.
+func (q *deferredQueue) remove(i int) error {
+	q.Lock()
+	defer q.Unlock()
+
+	items, err := q.load()
+	if err != nil || i >= len(items) {
+		return err
+	}
+
+	return q.save(append(items[:i], items[i+1:]...))
+}
+
+// deferral returns the parts of the action which can be performed now and those
+// which must be deferred, with the reason. While the host is in maintenance changes
+// are deferred, outside a change window config installs are deferred.
+func deferral(action Action) (now, later *Action, reason string) {
+	if maintenance.Active() {
+		now, later = splitDeferrable(action)
+
+		return now, later, DeferMaintenance
+	}
+
+	if action.Type == CONFIG && !window.Current(time.Now()).Open {
+		return nil, &action, DeferWindow
+	}
+
+	return &action, nil, ""
+}
+
+// splitDeferrable splits the action into the parts which can be performed while the
+// host is in maintenance (e.g. status, version) and the parts which change the host
+// (config installs, start/stop/restart/reload, packages). Either may be nil.
+func splitDeferrable(action Action) (now, later *Action) {
+	switch action.Type {
+	case CONFIG:
+		return nil, &action
+	case COMMAND:
+		run := action
+		run.Commands = nil
+		deferrable := action
+		deferrable.Commands = nil
+
+		for _, c := range action.Commands {
+			switch c.Command {
+			case START, STOP, RESTART, RELOAD, INSTALL, UPGRADE, UNINSTALL, SELFUPDATE:
+				deferrable.Commands = append(deferrable.Commands, c)
+			default:
+				run.Commands = append(run.Commands, c)
+			}
+		}
+
+		if len(run.Commands) > 0 {
+			now = &run
+		}
+
+		if len(deferrable.Commands) > 0 {
+			later = &deferrable
+		}
+
+		return now, later
+	default:
+		return &action, nil
+	}
+}
+
+// deferAction queues the action and reports its configs/commands as deferred. If it
+// cannot be queued it is reported as an error, it is not performed.
+func deferAction(ctx context.Context, action Action, reason string) {
+	err := deferred.add(DeferredAction{
+		Received: time.Now().UTC(),
+		Reason:   reason,
+		Action:   action,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("action_id", action.ID).Msg("deferring action, not performed")
+
+		metrics.ActionResult(action.Type, err)
+
+		reportDeferred(ctx, action, STATUS_ERROR, "unable to defer ("+deferredInfo(reason)+"): "+err.Error())
+
+		return
+	}
+
+	log.Info().Str("action_id", action.ID).Str("type", action.Type).Str("reason", reason).Msg("action deferred")
+
+	metrics.Action(action.Type, STATUS_DEFERRED)
+
+	reportDeferred(ctx, action, deferredStatus(reason), deferredInfo(reason))
+}
+
+// deferredStatus is the status reported for actions deferred for reason.
+func deferredStatus(reason string) string {
+	if reason == DeferWindow {
+		return STATUS_PENDING_WINDOW
+	}
+
+	return STATUS_DEFERRED
+}
+
+func deferredInfo(reason string) string {
+	switch reason {
+	case DeferWindow:
+		if next := window.Current(time.Now()).Next; !next.IsZero() {
+			return "outside change window, next opens " + next.UTC().Format(time.RFC3339)
+		}
+
+		return "outside change window"
+	default:
+		return "deferred, host in " + reason
+	}
+}
+
+func reportDeferred(ctx context.Context, action Action, status, info string) {
+	for _, configs := range action.Configs {
+		for _, config := range configs {
+			r := ConfigResult{ID: config.ID, Status: status, Info: info}
+			if err := sendConfigResult(ctx, r); err != nil {
+				log.Error().Err(err).Msg("config result")
+			}
+		}
+	}
+
+	for _, command := range action.Commands {
+		if command.ID == "" {
+			continue
+		}
+
+		r := CommandResult{
+			ID:     command.ID,
+			Status: status,
+			CommandData: CommandData{
+				Output:   base64.StdEncoding.EncodeToString([]byte(info)),
+				ExitCode: -1,
+			},
+		}
+		if err := sendCommandResult(ctx, r); err != nil {
+			log.Error().Err(err).Msg("command result")
+		}
+	}
+}
+
+// applyDeferred performs the deferred actions which are no longer blocked, in the
+// order received. Actions still blocked stay queued, if the reason changed (e.g.
+// maintenance ended outside a change window) they are reported again.
+func applyDeferred(ctx context.Context) error {
+	splayed := false
+
+	for i := 0; ; {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		item, err := deferred.at(i)
+		if err != nil || item == nil {
+			return err
+		}
+
+		if _, later, reason := deferral(item.Action); later != nil {
+			if reason != item.Reason {
+				item.Reason = reason
+				if err := deferred.update(i, *item); err != nil {
+					return err
+				}
+
+				reportDeferred(ctx, item.Action, deferredStatus(reason), deferredInfo(reason))
+			}
+
+			i++
+
+			continue
+		}
+
+		if !splayed {
+			if err := splay.Wait(ctx); err != nil {
+				return fmt.Errorf("splay, deferred actions not applied: %w", err)
+			}
+
+			splayed = true
+		}
+
+		log.Info().
+			Str("action_id", item.Action.ID).
+			Str("type", item.Action.Type).
+			Str("reason", item.Reason).
+			Time("received", item.Received).
+			Msg("applying deferred action")
+
+		// removed first, so an action which fails (or crashes the manager) is not applied over and over
+		if err := deferred.remove(i); err != nil {
+			return err
+		}
+
+		runAction(ctx, item.Action)
+	}
+}
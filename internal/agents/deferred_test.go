@@ -0,0 +1,251 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/maintenance"
+	"github.com/spf13/viper"
+)
+
+func TestSplitDeferrable(t *testing.T) {
+	tests := []struct {
+		name      string
+		action    Action
+		wantNow   int // commands run now (-1, none)
+		wantLater int // commands deferred (-1, none)
+	}{
+		{
+			name:      "config",
+			action:    Action{Type: CONFIG, Configs: map[string][]Config{"foo": {{ID: "1"}}}},
+			wantNow:   -1,
+			wantLater: 0,
+		},
+		{
+			name: "commands",
+			action: Action{Type: COMMAND, Commands: []Command{
+				{Agent: "foo", Command: STATUS},
+				{Agent: "foo", Command: RESTART},
+				{Agent: "foo", Command: VERSION},
+				{Agent: "foo", Command: STOP},
+				{Agent: "foo", Command: UPGRADE},
+			}},
+			wantNow:   2,
+			wantLater: 3,
+		},
+		{
+			name:      "status only",
+			action:    Action{Type: COMMAND, Commands: []Command{{Agent: "foo", Command: STATUS}}},
+			wantNow:   1,
+			wantLater: -1,
+		},
+		{
+			name:      "unknown",
+			action:    Action{Type: "foo"},
+			wantNow:   0,
+			wantLater: -1,
+		},
+	}
+
+	count := func(a *Action) int {
+		if a == nil {
+			return -1
+		}
+
+		return len(a.Commands)
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			now, later := splitDeferrable(tt.action)
+
+			if n := count(now); n != tt.wantNow {
+				t.Errorf("now = %d, want %d", n, tt.wantNow)
+			}
+
+			if n := count(later); n != tt.wantLater {
+				t.Errorf("later = %d, want %d", n, tt.wantLater)
+			}
+		})
+	}
+}
+
+func TestDeferredActions(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		results []ConfigResult
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		var cr ConfigResult
+		if err := json.Unmarshal(body, &cr); err == nil {
+			mu.Lock()
+			results = append(results, cr)
+			mu.Unlock()
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+
+	viper.Set(keys.APIURL, ts.URL)
+	viper.Set(keys.APIToken, testAuthToken)
+	viper.Set(keys.DeferredFile, filepath.Join(dir, "deferred.json"))
+	viper.Set(keys.MaintenanceFile, filepath.Join(dir, "maintenance"))
+
+	defer func() {
+		viper.Set(keys.DeferredFile, "")
+		viper.Set(keys.MaintenanceFile, "")
+	}()
+
+	ctx := context.Background()
+
+	if _, err := maintenance.Enable(ctx, time.Time{}, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	performAction(ctx, Action{ID: "a1", Type: CONFIG, Configs: map[string][]Config{"foo": {{ID: "c1", Path: filepath.Join(dir, "foo.conf")}}}})
+	performAction(ctx, Action{ID: "a2", Type: "test"})
+	performAction(ctx, Action{ID: "a3", Type: CONFIG, Configs: map[string][]Config{"foo": {{ID: "c2", Path: filepath.Join(dir, "foo.conf")}}}})
+
+	items, err := DeferredActions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 2 || items[0].Action.ID != "a1" || items[1].Action.ID != "a3" {
+		t.Fatalf("unexpected deferred actions %+v", items)
+	}
+
+	mu.Lock()
+	if len(results) != 2 || results[0].Status != STATUS_DEFERRED || results[1].ID != "c2" {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	mu.Unlock()
+
+	// still in maintenance, nothing applied
+	if err := applyDeferred(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if items, _ := DeferredActions(); len(items) != 2 {
+		t.Fatalf("expected 2 deferred actions, got %d", len(items))
+	}
+
+	if err := maintenance.Disable(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// applying, in order, removes them from the queue
+	if err := applyDeferred(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if items, _ := DeferredActions(); len(items) != 0 {
+		t.Fatalf("expected no deferred actions, got %d", len(items))
+	}
+}
+
+func TestDeferredWindow(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		statuses []string
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		var cr ConfigResult
+		if err := json.Unmarshal(body, &cr); err == nil {
+			mu.Lock()
+			statuses = append(statuses, cr.Status)
+			mu.Unlock()
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+
+	viper.Set(keys.APIURL, ts.URL)
+	viper.Set(keys.APIToken, testAuthToken)
+	viper.Set(keys.DeferredFile, filepath.Join(dir, "deferred.json"))
+	viper.Set(keys.MaintenanceFile, filepath.Join(dir, "maintenance"))
+
+	closed := []any{map[string]any{"schedule": "0 0 1 1 *", "duration": "1m"}}
+	if time.Now().Month() == time.January && time.Now().Day() == 1 {
+		closed = []any{map[string]any{"schedule": "0 0 1 7 *", "duration": "1m"}}
+	}
+
+	viper.Set(keys.ChangeWindows, closed)
+
+	defer func() {
+		viper.Set(keys.DeferredFile, "")
+		viper.Set(keys.MaintenanceFile, "")
+		viper.Set(keys.ChangeWindows, nil)
+	}()
+
+	ctx := context.Background()
+
+	performAction(ctx, Action{ID: "a1", Type: CONFIG, Configs: map[string][]Config{"foo": {{ID: "c1", Path: filepath.Join(dir, "foo.conf")}}}})
+
+	items, err := DeferredActions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 1 || items[0].Reason != DeferWindow {
+		t.Fatalf("unexpected deferred actions %+v", items)
+	}
+
+	// maintenance on, then off while the window is still closed
+	if _, err := maintenance.Enable(ctx, time.Time{}, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	performAction(ctx, Action{ID: "a2", Type: COMMAND, Commands: []Command{{ID: "r1", Agent: "foo", Command: RESTART}}})
+
+	if err := maintenance.Disable(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// the restart is applied, the config waits for the window
+	if err := applyDeferred(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if items, _ := DeferredActions(); len(items) != 1 || items[0].Action.ID != "a1" {
+		t.Fatalf("expected a1 deferred, got %+v", items)
+	}
+
+	viper.Set(keys.ChangeWindows, []any{map[string]any{"schedule": "* * * * *", "duration": "1h"}})
+
+	if err := applyDeferred(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if items, _ := DeferredActions(); len(items) != 0 {
+		t.Fatalf("expected no deferred actions, got %d", len(items))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(statuses) == 0 || statuses[0] != STATUS_PENDING_WINDOW {
+		t.Fatalf("expected %s reported first, got %v", STATUS_PENDING_WINDOW, statuses)
+	}
+}
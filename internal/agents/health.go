@@ -0,0 +1,277 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/units"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/inventory"
+	"github.com/rs/zerolog/log"
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Process level health checks, independent of the service manager's view of the agent.
+
+const (
+	defaultHealthTimeout = 5 * time.Second
+	cpuSampleInterval    = 1 * time.Second
+)
+
+type HealthResult struct {
+	ConfigError string              `json:"config_error,omitempty"` // invalid health check definition, not counted as unhealthy
+	Checks      []HealthCheckResult `json:"checks"`
+	Healthy     bool                `json:"healthy"`
+}
+
+type HealthCheckResult struct {
+	Name string `json:"name"`
+	Info string `json:"info,omitempty"`
+	OK   bool   `json:"ok"`
+}
+
+// localHealthChecks returns the health check definitions in the manager configuration
+// (health_checks.<agent_type>), by agent type. Invalid definitions are logged and ignored.
+func localHealthChecks() map[string]*inventory.HealthCheck {
+	checks := make(map[string]*inventory.HealthCheck)
+
+	for agentType, local := range viper.GetStringMap(keys.HealthChecks) {
+		var hc inventory.HealthCheck
+
+		data, err := yaml.Marshal(local)
+		if err == nil {
+			err = yaml.Unmarshal(data, &hc)
+		}
+
+		if err == nil {
+			err = hc.Validate()
+		}
+
+		if err != nil {
+			log.Warn().Err(err).Str("agent", agentType).Msg("invalid local health check definition, ignoring")
+
+			continue
+		}
+
+		checks[agentType] = &hc
+	}
+
+	return checks
+}
+
+// healthCheckFor returns the health check for the agent type, a local definition
+// overrides the inventory.
+func healthCheckFor(local map[string]*inventory.HealthCheck, agentType string, agent inventory.Agent) *inventory.HealthCheck {
+	if hc, ok := local[agentType]; ok {
+		return hc
+	}
+
+	return agent.HealthCheck
+}
+
+// checkHealth runs all of the defined checks. Definitions are validated when loaded
+// (see inventory.HealthCheck.Validate), a setting which still cannot be parsed is
+// reported as a config error.
+func checkHealth(ctx context.Context, hc *inventory.HealthCheck) *HealthResult {
+	if hc == nil {
+		return nil
+	}
+
+	result := &HealthResult{Healthy: true}
+
+	var configErrs []string
+
+	timeout := defaultHealthTimeout
+
+	if hc.Timeout != "" {
+		d, err := time.ParseDuration(hc.Timeout)
+		if err != nil {
+			configErrs = append(configErrs, fmt.Sprintf("parsing timeout (%s): %s", hc.Timeout, err))
+		} else {
+			timeout = d
+		}
+	}
+
+	add := func(name string, err error) {
+		r := HealthCheckResult{Name: name, OK: err == nil}
+		if err != nil {
+			r.Info = err.Error()
+			result.Healthy = false
+		}
+
+		result.Checks = append(result.Checks, r)
+	}
+
+	var procs []*process.Process
+
+	if hc.PIDFile != "" {
+		p, err := pidFileProcess(ctx, hc.PIDFile)
+		add("pid_file", err)
+
+		if p != nil {
+			procs = append(procs, p)
+		}
+	}
+
+	if hc.Process != "" {
+		pp, err := namedProcesses(ctx, hc.Process)
+		add("process", err)
+
+		if hc.PIDFile == "" {
+			procs = append(procs, pp...)
+		}
+	}
+
+	if hc.TCP != "" {
+		add("tcp", tcpProbe(ctx, hc.TCP, timeout))
+	}
+
+	if hc.HTTP != "" {
+		add("http", httpProbe(ctx, hc.HTTP, timeout))
+	}
+
+	if hc.MaxCPU > 0 && len(procs) > 0 {
+		add("cpu", cpuThreshold(ctx, procs, hc.MaxCPU))
+	}
+
+	if hc.MaxRSS != "" {
+		limit, err := units.ParseBase2Bytes(hc.MaxRSS)
+
+		switch {
+		case err != nil:
+			configErrs = append(configErrs, fmt.Sprintf("parsing max rss (%s): %s", hc.MaxRSS, err))
+		case len(procs) > 0:
+			add("rss", rssThreshold(ctx, procs, limit))
+		}
+	}
+
+	result.ConfigError = strings.Join(configErrs, "; ")
+
+	return result
+}
+
+func pidFileProcess(ctx context.Context, pidFile string) (*process.Process, error) {
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading pid file: %w", err)
+	}
+
+	pid, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("parsing pid file: %w", err)
+	}
+
+	p, err := process.NewProcessWithContext(ctx, int32(pid))
+	if err != nil {
+		return nil, fmt.Errorf("pid %d not running: %w", pid, err)
+	}
+
+	return p, nil
+}
+
+func namedProcesses(ctx context.Context, name string) ([]*process.Process, error) {
+	procs, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing processes: %w", err)
+	}
+
+	found := make([]*process.Process, 0, 1)
+
+	for _, p := range procs {
+		pname, err := p.NameWithContext(ctx)
+		if err != nil {
+			continue
+		}
+
+		if pname == name || pname == filepath.Base(name) {
+			found = append(found, p)
+		}
+	}
+
+	if len(found) == 0 {
+		return nil, fmt.Errorf("process %s not running", name)
+	}
+
+	return found, nil
+}
+
+func tcpProbe(ctx context.Context, addr string, timeout time.Duration) error {
+	d := net.Dialer{Timeout: timeout}
+
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+func httpProbe(ctx context.Context, rawURL string, timeout time.Duration) error {
+	c, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(c, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("non-2xx response -- status: %s", resp.Status)
+	}
+
+	return nil
+}
+
+func cpuThreshold(ctx context.Context, procs []*process.Process, maxCPU float64) error {
+	total := 0.0
+
+	for _, p := range procs {
+		pct, err := p.PercentWithContext(ctx, cpuSampleInterval)
+		if err != nil {
+			continue
+		}
+
+		total += pct
+	}
+
+	if total > maxCPU {
+		return fmt.Errorf("cpu %.1f%% exceeds %.1f%%", total, maxCPU)
+	}
+
+	return nil
+}
+
+func rssThreshold(ctx context.Context, procs []*process.Process, limit units.Base2Bytes) error {
+	var total uint64
+
+	for _, p := range procs {
+		mi, err := p.MemoryInfoWithContext(ctx)
+		if err != nil {
+			continue
+		}
+
+		total += mi.RSS
+	}
+
+	if total > uint64(limit) {
+		return fmt.Errorf("rss %s exceeds %s", units.Base2Bytes(total).String(), limit.String())
+	}
+
+	return nil
+}
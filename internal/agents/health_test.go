@@ -0,0 +1,121 @@
+package agents
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/circonus/agent-manager/internal/inventory"
+)
+
+func TestCheckHealth(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer healthy.Close()
+
+	wedged := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "error", http.StatusInternalServerError)
+	}))
+	defer wedged.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closedAddr := l.Addr().String()
+	l.Close()
+
+	pidFile := filepath.Join(t.TempDir(), "test.pid")
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		hc            *inventory.HealthCheck
+		name          string
+		wantHealthy   bool
+		wantConfigErr bool
+	}{
+		{
+			name:        "http ok",
+			hc:          &inventory.HealthCheck{HTTP: healthy.URL},
+			wantHealthy: true,
+		},
+		{
+			name:        "http wedged",
+			hc:          &inventory.HealthCheck{HTTP: wedged.URL},
+			wantHealthy: false,
+		},
+		{
+			name:        "tcp ok",
+			hc:          &inventory.HealthCheck{TCP: healthy.Listener.Addr().String()},
+			wantHealthy: true,
+		},
+		{
+			name:        "tcp closed",
+			hc:          &inventory.HealthCheck{TCP: closedAddr, Timeout: "1s"},
+			wantHealthy: false,
+		},
+		{
+			name:        "pid file",
+			hc:          &inventory.HealthCheck{PIDFile: pidFile, MaxRSS: "64GiB"},
+			wantHealthy: true,
+		},
+		{
+			name:        "pid file rss exceeded",
+			hc:          &inventory.HealthCheck{PIDFile: pidFile, MaxRSS: "1KiB"},
+			wantHealthy: false,
+		},
+		{
+			name:          "invalid max rss",
+			hc:            &inventory.HealthCheck{PIDFile: pidFile, MaxRSS: "lots"},
+			wantHealthy:   true,
+			wantConfigErr: true,
+		},
+		{
+			name:          "invalid timeout",
+			hc:            &inventory.HealthCheck{HTTP: healthy.URL, Timeout: "soon"},
+			wantHealthy:   true,
+			wantConfigErr: true,
+		},
+		{
+			name:        "missing pid file",
+			hc:          &inventory.HealthCheck{PIDFile: filepath.Join(t.TempDir(), "missing.pid")},
+			wantHealthy: false,
+		},
+		{
+			name:        "process not running",
+			hc:          &inventory.HealthCheck{Process: "cam-test-no-such-process"},
+			wantHealthy: false,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := checkHealth(context.Background(), tt.hc)
+			if got.Healthy != tt.wantHealthy {
+				t.Fatalf("checkHealth() healthy = %v, want %v (%#v)", got.Healthy, tt.wantHealthy, got.Checks)
+			}
+
+			if (got.ConfigError != "") != tt.wantConfigErr {
+				t.Fatalf("checkHealth() config error = %q, want error %v", got.ConfigError, tt.wantConfigErr)
+			}
+
+			if isBadStatus(StatusResult{Status: statusRunning, StatusData: StatusData{Health: got}}) == tt.wantHealthy {
+				t.Fatalf("isBadStatus() = %v, healthy %v", !tt.wantHealthy, tt.wantHealthy)
+			}
+		})
+	}
+
+	if checkHealth(context.Background(), nil) != nil {
+		t.Fatal("checkHealth(nil) expected nil result")
+	}
+}
@@ -0,0 +1,346 @@
+package agents
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/audit"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/maintenance"
+	"github.com/circonus/agent-manager/internal/metrics"
+	"github.com/circonus/agent-manager/internal/tracing"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Opt-in auto-remediation, restart agents which are repeatedly seen in a bad
+// state. Policies are defined per agent type in the manager configuration
+// (remediation.<agent_type>), see etc/circonus-am.yaml.
+
+type remediationSettings struct {
+	Backoff     string `yaml:"backoff"`
+	MaxBackoff  string `yaml:"max_backoff"`
+	Window      string `yaml:"window"`
+	Cooldown    string `yaml:"cooldown"`
+	Threshold   int    `yaml:"threshold"`
+	MaxAttempts int    `yaml:"max_attempts"`
+	Enabled     bool   `yaml:"enabled"`
+}
+
+type remediationPolicy struct {
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	window      time.Duration
+	cooldown    time.Duration
+	threshold   int
+	maxAttempts int
+}
+
+type remediationState struct {
+	nextAttempt   time.Time
+	cooldownUntil time.Time
+	attempts      []time.Time // restarts within the window
+	badPolls      int
+	consecutive   int // restarts without a good poll, drives backoff
+}
+
+type remediationDecision int
+
+const (
+	remediateNone remediationDecision = iota
+	remediateRestart
+	remediateSuppress
+)
+
+type remediator struct {
+	states map[string]*remediationState
+	sync.Mutex
+}
+
+func newRemediator() *remediator {
+	return &remediator{states: make(map[string]*remediationState)}
+}
+
+// remediationPolicyFor returns the policy for the agent type, false if not enabled.
+func remediationPolicyFor(agentType string) (remediationPolicy, bool) {
+	raw, ok := viper.GetStringMap(keys.Remediation)[agentType]
+	if !ok {
+		return remediationPolicy{}, false
+	}
+
+	var rs remediationSettings
+
+	data, err := yaml.Marshal(raw)
+	if err == nil {
+		err = yaml.Unmarshal(data, &rs)
+	}
+
+	if err != nil {
+		log.Warn().Err(err).Str("agent", agentType).Msg("invalid remediation policy, ignoring")
+
+		return remediationPolicy{}, false
+	}
+
+	if !rs.Enabled {
+		return remediationPolicy{}, false
+	}
+
+	pol := remediationPolicy{
+		threshold:   rs.Threshold,
+		maxAttempts: rs.MaxAttempts,
+		backoff:     30 * time.Second,
+		maxBackoff:  10 * time.Minute,
+		window:      time.Hour,
+		cooldown:    30 * time.Minute,
+	}
+
+	if pol.threshold <= 0 {
+		pol.threshold = 3
+	}
+
+	if pol.maxAttempts <= 0 {
+		pol.maxAttempts = 3
+	}
+
+	for _, d := range []struct {
+		dst *time.Duration
+		val string
+	}{
+		{&pol.backoff, rs.Backoff},
+		{&pol.maxBackoff, rs.MaxBackoff},
+		{&pol.window, rs.Window},
+		{&pol.cooldown, rs.Cooldown},
+	} {
+		if d.val == "" {
+			continue
+		}
+
+		v, err := time.ParseDuration(d.val)
+		if err != nil {
+			log.Warn().Err(err).Str("agent", agentType).Str("duration", d.val).Msg("invalid remediation duration, using default")
+
+			continue
+		}
+
+		*d.dst = v
+	}
+
+	return pol, true
+}
+
+// next records a poll and decides whether the agent should be restarted.
+func (s *remediationState) next(now time.Time, bad bool, pol remediationPolicy) remediationDecision {
+	if !bad {
+		s.badPolls = 0
+		s.consecutive = 0
+		s.nextAttempt = time.Time{}
+
+		return remediateNone
+	}
+
+	s.badPolls++
+
+	if s.badPolls < pol.threshold || now.Before(s.cooldownUntil) || now.Before(s.nextAttempt) {
+		return remediateNone
+	}
+
+	attempts := s.attempts[:0]
+
+	for _, a := range s.attempts {
+		if now.Sub(a) < pol.window {
+			attempts = append(attempts, a)
+		}
+	}
+
+	s.attempts = attempts
+
+	if len(s.attempts) >= pol.maxAttempts {
+		s.cooldownUntil = now.Add(pol.cooldown)
+		s.attempts = nil
+		s.consecutive = 0
+		s.nextAttempt = time.Time{}
+
+		return remediateSuppress
+	}
+
+	backoff := pol.backoff << s.consecutive
+	if backoff > pol.maxBackoff || backoff <= 0 {
+		backoff = pol.maxBackoff
+	}
+
+	s.attempts = append(s.attempts, now)
+	s.consecutive++
+	s.nextAttempt = now.Add(backoff)
+
+	return remediateRestart
+}
+
+// isBadStatus reports whether the status indicates the agent needs attention. An invalid
+// health check definition (HealthResult.ConfigError) is reported, restarting the agent
+// would not fix it.
+func isBadStatus(r StatusResult) bool {
+	switch r.Status {
+	case statusFailed, statusStopped:
+		return true
+	}
+
+	if r.StatusData.Health != nil && !r.StatusData.Health.Healthy {
+		return true
+	}
+
+	return false
+}
+
+// observe applies the remediation policy, if any, for the agent based on its latest status.
+func (r *remediator) observe(ctx context.Context, a statusAgent, result StatusResult) {
+	pol, ok := remediationPolicyFor(a.AgentType)
+	if !ok {
+		return
+	}
+
+	r.Lock()
+
+	s, ok := r.states[a.AgentID]
+	if !ok {
+		s = &remediationState{}
+		r.states[a.AgentID] = s
+	}
+
+	decision := s.next(time.Now(), isBadStatus(result), pol)
+	attempt := len(s.attempts)
+
+	r.Unlock()
+
+	switch decision {
+	case remediateNone:
+		return
+	case remediateSuppress:
+		log.Warn().
+			Str("agent", a.AgentType).
+			Str("status", result.Status).
+			Str("cooldown", pol.cooldown.String()).
+			Msg("remediation max attempts reached, cooling down")
+
+		r.report(ctx, a.AgentID, RemediationEvent{
+			Type:   "remediation",
+			Action: "suppressed",
+			Status: result.Status,
+			Reason: fmt.Sprintf("max attempts (%d) per %s reached", pol.maxAttempts, pol.window),
+		})
+	case remediateRestart:
+		if maintenance.Active() {
+			log.Warn().Str("agent", a.AgentType).Str("status", result.Status).Msg("remediation, host in maintenance, not restarting agent")
+
+			return
+		}
+
+		if a.Restart == "" {
+			log.Warn().Str("agent", a.AgentType).Msg("remediation, no restart command for agent")
+
+			return
+		}
+
+		log.Warn().
+			Str("agent", a.AgentType).
+			Str("status", result.Status).
+			Int("attempt", attempt).
+			Msg("remediation, restarting agent")
+
+		output, code, err := executeCommand(audit.WithSource(ctx, audit.SourceRemediation), a.Restart)
+		metrics.Command(a.AgentType, RESTART, code)
+
+		ev := RemediationEvent{
+			Type:     "remediation",
+			Action:   RESTART,
+			Status:   result.Status,
+			Reason:   fmt.Sprintf("%d consecutive bad polls", pol.threshold),
+			Attempt:  attempt,
+			ExitCode: code,
+		}
+
+		if err != nil {
+			ev.Error = err.Error()
+		}
+
+		if len(output) > 0 {
+			ev.Output = base64.StdEncoding.EncodeToString(output)
+		}
+
+		r.report(ctx, a.AgentID, ev)
+	}
+}
+
+type RemediationEvent struct {
+	Type     string `json:"type"`
+	Action   string `json:"action"`
+	Status   string `json:"status"`
+	Reason   string `json:"reason"`
+	Error    string `json:"error,omitempty"`
+	Output   string `json:"output,omitempty"`
+	Attempt  int    `json:"attempt,omitempty"`
+	ExitCode int    `json:"exit_code"`
+}
+
+func (r *remediator) report(ctx context.Context, agentID string, ev RemediationEvent) {
+	if err := sendAgentEvent(ctx, agentID, ev); err != nil {
+		log.Warn().Err(err).Str("agent_id", agentID).Msg("reporting remediation event")
+	}
+}
+
+func sendAgentEvent(ctx context.Context, agentID string, ev RemediationEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	token := viper.GetString(keys.APIToken)
+	if token == "" {
+		return fmt.Errorf("invalid api token (empty)")
+	}
+
+	reqURL, err := url.JoinPath(viper.GetString(keys.APIURL), "agent", agentID, "event")
+	if err != nil {
+		return fmt.Errorf("req url: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Add("Authorization", token)
+	tracing.Inject(ctx, req.Header)
+
+	client := &http.Client{}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		metrics.APIError("agent_event", 0)
+
+		return fmt.Errorf("calling event endpoint: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		metrics.APIError("agent_event", resp.StatusCode)
+
+		return fmt.Errorf("non-200 response -- status: %s, body: %s", resp.Status, string(body))
+	}
+
+	return nil
+}
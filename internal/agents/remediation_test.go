@@ -0,0 +1,128 @@
+package agents
+
+import (
+	"testing"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/spf13/viper"
+)
+
+func TestRemediationState_next(t *testing.T) {
+	pol := remediationPolicy{
+		threshold:   2,
+		maxAttempts: 2,
+		backoff:     time.Minute,
+		maxBackoff:  3 * time.Minute,
+		window:      time.Hour,
+		cooldown:    30 * time.Minute,
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type poll struct {
+		offset time.Duration
+		bad    bool
+		want   remediationDecision
+	}
+
+	tests := []struct {
+		name  string
+		polls []poll
+	}{
+		{
+			name: "healthy",
+			polls: []poll{
+				{0, false, remediateNone},
+				{time.Minute, false, remediateNone},
+			},
+		},
+		{
+			name: "threshold",
+			polls: []poll{
+				{0, true, remediateNone},
+				{time.Minute, true, remediateRestart},
+			},
+		},
+		{
+			name: "good poll resets threshold",
+			polls: []poll{
+				{0, true, remediateNone},
+				{time.Minute, false, remediateNone},
+				{2 * time.Minute, true, remediateNone},
+				{3 * time.Minute, true, remediateRestart},
+			},
+		},
+		{
+			name: "backoff",
+			polls: []poll{
+				{0, true, remediateNone},
+				{time.Minute, true, remediateRestart},
+				{90 * time.Second, true, remediateNone},    // within 1m backoff
+				{2 * time.Minute, true, remediateRestart},  // backoff now 2m
+				{3 * time.Minute, true, remediateNone},     // within 2m backoff
+				{4 * time.Minute, true, remediateSuppress}, // max attempts per window
+				{5 * time.Minute, true, remediateNone},     // cooldown
+				{34 * time.Minute, true, remediateRestart}, // cooldown expired
+			},
+		},
+		{
+			name: "window",
+			polls: []poll{
+				{0, true, remediateNone},
+				{time.Minute, true, remediateRestart},
+				{2 * time.Minute, false, remediateNone},
+				{3 * time.Minute, true, remediateNone},
+				{4 * time.Minute, true, remediateRestart},
+				{5 * time.Minute, false, remediateNone},
+				{62 * time.Minute, true, remediateNone},
+				{63 * time.Minute, true, remediateRestart}, // first attempt aged out of window
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := &remediationState{}
+
+			for i, p := range tt.polls {
+				if got := s.next(start.Add(p.offset), p.bad, pol); got != p.want {
+					t.Fatalf("poll %d (%s) next() = %v, want %v", i, p.offset, got, p.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRemediationPolicyFor(t *testing.T) {
+	viper.Set(keys.Remediation, map[string]any{
+		"telegraf": map[string]any{
+			"enabled":      true,
+			"threshold":    5,
+			"backoff":      "10s",
+			"max_attempts": 2,
+		},
+		"fluent-bit": map[string]any{
+			"enabled": false,
+		},
+	})
+	defer viper.Set(keys.Remediation, nil)
+
+	pol, ok := remediationPolicyFor("telegraf")
+	if !ok {
+		t.Fatal("expected telegraf policy")
+	}
+
+	if pol.threshold != 5 || pol.maxAttempts != 2 || pol.backoff != 10*time.Second || pol.cooldown != 30*time.Minute {
+		t.Fatalf("unexpected policy %+v", pol)
+	}
+
+	if _, ok := remediationPolicyFor("fluent-bit"); ok {
+		t.Fatal("expected fluent-bit policy to be disabled")
+	}
+
+	if _, ok := remediationPolicyFor("unknown"); ok {
+		t.Fatal("expected no policy")
+	}
+}
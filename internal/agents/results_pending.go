@@ -0,0 +1,92 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxPendingResults is the number of unsent results kept for retry, the oldest
+// are dropped when full.
+const maxPendingResults = 100
+
+// pendingResults are action results which could not be sent (API unreachable or
+// a server error), they are retried before each poll and flushed on shutdown.
+type pendingResults struct {
+	results [][]byte
+	sync.Mutex
+}
+
+var pending = &pendingResults{}
+
+func (q *pendingResults) add(data []byte) {
+	q.Lock()
+	defer q.Unlock()
+
+	if len(q.results) >= maxPendingResults {
+		log.Warn().Int("max", maxPendingResults).Msg("too many pending action results, dropping oldest")
+
+		q.results = q.results[1:]
+	}
+
+	q.results = append(q.results, data)
+}
+
+func (q *pendingResults) len() int {
+	q.Lock()
+	defer q.Unlock()
+
+	return len(q.results)
+}
+
+// flush sends the pending results, those which still cannot be sent (and may be
+// retried) are kept.
+func (q *pendingResults) flush(ctx context.Context) error {
+	q.Lock()
+	results := q.results
+	q.results = nil
+	q.Unlock()
+
+	if len(results) == 0 {
+		return nil
+	}
+
+	log.Info().Int("results", len(results)).Msg("sending pending action results")
+
+	var errs []error
+
+	for i, data := range results {
+		if ctx.Err() != nil {
+			for _, r := range results[i:] {
+				q.add(r)
+			}
+
+			errs = append(errs, ctx.Err())
+
+			break
+		}
+
+		retry, err := postActionResult(ctx, data)
+		if err != nil {
+			if retry {
+				q.add(data)
+			}
+
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("sending pending action results: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// FlushResults sends any pending action results.
+func FlushResults(ctx context.Context) error {
+	return pending.flush(ctx)
+}
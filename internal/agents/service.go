@@ -0,0 +1,90 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/env"
+	"github.com/circonus/agent-manager/internal/svcmgr"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+var (
+	svcMgr     svcmgr.ServiceManager
+	svcMgrOnce sync.Once
+)
+
+// serviceManager returns the native service manager, nil if not enabled or not available.
+func serviceManager() svcmgr.ServiceManager {
+	svcMgrOnce.Do(func() {
+		if !viper.GetBool(keys.SystemdDBus) || env.IsRunningInDocker() {
+			return
+		}
+
+		sm, err := svcmgr.New(context.Background())
+		if err != nil {
+			log.Info().Err(err).Msg("native service manager unavailable, using commands")
+
+			return
+		}
+
+		svcMgr = sm
+	})
+
+	return svcMgr
+}
+
+// executeCommand runs simple service manager commands (start/stop/restart/reload) via
+// the native service manager, anything else (or if the native service manager cannot
+// be called) is executed as a shell command. A job which ran and failed is an error,
+// the command is not run again.
+func executeCommand(ctx context.Context, command string) ([]byte, int, error) {
+	sm := serviceManager()
+	if sm == nil {
+		return execute(ctx, command)
+	}
+
+	verb, unit, ok := svcmgr.ParseSystemctl(command)
+	if !ok {
+		return execute(ctx, command)
+	}
+
+	var err error
+
+	start := time.Now()
+
+	switch verb {
+	case svcmgr.VerbStart:
+		err = sm.Start(ctx, unit)
+	case svcmgr.VerbStop:
+		err = sm.Stop(ctx, unit)
+	case svcmgr.VerbRestart:
+		err = sm.Restart(ctx, unit)
+	case svcmgr.VerbReload:
+		err = sm.Reload(ctx, unit)
+	default:
+		return execute(ctx, command)
+	}
+
+	if err != nil {
+		if errors.Is(err, svcmgr.ErrJobFailed) || ctx.Err() != nil {
+			// the job was queued, running the command as well would repeat it
+			auditCommand(ctx, command, 1, time.Since(start), err)
+
+			return []byte(err.Error()), 1, err
+		}
+
+		log.Warn().Err(err).Str("cmd", command).Msg("native service manager, falling back to command")
+
+		return execute(ctx, command)
+	}
+
+	auditCommand(ctx, command, 0, time.Since(start), nil)
+
+	return []byte(fmt.Sprintf("%s %s: done", verb, unit)), 0, nil
+}
@@ -0,0 +1,110 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/circonus/agent-manager/internal/svcmgr"
+	"github.com/rs/zerolog"
+)
+
+// fakeServiceManager returns err for unit jobs and counts them.
+type fakeServiceManager struct {
+	err  error
+	jobs int
+}
+
+func (f *fakeServiceManager) job() error {
+	f.jobs++
+
+	return f.err
+}
+
+func (f *fakeServiceManager) Start(context.Context, string) error   { return f.job() }
+func (f *fakeServiceManager) Stop(context.Context, string) error    { return f.job() }
+func (f *fakeServiceManager) Restart(context.Context, string) error { return f.job() }
+func (f *fakeServiceManager) Reload(context.Context, string) error  { return f.job() }
+
+func (f *fakeServiceManager) State(_ context.Context, unit string) (svcmgr.UnitState, error) {
+	return svcmgr.UnitState{Unit: unit}, nil
+}
+
+func (f *fakeServiceManager) Subscribe(context.Context, []string) (<-chan svcmgr.UnitState, error) {
+	return nil, svcmgr.ErrNotSupported
+}
+
+func (f *fakeServiceManager) Close() {}
+
+func TestExecuteCommand(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	svcMgrOnce.Do(func() {})
+
+	defer func() { svcMgr = nil }()
+
+	const command = "systemctl restart telegraf"
+
+	// the shell command is run on fallback, its errors are prefixed with the command
+	fellBack := func(output []byte, err error) bool {
+		if err != nil {
+			return strings.HasPrefix(err.Error(), command+": ")
+		}
+
+		return !strings.HasSuffix(string(output), ": done")
+	}
+
+	tests := []struct {
+		err          error
+		name         string
+		wantFallback bool
+		wantErr      bool
+	}{
+		{name: "done"},
+		{name: "call failed, fallback", err: errors.New("dbus: connection closed"), wantFallback: true},
+		{name: "job failed", err: fmt.Errorf("telegraf.service: job failed: %w", svcmgr.ErrJobFailed), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			sm := &fakeServiceManager{err: tt.err}
+			svcMgr = sm
+
+			output, _, err := executeCommand(context.Background(), command)
+
+			if sm.jobs != 1 {
+				t.Fatalf("jobs = %d, want 1", sm.jobs)
+			}
+
+			if got := fellBack(output, err); got != tt.wantFallback {
+				t.Fatalf("executeCommand() fell back = %t, want %t (%v)", got, tt.wantFallback, err)
+			}
+
+			if tt.wantFallback {
+				return
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("executeCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr && !errors.Is(err, svcmgr.ErrJobFailed) {
+				t.Fatalf("executeCommand() error = %v, want job failed (no fallback)", err)
+			}
+		})
+	}
+
+	// ctx expired waiting for the job, not run again
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	svcMgr = &fakeServiceManager{err: context.Canceled}
+
+	output, _, err := executeCommand(ctx, command)
+	if !errors.Is(err, context.Canceled) || fellBack(output, err) {
+		t.Fatalf("executeCommand() cancelled error = %v, want cancelled without fallback", err)
+	}
+}
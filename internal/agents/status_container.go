@@ -0,0 +1,173 @@
+package agents
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/inventory"
+	"github.com/circonus/agent-manager/internal/registration"
+	"github.com/circonus/agent-manager/internal/server"
+	"github.com/circonus/agent-manager/internal/tracker"
+	"github.com/rs/zerolog/log"
+)
+
+// Container mode, agents run in their own containers and report their status
+// (and the checksums of the configs they loaded) to the manager's server.
+
+// containerAgents returns all installed agents, status comes from the agents' reports.
+func containerAgents() ([]statusAgent, error) {
+	installed, err := registration.LoadInstalledAgents()
+	if err != nil {
+		return nil, err
+	}
+
+	agents := make([]statusAgent, 0, len(installed))
+
+	for _, a := range installed {
+		agent, err := inventory.GetAgent(a.AgentTypeID)
+		if err != nil {
+			log.Error().Err(err).Str("agent_type", a.AgentTypeID).Msg("getting agent")
+
+			continue
+		}
+
+		agents = append(agents, statusAgent{
+			AgentID:     a.AgentID,
+			AgentType:   a.AgentTypeID,
+			ConfigFiles: agent.ConfigFiles,
+		})
+	}
+
+	return agents, nil
+}
+
+// statusSeverity orders the reported statuses, the agent has the worst status of its replicas.
+var statusSeverity = map[string]int{
+	statusRunning: 0,
+	statusStopped: 1,
+	statusFailed:  2,
+}
+
+// containerStatus derives the agent status from the latest reports of its replicas, the
+// worst status of the replicas which reported within the timeout. An agent with no
+// replica reporting within the timeout is considered failed.
+func containerStatus(reports []server.AgentReport, timeout time.Duration) StatusResult {
+	if len(reports) == 0 {
+		return StatusResult{
+			Status:     statusUnknown,
+			StatusData: StatusData{SubStatus: "no status reported"},
+		}
+	}
+
+	var (
+		last  time.Time
+		worst *server.AgentReport
+		live  int
+	)
+
+	for i, r := range reports {
+		if r.Received.After(last) {
+			last = r.Received
+		}
+
+		if time.Since(r.Received) > timeout {
+			continue
+		}
+
+		live++
+
+		if worst == nil || statusSeverity[r.Status] > statusSeverity[worst.Status] {
+			worst = &reports[i]
+		}
+	}
+
+	if worst == nil {
+		return StatusResult{
+			Status: statusFailed,
+			StatusData: StatusData{
+				SubStatus: "no status reported since " + last.UTC().Format(time.RFC3339),
+			},
+		}
+	}
+
+	result := StatusResult{
+		Status: worst.Status,
+		StatusData: StatusData{
+			SubStatus: "reported",
+		},
+	}
+
+	if len(reports) > 1 {
+		result.StatusData.SubStatus = fmt.Sprintf("%d/%d replicas reported", live, len(reports))
+	}
+
+	if worst.Info != "" {
+		result.StatusData.RawResult = base64.StdEncoding.EncodeToString([]byte(worst.Info))
+	}
+
+	return result
+}
+
+// reportedChecksums returns the checksums of the configs the agent's replicas reported loading.
+func reportedChecksums(reports []server.AgentReport) []string {
+	seen := make(map[string]bool)
+	checksums := make([]string, 0, len(reports))
+
+	for _, r := range reports {
+		for _, c := range r.Checksums {
+			if !seen[c] {
+				seen[c] = true
+				checksums = append(checksums, c)
+			}
+		}
+	}
+
+	return checksums
+}
+
+// confirmApplied reports "config applied" for any of the agent's configs matching
+// a checksum the agent reported loading.
+func confirmApplied(ctx context.Context, a statusAgent, checksums []string) {
+	for _, checksum := range checksums {
+		for cfgID, cfgFile := range a.ConfigFiles {
+			applied, err := tracker.ConfirmApplied(ctx, a.AgentType, cfgFile, checksum)
+			if err != nil {
+				log.Warn().Err(err).
+					Str("agent", a.AgentType).
+					Str("id", cfgID).
+					Str("file", cfgFile).
+					Msg("confirming config applied")
+
+				continue
+			}
+
+			if applied {
+				log.Info().
+					Str("agent", a.AgentType).
+					Str("file", cfgFile).
+					Str("checksum", checksum).
+					Msg("config applied")
+			}
+		}
+	}
+}
+
+// collectContainerStatus gets the agent status from its latest report.
+func (p *StatusPoller) collectContainerStatus(ctx context.Context, a statusAgent) StatusResult {
+	reports := server.AgentReports()[a.AgentType]
+
+	confirmApplied(ctx, a, reportedChecksums(reports))
+
+	if c := engine(); c != nil {
+		result, err := engineStatus(ctx, c, a.AgentType)
+		if err == nil {
+			return result
+		}
+
+		log.Warn().Err(err).Str("agent", a.AgentType).Msg("container engine status, using agent reports")
+	}
+
+	return containerStatus(reports, p.reportTimeout)
+}
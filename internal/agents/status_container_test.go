@@ -0,0 +1,84 @@
+package agents
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/server"
+)
+
+func TestContainerStatus(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name          string
+		reports       []server.AgentReport
+		wantStatus    string
+		wantSubStatus string
+		wantRawResult string
+	}{
+		{
+			name:          "not reported",
+			wantStatus:    statusUnknown,
+			wantSubStatus: "no status reported",
+		},
+		{
+			name:          "reported",
+			reports:       []server.AgentReport{{Received: now, Status: statusRunning}},
+			wantStatus:    statusRunning,
+			wantSubStatus: "reported",
+		},
+		{
+			name:          "reported with info",
+			reports:       []server.AgentReport{{Received: now, Status: statusFailed, Info: "output retrying"}},
+			wantStatus:    statusFailed,
+			wantSubStatus: "reported",
+			wantRawResult: base64.StdEncoding.EncodeToString([]byte("output retrying")),
+		},
+		{
+			name:          "timed out",
+			reports:       []server.AgentReport{{Received: now.Add(-time.Hour), Status: statusRunning}},
+			wantStatus:    statusFailed,
+			wantSubStatus: "no status reported since " + now.Add(-time.Hour).UTC().Format(time.RFC3339),
+		},
+		{
+			name: "replica failed",
+			reports: []server.AgentReport{
+				{Received: now, Replica: "10.0.0.1", Status: statusRunning},
+				{Received: now, Replica: "10.0.0.2", Status: statusFailed, Info: "output retrying"},
+			},
+			wantStatus:    statusFailed,
+			wantSubStatus: "2/2 replicas reported",
+			wantRawResult: base64.StdEncoding.EncodeToString([]byte("output retrying")),
+		},
+		{
+			name: "replica timed out",
+			reports: []server.AgentReport{
+				{Received: now.Add(-time.Hour), Replica: "10.0.0.1", Status: statusFailed},
+				{Received: now, Replica: "10.0.0.2", Status: statusRunning},
+			},
+			wantStatus:    statusRunning,
+			wantSubStatus: "1/2 replicas reported",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := containerStatus(tt.reports, time.Minute)
+
+			if got.Status != tt.wantStatus {
+				t.Fatalf("containerStatus() status = %s, want %s", got.Status, tt.wantStatus)
+			}
+
+			if got.StatusData.SubStatus != tt.wantSubStatus {
+				t.Fatalf("containerStatus() sub status = %q, want %q", got.StatusData.SubStatus, tt.wantSubStatus)
+			}
+
+			if got.StatusData.RawResult != tt.wantRawResult {
+				t.Fatalf("containerStatus() raw result = %q, want %q", got.StatusData.RawResult, tt.wantRawResult)
+			}
+		})
+	}
+}
@@ -35,7 +35,7 @@ func brewStatus(ctx context.Context, cmd string) (string, string, string, int, e
 		cmd += " --json"
 	}
 
-	output, exitCode, err := execute(ctx, cmd)
+	output, exitCode, err := query(ctx, cmd)
 	if err != nil {
 		return currStatus, subStatus, base64.StdEncoding.EncodeToString(output), exitCode, fmt.Errorf("%s: %w", cmd, err)
 	}
@@ -0,0 +1,160 @@
+//go:build linux
+
+package agents
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Status for non-systemd init systems (OpenRC, SysV init scripts, runit). The
+// output of each is mapped onto the same running/stopped/failed vocabulary,
+// with the init system's own state as the sub status.
+
+// LSB init script status exit codes.
+const (
+	lsbRunning        = 0
+	lsbDeadPidFile    = 1
+	lsbDeadLockFile   = 2
+	lsbNotRunning     = 3
+	openrcCrashedCode = 32
+)
+
+type statusParser func(output []byte, exitCode int) (string, string)
+
+// initStatus runs the status command, a non-zero exit code is expected for stopped
+// services so it is only treated as an error if the output could not be parsed.
+func initStatus(ctx context.Context, cmd string, parse statusParser) (string, string, string, int, error) {
+	output, exitCode, err := query(ctx, cmd)
+	raw := base64.StdEncoding.EncodeToString(output)
+
+	status, subStatus := parse(output, exitCode)
+	if status == defaultStatus && err != nil {
+		return status, subStatus, raw, exitCode, fmt.Errorf("%s: %w", cmd, err)
+	}
+
+	return status, subStatus, raw, exitCode, nil
+}
+
+// parseOpenRCStatus parses `rc-service <svc> status` output e.g. " * status: started".
+func parseOpenRCStatus(output []byte, exitCode int) (string, string) {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		line = strings.TrimSpace(strings.TrimPrefix(line, "*"))
+
+		_, state, found := strings.Cut(line, "status:")
+		if !found {
+			continue
+		}
+
+		state = strings.TrimSpace(state)
+
+		switch state {
+		case "started":
+			return statusRunning, state
+		case "stopped", "stopping", "starting", "inactive":
+			return statusStopped, state
+		case "crashed":
+			return statusFailed, state
+		default:
+			return defaultStatus, state
+		}
+	}
+
+	switch exitCode {
+	case lsbRunning:
+		return statusRunning, ""
+	case lsbNotRunning:
+		return statusStopped, ""
+	case openrcCrashedCode:
+		return statusFailed, "crashed"
+	}
+
+	return defaultStatus, ""
+}
+
+// parseSysVStatus parses `service <svc> status` or `/etc/init.d/<svc> status` output,
+// relying on the LSB exit codes and falling back to common phrases.
+func parseSysVStatus(output []byte, exitCode int) (string, string) {
+	if bytes.Contains(output, []byte("status:")) {
+		// openrc init script
+		if status, subStatus := parseOpenRCStatus(output, exitCode); status != defaultStatus {
+			return status, subStatus
+		}
+	}
+
+	text := strings.ToLower(string(output))
+
+	switch exitCode {
+	case lsbRunning:
+		if strings.Contains(text, "not running") || strings.Contains(text, "stopped") {
+			break
+		}
+
+		return statusRunning, "running"
+	case lsbDeadPidFile:
+		return statusFailed, "dead, pid file exists"
+	case lsbDeadLockFile:
+		return statusFailed, "dead, lock file exists"
+	case lsbNotRunning:
+		return statusStopped, "not running"
+	}
+
+	// NOTE: order matters, e.g. "not running [ FAILED ]" is stopped
+	switch {
+	case strings.Contains(text, "dead but"):
+		return statusFailed, "dead"
+	case strings.Contains(text, "not running"), strings.Contains(text, "stopped"):
+		return statusStopped, "not running"
+	case strings.Contains(text, "failed"):
+		return statusFailed, "failed"
+	case strings.Contains(text, "is running"), strings.Contains(text, "start/running"):
+		return statusRunning, "running"
+	}
+
+	return defaultStatus, ""
+}
+
+// parseRunitStatus parses `sv status <svc>` output e.g.
+// "run: telegraf: (pid 1234) 5678s; run: log: (pid 1233) 5678s".
+func parseRunitStatus(output []byte, _ int) (string, string) {
+	line := strings.TrimSpace(string(output))
+	if i := strings.Index(line, "\n"); i > 0 {
+		line = line[:i]
+	}
+
+	// the first status is the service, anything after ';' is the log service
+	line, _, _ = strings.Cut(line, ";")
+
+	state, rest, found := strings.Cut(line, ":")
+	if !found {
+		return defaultStatus, ""
+	}
+
+	switch state {
+	case "run":
+		if strings.Contains(rest, "want down") {
+			return statusRunning, "run, want down"
+		}
+
+		return statusRunning, "run"
+	case "down":
+		if strings.Contains(rest, "normally up") {
+			// down, but supervised to be up
+			return statusStopped, "down, normally up"
+		}
+
+		return statusStopped, "down"
+	case "finish":
+		return statusStopped, "finish"
+	case "fail", "warning":
+		return statusFailed, strings.TrimSpace(rest)
+	}
+
+	return defaultStatus, ""
+}
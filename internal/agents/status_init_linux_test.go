@@ -0,0 +1,61 @@
+//go:build linux
+
+package agents
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInitStatusParsers(t *testing.T) {
+	tests := []struct {
+		name          string
+		parse         statusParser
+		file          string
+		exitCode      int
+		wantStatus    string
+		wantSubStatus string
+	}{
+		{name: "openrc started", parse: parseOpenRCStatus, file: "openrc_started.txt", exitCode: 0, wantStatus: statusRunning, wantSubStatus: "started"},
+		{name: "openrc stopped", parse: parseOpenRCStatus, file: "openrc_stopped.txt", exitCode: 3, wantStatus: statusStopped, wantSubStatus: "stopped"},
+		{name: "openrc crashed", parse: parseOpenRCStatus, file: "openrc_crashed.txt", exitCode: 32, wantStatus: statusFailed, wantSubStatus: "crashed"},
+		{name: "sysv running", parse: parseSysVStatus, file: "sysv_running.txt", exitCode: 0, wantStatus: statusRunning, wantSubStatus: "running"},
+		{name: "sysv redirected to systemd", parse: parseSysVStatus, file: "sysv_systemd_redirect.txt", exitCode: 0, wantStatus: statusRunning, wantSubStatus: "running"},
+		{name: "sysv not running", parse: parseSysVStatus, file: "sysv_not_running.txt", exitCode: 3, wantStatus: statusStopped, wantSubStatus: "not running"},
+		{name: "sysv not running (bad exit code)", parse: parseSysVStatus, file: "sysv_not_running.txt", exitCode: 0, wantStatus: statusStopped, wantSubStatus: "not running"},
+		{name: "sysv dead pid file", parse: parseSysVStatus, file: "sysv_dead_pid.txt", exitCode: 1, wantStatus: statusFailed, wantSubStatus: "dead, pid file exists"},
+		{name: "sysv openrc script", parse: parseSysVStatus, file: "openrc_crashed.txt", exitCode: 32, wantStatus: statusFailed, wantSubStatus: "crashed"},
+		{name: "runit run", parse: parseRunitStatus, file: "runit_run.txt", exitCode: 0, wantStatus: statusRunning, wantSubStatus: "run"},
+		{name: "runit down", parse: parseRunitStatus, file: "runit_down.txt", exitCode: 0, wantStatus: statusStopped, wantSubStatus: "down"},
+		{name: "runit down normally up", parse: parseRunitStatus, file: "runit_down_normally_up.txt", exitCode: 0, wantStatus: statusStopped, wantSubStatus: "down, normally up"},
+		{name: "runit fail", parse: parseRunitStatus, file: "runit_fail.txt", exitCode: 1, wantStatus: statusFailed, wantSubStatus: "telegraf: unable to change to service directory: file does not exist"},
+		{name: "runit warning", parse: parseRunitStatus, file: "runit_warning.txt", exitCode: 1, wantStatus: statusFailed, wantSubStatus: "telegraf: unable to open supervise/ok: file does not exist"},
+		{name: "runit empty", parse: parseRunitStatus, file: "", exitCode: 1, wantStatus: defaultStatus, wantSubStatus: ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var output []byte
+
+			if tt.file != "" {
+				data, err := os.ReadFile(filepath.Join("testdata", "status", tt.file))
+				if err != nil {
+					t.Fatalf("reading test file: %s", err)
+				}
+
+				output = data
+			}
+
+			status, subStatus := tt.parse(output, tt.exitCode)
+			if status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", status, tt.wantStatus)
+			}
+
+			if subStatus != tt.wantSubStatus {
+				t.Errorf("sub status = %q, want %q", subStatus, tt.wantSubStatus)
+			}
+		})
+	}
+}
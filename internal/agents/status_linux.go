@@ -19,11 +19,19 @@ func getStatus(ctx context.Context, cmd string) (string, string, string, int, er
 	currStatus := defaultStatus
 	subStatus := ""
 
+	name := strings.TrimPrefix(cmd, "sudo ")
+
 	switch {
-	case strings.HasPrefix(cmd, "systemctl"):
+	case strings.HasPrefix(name, "systemctl"):
 		return systemctlStatus(ctx, cmd)
-	case strings.HasPrefix(cmd, "brew"):
+	case strings.HasPrefix(name, "brew"):
 		return brewStatus(ctx, cmd)
+	case strings.HasPrefix(name, "rc-service"):
+		return initStatus(ctx, cmd, parseOpenRCStatus)
+	case strings.HasPrefix(name, "sv "):
+		return initStatus(ctx, cmd, parseRunitStatus)
+	case strings.HasPrefix(name, "service "), strings.HasPrefix(name, "/etc/init.d/"):
+		return initStatus(ctx, cmd, parseSysVStatus)
 	}
 
 	return currStatus, subStatus, "", -1, fmt.Errorf("unable to obtain status")
@@ -37,7 +45,7 @@ func brewStatus(ctx context.Context, cmd string) (string, string, string, int, e
 		cmd += " --json"
 	}
 
-	output, exitCode, err := execute(ctx, cmd)
+	output, exitCode, err := query(ctx, cmd)
 	if err != nil {
 		return currStatus, subStatus, base64.StdEncoding.EncodeToString(output), exitCode, fmt.Errorf("%s: %w", cmd, err)
 	}
@@ -61,7 +69,7 @@ func systemctlStatus(ctx context.Context, cmd string) (string, string, string, i
 
 	cmd2 := strings.Replace(cmd, "status", "show", 1)
 
-	output, exitCode, err := execute(ctx, cmd2)
+	output, exitCode, err := query(ctx, cmd2)
 	if err != nil {
 		return currStatus, subStatus, base64.StdEncoding.EncodeToString(output), exitCode, fmt.Errorf("%s: %w", cmd, err)
 	}
@@ -73,6 +81,7 @@ func systemctlStatus(ctx context.Context, cmd string) (string, string, string, i
 	scanner := bufio.NewScanner(bytes.NewReader(output))
 
 	sep := "="
+	activeState := ""
 
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -81,7 +90,7 @@ func systemctlStatus(ctx context.Context, cmd string) (string, string, string, i
 		case strings.HasPrefix(line, "ActiveState"):
 			_, status, found := strings.Cut(line, sep)
 			if found {
-				currStatus = status
+				activeState = status
 			}
 		case strings.HasPrefix(line, "SubState"):
 			_, status, found := strings.Cut(line, sep)
@@ -95,7 +104,11 @@ func systemctlStatus(ctx context.Context, cmd string) (string, string, string, i
 		return currStatus, subStatus, "error processing command output", -1, err
 	}
 
-	output, exitCode, err = execute(ctx, cmd)
+	if activeState != "" {
+		currStatus = unitStatus(activeState, subStatus)
+	}
+
+	output, exitCode, err = query(ctx, cmd)
 	if err != nil {
 		return currStatus, subStatus, base64.StdEncoding.EncodeToString(output), exitCode, fmt.Errorf("%s: %w", cmd, err)
 	}
@@ -4,70 +4,357 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/env"
+	"github.com/circonus/agent-manager/internal/heartbeat"
 	"github.com/circonus/agent-manager/internal/inventory"
+	"github.com/circonus/agent-manager/internal/metrics"
 	"github.com/circonus/agent-manager/internal/registration"
+	"github.com/circonus/agent-manager/internal/splay"
+	"github.com/circonus/agent-manager/internal/svcmgr"
+	"github.com/circonus/agent-manager/internal/tracing"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 )
 
+// common status vocabulary.
+const (
+	statusRunning = "running"
+	statusStopped = "stopped"
+	statusFailed  = "failed"
+	statusUnknown = "unknown"
+)
+
 type StatusPoller struct {
-	interval time.Duration
+	remediator    *remediator
+	unitCancel    context.CancelFunc
+	reported      map[string]reportedStatus         // last status sent, by agent id
+	localHealth   map[string]*inventory.HealthCheck // local health check definitions, by agent type
+	units         string                            // sorted, comma separated list of subscribed units
+	interval      time.Duration                     // heartbeat, when status is unchanged
+	checkInterval time.Duration                     // local status checks
+	reportTimeout time.Duration                     // container mode, agent status report timeout
+	settings      chan statusSettings               // new settings, applied by the poll loop
+	container     bool
+	sync.Mutex
+}
+
+// reportedStatus is the last status sent to the API for an agent.
+type reportedStatus struct {
+	sent        time.Time
+	result      StatusResult
+	agentType   string
+	status      string
+	fingerprint string
+}
+
+// AgentStatus is the last status reported for an agent.
+type AgentStatus struct {
+	Reported  time.Time    `json:"reported"`
+	AgentID   string       `json:"agent_id"`
+	AgentType string       `json:"agent_type"`
+	Status    StatusResult `json:"status"`
+}
+
+// statusAgent is an installed agent with a status command and/or health check.
+type statusAgent struct {
+	Health      *inventory.HealthCheck
+	ConfigFiles map[string]string
+	AgentID     string
+	AgentType   string
+	Cmd         string
+	Restart     string
 }
 
 func NewStatusPoller() (*StatusPoller, error) {
-	pi := viper.GetString(keys.StatusPollingInterval)
+	settings, err := statusPollerSettings(viper.GetViper())
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatusPoller{
+		interval:      settings.interval,
+		checkInterval: settings.checkInterval,
+		reportTimeout: settings.reportTimeout,
+		settings:      make(chan statusSettings, 1),
+		container:     env.IsRunningInDocker(),
+		remediator:    newRemediator(),
+		reported:      make(map[string]reportedStatus),
+		localHealth:   localHealthChecks(),
+	}, nil
+}
+
+// statusSettings are the status poller's interval and timeout settings.
+type statusSettings struct {
+	interval      time.Duration
+	checkInterval time.Duration
+	reportTimeout time.Duration
+}
+
+func statusPollerSettings(v *viper.Viper) (statusSettings, error) {
+	pi := v.GetString(keys.StatusPollingInterval)
 
 	i, err := time.ParseDuration(pi)
 	if err != nil {
-		return nil, fmt.Errorf("parsing status polling interval: %w", err)
+		return statusSettings{}, fmt.Errorf("parsing status polling interval: %w", err)
+	}
+
+	ci := v.GetString(keys.StatusCheckInterval)
+
+	ic, err := time.ParseDuration(ci)
+	if err != nil {
+		return statusSettings{}, fmt.Errorf("parsing status check interval: %w", err)
+	}
+
+	if ic <= 0 || ic > i {
+		ic = i
+	}
+
+	rt := v.GetString(keys.StatusReportTimeout)
+
+	it, err := time.ParseDuration(rt)
+	if err != nil {
+		return statusSettings{}, fmt.Errorf("parsing status report timeout: %w", err)
+	}
+
+	return statusSettings{interval: i, checkInterval: ic, reportTimeout: it}, nil
+}
+
+// Reconfigure applies the interval and timeout settings from v (e.g. after a config reload).
+func (p *StatusPoller) Reconfigure(v *viper.Viper) error {
+	settings, err := statusPollerSettings(v)
+	if err != nil {
+		return err
 	}
 
-	return &StatusPoller{interval: i}, nil
+	// only the latest settings matter
+	select {
+	case <-p.settings:
+	default:
+	}
+
+	p.settings <- settings
+
+	return nil
 }
 
 func (p *StatusPoller) Start(ctx context.Context) {
-	log.Info().Str("interval", p.interval.String()).Msg("starting poller")
+	log.Info().
+		Str("interval", p.interval.String()).
+		Str("check_interval", p.checkInterval.String()).
+		Msg("starting poller")
+
+	changes := p.subscribe(ctx, nil)
+
+	t := time.NewTimer(splay.Jitter(p.checkInterval))
 
 	for {
-		t := time.NewTimer(p.interval)
 		select {
 		case <-ctx.Done():
 			if !t.Stop() {
 				<-t.C
 			}
 
+			if p.unitCancel != nil {
+				p.unitCancel()
+			}
+
 			return
+		case settings := <-p.settings:
+			if !t.Stop() {
+				<-t.C
+			}
+
+			if settings.interval != p.interval || settings.checkInterval != p.checkInterval {
+				log.Info().
+					Str("interval", settings.interval.String()).
+					Str("check_interval", settings.checkInterval.String()).
+					Msg("status poller intervals changed")
+			}
+
+			p.interval = settings.interval
+			p.checkInterval = settings.checkInterval
+			p.reportTimeout = settings.reportTimeout
+
+			t.Reset(splay.Jitter(p.checkInterval))
+		case state, ok := <-changes:
+			if !ok {
+				changes = nil
+
+				continue
+			}
+
+			p.unitChanged(ctx, state)
 		case <-t.C:
 			log.Debug().Msg("collecting agent status")
 
-			agents, err := registration.LoadInstalledAgents()
+			agents, err := p.agents()
 			if err != nil {
 				log.Error().Err(err).Msg("loading installed agents, restart to inventory installed agents")
+				t.Reset(splay.Jitter(p.checkInterval))
 
 				continue
 			}
 
+			var errs []error
+
 			for _, a := range agents {
-				agent, err := inventory.GetAgent(a.AgentTypeID)
-				if err != nil {
-					log.Error().Err(err).Str("agent_type", a.AgentTypeID).Msg("getting agent")
+				if err := p.submitAgentStatus(ctx, a); err != nil {
+					log.Warn().Err(err).Msg("submitting agent status")
 
-					continue
+					errs = append(errs, err)
 				}
+			}
 
-				if agent.Status != "" {
-					if err := p.submitAgentStatus(ctx, a.AgentID, agent.Status); err != nil {
-						log.Warn().Err(err).Msg("submitting agent status")
-					}
-				}
+			// reported status is current for all agents
+			heartbeat.Ran(heartbeat.StatusReport, errors.Join(errs...))
+
+			p.prune(agents)
+
+			if c := p.subscribe(ctx, agents); c != nil {
+				changes = c
 			}
+
+			t.Reset(splay.Jitter(p.checkInterval))
+		}
+	}
+}
+
+func (p *StatusPoller) agents() ([]statusAgent, error) {
+	if p.container {
+		return containerAgents()
+	}
+
+	return statusAgents(p.localHealth)
+}
+
+// statusAgents returns the installed agents which have a status command or health check,
+// local health check definitions override the inventory.
+func statusAgents(localHealth map[string]*inventory.HealthCheck) ([]statusAgent, error) {
+	installed, err := registration.LoadInstalledAgents()
+	if err != nil {
+		return nil, err
+	}
+
+	agents := make([]statusAgent, 0, len(installed))
+
+	for _, a := range installed {
+		agent, err := inventory.GetAgent(a.AgentTypeID)
+		if err != nil {
+			log.Error().Err(err).Str("agent_type", a.AgentTypeID).Msg("getting agent")
+
+			continue
+		}
+
+		hc := healthCheckFor(localHealth, a.AgentTypeID, agent)
+
+		if agent.Status == "" && hc == nil {
+			continue
+		}
+
+		agents = append(agents, statusAgent{
+			AgentID:   a.AgentID,
+			AgentType: a.AgentTypeID,
+			Cmd:       agent.Status,
+			Restart:   agent.Restart,
+			Health:    hc,
+		})
+	}
+
+	return agents, nil
+}
+
+// subscribe to unit state changes for the agents (loaded if nil) via the native service
+// manager. Returns nil if not available or the set of units has not changed.
+func (p *StatusPoller) subscribe(ctx context.Context, agents []statusAgent) <-chan svcmgr.UnitState {
+	sm := serviceManager()
+	if sm == nil {
+		return nil
+	}
+
+	if agents == nil {
+		var err error
+
+		agents, err = statusAgents(p.localHealth)
+		if err != nil {
+			return nil
+		}
+	}
+
+	units := make([]string, 0, len(agents))
+
+	for _, a := range agents {
+		if verb, unit, ok := svcmgr.ParseSystemctl(a.Cmd); ok && verb == svcmgr.VerbStatus {
+			units = append(units, unit)
+		}
+	}
+
+	if len(units) == 0 {
+		return nil
+	}
+
+	sort.Strings(units)
+
+	if strings.Join(units, ",") == p.units {
+		return nil
+	}
+
+	if p.unitCancel != nil {
+		p.unitCancel()
+	}
+
+	sctx, cancel := context.WithCancel(ctx)
+
+	changes, err := sm.Subscribe(sctx, units)
+	if err != nil {
+		cancel()
+		log.Warn().Err(err).Msg("subscribing to unit changes")
+
+		return nil
+	}
+
+	p.unitCancel = cancel
+	p.units = strings.Join(units, ",")
+
+	log.Info().Strs("units", units).Msg("subscribed to unit state changes")
+
+	return changes
+}
+
+// unitChanged submits status for any agents using the unit as soon as it changes state.
+func (p *StatusPoller) unitChanged(ctx context.Context, state svcmgr.UnitState) {
+	agents, err := statusAgents(p.localHealth)
+	if err != nil {
+		return
+	}
+
+	for _, a := range agents {
+		if _, unit, ok := svcmgr.ParseSystemctl(a.Cmd); !ok || unit != state.Unit {
+			continue
+		}
+
+		log.Info().
+			Str("agent", a.AgentType).
+			Str("unit", state.Unit).
+			Str("state", state.ActiveState).
+			Str("sub_state", state.SubState).
+			Msg("unit state changed")
+
+		result := unitStatusResult(state)
+		result.StatusData.Health = checkHealth(ctx, a.Health)
+
+		if err := p.report(ctx, a, result); err != nil {
+			log.Warn().Err(err).Msg("submitting agent status")
 		}
 	}
 }
@@ -78,13 +365,48 @@ type StatusResult struct {
 }
 
 type StatusData struct {
-	SubStatus string `json:"substatus"`
-	Error     string `json:"error"`
-	RawResult string `json:"raw_result"`
-	ExitCode  int    `json:"exit_code"`
+	Health    *HealthResult     `json:"health,omitempty"`
+	Unit      *svcmgr.UnitState `json:"unit,omitempty"` // from the native service manager, in place of raw_result
+	SubStatus string            `json:"substatus"`
+	Error     string            `json:"error"`
+	RawResult string            `json:"raw_result"`
+	ExitCode  int               `json:"exit_code"`
+}
+
+// collectStatus gets the agent status and combines it with the results of any health checks.
+func collectStatus(ctx context.Context, a statusAgent) StatusResult {
+	health := checkHealth(ctx, a.Health)
+
+	if a.Cmd == "" {
+		// no service manager status, health checks only
+		result := StatusResult{Status: statusRunning, StatusData: StatusData{Health: health}}
+		if !health.Healthy {
+			result.Status = statusFailed
+		}
+
+		return result
+	}
+
+	result := serviceStatus(ctx, a.AgentID, a.Cmd)
+	result.StatusData.Health = health
+
+	return result
 }
 
-func (p *StatusPoller) submitAgentStatus(ctx context.Context, agentID, cmd string) error {
+// serviceStatus gets the agent status from the native service manager if available,
+// otherwise by running the status command.
+func serviceStatus(ctx context.Context, agentID, cmd string) StatusResult {
+	if sm := serviceManager(); sm != nil {
+		if verb, unit, ok := svcmgr.ParseSystemctl(cmd); ok && verb == svcmgr.VerbStatus {
+			state, err := sm.State(ctx, unit)
+			if err == nil {
+				return unitStatusResult(state)
+			}
+
+			log.Warn().Err(err).Str("unit", unit).Msg("native service manager status, falling back to command")
+		}
+	}
+
 	status, subStatus, statusData, exitCode, err := getStatus(ctx, cmd)
 	if err != nil {
 		log.Warn().Err(err).
@@ -113,6 +435,174 @@ func (p *StatusPoller) submitAgentStatus(ctx context.Context, agentID, cmd strin
 		result.StatusData.RawResult = statusData
 	}
 
+	return result
+}
+
+func unitStatusResult(state svcmgr.UnitState) StatusResult {
+	return StatusResult{
+		Status: unitStatus(state.ActiveState, state.SubState),
+		StatusData: StatusData{
+			SubStatus: state.SubState,
+			Unit:      &state,
+		},
+	}
+}
+
+// unitStatus maps a systemd unit's active and sub state to the common status vocabulary.
+func unitStatus(activeState, subState string) string {
+	switch activeState {
+	case "active", "reloading":
+		return statusRunning
+	case "activating":
+		// waiting to be restarted after exiting
+		if subState == "auto-restart" {
+			return statusFailed
+		}
+
+		return statusRunning
+	case "inactive", "deactivating":
+		return statusStopped
+	case "failed":
+		return statusFailed
+	}
+
+	return statusUnknown
+}
+
+// StatusHeartbeat is sent in place of the full status when nothing has changed.
+type StatusHeartbeat struct {
+	Status    string `json:"status"`
+	Heartbeat bool   `json:"heartbeat"`
+}
+
+func (p *StatusPoller) submitAgentStatus(ctx context.Context, a statusAgent) error {
+	var result StatusResult
+
+	if p.container {
+		result = p.collectContainerStatus(ctx, a)
+	} else {
+		result = collectStatus(ctx, a)
+
+		defer p.remediator.observe(ctx, a, result)
+	}
+
+	fp := statusFingerprint(result)
+
+	p.Lock()
+	last, ok := p.reported[a.AgentID]
+	p.Unlock()
+
+	switch {
+	case !ok || last.fingerprint != fp:
+		if ok {
+			log.Info().
+				Str("agent", a.AgentType).
+				Str("prev_status", last.status).
+				Str("status", result.Status).
+				Msg("agent status changed")
+		}
+
+		return p.report(ctx, a, result)
+	case time.Since(last.sent) >= p.interval:
+		err := sendAgentStatus(ctx, a.AgentID, StatusHeartbeat{Status: result.Status, Heartbeat: true})
+		metrics.StatusReport("heartbeat", err)
+
+		if err != nil {
+			return err
+		}
+
+		p.Lock()
+		last.sent = time.Now()
+		p.reported[a.AgentID] = last
+		p.Unlock()
+	}
+
+	return nil
+}
+
+// report sends the full status and records it as the last reported status for the agent.
+func (p *StatusPoller) report(ctx context.Context, a statusAgent, result StatusResult) error {
+	err := sendAgentStatus(ctx, a.AgentID, result)
+	metrics.StatusReport("full", err)
+
+	if err != nil {
+		return err
+	}
+
+	p.Lock()
+	p.reported[a.AgentID] = reportedStatus{
+		sent:        time.Now(),
+		result:      result,
+		agentType:   a.AgentType,
+		status:      result.Status,
+		fingerprint: statusFingerprint(result),
+	}
+	p.Unlock()
+
+	return nil
+}
+
+// LastStatus returns the last status reported for each agent.
+func (p *StatusPoller) LastStatus() []AgentStatus {
+	p.Lock()
+	defer p.Unlock()
+
+	statuses := make([]AgentStatus, 0, len(p.reported))
+
+	for id, r := range p.reported {
+		statuses = append(statuses, AgentStatus{
+			AgentID:   id,
+			AgentType: r.agentType,
+			Reported:  r.sent,
+			Status:    r.result,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].AgentType < statuses[j].AgentType })
+
+	return statuses
+}
+
+// prune forgets the last reported status of agents which are no longer installed.
+func (p *StatusPoller) prune(agents []statusAgent) {
+	ids := make(map[string]bool, len(agents))
+	for _, a := range agents {
+		ids[a.AgentID] = true
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	for id := range p.reported {
+		if !ids[id] {
+			delete(p.reported, id)
+		}
+	}
+}
+
+// statusFingerprint identifies a distinct agent state, ignoring volatile details
+// (e.g. raw command output, memory usage) which would otherwise be seen as a change.
+func statusFingerprint(r StatusResult) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s|%s|%d", r.Status, r.StatusData.SubStatus, r.StatusData.ExitCode)
+
+	if r.StatusData.Unit != nil {
+		fmt.Fprintf(&b, "|%d|%d", r.StatusData.Unit.MainPID, r.StatusData.Unit.NRestarts)
+	}
+
+	if r.StatusData.Health != nil {
+		fmt.Fprintf(&b, "|%t|%s", r.StatusData.Health.Healthy, r.StatusData.Health.ConfigError)
+
+		for _, c := range r.StatusData.Health.Checks {
+			fmt.Fprintf(&b, "|%s:%t", c.Name, c.OK)
+		}
+	}
+
+	return b.String()
+}
+
+func sendAgentStatus(ctx context.Context, agentID string, result any) error {
 	data, err := json.Marshal(result)
 	if err != nil {
 		return fmt.Errorf("marshal result: %w", err)
@@ -134,11 +624,14 @@ func (p *StatusPoller) submitAgentStatus(ctx context.Context, agentID, cmd strin
 	}
 
 	req.Header.Add("Authorization", token)
+	tracing.Inject(ctx, req.Header)
 
 	client := &http.Client{}
 
 	resp, err := client.Do(req)
 	if err != nil {
+		metrics.APIError("agent_status", 0)
+
 		return fmt.Errorf("calling actions endpoint: %w", err)
 	}
 
@@ -150,6 +643,8 @@ func (p *StatusPoller) submitAgentStatus(ctx context.Context, agentID, cmd strin
 	}
 
 	if resp.StatusCode != http.StatusOK {
+		metrics.APIError("agent_status", resp.StatusCode)
+
 		return fmt.Errorf("non-200 response -- status: %s, body: %s", resp.Status, string(body))
 	}
 
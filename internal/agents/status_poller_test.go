@@ -0,0 +1,142 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/inventory"
+	"github.com/circonus/agent-manager/internal/svcmgr"
+	"github.com/spf13/viper"
+)
+
+func TestStatusPoller_submitAgentStatus(t *testing.T) {
+	var (
+		mu         sync.Mutex
+		full       int
+		heartbeats int
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/agent/abc" {
+			http.Error(w, "not found", http.StatusNotFound)
+
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+
+		var hb StatusHeartbeat
+		if err := json.Unmarshal(body, &hb); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		mu.Lock()
+		if hb.Heartbeat {
+			heartbeats++
+		} else {
+			full++
+		}
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	viper.Set(keys.APIURL, ts.URL)
+	viper.Set(keys.APIToken, "test")
+
+	defer func() {
+		viper.Set(keys.APIURL, nil)
+		viper.Set(keys.APIToken, nil)
+	}()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hc := &inventory.HealthCheck{TCP: l.Addr().String()}
+	a := statusAgent{AgentID: "abc", AgentType: "test", Health: hc}
+
+	p := &StatusPoller{
+		interval:   time.Hour,
+		remediator: newRemediator(),
+		reported:   make(map[string]reportedStatus),
+	}
+
+	check := func(wantFull, wantHeartbeats int) {
+		t.Helper()
+
+		if err := p.submitAgentStatus(context.Background(), a); err != nil {
+			t.Fatal(err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if full != wantFull || heartbeats != wantHeartbeats {
+			t.Fatalf("full=%d heartbeats=%d, want full=%d heartbeats=%d", full, heartbeats, wantFull, wantHeartbeats)
+		}
+	}
+
+	check(1, 0) // first status always sent
+	check(1, 0) // unchanged, heartbeat not due
+
+	l.Close()
+	check(2, 0) // changed, running -> failed
+
+	p.Lock()
+	last := p.reported["abc"]
+	last.sent = time.Now().Add(-2 * time.Hour)
+	p.reported["abc"] = last
+	p.Unlock()
+
+	check(2, 1) // unchanged, heartbeat due
+	check(2, 1)
+
+	p.prune(nil)
+	check(3, 1) // forgotten, sent again
+}
+
+func TestUnitStatusResult(t *testing.T) {
+	tests := []struct {
+		name       string
+		state      svcmgr.UnitState
+		wantStatus string
+	}{
+		{name: "active", state: svcmgr.UnitState{ActiveState: "active", SubState: "running", MainPID: 42}, wantStatus: statusRunning},
+		{name: "inactive", state: svcmgr.UnitState{ActiveState: "inactive", SubState: "dead"}, wantStatus: statusStopped},
+		{name: "failed", state: svcmgr.UnitState{ActiveState: "failed", SubState: "failed"}, wantStatus: statusFailed},
+		{name: "restarting", state: svcmgr.UnitState{ActiveState: "activating", SubState: "auto-restart"}, wantStatus: statusFailed},
+		{name: "starting", state: svcmgr.UnitState{ActiveState: "activating", SubState: "start"}, wantStatus: statusRunning},
+		{name: "unknown", state: svcmgr.UnitState{ActiveState: "maintenance"}, wantStatus: statusUnknown},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := unitStatusResult(tt.state)
+
+			if got.Status != tt.wantStatus {
+				t.Fatalf("status = %s, want %s", got.Status, tt.wantStatus)
+			}
+
+			if got.StatusData.SubStatus != tt.state.SubState || got.StatusData.Unit == nil || *got.StatusData.Unit != tt.state {
+				t.Fatalf("unexpected status data (%+v)", got.StatusData)
+			}
+
+			// raw_result is only the status command output
+			if got.StatusData.RawResult != "" {
+				t.Fatalf("unexpected raw result (%s)", got.StatusData.RawResult)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"fmt"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/spf13/viper"
+)
+
+// Anchor is a position in the hash chain, reported off the host (see Head) so removing
+// the newest entries, or the whole log, can be detected with VerifyAnchor.
+type Anchor struct {
+	Hash string `json:"hash"`
+	Seq  uint64 `json:"seq"`
+}
+
+// Head returns the position of the newest entry, false if auditing is disabled or
+// nothing has been recorded.
+func Head() (Anchor, bool) {
+	if !viper.GetBool(keys.AuditEnable) {
+		return Anchor{}, false
+	}
+
+	std.Lock()
+	defer std.Unlock()
+
+	if err := std.load(); err != nil || std.seq == 0 {
+		return Anchor{}, false
+	}
+
+	return Anchor{Seq: std.seq, Hash: std.last}, true
+}
+
+// VerifyAnchor verifies the audit log like Verify and checks the chain still includes
+// the anchored entry, unchanged. Entries removed after the anchor was reported are
+// detected, entries recorded after it are not covered until the next anchor.
+func VerifyAnchor(file string, anchor Anchor) (*VerifyResult, error) {
+	result, err := verify(file, &anchor)
+	if err != nil {
+		return result, err
+	}
+
+	switch {
+	case anchor.Seq > result.LastSeq:
+		return result, fmt.Errorf("audit log truncated, anchored entry %d missing (last entry %d)", anchor.Seq, result.LastSeq)
+	case anchor.Seq < result.FirstSeq:
+		return result, fmt.Errorf("anchored entry %d no longer in the audit log (first entry %d)", anchor.Seq, result.FirstSeq)
+	case result.atAnchor != anchor.Hash:
+		return result, fmt.Errorf("entry %d does not match the anchor (hash mismatch)", anchor.Seq)
+	}
+
+	result.Anchored = true
+
+	return result, nil
+}
@@ -0,0 +1,397 @@
+// Package audit keeps a local, append-only, hash-chained log of the changes the
+// manager makes on the host (config writes, commands, credentials, registration,
+// decommission). Each entry includes the hash of the previous entry, so removing
+// or editing an entry breaks the chain (see Verify). It is separate from the
+// manager's (debug) log.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/units"
+	"github.com/circonus/agent-manager/internal/config/defaults"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// events.
+const (
+	EventConfigWrite  = "config_write"
+	EventCommand      = "command"
+	EventCredential   = "credential"
+	EventRegister     = "register"
+	EventDecommission = "decommission"
+	EventMaintenance  = "maintenance"
+	EventPackage      = "package"
+	EventSelfUpdate   = "self_update"
+	EventAudit        = "audit" // the audit log itself, e.g. a truncated entry discarded
+)
+
+// sources, who initiated the change.
+const (
+	SourceManager     = "manager"
+	SourceAction      = "action"
+	SourceAdmin       = "admin_api"
+	SourceRemediation = "remediation"
+)
+
+// Entry is a single audit log line.
+type Entry struct {
+	Time         time.Time `json:"time"`
+	ExitCode     *int      `json:"exit_code,omitempty"`
+	Event        string    `json:"event"`
+	Source       string    `json:"source"`
+	ManagerID    string    `json:"manager_id,omitempty"`
+	Agent        string    `json:"agent,omitempty"`
+	AssignmentID string    `json:"assignment_id,omitempty"`
+	Path         string    `json:"path,omitempty"`
+	OldChecksum  string    `json:"old_checksum,omitempty"`
+	NewChecksum  string    `json:"new_checksum,omitempty"`
+	Command      string    `json:"command,omitempty"`
+	Duration     string    `json:"duration,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	Detail       string    `json:"detail,omitempty"`
+	Prev         string    `json:"prev"`
+	Hash         string    `json:"hash"`
+	Seq          uint64    `json:"seq"`
+}
+
+// sum is the hash of the entry (including the previous hash), without its own hash.
+func (e Entry) sum() (string, error) {
+	e.Hash = ""
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", fmt.Errorf("marshal entry: %w", err)
+	}
+
+	s := sha256.Sum256(data)
+
+	return hex.EncodeToString(s[:]), nil
+}
+
+type sourceKey struct{}
+
+// WithSource returns a context identifying who initiated the changes made with it.
+func WithSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+// Source returns the source set on the context, SourceManager if none.
+func Source(ctx context.Context) string {
+	if s, ok := ctx.Value(sourceKey{}).(string); ok && s != "" {
+		return s
+	}
+
+	return SourceManager
+}
+
+// File returns the audit log file path.
+func File() string {
+	if f := viper.GetString(keys.AuditFile); f != "" {
+		return f
+	}
+
+	return defaults.AuditFile
+}
+
+type logger struct {
+	file     string
+	last     string
+	seq      uint64
+	maxSize  int64
+	maxFiles int
+	loaded   bool
+	// a truncated trailing entry was discarded on load, recorded with the next entry
+	discarded bool
+	sync.Mutex
+}
+
+var std = &logger{}
+
+// Record appends the entry to the audit log, the time, source, manager id and chain
+// fields are filled in. Failures are logged, they do not fail the change being audited.
+func Record(ctx context.Context, e Entry) {
+	if !viper.GetBool(keys.AuditEnable) {
+		return
+	}
+
+	e.Time = time.Now().UTC()
+	e.Source = Source(ctx)
+	e.ManagerID = viper.GetString(keys.ManagerID)
+
+	if err := std.append(e); err != nil {
+		log.Warn().Err(err).Str("event", e.Event).Msg("writing audit log")
+	}
+}
+
+// Checksum returns the sha256 of data.
+func Checksum(data []byte) string {
+	s := sha256.Sum256(data)
+
+	return hex.EncodeToString(s[:])
+}
+
+// ExitCode returns a pointer for Entry.ExitCode.
+func ExitCode(code int) *int {
+	return &code
+}
+
+func (l *logger) append(e Entry) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if err := l.load(); err != nil {
+		return err
+	}
+
+	if l.discarded {
+		if err := l.write(Entry{
+			Time:      e.Time,
+			Event:     EventAudit,
+			Source:    SourceManager,
+			ManagerID: e.ManagerID,
+			Path:      l.file,
+			Detail:    "truncated entry discarded",
+		}); err != nil {
+			return err
+		}
+
+		l.discarded = false
+	}
+
+	return l.write(e)
+}
+
+// write adds the entry to the chain and appends it to the current file.
+func (l *logger) write(e Entry) error {
+	e.Seq = l.seq + 1
+	e.Prev = l.last
+
+	sum, err := e.sum()
+	if err != nil {
+		return err
+	}
+
+	e.Hash = sum
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal entry: %w", err)
+	}
+
+	line = append(line, '\n')
+
+	if err := l.rotate(int64(len(line))); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(l.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening audit log: %w", err)
+	}
+
+	defer f.Close()
+
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("writing audit log: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("syncing audit log: %w", err)
+	}
+
+	l.seq = e.Seq
+	l.last = e.Hash
+
+	return nil
+}
+
+// load reads the settings and the last entry, to continue the chain, on first use.
+func (l *logger) load() error {
+	if l.loaded {
+		return nil
+	}
+
+	l.file = File()
+	l.maxFiles = viper.GetInt(keys.AuditMaxFiles)
+
+	size, err := units.ParseBase2Bytes(viper.GetString(keys.AuditMaxSize))
+	if err != nil {
+		return fmt.Errorf("parsing audit max size (%s): %w", viper.GetString(keys.AuditMaxSize), err)
+	}
+
+	l.maxSize = int64(size)
+
+	if err := os.MkdirAll(filepath.Dir(l.file), 0o700); err != nil {
+		return fmt.Errorf("creating audit log directory: %w", err)
+	}
+
+	// the current file may be empty (or missing) right after a rotation
+	for _, file := range []string{l.file, rotated(l.file, 1)} {
+		e, discard, err := lastEntry(file)
+		if err != nil {
+			return err
+		}
+
+		// a write interrupted part way (e.g. a crash), the chain continues from the
+		// last complete entry
+		if discard > 0 {
+			if err := discardTail(file, discard); err != nil {
+				return err
+			}
+
+			log.Warn().Str("file", file).Int64("bytes", discard).Msg("discarded truncated audit log entry")
+
+			l.discarded = true
+		}
+
+		if e != nil {
+			l.seq = e.Seq
+			l.last = e.Hash
+
+			break
+		}
+	}
+
+	l.loaded = true
+
+	return nil
+}
+
+// rotate moves the current file aside if adding n bytes would exceed the max size,
+// keeping at most max files rotated files (file.1 is the most recent).
+func (l *logger) rotate(n int64) error {
+	if l.maxSize <= 0 {
+		return nil
+	}
+
+	fi, err := os.Stat(l.file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("audit log: %w", err)
+	}
+
+	if fi.Size() == 0 || fi.Size()+n <= l.maxSize {
+		return nil
+	}
+
+	if l.maxFiles <= 0 {
+		return fmt.Errorf("audit log %s exceeds max size, no rotated files allowed", l.file)
+	}
+
+	if err := os.Remove(rotated(l.file, l.maxFiles)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing oldest audit log: %w", err)
+	}
+
+	for i := l.maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(rotated(l.file, i), rotated(l.file, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("rotating audit log: %w", err)
+		}
+	}
+
+	if err := os.Rename(l.file, rotated(l.file, 1)); err != nil {
+		return fmt.Errorf("rotating audit log: %w", err)
+	}
+
+	return nil
+}
+
+func rotated(file string, n int) string {
+	return file + "." + strconv.Itoa(n)
+}
+
+// lastEntry returns the last entry in the file. A trailing line which cannot be
+// parsed is a truncated entry, the entry before it is returned along with the size
+// of the truncated line to discard.
+func lastEntry(file string) (*Entry, int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, 0, nil
+		}
+
+		return nil, 0, fmt.Errorf("reading audit log: %w", err)
+	}
+
+	defer f.Close()
+
+	var (
+		prev, last []byte // the last two non-empty lines
+		lastStart  int64  // offset of the last non-empty line
+		offset     int64
+	)
+
+	r := bufio.NewReader(f)
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			prev = append(prev[:0], last...)
+			last = append(last[:0], line...)
+			lastStart = offset
+		}
+
+		offset += int64(len(line))
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			return nil, 0, fmt.Errorf("reading audit log: %w", err)
+		}
+	}
+
+	if last == nil {
+		return nil, 0, nil
+	}
+
+	var e Entry
+	if err := json.Unmarshal(last, &e); err == nil {
+		return &e, 0, nil
+	}
+
+	discard := offset - lastStart
+
+	if len(prev) == 0 {
+		return nil, discard, nil
+	}
+
+	if err := json.Unmarshal(prev, &e); err != nil {
+		return nil, 0, fmt.Errorf("parsing last audit log entry: %w", err)
+	}
+
+	return &e, discard, nil
+}
+
+// discardTail removes the last n bytes of the file.
+func discardTail(file string, n int64) error {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+
+	if err := os.Truncate(file, fi.Size()-n); err != nil {
+		return fmt.Errorf("discarding truncated audit log entry: %w", err)
+	}
+
+	return nil
+}
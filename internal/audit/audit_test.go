@@ -0,0 +1,254 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/spf13/viper"
+)
+
+func setup(t *testing.T, maxSize string, maxFiles int) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "audit.log")
+
+	viper.Set(keys.AuditEnable, true)
+	viper.Set(keys.AuditFile, file)
+	viper.Set(keys.AuditMaxSize, maxSize)
+	viper.Set(keys.AuditMaxFiles, maxFiles)
+
+	std = &logger{}
+
+	t.Cleanup(func() {
+		viper.Reset()
+
+		std = &logger{}
+	})
+
+	return file
+}
+
+func TestRecordVerify(t *testing.T) {
+	file := setup(t, "10MiB", 2)
+
+	ctx := WithSource(context.Background(), SourceAdmin)
+
+	Record(ctx, Entry{Event: EventCommand, Command: "systemctl restart foo", ExitCode: ExitCode(0)})
+	Record(ctx, Entry{Event: EventConfigWrite, Path: "/etc/foo.conf", NewChecksum: Checksum([]byte("foo"))})
+
+	// a restarted manager continues the chain
+	std = &logger{}
+
+	Record(context.Background(), Entry{Event: EventCredential, Path: "/etc/.id/jwt"})
+
+	result, err := Verify(file)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	if result.Entries != 3 || result.FirstSeq != 1 || result.LastSeq != 3 {
+		t.Fatalf("unexpected result (%+v)", result)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), `"source":"admin_api"`) || !strings.Contains(string(data), `"source":"manager"`) {
+		t.Fatalf("expected sources in entries (%s)", data)
+	}
+}
+
+func TestTruncatedEntry(t *testing.T) {
+	file := setup(t, "10MiB", 2)
+
+	Record(context.Background(), Entry{Event: EventCommand, Command: "systemctl restart foo", ExitCode: ExitCode(0)})
+	Record(context.Background(), Entry{Event: EventConfigWrite, Path: "/etc/foo.conf"})
+
+	// a write interrupted by a crash
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.WriteString(`{"time":"2024-01-01T00:00:00Z","event":"comm`); err != nil {
+		t.Fatal(err)
+	}
+
+	f.Close()
+
+	std = &logger{}
+
+	Record(context.Background(), Entry{Event: EventCredential, Path: "/etc/.id/jwt"})
+
+	result, err := Verify(file)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	if result.Entries != 4 || result.LastSeq != 4 {
+		t.Fatalf("unexpected result (%+v)", result)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if !strings.Contains(lines[2], `"detail":"truncated entry discarded"`) || !strings.Contains(lines[3], `"event":"credential"`) {
+		t.Fatalf("expected discarded entry recorded before the new entry (%s)", data)
+	}
+}
+
+func TestVerifyAnchor(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(lines []string) []string
+		anchor  func(head Anchor) Anchor
+		wantErr string
+	}{
+		{
+			name: "intact",
+		},
+		{
+			name:    "newest entries removed",
+			tamper:  func(lines []string) []string { return lines[:1] },
+			wantErr: "anchored entry 2 missing",
+		},
+		{
+			name:    "different chain",
+			anchor:  func(head Anchor) Anchor { return Anchor{Seq: head.Seq, Hash: "abc"} },
+			wantErr: "does not match the anchor",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			file := setup(t, "10MiB", 2)
+
+			Record(context.Background(), Entry{Event: EventCommand, Command: "systemctl restart foo", ExitCode: ExitCode(0)})
+			Record(context.Background(), Entry{Event: EventConfigWrite, Path: "/etc/foo.conf"})
+
+			head, ok := Head()
+			if !ok || head.Seq != 2 {
+				t.Fatalf("unexpected head (%+v, %t)", head, ok)
+			}
+
+			// recorded after the anchor
+			Record(context.Background(), Entry{Event: EventCredential, Path: "/etc/.id/jwt"})
+
+			if tt.tamper != nil {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				lines := tt.tamper(strings.Split(strings.TrimSpace(string(data)), "\n"))
+				if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if tt.anchor != nil {
+				head = tt.anchor(head)
+			}
+
+			result, err := VerifyAnchor(file, head)
+
+			switch {
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error (%s)", err)
+			case !result.Anchored || result.LastSeq != 3:
+				t.Fatalf("unexpected result (%+v)", result)
+			}
+		})
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(lines []string) []string
+		wantErr string
+	}{
+		{
+			name: "modified",
+			tamper: func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], "restart", "stop", 1)
+
+				return lines
+			},
+			wantErr: "entry 2 modified",
+		},
+		{
+			name: "removed",
+			tamper: func(lines []string) []string {
+				return append(lines[:1], lines[2:]...)
+			},
+			wantErr: "chain broken",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			file := setup(t, "10MiB", 2)
+
+			for i := 0; i < 3; i++ {
+				Record(context.Background(), Entry{Event: EventCommand, Command: "systemctl restart foo"})
+			}
+
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			lines := tt.tamper(strings.Split(strings.TrimSpace(string(data)), "\n"))
+
+			if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = Verify(file)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	file := setup(t, "1KiB", 2)
+
+	for i := 0; i < 30; i++ {
+		Record(context.Background(), Entry{Event: EventCommand, Command: "systemctl restart foo"})
+	}
+
+	if _, err := os.Stat(file + ".3"); err == nil {
+		t.Fatal("expected at most 2 rotated files")
+	}
+
+	result, err := Verify(file)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	if len(result.Files) != 3 {
+		t.Fatalf("expected 3 files, got %v", result.Files)
+	}
+
+	if result.LastSeq != 30 || result.FirstSeq == 1 {
+		t.Fatalf("unexpected result (%+v)", result)
+	}
+}
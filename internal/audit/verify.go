@@ -0,0 +1,156 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VerifyResult summarizes a verified audit log.
+type VerifyResult struct {
+	anchor   *Anchor  // entry whose hash to keep (see VerifyAnchor)
+	atAnchor string   // hash of the anchored entry in the log
+	Files    []string `json:"files"`
+	Last     string   `json:"last_hash"`
+	Entries  int      `json:"entries"`
+	FirstSeq uint64   `json:"first_seq"`
+	LastSeq  uint64   `json:"last_seq"`
+	Anchored bool     `json:"anchored,omitempty"` // the chain includes the anchor (see VerifyAnchor)
+}
+
+// Verify checks the hash chain of the audit log file and its rotated files, oldest
+// first. The chain of the oldest file is verified from its first entry (earlier
+// entries may have been rotated out). Returns an error describing the first break.
+// Removing the newest entries, or the oldest files, leaves a valid chain, see
+// VerifyAnchor.
+func Verify(file string) (*VerifyResult, error) {
+	return verify(file, nil)
+}
+
+func verify(file string, anchor *Anchor) (*VerifyResult, error) {
+	files, err := chainFiles(file)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VerifyResult{Files: files, anchor: anchor}
+
+	for _, f := range files {
+		if err := verifyFile(f, result); err != nil {
+			return result, err
+		}
+	}
+
+	if result.Entries == 0 {
+		return result, fmt.Errorf("no audit log entries found (%s)", file)
+	}
+
+	return result, nil
+}
+
+// chainFiles returns the existing rotated files, oldest first, followed by the file.
+func chainFiles(file string) ([]string, error) {
+	matches, err := filepath.Glob(file + ".*")
+	if err != nil {
+		return nil, fmt.Errorf("finding rotated audit logs: %w", err)
+	}
+
+	type rotatedFile struct {
+		name string
+		n    int
+	}
+
+	var rf []rotatedFile
+
+	for _, m := range matches {
+		n, err := strconv.Atoi(strings.TrimPrefix(m, file+"."))
+		if err != nil {
+			continue
+		}
+
+		rf = append(rf, rotatedFile{name: m, n: n})
+	}
+
+	sort.Slice(rf, func(i, j int) bool { return rf[i].n > rf[j].n })
+
+	files := make([]string, 0, len(rf)+1)
+	for _, r := range rf {
+		files = append(files, r.name)
+	}
+
+	if _, err := os.Stat(file); err == nil {
+		files = append(files, file)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("audit log: %w", err)
+	}
+
+	return files, nil
+}
+
+func verifyFile(file string, result *VerifyResult) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("reading audit log: %w", err)
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("%s:%d: parsing entry: %w", file, line, err)
+		}
+
+		sum, err := e.sum()
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", file, line, err)
+		}
+
+		if sum != e.Hash {
+			return fmt.Errorf("%s:%d: entry %d modified (hash mismatch)", file, line, e.Seq)
+		}
+
+		if result.Entries > 0 {
+			if e.Prev != result.Last {
+				return fmt.Errorf("%s:%d: chain broken before entry %d (previous hash mismatch)", file, line, e.Seq)
+			}
+
+			if e.Seq != result.LastSeq+1 {
+				return fmt.Errorf("%s:%d: chain broken, entry %d follows %d", file, line, e.Seq, result.LastSeq)
+			}
+		} else {
+			result.FirstSeq = e.Seq
+		}
+
+		result.Entries++
+		result.LastSeq = e.Seq
+		result.Last = e.Hash
+
+		if result.anchor != nil && e.Seq == result.anchor.Seq {
+			result.atAnchor = e.Hash
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading audit log: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+var (
+	bm       sync.Mutex
+	flags    = make(map[string]*pflag.Flag)
+	envVars  = make(map[string][]string)
+	baseline map[string]any  // settings before the config file is read
+	pinned   map[string]bool // settings from flags or the environment, the config file does not override them
+)
+
+// BindFlag binds a command line flag to a setting, the binding is recorded so a
+// reloaded config keeps the flag's precedence over the config file.
+func BindFlag(key string, flag *pflag.Flag) error {
+	if err := viper.BindPFlag(key, flag); err != nil {
+		return fmt.Errorf("bind flag: %w", err)
+	}
+
+	bm.Lock()
+	flags[key] = flag
+	bm.Unlock()
+
+	return nil
+}
+
+// BindEnv binds an environment variable to a setting, the binding is recorded so a
+// reloaded config keeps the variable's precedence over the config file.
+func BindEnv(key, envVar string) error {
+	if err := viper.BindEnv(key, envVar); err != nil {
+		return fmt.Errorf("bind env: %w", err)
+	}
+
+	bm.Lock()
+	envVars[key] = append(envVars[key], envVar)
+	bm.Unlock()
+
+	return nil
+}
+
+// SetBaseline records the settings from defaults, flags and environment variables,
+// it must be called after the flags are parsed and before the config file is read.
+// Reload builds the new config from the baseline and the config file.
+func SetBaseline() {
+	bm.Lock()
+	defer bm.Unlock()
+
+	baseline = make(map[string]any)
+	pinned = make(map[string]bool)
+
+	for _, key := range viper.AllKeys() {
+		baseline[key] = viper.Get(key)
+
+		if flag, ok := flags[key]; ok && flag.Changed {
+			pinned[key] = true
+		}
+
+		// explicit bindings and automatic env (upper case key)
+		for _, envVar := range append(envVars[key], strings.ToUpper(key)) {
+			if _, ok := os.LookupEnv(envVar); ok {
+				pinned[key] = true
+			}
+		}
+	}
+}
+
+// newFromBaseline returns a new viper with the baseline settings, pinned settings
+// take precedence over a config file read into it.
+func newFromBaseline() *viper.Viper {
+	bm.Lock()
+	defer bm.Unlock()
+
+	v := viper.New()
+
+	for key, val := range baseline {
+		if pinned[key] {
+			v.Set(key, val)
+		} else {
+			v.SetDefault(key, val)
+		}
+	}
+
+	return v
+}
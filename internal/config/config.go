@@ -3,24 +3,44 @@ package config
 
 import (
 	"github.com/circonus/agent-manager/internal/config/defaults"
+	"github.com/spf13/viper"
 )
 
 // Config defines the running configuration options.
 type Config struct {
-	Tags                   map[string]string `json:"tags"                  toml:"tags"                  yaml:"tags"`
-	API                    API               `json:"api"                   toml:"api"                   yaml:"api"`
-	ActionPollingInterval  string            `json:"action_poll_interval"  toml:"action_poll_interval"  yaml:"action_poll_interval"`
-	TrackerPollingInterval string            `json:"tracker_poll_interval" toml:"tracker_poll_interval" yaml:"tracker_poll_interval"`
-	StatusPollingInterval  string            `json:"status_poll_interval"  toml:"status_poll_interval"  yaml:"status_poll_interval"`
-	Server                 Server            `json:"server"                toml:"server"                yaml:"server"`
-	Log                    Log               `json:"log"                   toml:"log"                   yaml:"log"`
-	AWSEC2Tags             []string          `json:"aws_ec2_tags"          toml:"aws_ec2_tags"          yaml:"aws_ec2_tags"`
-	Debug                  bool              `json:"debug"                 toml:"debug"                 yaml:"debug"`
+	Tags                     map[string]string `json:"tags"                    toml:"tags"                    yaml:"tags"`
+	HealthChecks             map[string]any    `json:"health_checks"           toml:"health_checks"           yaml:"health_checks"`
+	Remediation              map[string]any    `json:"remediation"             toml:"remediation"             yaml:"remediation"`
+	API                      API               `json:"api"                     toml:"api"                     yaml:"api"`
+	ActionPollingInterval    string            `json:"action_poll_interval"    toml:"action_poll_interval"    yaml:"action_poll_interval"`
+	TrackerPollingInterval   string            `json:"tracker_poll_interval"   toml:"tracker_poll_interval"   yaml:"tracker_poll_interval"`
+	StatusPollingInterval    string            `json:"status_poll_interval"    toml:"status_poll_interval"    yaml:"status_poll_interval"`
+	DiscoveryPollingInterval string            `json:"discovery_poll_interval" toml:"discovery_poll_interval" yaml:"discovery_poll_interval"`
+	StatusCheckInterval      string            `json:"status_check_interval"   toml:"status_check_interval"   yaml:"status_check_interval"`
+	StatusReportTimeout      string            `json:"status_report_timeout"   toml:"status_report_timeout"   yaml:"status_report_timeout"`
+	DrainTimeout             string            `json:"drain_timeout"           toml:"drain_timeout"           yaml:"drain_timeout"`
+	SplayMax                 string            `json:"splay_max"               toml:"splay_max"               yaml:"splay_max"`
+	Server                   Server            `json:"server"                  toml:"server"                  yaml:"server"`
+	Log                      Log               `json:"log"                     toml:"log"                     yaml:"log"`
+	Secrets                  Secrets           `json:"secrets"                 toml:"secrets"                 yaml:"secrets"`
+	Container                Container         `json:"container"               toml:"container"               yaml:"container"`
+	Admin                    Admin             `json:"admin"                   toml:"admin"                   yaml:"admin"`
+	Tracing                  Tracing           `json:"tracing"                 toml:"tracing"                 yaml:"tracing"`
+	Audit                    Audit             `json:"audit"                   toml:"audit"                   yaml:"audit"`
+	Maintenance              Maintenance       `json:"maintenance"             toml:"maintenance"             yaml:"maintenance"`
+	SelfUpdate               SelfUpdate        `json:"self_update"             toml:"self_update"             yaml:"self_update"`
+	ChangeWindows            []ChangeWindow    `json:"change_windows"          toml:"change_windows"          yaml:"change_windows"`
+	AWSEC2Tags               []string          `json:"aws_ec2_tags"            toml:"aws_ec2_tags"            yaml:"aws_ec2_tags"`
+	PollJitter               float64           `json:"poll_jitter"             toml:"poll_jitter"             yaml:"poll_jitter"`
+	Debug                    bool              `json:"debug"                   toml:"debug"                   yaml:"debug"`
+	ConfigWatch              bool              `json:"config_watch"            toml:"config_watch"            yaml:"config_watch"`
+	SystemdDBus              bool              `json:"systemd_dbus"            toml:"systemd_dbus"            yaml:"systemd_dbus"`
 }
 
 // API defines the various API options.
 type API struct {
-	URL string `json:"url" toml:"url" yaml:"url"`
+	URL       string `json:"url"        toml:"url"        yaml:"url"`
+	AllowHTTP bool   `json:"allow_http" toml:"allow_http" yaml:"allow_http"`
 }
 
 // Log defines the logging configuration options.
@@ -38,11 +58,91 @@ type Server struct {
 	HandlerTimeout    string `json:"handler_timeout"     toml:"handler_timeout"     yaml:"handler_timeout"`
 	TLSKeyFile        string `json:"tls_key_file"        toml:"tls_key_file"        yaml:"tls_key_file"`
 	TLSCertFile       string `json:"tls_cert_file"       toml:"tls_cert_file"       yaml:"tls_cert_file"`
+	ConfigToken       string `json:"config_token"        toml:"config_token"        yaml:"config_token"`
 	TLSEnable         bool   `json:"tls_enable"          toml:"tls_enable"          yaml:"tls_enable"`
 }
 
+// Secrets defines the secret provider options.
+type Secrets struct {
+	CacheTTL string       `json:"cache_ttl" toml:"cache_ttl" yaml:"cache_ttl"`
+	Env      SecretsEnv   `json:"env"       toml:"env"       yaml:"env"`
+	File     SecretsFile  `json:"file"      toml:"file"      yaml:"file"`
+	Vault    SecretsVault `json:"vault"     toml:"vault"     yaml:"vault"`
+}
+
+// Admin defines the local admin api options.
+type Admin struct {
+	Socket    string `json:"socket"     toml:"socket"     yaml:"socket"`
+	TokenFile string `json:"token_file" toml:"token_file" yaml:"token_file"`
+	Enable    bool   `json:"enable"     toml:"enable"     yaml:"enable"`
+}
+
+// Audit defines the local audit log options.
+type Audit struct {
+	File     string `json:"file"      toml:"file"      yaml:"file"`
+	MaxSize  string `json:"max_size"  toml:"max_size"  yaml:"max_size"`
+	MaxFiles int    `json:"max_files" toml:"max_files" yaml:"max_files"`
+	Enable   bool   `json:"enable"    toml:"enable"    yaml:"enable"`
+}
+
+// Maintenance defines the host maintenance options.
+type Maintenance struct {
+	Until  string `json:"until"  toml:"until"  yaml:"until"`
+	Reason string `json:"reason" toml:"reason" yaml:"reason"`
+	File   string `json:"file"   toml:"file"   yaml:"file"`
+	Enable bool   `json:"enable" toml:"enable" yaml:"enable"`
+}
+
+// SelfUpdate defines the self-update options.
+type SelfUpdate struct {
+	PublicKey     string `json:"public_key"     toml:"public_key"     yaml:"public_key"`
+	HealthTimeout string `json:"health_timeout" toml:"health_timeout" yaml:"health_timeout"`
+	Restart       string `json:"restart"        toml:"restart"        yaml:"restart"`
+	Enable        bool   `json:"enable"         toml:"enable"         yaml:"enable"`
+}
+
+// ChangeWindow defines a window when config assignments may be applied.
+type ChangeWindow struct {
+	Name     string `json:"name"     toml:"name"     yaml:"name"`
+	Schedule string `json:"schedule" toml:"schedule" yaml:"schedule"`
+	Duration string `json:"duration" toml:"duration" yaml:"duration"`
+	Timezone string `json:"timezone" toml:"timezone" yaml:"timezone"`
+}
+
+// Tracing defines the OpenTelemetry tracing options.
+type Tracing struct {
+	Exporter    string  `json:"exporter"     toml:"exporter"     yaml:"exporter"`
+	Endpoint    string  `json:"endpoint"     toml:"endpoint"     yaml:"endpoint"`
+	File        string  `json:"file"         toml:"file"         yaml:"file"`
+	SampleRatio float64 `json:"sample_ratio" toml:"sample_ratio" yaml:"sample_ratio"`
+}
+
+type Container struct {
+	Agents       map[string]any `json:"agents"        toml:"agents"        yaml:"agents"`
+	EngineSocket string         `json:"engine_socket" toml:"engine_socket" yaml:"engine_socket"`
+	Label        string         `json:"label"         toml:"label"         yaml:"label"`
+	Reload       string         `json:"reload"        toml:"reload"        yaml:"reload"`
+}
+
+type SecretsEnv struct {
+	Allow []string `json:"allow" toml:"allow" yaml:"allow"`
+}
+
+type SecretsFile struct {
+	BasePath string `json:"base_path" toml:"base_path" yaml:"base_path"`
+}
+
+type SecretsVault struct {
+	Address   string `json:"address"    toml:"address"    yaml:"address"`
+	Token     string `json:"token"      toml:"token"      yaml:"token"`
+	TokenFile string `json:"token_file" toml:"token_file" yaml:"token_file"`
+	Mount     string `json:"mount"      toml:"mount"      yaml:"mount"`
+	Namespace string `json:"namespace"  toml:"namespace"  yaml:"namespace"`
+}
+
+// Validate checks the loaded configuration.
 func Validate() error {
-	return nil
+	return validate(viper.GetViper())
 }
 
 func SetPathsBasedOnConfigFile(cfgPath string) {
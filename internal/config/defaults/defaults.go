@@ -9,11 +9,17 @@ import (
 )
 
 const (
-	APIURL = "https://agents-api.circonus.app/configurations/v1"
-
-	ActionPollingInterval  = "60s"
-	TrackerPollingInterval = "15m"
-	StatusPollingInterval  = "5m"
+	APIURL       = "https://agents-api.circonus.app/configurations/v1"
+	APIAllowHTTP = false
+
+	ActionPollingInterval    = "60s"
+	TrackerPollingInterval   = "15m"
+	StatusPollingInterval    = "5m"
+	DiscoveryPollingInterval = "10m"
+	StatusCheckInterval      = "15s"
+	StatusReportTimeout      = "5m"
+	PollJitter               = 0.1
+	SplayMax                 = "0s"
 
 	// General defaults.
 
@@ -21,8 +27,15 @@ const (
 	LogLevel  = "info"
 	LogPretty = false
 
+	ConfigWatch  = false
+	DrainTimeout = "30s"
+
 	UseMachineID  = true
 	ForceRegister = false
+	SystemdDBus   = true
+
+	ContainerLabel  = "com.circonus.agent"
+	ContainerReload = "restart"
 
 	ServerAddress           = ":43285"
 	ServerReadTimeout       = "60s"
@@ -33,6 +46,25 @@ const (
 	ServerUseTLS            = false
 	ServerCertFile          = ""
 	ServerKeyFile           = ""
+
+	AdminEnable = true
+
+	AuditEnable   = true
+	AuditMaxSize  = "10MiB"
+	AuditMaxFiles = 5
+
+	MaintenanceEnable = false
+
+	SelfUpdateEnable        = false
+	SelfUpdateHealthTimeout = "2m"
+	SelfUpdateRestart       = "systemctl restart --no-block " + release.NAME
+
+	TracingExporter    = "none"
+	TracingSampleRatio = 1.0
+
+	SecretsCacheTTL     = "5m"
+	SecretsVaultMount   = "secret"
+	SecretsFileBasePath = ""
 )
 
 var (
@@ -61,6 +93,31 @@ var (
 	RefreshTokenFile = ""
 	MachineIDFile    = ""
 
+	// ConfigUpdatesFile persists pending container config change signals.
+	ConfigUpdatesFile = ""
+
+	// AdminSocket is the local admin api unix socket, AdminTokenFile its auth token.
+	AdminSocket    = ""
+	AdminTokenFile = ""
+
+	// AuditFile is the local audit log.
+	AuditFile = ""
+
+	// MaintenanceFile is the maintenance marker, DeferredFile the actions deferred
+	// during maintenance.
+	MaintenanceFile = ""
+	DeferredFile    = ""
+
+	// SelfUpdateFile is the state of a self-update, kept across the restart.
+	SelfUpdateFile = ""
+
+	// SecretsPath is the directory file secret references are restricted to, unless
+	// another is configured.
+	SecretsPath = ""
+
+	// SecretsEnvAllow are the environment variables env secret references may use.
+	SecretsEnvAllow = []string{"SECRET_*"}
+
 	AWSEC2Tags = []string{}
 	Tags       = []string{}
 	Agents     = []string{}
@@ -97,6 +154,14 @@ func SetEtcPaths(etcPath string) {
 	ManagerIDFile = filepath.Join(IDPath, "ai")
 	RefreshTokenFile = filepath.Join(IDPath, "rft")
 	MachineIDFile = filepath.Join(IDPath, "mid")
+	ConfigUpdatesFile = filepath.Join(EtcPath, "config_updates.yaml")
+	AdminSocket = filepath.Join(EtcPath, release.NAME+".sock")
+	AdminTokenFile = filepath.Join(IDPath, "adm")
+	AuditFile = filepath.Join(EtcPath, "audit", "audit.log")
+	MaintenanceFile = filepath.Join(EtcPath, "maintenance")
+	DeferredFile = filepath.Join(EtcPath, "deferred.json")
+	SelfUpdateFile = filepath.Join(EtcPath, "selfupdate.json")
+	SecretsPath = filepath.Join(EtcPath, "secrets")
 
 	if err := os.MkdirAll(IDPath, 0o700); err != nil {
 		log.Fatal().Err(err).Msg("creating ID path")
@@ -8,6 +8,7 @@ const (
 	Decommission  = "decommission"
 
 	APIURL            = "api.url"
+	APIAllowHTTP      = "api.allow_http"
 	APIToken          = "api.token"
 	ManagerID         = "manager_id"
 	RegistrationToken = "registration_token"
@@ -20,9 +21,18 @@ const (
 	// frequency of tracking config checksums.
 	TrackerPollingInterval = "tracker_poll_interval"
 
-	// frequency of gathering agent status.
+	// frequency of discovering installed, removed and upgraded agents.
+	DiscoveryPollingInterval = "discovery_poll_interval"
+
+	// frequency of full agent status reports (heartbeat when unchanged).
 	StatusPollingInterval = "status_poll_interval"
 
+	// frequency of local agent status checks, changes are reported immediately.
+	StatusCheckInterval = "status_check_interval"
+
+	// container mode, agent status is failed when no report is received within this time.
+	StatusReportTimeout = "status_report_timeout"
+
 	// AWS EC2 tags to be included in registration meta data.
 	AWSEC2Tags = "aws_ec2_tags"
 
@@ -42,6 +52,89 @@ const (
 	ServerTLSEnable         = "server.tls_enable"
 	ServerTLSKeyFile        = "server.tls_key_file"
 	ServerTLSCertFile       = "server.tls_cert_file"
+	ServerConfigToken       = "server.config_token" //nolint:gosec
+
+	// local admin api.
+	AdminEnable    = "admin.enable"
+	AdminSocket    = "admin.socket"
+	AdminTokenFile = "admin.token_file"
+
+	// HealthChecks local per agent type process health checks (override inventory).
+	HealthChecks = "health_checks"
+
+	// Remediation opt-in per agent type auto-remediation (restart) policies.
+	Remediation = "remediation"
+
+	// ContainerEngineSocket docker/podman engine API socket for container mode (disabled if empty).
+	ContainerEngineSocket = "container.engine_socket"
+	// ContainerLabel label identifying agent containers, value is the agent type.
+	ContainerLabel = "container.label"
+	// ContainerReload method used to reload agent containers (restart, signal, exec).
+	ContainerReload = "container.reload"
+	// ContainerAgents per agent type container settings (reload, signal, exec).
+	ContainerAgents = "container.agents"
+
+	// AuditEnable local hash-chained audit log of changes made on the host.
+	AuditEnable = "audit.enable"
+	// AuditFile audit log file (rotated files have a numeric suffix).
+	AuditFile = "audit.file"
+	// AuditMaxSize rotate the audit log at this size (e.g. 10MiB).
+	AuditMaxSize = "audit.max_size"
+	// AuditMaxFiles number of rotated audit log files kept.
+	AuditMaxFiles = "audit.max_files"
+
+	// MaintenanceEnable host maintenance, changes are deferred and drift is not reported.
+	MaintenanceEnable = "maintenance.enable"
+	// MaintenanceUntil maintenance expiry, a duration (from start) or RFC3339 time.
+	MaintenanceUntil = "maintenance.until"
+	// MaintenanceReason why the host is in maintenance (informational).
+	MaintenanceReason = "maintenance.reason"
+	// MaintenanceFile maintenance marker file, the host is in maintenance while it exists.
+	MaintenanceFile = "maintenance.file"
+
+	// SelfUpdateEnable allow self-update command actions.
+	SelfUpdateEnable = "self_update.enable"
+	// SelfUpdatePublicKey base64 ed25519 public key release artifacts are signed with.
+	SelfUpdatePublicKey = "self_update.public_key"
+	// SelfUpdateHealthTimeout how long the new binary has to pass the startup health check.
+	SelfUpdateHealthTimeout = "self_update.health_timeout"
+	// SelfUpdateRestart command restarting the manager through the service manager.
+	SelfUpdateRestart = "self_update.restart"
+
+	// ChangeWindows schedule of when config assignments may be applied (cron, duration, timezone).
+	ChangeWindows = "change_windows"
+
+	// TracingExporter OpenTelemetry trace exporter (none, otlp, stdout, file).
+	TracingExporter = "tracing.exporter"
+	// TracingEndpoint OTLP/HTTP endpoint URL (e.g. http://collector:4318).
+	TracingEndpoint = "tracing.endpoint"
+	// TracingFile file the file exporter appends spans to.
+	TracingFile = "tracing.file"
+	// TracingSampleRatio fraction of action traces sampled (0-1).
+	TracingSampleRatio = "tracing.sample_ratio"
+
+	// SystemdDBus use the systemd D-Bus API for service commands and status (linux).
+	SystemdDBus = "systemd_dbus"
+
+	//
+	// Secrets.
+	//
+
+	// SecretsCacheTTL how long resolved secrets are cached.
+	SecretsCacheTTL = "secrets.cache_ttl"
+
+	// SecretsFileBasePath restricts file secret references to a directory
+	// (default etc/secrets, "/" for any file).
+	SecretsFileBasePath = "secrets.file.base_path"
+
+	// SecretsEnvAllow restricts env secret references to matching variable names.
+	SecretsEnvAllow = "secrets.env.allow"
+
+	SecretsVaultAddress   = "secrets.vault.address"
+	SecretsVaultToken     = "secrets.vault.token"
+	SecretsVaultTokenFile = "secrets.vault.token_file"
+	SecretsVaultMount     = "secrets.vault.mount"
+	SecretsVaultNamespace = "secrets.vault.namespace"
 
 	//
 	// Logging.
@@ -60,6 +153,18 @@ const (
 	// Debug enables debug messages.
 	Debug = "debug"
 
+	// ConfigWatch reload the config file when it changes.
+	ConfigWatch = "config_watch"
+
+	// PollJitter randomize the poll intervals by up to this fraction (0-0.5).
+	PollJitter = "poll_jitter"
+
+	// SplayMax random delay, up to this, before applying config actions and commands.
+	SplayMax = "splay_max"
+
+	// DrainTimeout on shutdown, how long to wait for actions in progress.
+	DrainTimeout = "drain_timeout"
+
 	// UseMachineID - use the machine id or generate a uuid.
 	UseMachineID = "use_machine_id"
 
@@ -77,10 +182,15 @@ const (
 	// ShowVersion - show version information and exit.
 	ShowVersion = "version"
 
+	// CheckConfig - validate the configuration and exit.
+	CheckConfig = "check_config"
+
 	// Internal settings.
 	InventoryFile    = "internal.inventory_file"
 	JwtTokenFile     = "internal.jwt_token_file"
 	ManagerIDFile    = "internal.manager_id_file"
 	RefreshTokenFile = "internal.refresh_token_file"
 	MachineIDFile    = "internal.machine_id_file"
+	DeferredFile     = "internal.deferred_file"
+	SelfUpdateFile   = "internal.self_update_file"
 )
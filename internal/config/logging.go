@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+// SetLogLevel sets the global log level from v, debug if enabled, otherwise the
+// configured level (if specified).
+func SetLogLevel(v *viper.Viper) error {
+	if v.GetBool(keys.Debug) {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+
+		return nil
+	}
+
+	if !v.IsSet(keys.LogLevel) {
+		return nil
+	}
+
+	level, err := parseLogLevel(v.GetString(keys.LogLevel))
+	if err != nil {
+		return err
+	}
+
+	zerolog.SetGlobalLevel(level)
+
+	return nil
+}
+
+func parseLogLevel(level string) (zerolog.Level, error) {
+	switch level {
+	case "panic":
+		return zerolog.PanicLevel, nil
+	case "fatal":
+		return zerolog.FatalLevel, nil
+	case "error":
+		return zerolog.ErrorLevel, nil
+	case "warn":
+		return zerolog.WarnLevel, nil
+	case "info":
+		return zerolog.InfoLevel, nil
+	case "debug":
+		return zerolog.DebugLevel, nil
+	case "disabled":
+		return zerolog.Disabled, nil
+	default:
+		return zerolog.NoLevel, fmt.Errorf("unknown log level (%s)", level)
+	}
+}
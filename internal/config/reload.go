@@ -0,0 +1,110 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// running are the settings in use, the last config loaded or reloaded.
+type running struct {
+	values   map[string]any
+	fromFile map[string]bool
+	file     string
+}
+
+var (
+	rm      sync.Mutex
+	current *running
+)
+
+// SetRunning records the settings in v as the settings in use, after the config file
+// is read at start. Reload reports changes relative to the settings in use.
+func SetRunning(v *viper.Viper) {
+	rm.Lock()
+	current = snapshot(v, v.ConfigFileUsed())
+	rm.Unlock()
+}
+
+// Reload re-reads the config file in use into a new config built from the baseline
+// (defaults, flags and environment variables, see SetBaseline). The new config is
+// validated, if it is not valid the running configuration is kept. The global settings
+// are not changed, the caller applies the (reloadable) changed settings from the new
+// config. Returns the new config and the keys whose (effective) values changed.
+func Reload() (*viper.Viper, []string, error) {
+	rm.Lock()
+	defer rm.Unlock()
+
+	if current == nil || current.file == "" {
+		return nil, nil, errors.New("no config file in use")
+	}
+
+	file := current.file
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading config: %w", err)
+	}
+
+	candidate := newFromBaseline()
+	candidate.SetConfigType(strings.TrimPrefix(filepath.Ext(file), "."))
+
+	if err := candidate.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, nil, fmt.Errorf("parsing config %s: %w", file, err)
+	}
+
+	if err := validate(candidate); err != nil {
+		return nil, nil, fmt.Errorf("invalid config %s: %w", file, err)
+	}
+
+	next := snapshot(candidate, file)
+
+	// only settings from either config file, settings changed at runtime (e.g. the
+	// api token) are not config changes
+	var changed []string
+
+	for key := range next.fromFile {
+		if !reflect.DeepEqual(current.values[key], next.values[key]) {
+			changed = append(changed, key)
+		}
+	}
+
+	// settings removed from the config file, now the baseline value
+	for key := range current.fromFile {
+		if !next.fromFile[key] && !reflect.DeepEqual(current.values[key], next.values[key]) {
+			changed = append(changed, key)
+		}
+	}
+
+	sort.Strings(changed)
+
+	current = next
+
+	return candidate, changed, nil
+}
+
+func snapshot(v *viper.Viper, file string) *running {
+	s := &running{
+		values:   make(map[string]any),
+		fromFile: make(map[string]bool),
+		file:     file,
+	}
+
+	for _, key := range v.AllKeys() {
+		s.values[key] = v.Get(key)
+
+		if v.InConfig(key) {
+			s.fromFile[key] = true
+		}
+	}
+
+	return s
+}
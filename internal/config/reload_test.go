@@ -0,0 +1,120 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/circonus/agent-manager/internal/config/defaults"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+func TestReload(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		update      string
+		wantChanged []string
+		wantErr     string
+		wantAction  string
+	}{
+		{
+			name:        "valid",
+			update:      "action_poll_interval: 30s\nlog:\n  level: debug\n",
+			wantChanged: []string{keys.ActionPollingInterval, keys.LogLevel},
+			wantAction:  "30s",
+		},
+		{
+			name:       "no changes",
+			update:     "action_poll_interval: 10s\n",
+			wantAction: "10s",
+		},
+		{
+			name:        "removed setting",
+			update:      "log:\n  level: info\n",
+			wantChanged: []string{keys.ActionPollingInterval},
+			wantAction:  defaults.ActionPollingInterval,
+		},
+		{
+			name:       "flag takes precedence",
+			args:       []string{"--action-poll-interval=20s"},
+			update:     "action_poll_interval: 30s\n",
+			wantAction: "20s",
+		},
+		{
+			name:    "invalid kept",
+			update:  "action_poll_interval: 30\nserver:\n  read_timeout: soon\n",
+			wantErr: "server.read_timeout",
+		},
+		{
+			name:    "unparsable kept",
+			update:  "action_poll_interval: [30s\n",
+			wantErr: "parsing config",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(viper.Reset)
+
+			file := filepath.Join(t.TempDir(), "circonus-am.yaml")
+			if err := os.WriteFile(file, []byte("action_poll_interval: 10s\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			setDefaults(viper.GetViper())
+
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			fs.String("action-poll-interval", defaults.ActionPollingInterval, "")
+
+			if err := BindFlag(keys.ActionPollingInterval, fs.Lookup("action-poll-interval")); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			SetBaseline()
+
+			viper.SetConfigFile(file)
+
+			if err := viper.ReadInConfig(); err != nil {
+				t.Fatal(err)
+			}
+
+			SetRunning(viper.GetViper())
+
+			running := viper.GetString(keys.ActionPollingInterval)
+
+			if err := os.WriteFile(file, []byte(tt.update), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, changed, err := Reload()
+
+			switch {
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error (%s)", err)
+			case !reflect.DeepEqual(changed, tt.wantChanged):
+				t.Fatalf("changed = %v, want %v", changed, tt.wantChanged)
+			case cfg.GetString(keys.ActionPollingInterval) != tt.wantAction:
+				t.Fatalf("action poll interval = %s, want %s", cfg.GetString(keys.ActionPollingInterval), tt.wantAction)
+			}
+
+			// the global settings are not changed by a reload
+			if got := viper.GetString(keys.ActionPollingInterval); got != running {
+				t.Fatalf("global action poll interval = %s, want %s", got, running)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/alecthomas/units"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/selfupdate"
+	"github.com/circonus/agent-manager/internal/splay"
+	"github.com/circonus/agent-manager/internal/window"
+	"github.com/spf13/viper"
+)
+
+const (
+	// MaxTags is the maximum number of custom tags.
+	MaxTags = 32
+	// MaxTagLen is the maximum length of a custom tag.
+	MaxTagLen = 256
+)
+
+// SupportedAWSEC2Tags are the instance identity document attributes which can be
+// added to the registration meta data.
+var SupportedAWSEC2Tags = []string{
+	"account_id",
+	"architecture",
+	"availability_zone",
+	"image_id",
+	"instance_id",
+	"instance_type",
+	"kernel_id",
+	"pending_time",
+	"private_ip",
+	"ramdisk_id",
+	"region",
+	"version",
+}
+
+// durationBounds are the sane ranges for interval and timeout settings.
+var durationBounds = []struct {
+	key    string
+	min    time.Duration
+	max    time.Duration
+	zeroOK bool // zero has a meaning (e.g. use the default)
+}{
+	{key: keys.ActionPollingInterval, min: 5 * time.Second, max: time.Hour},
+	{key: keys.TrackerPollingInterval, min: time.Minute, max: 24 * time.Hour},
+	{key: keys.StatusPollingInterval, min: 30 * time.Second, max: 24 * time.Hour},
+	{key: keys.DiscoveryPollingInterval, min: time.Minute, max: 24 * time.Hour},
+	{key: keys.StatusCheckInterval, min: time.Second, max: time.Hour, zeroOK: true}, // zero, same as status poll interval
+	{key: keys.StatusReportTimeout, min: 30 * time.Second, max: 24 * time.Hour},
+	{key: keys.DrainTimeout, min: time.Second, max: 10 * time.Minute, zeroOK: true}, // zero, do not wait
+	{key: keys.SplayMax, min: time.Second, max: time.Hour, zeroOK: true},            // zero, disabled
+	{key: keys.SelfUpdateHealthTimeout, min: 10 * time.Second, max: 30 * time.Minute},
+	{key: keys.ServerReadTimeout, min: time.Second, max: time.Hour},
+	{key: keys.ServerWriteTimeout, min: time.Second, max: time.Hour},
+	{key: keys.ServerIdleTimeout, min: time.Second, max: time.Hour},
+	{key: keys.ServerReadHeaderTimeout, min: time.Second, max: time.Hour},
+	{key: keys.ServerHandlerTimeout, min: time.Second, max: time.Hour},
+}
+
+// validate checks the settings in v, all problems are reported together.
+func validate(v *viper.Viper) error {
+	var errs []error
+
+	for _, b := range durationBounds {
+		d, err := duration(v, b.key)
+
+		switch {
+		case err != nil:
+			errs = append(errs, err)
+		case d == 0 && b.zeroOK:
+		case d < b.min:
+			errs = append(errs, fmt.Errorf("%s: %s is less than the minimum %s", b.key, d, b.min))
+		case d > b.max:
+			errs = append(errs, fmt.Errorf("%s: %s is more than the maximum %s", b.key, d, b.max))
+		}
+	}
+
+	if v.IsSet(keys.LogLevel) {
+		if _, err := parseLogLevel(v.GetString(keys.LogLevel)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", keys.LogLevel, err))
+		}
+	}
+
+	errs = append(errs, validateAPIURL(v))
+	errs = append(errs, validateTLS(v))
+	errs = append(errs, validateAWSEC2Tags(v.GetStringSlice(keys.AWSEC2Tags))...)
+	errs = append(errs, validateTags(v.GetStringSlice(keys.Tags))...)
+	errs = append(errs, validateOptions(v)...)
+
+	return errors.Join(errs...)
+}
+
+func duration(v *viper.Viper, key string) (time.Duration, error) {
+	d, err := time.ParseDuration(v.GetString(key))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+
+	return d, nil
+}
+
+func validateAPIURL(v *viper.Viper) error {
+	raw := v.GetString(keys.APIURL)
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%s: %w", keys.APIURL, err)
+	}
+
+	if u.Host == "" {
+		return fmt.Errorf("%s: %q is not an absolute url (e.g. https://host/path)", keys.APIURL, raw)
+	}
+
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if v.GetBool(keys.APIAllowHTTP) {
+			return nil
+		}
+
+		return fmt.Errorf("%s: %q is not https, see --api-allow-http", keys.APIURL, raw)
+	default:
+		return fmt.Errorf("%s: unsupported scheme %q", keys.APIURL, u.Scheme)
+	}
+}
+
+func validateTLS(v *viper.Viper) error {
+	if !v.GetBool(keys.ServerTLSEnable) {
+		return nil
+	}
+
+	cert := v.GetString(keys.ServerTLSCertFile)
+	key := v.GetString(keys.ServerTLSKeyFile)
+
+	var errs []error
+
+	for _, f := range []struct{ key, file string }{
+		{key: keys.ServerTLSCertFile, file: cert},
+		{key: keys.ServerTLSKeyFile, file: key},
+	} {
+		k, file := f.key, f.file
+
+		if file == "" {
+			errs = append(errs, fmt.Errorf("%s: required when %s is enabled", k, keys.ServerTLSEnable))
+
+			continue
+		}
+
+		if _, err := os.Stat(file); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", k, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	if _, err := tls.LoadX509KeyPair(cert, key); err != nil {
+		return fmt.Errorf("%s/%s: %w", keys.ServerTLSCertFile, keys.ServerTLSKeyFile, err)
+	}
+
+	return nil
+}
+
+func validateAWSEC2Tags(tags []string) []error {
+	var errs []error
+
+	for _, tag := range tags {
+		ok := false
+
+		for _, s := range SupportedAWSEC2Tags {
+			if tag == s {
+				ok = true
+
+				break
+			}
+		}
+
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unsupported tag %q (supported: %s)",
+				keys.AWSEC2Tags, tag, strings.Join(SupportedAWSEC2Tags, ", ")))
+		}
+	}
+
+	return errs
+}
+
+// validateTags checks custom tags are key:value pairs within the limits.
+func validateTags(tags []string) []error {
+	var errs []error
+
+	if len(tags) > MaxTags {
+		errs = append(errs, fmt.Errorf("%s: too many tags (%d), max %d", keys.Tags, len(tags), MaxTags))
+	}
+
+	for _, tag := range tags {
+		if len(tag) > MaxTagLen {
+			errs = append(errs, fmt.Errorf("%s: tag %.32q... is too long (%d), max %d", keys.Tags, tag, len(tag), MaxTagLen))
+
+			continue
+		}
+
+		if k, _, found := strings.Cut(tag, ":"); !found || strings.TrimSpace(k) == "" {
+			errs = append(errs, fmt.Errorf("%s: tag %q is not key:value", keys.Tags, tag))
+
+			continue
+		}
+
+		for _, r := range tag {
+			if !unicode.IsPrint(r) {
+				errs = append(errs, fmt.Errorf("%s: tag %q contains a non-printable character", keys.Tags, tag))
+
+				break
+			}
+		}
+	}
+
+	return errs
+}
+
+// validateOptions checks settings with a fixed set of values or a specific format.
+func validateOptions(v *viper.Viper) []error {
+	var errs []error
+
+	oneOf := func(key string, options ...string) {
+		val := v.GetString(key)
+		for _, o := range options {
+			if strings.EqualFold(val, o) {
+				return
+			}
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %q is not one of %s", key, val, strings.Join(options, ", ")))
+	}
+
+	oneOf(keys.ContainerReload, "restart", "signal", "exec")
+	oneOf(keys.TracingExporter, "", "none", "otlp", "stdout", "file")
+
+	if strings.EqualFold(v.GetString(keys.TracingExporter), "file") && v.GetString(keys.TracingFile) == "" {
+		errs = append(errs, fmt.Errorf("%s: required for the file exporter", keys.TracingFile))
+	}
+
+	if j := v.GetFloat64(keys.PollJitter); j < 0 || j > splay.MaxJitter {
+		errs = append(errs, fmt.Errorf("%s: %v is not between 0 and %v", keys.PollJitter, j, splay.MaxJitter))
+	}
+
+	if r := v.GetFloat64(keys.TracingSampleRatio); r < 0 || r > 1 {
+		errs = append(errs, fmt.Errorf("%s: %v is not between 0 and 1", keys.TracingSampleRatio, r))
+	}
+
+	if ttl := v.GetString(keys.SecretsCacheTTL); ttl != "" {
+		if _, err := time.ParseDuration(ttl); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", keys.SecretsCacheTTL, err))
+		}
+	}
+
+	for _, pattern := range v.GetStringSlice(keys.SecretsEnvAllow) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", keys.SecretsEnvAllow, pattern, err))
+		}
+	}
+
+	if v.GetBool(keys.AuditEnable) {
+		if _, err := units.ParseBase2Bytes(v.GetString(keys.AuditMaxSize)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", keys.AuditMaxSize, err))
+		}
+	}
+
+	if _, err := window.Parse(v.Get(keys.ChangeWindows)); err != nil {
+		errs = append(errs, err)
+	}
+
+	if v.GetBool(keys.SelfUpdateEnable) {
+		if _, err := selfupdate.ParsePublicKey(v.GetString(keys.SelfUpdatePublicKey)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", keys.SelfUpdatePublicKey, err))
+		}
+
+		if strings.TrimSpace(v.GetString(keys.SelfUpdateRestart)) == "" {
+			errs = append(errs, fmt.Errorf("%s: required to self-update", keys.SelfUpdateRestart))
+		}
+	}
+
+	if until := v.GetString(keys.MaintenanceUntil); until != "" {
+		if d, err := time.ParseDuration(until); err == nil {
+			if d <= 0 {
+				errs = append(errs, fmt.Errorf("%s: %s must be positive", keys.MaintenanceUntil, until))
+			}
+		} else if _, err := time.Parse(time.RFC3339, until); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %q is not a duration or RFC3339 time", keys.MaintenanceUntil, until))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/config/defaults"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/spf13/viper"
+)
+
+// setDefaults sets the defaults validated (normally set with the command line flags).
+func setDefaults(v *viper.Viper) {
+	for key, val := range map[string]any{
+		keys.APIURL:                   defaults.APIURL,
+		keys.ActionPollingInterval:    defaults.ActionPollingInterval,
+		keys.TrackerPollingInterval:   defaults.TrackerPollingInterval,
+		keys.StatusPollingInterval:    defaults.StatusPollingInterval,
+		keys.DiscoveryPollingInterval: defaults.DiscoveryPollingInterval,
+		keys.StatusCheckInterval:      defaults.StatusCheckInterval,
+		keys.StatusReportTimeout:      defaults.StatusReportTimeout,
+		keys.DrainTimeout:             defaults.DrainTimeout,
+		keys.SplayMax:                 defaults.SplayMax,
+		keys.PollJitter:               defaults.PollJitter,
+		keys.ServerReadTimeout:        defaults.ServerReadTimeout,
+		keys.ServerWriteTimeout:       defaults.ServerWriteTimeout,
+		keys.ServerIdleTimeout:        defaults.ServerIdleTimeout,
+		keys.ServerReadHeaderTimeout:  defaults.ServerReadHeaderTimeout,
+		keys.ServerHandlerTimeout:     defaults.ServerHandlerTimeout,
+		keys.LogLevel:                 defaults.LogLevel,
+		keys.ContainerReload:          defaults.ContainerReload,
+		keys.TracingExporter:          defaults.TracingExporter,
+		keys.TracingSampleRatio:       defaults.TracingSampleRatio,
+		keys.AuditEnable:              defaults.AuditEnable,
+		keys.AuditMaxSize:             defaults.AuditMaxSize,
+		keys.SelfUpdateHealthTimeout:  defaults.SelfUpdateHealthTimeout,
+		keys.SelfUpdateRestart:        defaults.SelfUpdateRestart,
+	} {
+		v.SetDefault(key, val)
+	}
+}
+
+// writeCert writes a self-signed certificate and its key, returning the file names.
+func writeCert(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	certA, keyA := writeCert(t, dir, "a")
+	_, keyB := writeCert(t, dir, "b")
+
+	tests := []struct {
+		settings map[string]any
+		name     string
+		wantErrs []string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name: "intervals out of bounds",
+			settings: map[string]any{
+				keys.ActionPollingInterval:  "1s",
+				keys.TrackerPollingInterval: "48h",
+				keys.StatusCheckInterval:    "0s",
+				keys.ServerReadTimeout:      "soon",
+				keys.SplayMax:               "2h",
+			},
+			wantErrs: []string{
+				"action_poll_interval: 1s is less than the minimum 5s",
+				"tracker_poll_interval: 48h0m0s is more than the maximum 24h0m0s",
+				"server.read_timeout: time: invalid duration",
+				"splay_max: 2h0m0s is more than the maximum 1h0m0s",
+			},
+		},
+		{
+			name:     "api url http",
+			settings: map[string]any{keys.APIURL: "http://api.example.com/v1"},
+			wantErrs: []string{"is not https"},
+		},
+		{
+			name:     "api url http allowed",
+			settings: map[string]any{keys.APIURL: "http://127.0.0.1:8080/v1", keys.APIAllowHTTP: true},
+		},
+		{
+			name:     "api url relative",
+			settings: map[string]any{keys.APIURL: "api.example.com/v1"},
+			wantErrs: []string{"is not an absolute url"},
+		},
+		{
+			name:     "tls",
+			settings: map[string]any{keys.ServerTLSEnable: true, keys.ServerTLSCertFile: certA, keys.ServerTLSKeyFile: keyA},
+		},
+		{
+			name:     "tls missing files",
+			settings: map[string]any{keys.ServerTLSEnable: true, keys.ServerTLSCertFile: filepath.Join(dir, "missing.crt")},
+			wantErrs: []string{"server.tls_cert_file: stat", "server.tls_key_file: required"},
+		},
+		{
+			name:     "tls mismatched",
+			settings: map[string]any{keys.ServerTLSEnable: true, keys.ServerTLSCertFile: certA, keys.ServerTLSKeyFile: keyB},
+			wantErrs: []string{"private key does not match public key"},
+		},
+		{
+			name:     "tags",
+			settings: map[string]any{keys.Tags: []string{"env:prod", "nope", ":empty", "bad:\x01"}, keys.AWSEC2Tags: []string{"region", "hostname"}},
+			wantErrs: []string{`tag "nope" is not key:value`, `tag ":empty" is not key:value`, "non-printable", `unsupported tag "hostname"`},
+		},
+		{
+			name:     "options",
+			settings: map[string]any{keys.ContainerReload: "kill", keys.TracingExporter: "file", keys.TracingSampleRatio: 2, keys.PollJitter: 0.9},
+			wantErrs: []string{"container.reload", "tracing.file: required", "tracing.sample_ratio", "poll_jitter: 0.9 is not between 0 and 0.5"},
+		},
+		{
+			name: "change windows",
+			settings: map[string]any{keys.ChangeWindows: []any{
+				map[string]any{"schedule": "0 2 * * sat", "duration": "4h", "timezone": "Europe/London"},
+				map[string]any{"schedule": "0 25 * * *", "duration": "1h"},
+			}},
+			wantErrs: []string{"change_windows[1]: schedule \"0 25 * * *\": hour: 25 out of range 0-23"},
+		},
+		{
+			name:     "self-update",
+			settings: map[string]any{keys.SelfUpdateEnable: true, keys.SelfUpdatePublicKey: "bm9wZQ==", keys.SelfUpdateHealthTimeout: "1s"},
+			wantErrs: []string{"self_update.public_key: invalid ed25519 public key", "self_update.health_timeout: 1s is less than the minimum 10s"},
+		},
+		{
+			name:     "log level",
+			settings: map[string]any{keys.LogLevel: "verbose"},
+			wantErrs: []string{"unknown log level (verbose)"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			setDefaults(v)
+
+			for key, val := range tt.settings {
+				v.Set(key, val)
+			}
+
+			err := validate(v)
+
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error (%s)", err)
+				}
+
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected error")
+			}
+
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected %q in:\n%s", want, err)
+				}
+			}
+
+			// all problems reported, one per line
+			if got := len(strings.Split(err.Error(), "\n")); got != len(tt.wantErrs) {
+				t.Errorf("expected %d problems, got %d:\n%s", len(tt.wantErrs), got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// settle is how long the config file must be unchanged before a reload, editors
+// and config management tools may write it in several steps.
+const settle = time.Second
+
+// Watch calls changed when the config file is written, created, or replaced,
+// until the context is done. The directory is watched, editors and config
+// management tools often replace the file rather than write it in place.
+func Watch(ctx context.Context, file string, changed func()) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("config watcher: %w", err)
+	}
+
+	file = filepath.Clean(file)
+
+	if err := w.Add(filepath.Dir(file)); err != nil {
+		w.Close()
+
+		return fmt.Errorf("watching %s: %w", filepath.Dir(file), err)
+	}
+
+	go func() {
+		defer w.Close()
+
+		t := time.NewTimer(settle)
+		t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				t.Stop()
+
+				return
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+
+				if filepath.Clean(ev.Name) != file || !ev.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+					continue
+				}
+
+				t.Reset(settle)
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+
+				log.Warn().Err(err).Str("file", file).Msg("config watcher")
+			case <-t.C:
+				changed()
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,263 @@
+// Package container is a minimal client for the Docker engine API (also served by
+// Podman's compatibility API) over the local unix socket.
+package container
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// NOTE: the host is ignored, all requests go to the unix socket.
+const baseURL = "http://engine"
+
+type Client struct {
+	http *http.Client
+}
+
+type Container struct {
+	Labels map[string]string `json:"Labels"`
+	ID     string            `json:"Id"`
+	State  string            `json:"State"`
+	Status string            `json:"Status"`
+	Names  []string          `json:"Names"`
+}
+
+type State struct {
+	Health     *Health `json:"Health,omitempty"`
+	Status     string  `json:"Status"`
+	Error      string  `json:"Error,omitempty"`
+	StartedAt  string  `json:"StartedAt"`
+	FinishedAt string  `json:"FinishedAt"`
+	ExitCode   int     `json:"ExitCode"`
+	Pid        int     `json:"Pid"`
+	Running    bool    `json:"Running"`
+	Restarting bool    `json:"Restarting"`
+	OOMKilled  bool    `json:"OOMKilled"`
+	Dead       bool    `json:"Dead"`
+}
+
+type Health struct {
+	Status        string `json:"Status"`
+	FailingStreak int    `json:"FailingStreak"`
+}
+
+type Inspect struct {
+	State        State  `json:"State"`
+	ID           string `json:"Id"`
+	Name         string `json:"Name"`
+	RestartCount int    `json:"RestartCount"`
+}
+
+// New returns a client for the engine API listening on the unix socket.
+func New(socket string) *Client {
+	return &Client{
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+
+					return d.DialContext(ctx, "unix", socket)
+				},
+				MaxIdleConns:    2,
+				IdleConnTimeout: 30 * time.Second,
+			},
+		},
+	}
+}
+
+// List returns all containers (running or not) with the label set to the value.
+func (c *Client) List(ctx context.Context, label, value string) ([]Container, error) {
+	filters, err := json.Marshal(map[string][]string{"label": {label + "=" + value}})
+	if err != nil {
+		return nil, fmt.Errorf("marshal filters: %w", err)
+	}
+
+	q := url.Values{}
+	q.Set("all", "true")
+	q.Set("filters", string(filters))
+
+	var containers []Container
+
+	if err := c.call(ctx, http.MethodGet, "/containers/json?"+q.Encode(), nil, http.StatusOK, &containers); err != nil {
+		return nil, fmt.Errorf("list containers: %w", err)
+	}
+
+	return containers, nil
+}
+
+// Inspect returns the details of the container.
+func (c *Client) Inspect(ctx context.Context, id string) (*Inspect, error) {
+	var inspect Inspect
+
+	if err := c.call(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/json", nil, http.StatusOK, &inspect); err != nil {
+		return nil, fmt.Errorf("inspect container: %w", err)
+	}
+
+	return &inspect, nil
+}
+
+// Restart the container, the engine waits timeout for it to stop before killing it.
+func (c *Client) Restart(ctx context.Context, id string, timeout time.Duration) error {
+	q := url.Values{}
+	q.Set("t", strconv.Itoa(int(timeout.Seconds())))
+
+	if err := c.call(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/restart?"+q.Encode(), nil, http.StatusNoContent, nil); err != nil {
+		return fmt.Errorf("restart container: %w", err)
+	}
+
+	return nil
+}
+
+// Kill sends the signal (e.g. SIGHUP) to the container.
+func (c *Client) Kill(ctx context.Context, id, signal string) error {
+	q := url.Values{}
+	q.Set("signal", signal)
+
+	if err := c.call(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/kill?"+q.Encode(), nil, http.StatusNoContent, nil); err != nil {
+		return fmt.Errorf("signal container: %w", err)
+	}
+
+	return nil
+}
+
+// Exec runs the command in the container, returning the combined output and exit code.
+func (c *Client) Exec(ctx context.Context, id string, cmd []string) ([]byte, int, error) {
+	create := map[string]any{
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"Cmd":          cmd,
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+
+	if err := c.call(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/exec", create, http.StatusCreated, &created); err != nil {
+		return nil, -1, fmt.Errorf("create exec: %w", err)
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/exec/"+url.PathEscape(created.ID)+"/start", map[string]any{"Detach": false, "Tty": false})
+	if err != nil {
+		return nil, -1, fmt.Errorf("start exec: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+
+		return nil, -1, fmt.Errorf("start exec: non-200 response -- status: %s, body: %s", resp.Status, string(body))
+	}
+
+	output, err := demux(resp.Body)
+	if err != nil {
+		return output, -1, fmt.Errorf("reading exec output: %w", err)
+	}
+
+	var inspect struct {
+		ExitCode int  `json:"ExitCode"`
+		Running  bool `json:"Running"`
+	}
+
+	if err := c.call(ctx, http.MethodGet, "/exec/"+url.PathEscape(created.ID)+"/json", nil, http.StatusOK, &inspect); err != nil {
+		return output, -1, fmt.Errorf("inspect exec: %w", err)
+	}
+
+	if inspect.ExitCode != 0 {
+		return output, inspect.ExitCode, fmt.Errorf("exec exit code %d", inspect.ExitCode)
+	}
+
+	return output, 0, nil
+}
+
+// demux combines the stdout/stderr frames of a non-tty attached stream, each frame
+// has an 8 byte header [stream, 0, 0, 0, size (big endian uint32)].
+func demux(r io.Reader) ([]byte, error) {
+	var (
+		out    bytes.Buffer
+		header [8]byte
+	)
+
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return out.Bytes(), nil
+			}
+
+			return out.Bytes(), err
+		}
+
+		size := binary.BigEndian.Uint32(header[4:])
+
+		if _, err := io.CopyN(&out, r, int64(size)); err != nil {
+			return out.Bytes(), err
+		}
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, payload any) (*http.Response, error) {
+	var body io.Reader
+
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("marshal payload: %w", err)
+		}
+
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling engine api: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (c *Client) call(ctx context.Context, method, path string, payload any, wantStatus int, result any) error {
+	resp, err := c.do(ctx, method, path, payload)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading response body: %w", err)
+	}
+
+	if resp.StatusCode != wantStatus {
+		return fmt.Errorf("non-%d response -- status: %s, body: %s", wantStatus, resp.Status, string(body))
+	}
+
+	if result == nil || len(body) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("parsing response: %w", err)
+	}
+
+	return nil
+}
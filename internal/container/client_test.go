@@ -0,0 +1,165 @@
+package container
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeEngine serves a minimal engine API on a unix socket.
+func fakeEngine(t *testing.T, calls *[]string) string {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "engine.sock")
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		var filters map[string][]string
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		if !reflect.DeepEqual(filters["label"], []string{"com.circonus.agent=telegraf"}) {
+			_, _ = w.Write([]byte(`[]`))
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`[{"Id":"c1","Names":["/telegraf"],"State":"running","Status":"Up 2 hours","Labels":{"com.circonus.agent":"telegraf"}}]`))
+	})
+
+	mux.HandleFunc("/containers/c1/json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Id":"c1","Name":"/telegraf","RestartCount":1,"State":{"Status":"running","Running":true,"Pid":42,"Health":{"Status":"healthy"}}}`))
+	})
+
+	mux.HandleFunc("/containers/c1/restart", func(w http.ResponseWriter, r *http.Request) {
+		*calls = append(*calls, "restart t="+r.URL.Query().Get("t"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("/containers/c1/kill", func(w http.ResponseWriter, r *http.Request) {
+		*calls = append(*calls, "kill "+r.URL.Query().Get("signal"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("/containers/c1/exec", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Cmd []string `json:"Cmd"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		*calls = append(*calls, "exec "+req.Cmd[0])
+
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"Id":"e1"}`))
+	})
+
+	mux.HandleFunc("/exec/e1/start", func(w http.ResponseWriter, r *http.Request) {
+		for _, frame := range []struct {
+			data   string
+			stream byte
+		}{
+			{"reloading\n", 1},
+			{"warning\n", 2},
+		} {
+			header := make([]byte, 8)
+			header[0] = frame.stream
+			binary.BigEndian.PutUint32(header[4:], uint32(len(frame.data)))
+
+			_, _ = w.Write(header)
+			_, _ = w.Write([]byte(frame.data))
+		}
+	})
+
+	mux.HandleFunc("/exec/e1/json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ExitCode":0,"Running":false}`))
+	})
+
+	ts := httptest.NewUnstartedServer(mux)
+	ts.Listener = l
+	ts.Start()
+
+	t.Cleanup(ts.Close)
+
+	return socket
+}
+
+func TestClient(t *testing.T) {
+	var calls []string
+
+	c := New(fakeEngine(t, &calls))
+	ctx := context.Background()
+
+	containers, err := c.List(ctx, "com.circonus.agent", "telegraf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(containers) != 1 || containers[0].ID != "c1" {
+		t.Fatalf("List() = %+v", containers)
+	}
+
+	containers, err = c.List(ctx, "com.circonus.agent", "fluent-bit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(containers) != 0 {
+		t.Fatalf("List() = %+v, expected none", containers)
+	}
+
+	inspect, err := c.Inspect(ctx, "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !inspect.State.Running || inspect.State.Health == nil || inspect.State.Health.Status != "healthy" || inspect.RestartCount != 1 {
+		t.Fatalf("Inspect() = %+v", inspect)
+	}
+
+	if _, err := c.Inspect(ctx, "missing"); err == nil {
+		t.Fatal("expected error inspecting missing container")
+	}
+
+	if err := c.Restart(ctx, "c1", 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Kill(ctx, "c1", "SIGHUP"); err != nil {
+		t.Fatal(err)
+	}
+
+	output, code, err := c.Exec(ctx, "c1", []string{"reload"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code != 0 || string(output) != "reloading\nwarning\n" {
+		t.Fatalf("Exec() = %q, %d", string(output), code)
+	}
+
+	want := []string{"restart t=10", "kill SIGHUP", "exec reload"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
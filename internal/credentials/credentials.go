@@ -1,10 +1,12 @@
 package credentials
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 
+	"github.com/circonus/agent-manager/internal/audit"
 	"github.com/circonus/agent-manager/internal/config/keys"
 	"github.com/spf13/viper"
 )
@@ -35,7 +37,7 @@ func SaveJWT(creds []byte) error {
 		return fmt.Errorf("invalid credential token (empty)")
 	}
 
-	return write(file, creds)
+	return write("jwt", file, creds)
 }
 
 func LoadManagerID() error {
@@ -64,7 +66,7 @@ func SaveManagerID(creds []byte) error {
 		return fmt.Errorf("invalid manager id (empty)")
 	}
 
-	return write(file, creds)
+	return write("manager_id", file, creds)
 }
 
 func LoadRefreshToken() error {
@@ -93,7 +95,7 @@ func SaveRefreshToken(creds []byte) error {
 		return fmt.Errorf("invalid refresh token (empty)")
 	}
 
-	return write(file, creds)
+	return write("refresh_token", file, creds)
 }
 
 func LoadMachineID() error {
@@ -122,7 +124,7 @@ func SaveMachineID(creds []byte) error {
 		return fmt.Errorf("invalid machine id (empty)")
 	}
 
-	return write(file, creds)
+	return write("machine_id", file, creds)
 }
 
 func read(file string) ([]byte, error) {
@@ -134,8 +136,23 @@ func read(file string) ([]byte, error) {
 	return data, nil
 }
 
-func write(file string, data []byte) error {
-	return os.WriteFile(file, data, 0o600)
+// write saves a credential, recording the change (never the credential) in the audit log.
+func write(name, file string, data []byte) error {
+	err := os.WriteFile(file, data, 0o600)
+
+	e := audit.Entry{
+		Event:  audit.EventCredential,
+		Path:   file,
+		Detail: name,
+	}
+
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	audit.Record(context.Background(), e)
+
+	return err //nolint:wrapcheck
 }
 
 func DoesFileExist(file string) bool {
@@ -8,19 +8,29 @@ import (
 	"net/url"
 	"os"
 
+	"github.com/circonus/agent-manager/internal/audit"
 	"github.com/circonus/agent-manager/internal/config/keys"
 	"github.com/circonus/agent-manager/internal/credentials"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 )
 
-func Start(ctx context.Context) error {
+func Start(ctx context.Context) (err error) {
 	log.Debug().Msg("loading manager id")
 
 	if err := credentials.LoadManagerID(); err != nil {
 		return fmt.Errorf("loading manager id: %w", err)
 	}
 
+	defer func() {
+		e := audit.Entry{Event: audit.EventDecommission}
+		if err != nil {
+			e.Error = err.Error()
+		}
+
+		audit.Record(ctx, e)
+	}()
+
 	if err := credentials.LoadJWT(); err != nil {
 		return fmt.Errorf("loading API credentials: %w", err)
 	}
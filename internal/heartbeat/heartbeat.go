@@ -0,0 +1,77 @@
+package heartbeat
+
+import (
+	"sync"
+	"time"
+)
+
+// tracks when the manager's background loops last ran and last succeeded,
+// used by the /livez and /readyz endpoints.
+
+const (
+	ActionPoll   = "action_poll"
+	StatusReport = "status_report"
+	Tracker      = "tracker"
+	Discovery    = "discovery"
+)
+
+// Component is the state of a background loop.
+type Component struct {
+	LastRun   time.Time
+	LastOK    time.Time
+	LastError string
+}
+
+var (
+	started    = time.Now()
+	components = map[string]Component{}
+	mu         sync.Mutex
+)
+
+// Ran records a completed iteration of the named loop, successful if err is nil.
+func Ran(name string, err error) {
+	now := time.Now()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := components[name]
+	c.LastRun = now
+
+	if err != nil {
+		c.LastError = err.Error()
+	} else {
+		c.LastOK = now
+		c.LastError = ""
+	}
+
+	components[name] = c
+}
+
+// Get returns the state of the named loop, false if it has not run yet.
+func Get(name string) (Component, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	c, ok := components[name]
+
+	return c, ok
+}
+
+// Started returns when the manager started, loops which have not run
+// yet are measured from this time.
+func Started() time.Time {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return started
+}
+
+// Reset forgets all loop state (e.g. for tests).
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	started = time.Now()
+	components = map[string]Component{}
+}
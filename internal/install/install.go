@@ -0,0 +1,345 @@
+// Package install installs, upgrades and uninstalls agents from the package
+// definitions in the agent inventory, with the host's package manager (apt, dnf or
+// yum) or by downloading a deb, rpm or tarball and verifying its sha256 checksum.
+package install
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/audit"
+	"github.com/circonus/agent-manager/internal/inventory"
+	"github.com/rs/zerolog/log"
+)
+
+// operations.
+const (
+	Install   = "install"
+	Upgrade   = "upgrade"
+	Uninstall = "uninstall"
+)
+
+// package kinds.
+const (
+	kindRepo    = "repo"
+	kindDeb     = "deb"
+	kindRPM     = "rpm"
+	kindTarball = "tarball"
+)
+
+// package managers.
+const (
+	managerApt = "apt"
+	managerDnf = "dnf"
+	managerYum = "yum"
+)
+
+// timeout is how long an operation (download and package manager) may take.
+const timeout = 10 * time.Minute
+
+// lookPath finds package manager executables, replaced in tests.
+var lookPath = exec.LookPath
+
+// Run performs the operation (install, upgrade or uninstall) for the agent's package,
+// returning the combined output and exit code. It is recorded in the audit log.
+func Run(ctx context.Context, agentType, op string, pkg *inventory.Package) (output []byte, code int, err error) {
+	if pkg == nil {
+		return nil, -1, fmt.Errorf("no package defined for %s", agentType)
+	}
+
+	switch op {
+	case Install, Upgrade, Uninstall:
+	default:
+		return nil, -1, fmt.Errorf("unsupported package operation (%s)", op)
+	}
+
+	kind, err := packageKind(*pkg)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	start := time.Now()
+
+	e := audit.Entry{Event: audit.EventPackage, Agent: agentType, Command: op + " " + source(*pkg)}
+
+	defer func() {
+		e.ExitCode = audit.ExitCode(code)
+		e.Duration = time.Since(start).String()
+
+		if err != nil {
+			e.Error = err.Error()
+		}
+
+		audit.Record(ctx, e)
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var file string
+
+	if kind != kindRepo && op != Uninstall {
+		f, sum, err := download(ctx, *pkg, kind)
+		if err != nil {
+			return nil, -1, err
+		}
+
+		defer os.Remove(f)
+
+		file = f
+		e.NewChecksum = sum
+	}
+
+	if kind == kindTarball {
+		if op == Uninstall {
+			output, err = removeTarball(agentType, *pkg)
+		} else {
+			output, err = extractTarball(file, agentType, *pkg)
+		}
+
+		if err != nil {
+			return output, -1, err
+		}
+
+		return output, 0, nil
+	}
+
+	manager, err := packageManager(kind, pkg.Manager)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	cmds, err := commands(manager, op, *pkg, file)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	return run(ctx, manager, cmds)
+}
+
+// Tarball returns true if the package is a tarball, which is not managed by a
+// package manager (e.g. the agent is not restarted by package scripts on upgrade).
+func Tarball(pkg *inventory.Package) bool {
+	if pkg == nil {
+		return false
+	}
+
+	kind, err := packageKind(*pkg)
+
+	return err == nil && kind == kindTarball
+}
+
+func packageKind(pkg inventory.Package) (string, error) {
+	if pkg.URL == "" {
+		if pkg.Name == "" {
+			return "", fmt.Errorf("package has no name or url")
+		}
+
+		return kindRepo, nil
+	}
+
+	u, err := url.Parse(pkg.URL)
+	if err != nil {
+		return "", fmt.Errorf("package url: %w", err)
+	}
+
+	p := strings.ToLower(u.Path)
+
+	switch {
+	case strings.HasSuffix(p, ".deb"):
+		return kindDeb, nil
+	case strings.HasSuffix(p, ".rpm"):
+		return kindRPM, nil
+	case strings.HasSuffix(p, ".tar.gz"), strings.HasSuffix(p, ".tgz"):
+		return kindTarball, nil
+	default:
+		return "", fmt.Errorf("unsupported package url (%s), expected .deb, .rpm, .tar.gz or .tgz", pkg.URL)
+	}
+}
+
+// source describes the package for the audit log.
+func source(pkg inventory.Package) string {
+	s := pkg.Name
+	if pkg.URL != "" {
+		s = pkg.URL
+	}
+
+	if pkg.Version != "" {
+		s += " (" + pkg.Version + ")"
+	}
+
+	return s
+}
+
+// packageManager returns the configured package manager, or the first found which can
+// install the kind of package.
+func packageManager(kind, configured string) (string, error) {
+	candidates := map[string][]string{
+		kindRepo: {managerApt, managerDnf, managerYum},
+		kindDeb:  {managerApt},
+		kindRPM:  {managerDnf, managerYum},
+	}[kind]
+
+	if configured != "" {
+		for _, m := range candidates {
+			if m == configured {
+				return m, nil
+			}
+		}
+
+		return "", fmt.Errorf("package manager %s cannot install %s packages", configured, kind)
+	}
+
+	for _, m := range candidates {
+		if _, err := lookPath(executable(m)); err == nil {
+			return m, nil
+		}
+	}
+
+	return "", fmt.Errorf("no package manager found for %s packages (%s)", kind, strings.Join(candidates, ", "))
+}
+
+func executable(manager string) string {
+	if manager == managerApt {
+		return "apt-get"
+	}
+
+	return manager
+}
+
+// commands returns the package manager commands for the operation, file is the
+// downloaded package (if any).
+func commands(manager, op string, pkg inventory.Package, file string) ([][]string, error) {
+	exe := executable(manager)
+
+	if op == Uninstall {
+		if pkg.Name == "" {
+			return nil, fmt.Errorf("package name required to uninstall")
+		}
+
+		return [][]string{{exe, "remove", "-y", pkg.Name}}, nil
+	}
+
+	if file != "" {
+		return [][]string{{exe, "install", "-y", file}}, nil
+	}
+
+	name := pkg.Name
+
+	if manager == managerApt {
+		if pkg.Version != "" {
+			name += "=" + pkg.Version
+		}
+
+		install := []string{exe, "install", "-y"}
+		if op == Upgrade && pkg.Version == "" {
+			install = append(install, "--only-upgrade")
+		}
+
+		return [][]string{{exe, "update"}, append(install, name)}, nil
+	}
+
+	if pkg.Version != "" {
+		return [][]string{{exe, "install", "-y", name + "-" + pkg.Version}}, nil
+	}
+
+	if op == Upgrade {
+		return [][]string{{exe, "upgrade", "-y", name}}, nil
+	}
+
+	return [][]string{{exe, "install", "-y", name}}, nil
+}
+
+func run(ctx context.Context, manager string, cmds [][]string) ([]byte, int, error) {
+	var output []byte
+
+	for _, args := range cmds {
+		log.Debug().Strs("cmd", args).Msg("package manager")
+
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...) //nolint:gosec
+		if manager == managerApt {
+			cmd.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive")
+		}
+
+		out, err := cmd.CombinedOutput()
+		output = append(output, out...)
+
+		if err != nil {
+			code := -1
+
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				code = exitErr.ExitCode()
+			}
+
+			return output, code, fmt.Errorf("%s: %w", strings.Join(args, " "), err)
+		}
+	}
+
+	return output, 0, nil
+}
+
+// download fetches the package to a temporary file, verifying its checksum. Returns
+// the file, which the caller removes, and the checksum.
+func download(ctx context.Context, pkg inventory.Package, kind string) (string, string, error) {
+	want := strings.ToLower(pkg.SHA256)
+	if len(want) != sha256.Size*2 {
+		return "", "", fmt.Errorf("package sha256 checksum required with url")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pkg.URL, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("downloading package: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("downloading package: non-200 response -- status: %s", resp.Status)
+	}
+
+	ext := map[string]string{kindDeb: ".deb", kindRPM: ".rpm", kindTarball: ".tar.gz"}[kind]
+
+	f, err := os.CreateTemp("", "circonus-am-*"+ext)
+	if err != nil {
+		return "", "", fmt.Errorf("creating package file: %w", err)
+	}
+
+	h := sha256.New()
+
+	_, err = io.Copy(io.MultiWriter(f, h), resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+
+		return "", "", fmt.Errorf("downloading package: %w", err)
+	}
+
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		os.Remove(f.Name())
+
+		return "", "", fmt.Errorf("package checksum mismatch, expected %s got %s", want, got)
+	}
+
+	log.Debug().Str("url", pkg.URL).Str("sha256", want).Msg("package downloaded")
+
+	return f.Name(), want, nil
+}
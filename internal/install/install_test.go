@@ -0,0 +1,310 @@
+package install
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/circonus/agent-manager/internal/inventory"
+	"github.com/rs/zerolog"
+)
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		manager string
+		op      string
+		file    string
+		pkg     inventory.Package
+		want    [][]string
+		wantErr bool
+	}{
+		{
+			name: "apt install", manager: managerApt, op: Install,
+			pkg:  inventory.Package{Name: "telegraf"},
+			want: [][]string{{"apt-get", "update"}, {"apt-get", "install", "-y", "telegraf"}},
+		},
+		{
+			name: "apt install version", manager: managerApt, op: Install,
+			pkg:  inventory.Package{Name: "telegraf", Version: "1.28.5-1"},
+			want: [][]string{{"apt-get", "update"}, {"apt-get", "install", "-y", "telegraf=1.28.5-1"}},
+		},
+		{
+			name: "apt upgrade", manager: managerApt, op: Upgrade,
+			pkg:  inventory.Package{Name: "telegraf"},
+			want: [][]string{{"apt-get", "update"}, {"apt-get", "install", "-y", "--only-upgrade", "telegraf"}},
+		},
+		{
+			name: "apt deb", manager: managerApt, op: Upgrade, file: "/tmp/t.deb",
+			pkg:  inventory.Package{URL: "https://example.com/t.deb"},
+			want: [][]string{{"apt-get", "install", "-y", "/tmp/t.deb"}},
+		},
+		{
+			name: "apt uninstall", manager: managerApt, op: Uninstall,
+			pkg:  inventory.Package{Name: "telegraf"},
+			want: [][]string{{"apt-get", "remove", "-y", "telegraf"}},
+		},
+		{
+			name: "dnf install version", manager: managerDnf, op: Install,
+			pkg:  inventory.Package{Name: "telegraf", Version: "1.28.5-1"},
+			want: [][]string{{"dnf", "install", "-y", "telegraf-1.28.5-1"}},
+		},
+		{
+			name: "dnf upgrade", manager: managerDnf, op: Upgrade,
+			pkg:  inventory.Package{Name: "telegraf"},
+			want: [][]string{{"dnf", "upgrade", "-y", "telegraf"}},
+		},
+		{
+			name: "yum rpm", manager: managerYum, op: Install, file: "/tmp/t.rpm",
+			pkg:  inventory.Package{URL: "https://example.com/t.rpm"},
+			want: [][]string{{"yum", "install", "-y", "/tmp/t.rpm"}},
+		},
+		{
+			name: "uninstall without name", manager: managerDnf, op: Uninstall,
+			pkg:     inventory.Package{URL: "https://example.com/t.rpm"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := commands(tt.manager, tt.op, tt.pkg, tt.file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("commands() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("commands() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPackageManager(t *testing.T) {
+	defer func() { lookPath = exec.LookPath }()
+
+	tests := []struct {
+		name       string
+		kind       string
+		configured string
+		found      []string // executables on the host
+		want       string
+		wantErr    bool
+	}{
+		{name: "repo apt", kind: kindRepo, found: []string{"apt-get", "yum"}, want: managerApt},
+		{name: "repo yum", kind: kindRepo, found: []string{"yum"}, want: managerYum},
+		{name: "rpm prefers dnf", kind: kindRPM, found: []string{"dnf", "yum"}, want: managerDnf},
+		{name: "deb no apt", kind: kindDeb, found: []string{"dnf"}, wantErr: true},
+		{name: "configured", kind: kindRepo, configured: managerYum, want: managerYum},
+		{name: "configured mismatch", kind: kindDeb, configured: managerDnf, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			lookPath = func(file string) (string, error) {
+				for _, f := range tt.found {
+					if f == file {
+						return "/usr/bin/" + file, nil
+					}
+				}
+
+				return "", errors.New("not found")
+			}
+
+			got, err := packageManager(tt.kind, tt.configured)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("packageManager() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("packageManager() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+type entry struct {
+	name     string
+	body     string
+	linkname string
+	dir      bool
+}
+
+func tarball(t *testing.T, entries []entry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o755, Typeflag: tar.TypeReg, Size: int64(len(e.body))}
+
+		switch {
+		case e.dir:
+			hdr.Typeflag = tar.TypeDir
+			hdr.Size = 0
+		case e.linkname != "":
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = e.linkname
+			hdr.Size = 0
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("tar header: %s", err)
+		}
+
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatalf("tar write: %s", err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar close: %s", err)
+	}
+
+	if err := gz.Close(); err != nil {
+		t.Fatalf("gzip close: %s", err)
+	}
+
+	return buf.Bytes()
+}
+
+func checksum(data []byte) string {
+	s := sha256.Sum256(data)
+
+	return hex.EncodeToString(s[:])
+}
+
+func TestRunTarball(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	artifacts := map[string][]byte{
+		"/v1.tar.gz": tarball(t, []entry{
+			{name: "telegraf-1/", dir: true},
+			{name: "telegraf-1/usr/bin/telegraf", body: "v1"},
+			{name: "telegraf-1/usr/lib/old.so", body: "old"},
+			{name: "telegraf-1/../../x/escape", body: "x"},
+		}),
+		"/v2.tar.gz": tarball(t, []entry{
+			{name: "telegraf-2/usr/bin/telegraf", body: "v2"},
+			{name: "telegraf-2/usr/bin/tg", linkname: "telegraf"},
+		}),
+		"/bad-link.tar.gz": tarball(t, []entry{
+			{name: "telegraf-3/usr/bin/tg", linkname: "../../../etc/passwd"},
+		}),
+		// each link resolves inside the prefix, together b is the prefix's parent
+		"/link-chain.tar.gz": tarball(t, []entry{
+			{name: "telegraf-4/a", linkname: "."},
+			{name: "telegraf-4/a/b", linkname: ".."},
+			{name: "telegraf-4/b/x", body: "x"},
+		}),
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := artifacts[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		_, _ = w.Write(data)
+	}))
+	defer ts.Close()
+
+	prefix := filepath.Join(t.TempDir(), "opt", "telegraf")
+	ctx := context.Background()
+
+	pkg := func(name, sum string) *inventory.Package {
+		return &inventory.Package{URL: ts.URL + name, SHA256: sum, Prefix: prefix, StripComponents: 1}
+	}
+
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(prefix, name))
+		if err != nil {
+			return ""
+		}
+
+		return string(data)
+	}
+
+	// install
+	if _, _, err := Run(ctx, "telegraf", Install, pkg("/v1.tar.gz", checksum(artifacts["/v1.tar.gz"]))); err != nil {
+		t.Fatalf("install: %s", err)
+	}
+
+	if got := read("usr/bin/telegraf"); got != "v1" {
+		t.Fatalf("install: telegraf = %q, want v1", got)
+	}
+
+	if got := read("escape"); got != "x" {
+		t.Fatalf("install: path traversal entry not contained in prefix")
+	}
+
+	// checksum mismatch, nothing changed
+	if _, _, err := Run(ctx, "telegraf", Upgrade, pkg("/v2.tar.gz", checksum(artifacts["/v1.tar.gz"]))); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("upgrade: expected checksum mismatch, got %v", err)
+	}
+
+	if _, _, err := Run(ctx, "telegraf", Upgrade, pkg("/v2.tar.gz", "")); err == nil {
+		t.Fatalf("upgrade: expected error without checksum")
+	}
+
+	if got := read("usr/bin/telegraf"); got != "v1" {
+		t.Fatalf("failed upgrade: telegraf = %q, want v1", got)
+	}
+
+	// upgrade, files no longer in the package are removed
+	if _, _, err := Run(ctx, "telegraf", Upgrade, pkg("/v2.tar.gz", checksum(artifacts["/v2.tar.gz"]))); err != nil {
+		t.Fatalf("upgrade: %s", err)
+	}
+
+	if got := read("usr/bin/tg"); got != "v2" {
+		t.Fatalf("upgrade: tg (symlink) = %q, want v2", got)
+	}
+
+	if got := read("usr/lib/old.so"); got != "" {
+		t.Fatalf("upgrade: old.so not removed")
+	}
+
+	if _, _, err := Run(ctx, "telegraf", Upgrade, pkg("/bad-link.tar.gz", checksum(artifacts["/bad-link.tar.gz"]))); err == nil {
+		t.Fatalf("upgrade: expected error for symlink outside prefix")
+	}
+
+	if _, _, err := Run(ctx, "telegraf", Upgrade, pkg("/link-chain.tar.gz", checksum(artifacts["/link-chain.tar.gz"]))); err == nil {
+		t.Fatalf("upgrade: expected error for entry through symlink")
+	}
+
+	if _, err := os.Lstat(filepath.Join(filepath.Dir(prefix), "x")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("upgrade: entry written outside prefix through symlinks")
+	}
+
+	// uninstall
+	if _, _, err := Run(ctx, "telegraf", Uninstall, pkg("/v2.tar.gz", "")); err != nil {
+		t.Fatalf("uninstall: %s", err)
+	}
+
+	if got := read("usr/bin/telegraf"); got != "" {
+		t.Fatalf("uninstall: telegraf not removed")
+	}
+
+	if _, _, err := Run(ctx, "telegraf", Uninstall, pkg("/v2.tar.gz", "")); err == nil {
+		t.Fatalf("uninstall: expected error, not installed")
+	}
+}
@@ -0,0 +1,313 @@
+package install
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/circonus/agent-manager/internal/inventory"
+)
+
+// tarballs are extracted into the package prefix, the files extracted are listed in a
+// manifest (in the prefix) so they can be removed on upgrade (if no longer in the
+// package) and uninstall.
+
+func manifestFile(prefix, agentType string) string {
+	return filepath.Join(prefix, ".circonus-am-"+agentType+".files")
+}
+
+func extractTarball(file, agentType string, pkg inventory.Package) ([]byte, error) {
+	prefix, err := tarballPrefix(pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("opening package: %w", err)
+	}
+
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading package: %w", err)
+	}
+
+	defer gz.Close()
+
+	previous, err := readManifest(prefix, agentType)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	var files []string
+
+	tr := tar.NewReader(gz)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("reading package: %w", err)
+		}
+
+		name := entryName(hdr.Name, pkg.StripComponents)
+		if name == "" {
+			continue
+		}
+
+		if err := checkParents(prefix, name); err != nil {
+			return nil, err
+		}
+
+		target := filepath.Join(prefix, filepath.FromSlash(name))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil { //nolint:gosec
+				return nil, fmt.Errorf("creating %s: %w", target, err)
+			}
+		case tar.TypeReg:
+			if err := writeFile(target, tr, hdr.FileInfo().Mode().Perm()); err != nil {
+				return nil, err
+			}
+
+			files = append(files, name)
+		case tar.TypeSymlink:
+			if err := symlink(target, name, hdr.Linkname); err != nil {
+				return nil, err
+			}
+
+			files = append(files, name)
+		default:
+			return nil, fmt.Errorf("unsupported tarball entry %s (type %c)", hdr.Name, hdr.Typeflag)
+		}
+	}
+
+	if err := writeManifest(prefix, agentType, files); err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]bool, len(files))
+	for _, name := range files {
+		current[name] = true
+	}
+
+	removed := 0
+
+	for _, name := range previous {
+		if current[name] || checkParents(prefix, name) != nil {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(prefix, filepath.FromSlash(name))); err == nil {
+			removed++
+		}
+	}
+
+	return []byte(fmt.Sprintf("extracted %d files to %s, removed %d previous files\n", len(files), prefix, removed)), nil
+}
+
+func removeTarball(agentType string, pkg inventory.Package) ([]byte, error) {
+	prefix, err := tarballPrefix(pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := readManifest(prefix, agentType)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%s not installed by the manager in %s (no manifest)", agentType, prefix)
+		}
+
+		return nil, err
+	}
+
+	removed := 0
+
+	for _, name := range files {
+		if err := checkParents(prefix, name); err != nil {
+			return nil, err
+		}
+
+		err := os.Remove(filepath.Join(prefix, filepath.FromSlash(name)))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("removing %s: %w", name, err)
+		}
+
+		removed++
+	}
+
+	if err := os.Remove(manifestFile(prefix, agentType)); err != nil {
+		return nil, fmt.Errorf("removing manifest: %w", err)
+	}
+
+	return []byte(fmt.Sprintf("removed %d files from %s\n", removed, prefix)), nil
+}
+
+func tarballPrefix(pkg inventory.Package) (string, error) {
+	if pkg.Prefix == "" || !filepath.IsAbs(pkg.Prefix) {
+		return "", fmt.Errorf("tarball package requires an absolute prefix (%q)", pkg.Prefix)
+	}
+
+	return filepath.Clean(pkg.Prefix), nil
+}
+
+// entryName returns the cleaned (relative, slash separated) name of the tarball entry
+// with the leading elements removed, empty if nothing remains. Cleaning as an absolute
+// path drops any "..", so entries cannot escape the prefix.
+func entryName(name string, strip int) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return ""
+	}
+
+	parts := strings.Split(name, "/")
+	if len(parts) <= strip {
+		return ""
+	}
+
+	return path.Join(parts[strip:]...)
+}
+
+// checkParents returns an error if a directory between the prefix and the entry is a
+// symlink, links which each resolve inside the prefix can be chained to reach outside
+// it (e.g. a -> ., a/b -> .., b/x).
+func checkParents(prefix, name string) error {
+	dir := path.Dir(name)
+	if dir == "." {
+		return nil
+	}
+
+	parent := prefix
+
+	for _, p := range strings.Split(dir, "/") {
+		parent = filepath.Join(parent, p)
+
+		fi, err := os.Lstat(parent)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("checking %s: %w", parent, err)
+		}
+
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("entry %s is through symlink %s", name, parent)
+		}
+	}
+
+	return nil
+}
+
+// writeFile replaces target atomically, so a running binary is not modified in place.
+func writeFile(target string, r io.Reader, perm os.FileMode) error {
+	dir := filepath.Dir(target)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil { //nolint:gosec
+		return fmt.Errorf("creating %s: %w", dir, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(target)+".*")
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", target, err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil { //nolint:gosec // package checksum verified
+		tmp.Close()
+
+		return fmt.Errorf("writing %s: %w", target, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing %s: %w", target, err)
+	}
+
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return fmt.Errorf("setting mode %s: %w", target, err)
+	}
+
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return fmt.Errorf("replacing %s: %w", target, err)
+	}
+
+	return nil
+}
+
+// symlink creates a relative link which must resolve inside the prefix.
+func symlink(target, name, linkname string) error {
+	if path.IsAbs(linkname) {
+		return fmt.Errorf("symlink %s to absolute path %s", name, linkname)
+	}
+
+	if resolved := path.Join(path.Dir(name), linkname); resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return fmt.Errorf("symlink %s to %s outside prefix", name, linkname)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil { //nolint:gosec
+		return fmt.Errorf("creating %s: %w", filepath.Dir(target), err)
+	}
+
+	if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("replacing %s: %w", target, err)
+	}
+
+	if err := os.Symlink(linkname, target); err != nil {
+		return fmt.Errorf("creating symlink %s: %w", target, err)
+	}
+
+	return nil
+}
+
+func readManifest(prefix, agentType string) ([]string, error) {
+	f, err := os.Open(manifestFile(prefix, agentType))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, err //nolint:wrapcheck
+		}
+
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	defer f.Close()
+
+	var files []string
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// entries are re-cleaned, an edited manifest cannot remove files outside the prefix
+		if name := entryName(s.Text(), 0); name != "" {
+			files = append(files, name)
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	return files, nil
+}
+
+func writeManifest(prefix, agentType string, files []string) error {
+	data := strings.Join(files, "\n") + "\n"
+
+	if err := os.WriteFile(manifestFile(prefix, agentType), []byte(data), 0o600); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+
+	return nil
+}
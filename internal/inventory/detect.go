@@ -0,0 +1,279 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/circonus/agent-manager/internal/svcmgr"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// agent states found by detection.
+const (
+	StateNotInstalled = "not_installed"
+	StateInstalled    = "installed"
+	StateDisabled     = "disabled" // installed, the systemd unit is disabled or masked
+	StateRunning      = "running"
+)
+
+// detection rules which matched.
+const (
+	ruleBinary  = "binary"
+	rulePaths   = "paths"
+	ruleCommand = "command"
+	rulePackage = "package"
+	ruleUnit    = "unit"
+	ruleProcess = "process"
+)
+
+// detectTimeout limits the package, unit and process queries for an agent.
+const detectTimeout = 30 * time.Second
+
+// Detect defines additional rules for finding an installed agent, beyond the binary.
+// The agent is installed if any rule matches.
+type Detect struct {
+	Paths   []string `json:"paths,omitempty"   yaml:"paths,omitempty"`   // candidate binaries, checked after binary
+	Command string   `json:"command,omitempty" yaml:"command,omitempty"` // executable looked up in PATH
+	Package string   `json:"package,omitempty" yaml:"package,omitempty"` // dpkg or rpm package name
+	Unit    string   `json:"unit,omitempty"    yaml:"unit,omitempty"`    // systemd unit, disabled or masked is installed-but-disabled
+	Process string   `json:"process,omitempty" yaml:"process,omitempty"` // running process name, e.g. an agent run from a container
+}
+
+// Detection is the result of detecting an agent.
+type Detection struct {
+	State string   // not_installed, installed, disabled or running
+	Path  string   // detected binary, used in place of the inventory binary
+	Rules []string // rules which matched
+}
+
+// Installed returns true if the agent was found by any rule.
+func (d Detection) Installed() bool {
+	return d.State != StateNotInstalled
+}
+
+var (
+	lookPath      = exec.LookPath
+	commandOutput = func(ctx context.Context, name string, arg ...string) ([]byte, error) {
+		return exec.CommandContext(ctx, name, arg...).Output()
+	}
+	processExe = runningProcess
+)
+
+// DetectAgent finds the agent with its binary and detection rules. Without rules
+// the agent is installed if the binary exists.
+func DetectAgent(ctx context.Context, a Agent) Detection {
+	ctx, cancel := context.WithTimeout(ctx, detectTimeout)
+	defer cancel()
+
+	d := Detection{State: StateNotInstalled}
+
+	if exists(a.Binary) {
+		d.Path = a.Binary
+		d.Rules = append(d.Rules, ruleBinary)
+	}
+
+	r := a.Detect
+	if r == nil {
+		if d.Path != "" {
+			d.State = StateInstalled
+		}
+
+		return d
+	}
+
+	if d.Path == "" {
+		for _, p := range r.Paths {
+			if exists(p) {
+				d.Path = p
+				d.Rules = append(d.Rules, rulePaths)
+
+				break
+			}
+		}
+	}
+
+	if d.Path == "" && r.Command != "" {
+		if p, err := lookPath(r.Command); err == nil {
+			d.Path = p
+			d.Rules = append(d.Rules, ruleCommand)
+		}
+	}
+
+	if r.Package != "" && packageInstalled(ctx, r.Package) {
+		d.Rules = append(d.Rules, rulePackage)
+	}
+
+	enabled := true
+
+	if r.Unit != "" {
+		if loaded, unitEnabled := unitState(ctx, r.Unit); loaded {
+			d.Rules = append(d.Rules, ruleUnit)
+			enabled = unitEnabled
+		}
+	}
+
+	running := false
+
+	if r.Process != "" {
+		if exe, ok := processExe(ctx, r.Process); ok {
+			d.Rules = append(d.Rules, ruleProcess)
+			running = true
+
+			if d.Path == "" && exists(exe) {
+				// not a process in a container, the exe is on this host
+				d.Path = exe
+			}
+		}
+	}
+
+	switch {
+	case running:
+		d.State = StateRunning
+	case len(d.Rules) == 0:
+		d.State = StateNotInstalled
+	case !enabled:
+		d.State = StateDisabled
+	default:
+		d.State = StateInstalled
+	}
+
+	return d
+}
+
+func exists(file string) bool {
+	if file == "" {
+		return false
+	}
+
+	_, err := os.Stat(file)
+
+	return !errors.Is(err, os.ErrNotExist)
+}
+
+// packageInstalled queries the dpkg or rpm database for the package.
+func packageInstalled(ctx context.Context, name string) bool {
+	if _, err := lookPath("dpkg-query"); err == nil {
+		out, err := commandOutput(ctx, "dpkg-query", "-W", "-f=${Status}", name)
+		if err == nil && strings.Contains(string(out), "install ok installed") {
+			return true
+		}
+	}
+
+	if _, err := lookPath("rpm"); err == nil {
+		if _, err := commandOutput(ctx, "rpm", "-q", name); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unitState returns whether the systemd unit is loaded (present) and enabled.
+func unitState(ctx context.Context, unit string) (bool, bool) {
+	if _, err := lookPath("systemctl"); err != nil {
+		return false, false
+	}
+
+	out, err := commandOutput(ctx, "systemctl", "show", "--property=LoadState,UnitFileState", svcmgr.UnitName(unit))
+	if err != nil {
+		return false, false
+	}
+
+	props := make(map[string]string)
+
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		if k, v, ok := strings.Cut(s.Text(), "="); ok {
+			props[k] = strings.TrimSpace(v)
+		}
+	}
+
+	if props["LoadState"] != "loaded" {
+		return false, false
+	}
+
+	switch props["UnitFileState"] {
+	case "disabled", "masked", "masked-runtime":
+		return true, false
+	}
+
+	return true, true
+}
+
+// runningProcess returns the executable of a process with the name, if one is running.
+func runningProcess(ctx context.Context, name string) (string, bool) {
+	procs, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return "", false
+	}
+
+	for _, p := range procs {
+		pname, err := p.NameWithContext(ctx)
+		if err != nil || (pname != name && pname != filepath.Base(name)) {
+			continue
+		}
+
+		exe, _ := p.ExeWithContext(ctx)
+
+		return exe, true
+	}
+
+	return "", false
+}
+
+// withBinary returns the agent with the detected binary in place of the inventory binary,
+// including in its commands (as a whole word, e.g. not /usr/bin/telegraf-wrapper).
+func (a Agent) withBinary(path string) Agent {
+	if path == "" || path == a.Binary {
+		return a
+	}
+
+	if a.Binary != "" {
+		for _, cmd := range []*string{&a.Start, &a.Stop, &a.Restart, &a.Reload, &a.Status, &a.Version} {
+			*cmd = replaceWord(*cmd, a.Binary, path)
+		}
+	}
+
+	a.Binary = path
+
+	return a
+}
+
+// replaceWord replaces the whitespace separated words of s equal to from with to, the
+// whitespace is kept.
+func replaceWord(s, from, to string) string {
+	var b strings.Builder
+
+	for len(s) > 0 {
+		end := strings.IndexFunc(s, unicode.IsSpace)
+		if end == -1 {
+			end = len(s)
+		}
+
+		if word := s[:end]; word == from {
+			b.WriteString(to)
+		} else {
+			b.WriteString(word)
+		}
+
+		s = s[end:]
+
+		space := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsSpace(r) })
+		if space == -1 {
+			space = len(s)
+		}
+
+		b.WriteString(s[:space])
+		s = s[space:]
+	}
+
+	return b.String()
+}
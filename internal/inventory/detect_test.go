@@ -0,0 +1,139 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDetectAgent(t *testing.T) {
+	origLookPath, origOutput, origExe := lookPath, commandOutput, processExe
+
+	defer func() { lookPath, commandOutput, processExe = origLookPath, origOutput, origExe }()
+
+	dir := t.TempDir()
+	installed := filepath.Join(dir, "telegraf")
+	missing := filepath.Join(dir, "missing")
+
+	if err := os.WriteFile(installed, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// host has dpkg and systemctl, telegraf package installed, telegraf.service disabled
+	lookPath = func(file string) (string, error) {
+		switch file {
+		case "dpkg-query", "systemctl", "telegraf":
+			return "/usr/bin/" + file, nil
+		}
+
+		return "", errors.New("not found")
+	}
+	commandOutput = func(_ context.Context, name string, arg ...string) ([]byte, error) {
+		switch name + " " + strings.Join(arg, " ") {
+		case "dpkg-query -W -f=${Status} telegraf":
+			return []byte("install ok installed"), nil
+		case "systemctl show --property=LoadState,UnitFileState telegraf.service":
+			return []byte("LoadState=loaded\nUnitFileState=disabled\n"), nil
+		case "systemctl show --property=LoadState,UnitFileState fluent-bit.service":
+			return []byte("LoadState=not-found\nUnitFileState=\n"), nil
+		}
+
+		return nil, errors.New("exit status 1")
+	}
+	// telegraf running in a container, the exe is not on this host
+	processExe = func(_ context.Context, name string) (string, bool) {
+		if name == "telegraf" {
+			return "/usr/bin/telegraf-in-container", true
+		}
+
+		return "", false
+	}
+
+	tests := []struct {
+		name  string
+		agent Agent
+		want  Detection
+	}{
+		{
+			name:  "binary",
+			agent: Agent{Binary: installed},
+			want:  Detection{State: StateInstalled, Path: installed, Rules: []string{ruleBinary}},
+		},
+		{
+			name:  "binary missing",
+			agent: Agent{Binary: missing},
+			want:  Detection{State: StateNotInstalled},
+		},
+		{
+			name:  "candidate paths",
+			agent: Agent{Binary: missing, Detect: &Detect{Paths: []string{missing, installed}}},
+			want:  Detection{State: StateInstalled, Path: installed, Rules: []string{rulePaths}},
+		},
+		{
+			name:  "PATH lookup",
+			agent: Agent{Binary: missing, Detect: &Detect{Command: "telegraf"}},
+			want:  Detection{State: StateInstalled, Path: "/usr/bin/telegraf", Rules: []string{ruleCommand}},
+		},
+		{
+			name:  "package",
+			agent: Agent{Binary: missing, Detect: &Detect{Package: "telegraf"}},
+			want:  Detection{State: StateInstalled, Rules: []string{rulePackage}},
+		},
+		{
+			name:  "unit disabled",
+			agent: Agent{Binary: installed, Detect: &Detect{Unit: "telegraf"}},
+			want:  Detection{State: StateDisabled, Path: installed, Rules: []string{ruleBinary, ruleUnit}},
+		},
+		{
+			name:  "process in container",
+			agent: Agent{Binary: missing, Detect: &Detect{Unit: "telegraf", Process: "telegraf"}},
+			want:  Detection{State: StateRunning, Rules: []string{ruleUnit, ruleProcess}},
+		},
+		{
+			name:  "not installed",
+			agent: Agent{Binary: missing, Detect: &Detect{Command: "fluent-bit", Package: "fluent-bit", Unit: "fluent-bit", Process: "fluent-bit"}},
+			want:  Detection{State: StateNotInstalled},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectAgent(context.Background(), tt.agent); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("DetectAgent() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithBinary(t *testing.T) {
+	a := Agent{
+		Binary:  "/usr/bin/telegraf",
+		Start:   "systemctl start telegraf",
+		Reload:  "/usr/bin/telegraf-wrapper reload --bin=/usr/bin/telegraf",
+		Status:  "/usr/bin/telegraf-wrapper  status /usr/bin/telegraf",
+		Version: "/usr/bin/telegraf --version",
+	}
+
+	got := a.withBinary("/opt/telegraf/usr/bin/telegraf")
+
+	want := Agent{
+		Binary:  "/opt/telegraf/usr/bin/telegraf",
+		Start:   "systemctl start telegraf",
+		Reload:  "/usr/bin/telegraf-wrapper reload --bin=/usr/bin/telegraf",
+		Status:  "/usr/bin/telegraf-wrapper  status /opt/telegraf/usr/bin/telegraf",
+		Version: "/opt/telegraf/usr/bin/telegraf --version",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("withBinary() = %+v, want %+v", got, want)
+	}
+
+	if got := a.withBinary(""); !reflect.DeepEqual(got, a) {
+		t.Fatalf("withBinary(\"\") = %+v, want unchanged", got)
+	}
+}
@@ -0,0 +1,351 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/heartbeat"
+	"github.com/circonus/agent-manager/internal/maintenance"
+	"github.com/circonus/agent-manager/internal/metrics"
+	"github.com/circonus/agent-manager/internal/registration"
+	"github.com/circonus/agent-manager/internal/splay"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// discovery periodically checks for agents installed, removed or upgraded after the
+// manager started, only the changes are reported to the api.
+
+// kinds of change found by discovery.
+const (
+	changeAdded   = "added"
+	changeRemoved = "removed"
+	changeVersion = "version"
+)
+
+// removeAfterMisses is the number of consecutive discoveries a registered agent must
+// be missing from before it is reported removed, a single failed detection is not.
+const removeAfterMisses = 3
+
+// misses counts the consecutive discoveries a registered agent was not found in, by
+// agent type. Guarded by registerMu.
+var misses = make(map[string]int)
+
+// agentChange is an installed agent which differs from the registered agent.
+type agentChange struct {
+	Change string
+	From   string // registered version
+	InstalledAgent
+}
+
+// Discover compares the agents installed locally with the registered agents (agents.yaml)
+// and reports only the differences: new agents, removed agents and version changes. The
+// registered agents are updated, keeping the ids of existing (and removed) agents.
+func Discover(ctx context.Context) error {
+	found, err := installedAgents(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	registerMu.Lock()
+	defer registerMu.Unlock()
+
+	prev, err := registration.LoadRegisteredAgents()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("loading installed agents: %w", err)
+	}
+
+	changes := confirmRemovals(diffAgents(prev, found), found)
+	if len(changes) == 0 {
+		if !setPaths(prev, found) {
+			return nil
+		}
+
+		// only the detected binaries changed, nothing to report
+		if err := registration.SaveInstalledAgents(prev); err != nil {
+			return fmt.Errorf("saving installed agents: %w", err)
+		}
+
+		return nil
+	}
+
+	report := make(InstalledAgents, 0, len(changes))
+
+	for _, c := range changes {
+		log.Info().
+			Str("agent", c.AgentTypeID).
+			Str("change", c.Change).
+			Str("prev_version", c.From).
+			Str("version", c.Version).
+			Msg("agent change discovered")
+
+		report = append(report, c.InstalledAgent)
+	}
+
+	resp, err := registerAgents(ctx, report)
+	if err != nil {
+		return err
+	}
+
+	merged := mergeAgents(prev, report, resp)
+	setPaths(merged, found)
+
+	if err := registration.SaveInstalledAgents(merged); err != nil {
+		return fmt.Errorf("saving installed agents: %w", err)
+	}
+
+	for _, c := range changes {
+		metrics.AgentDiscovered(c.AgentTypeID, c.Change)
+	}
+
+	return nil
+}
+
+// diffAgents returns the agents added, removed or with a different version than registered.
+func diffAgents(prev registration.Agents, found InstalledAgents) []agentChange {
+	registered := make(map[string]string, len(prev))
+	for _, a := range prev {
+		if !a.Removed {
+			registered[a.AgentTypeID] = a.Version
+		}
+	}
+
+	installed := make(map[string]InstalledAgent, len(found))
+	for _, f := range found {
+		installed[f.AgentTypeID] = f
+	}
+
+	var changes []agentChange
+
+	for name, f := range installed {
+		rv, ok := registered[name]
+
+		switch {
+		case !ok:
+			changes = append(changes, agentChange{Change: changeAdded, InstalledAgent: f})
+		case rv != f.Version:
+			changes = append(changes, agentChange{Change: changeVersion, From: rv, InstalledAgent: f})
+		}
+	}
+
+	for name, ver := range registered {
+		if _, ok := installed[name]; !ok {
+			changes = append(changes, agentChange{Change: changeRemoved, From: ver, InstalledAgent: InstalledAgent{AgentTypeID: name, Version: ver, Removed: true}})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].AgentTypeID < changes[j].AgentTypeID })
+
+	return changes
+}
+
+// confirmRemovals drops the removals of agents not yet missing for removeAfterMisses
+// consecutive discoveries. The caller holds registerMu.
+func confirmRemovals(changes []agentChange, found InstalledAgents) []agentChange {
+	for _, f := range found {
+		delete(misses, f.AgentTypeID)
+	}
+
+	confirmed := make([]agentChange, 0, len(changes))
+
+	for _, c := range changes {
+		if c.Change == changeRemoved {
+			misses[c.AgentTypeID]++
+
+			if misses[c.AgentTypeID] < removeAfterMisses {
+				log.Debug().Str("agent", c.AgentTypeID).Int("misses", misses[c.AgentTypeID]).Msg("registered agent not found")
+
+				continue
+			}
+
+			delete(misses, c.AgentTypeID)
+		}
+
+		confirmed = append(confirmed, c)
+	}
+
+	return confirmed
+}
+
+// mergeAgents applies the reported changes, and the ids in the api response, to the
+// registered agents. Existing agents keep their id unless the api returns a new one,
+// removed agents are kept (marked removed) so a reinstalled agent reuses its id, and
+// added agents the api did not return an id for are left to be reported again.
+func mergeAgents(prev registration.Agents, report InstalledAgents, resp registration.Agents) registration.Agents {
+	agents := make(map[string]registration.Agent, len(prev)+len(report))
+	for _, a := range prev {
+		agents[a.AgentTypeID] = a
+	}
+
+	for _, r := range report {
+		a := agents[r.AgentTypeID]
+		a.AgentTypeID = r.AgentTypeID
+		a.Version = r.Version
+		a.Removed = r.Removed
+
+		if r.Removed {
+			a.Path = ""
+		}
+
+		agents[r.AgentTypeID] = a
+	}
+
+	for _, r := range resp {
+		a, ok := agents[r.AgentTypeID]
+		if !ok || r.AgentID == "" {
+			continue
+		}
+
+		a.AgentID = r.AgentID
+		agents[r.AgentTypeID] = a
+	}
+
+	merged := make(registration.Agents, 0, len(agents))
+
+	for _, a := range agents {
+		if a.AgentID == "" {
+			log.Warn().Str("agent", a.AgentTypeID).Msg("no agent id in api response, will report again")
+
+			continue
+		}
+
+		merged = append(merged, a)
+	}
+
+	sort.Slice(merged, func(i, j int) bool { return merged[i].AgentTypeID < merged[j].AgentTypeID })
+
+	return merged
+}
+
+// setPaths records the detected binaries of the installed agents, returns true if any changed.
+func setPaths(agents registration.Agents, found InstalledAgents) bool {
+	paths := make(map[string]string, len(found))
+	for _, f := range found {
+		paths[f.AgentTypeID] = f.Path
+	}
+
+	changed := false
+
+	for i, a := range agents {
+		if p, ok := paths[a.AgentTypeID]; ok && p != a.Path {
+			agents[i].Path = p
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// detectedPaths returns the binaries detected for the registered agents, by agent type.
+func detectedPaths() map[string]string {
+	agents, err := registration.LoadInstalledAgents()
+	if err != nil {
+		return nil
+	}
+
+	paths := make(map[string]string, len(agents))
+
+	for _, a := range agents {
+		if a.Path != "" {
+			paths[a.AgentTypeID] = a.Path
+		}
+	}
+
+	return paths
+}
+
+type Poller struct {
+	intervals chan time.Duration // new interval, applied by the poll loop
+	interval  time.Duration
+}
+
+func NewPoller() (*Poller, error) {
+	i, err := discoveryInterval(viper.GetViper())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Poller{interval: i, intervals: make(chan time.Duration, 1)}, nil
+}
+
+func discoveryInterval(v *viper.Viper) (time.Duration, error) {
+	di := v.GetString(keys.DiscoveryPollingInterval)
+
+	i, err := time.ParseDuration(di)
+	if err != nil {
+		return 0, fmt.Errorf("parsing discovery polling interval: %w", err)
+	}
+
+	return i, nil
+}
+
+// Reconfigure applies the polling interval setting from v (e.g. after a config reload).
+func (p *Poller) Reconfigure(v *viper.Viper) error {
+	i, err := discoveryInterval(v)
+	if err != nil {
+		return err
+	}
+
+	// only the latest setting matters
+	select {
+	case <-p.intervals:
+	default:
+	}
+
+	p.intervals <- i
+
+	return nil
+}
+
+// Start refreshes the inventory from the api and discovers agent changes every interval.
+func (p *Poller) Start(ctx context.Context) {
+	log.Info().Str("interval", p.interval.String()).Msg("starting agent discovery")
+
+	for {
+		t := time.NewTimer(splay.Jitter(p.interval))
+		select {
+		case <-ctx.Done():
+			if !t.Stop() {
+				<-t.C
+			}
+
+			return
+		case i := <-p.intervals:
+			if !t.Stop() {
+				<-t.C
+			}
+
+			if i != p.interval {
+				log.Info().Str("interval", i.String()).Msg("agent discovery interval changed")
+			}
+
+			p.interval = i
+		case <-t.C:
+			if maintenance.Active() {
+				// agents are expected to be stopped, upgraded or reinstalled during maintenance
+				log.Debug().Msg("host in maintenance, not discovering agents")
+				heartbeat.Ran(heartbeat.Discovery, nil)
+
+				continue
+			}
+
+			log.Debug().Msg("discovering agents")
+
+			if err := FetchAgents(ctx); err != nil {
+				log.Warn().Err(err).Msg("fetching agents, using current inventory")
+			}
+
+			err := Discover(ctx)
+			heartbeat.Ran(heartbeat.Discovery, err)
+
+			if err != nil {
+				log.Error().Err(err).Msg("discovering agents")
+			}
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/circonus/agent-manager/internal/config/defaults"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/env"
+	"github.com/circonus/agent-manager/internal/registration"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestDiscover(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	dir := t.TempDir()
+	origEtc := defaults.EtcPath
+	defaults.EtcPath = dir
+
+	defer func() { defaults.EtcPath = origEtc }()
+
+	var reported InstalledAgents
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/agent/manager" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&reported); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		// ids for the reported agents, new agents get a new id
+		var resp registration.Agents
+
+		for _, a := range reported {
+			// no new id for a reinstalled baz, the registered id is reused
+			if a.Removed || a.AgentTypeID == "baz" {
+				continue
+			}
+
+			id := "id-" + a.AgentTypeID
+			if a.AgentTypeID == "foo" {
+				id = "abc"
+			}
+
+			resp = append(resp, registration.Agent{AgentID: id, AgentTypeID: a.AgentTypeID})
+		}
+
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer ts.Close()
+
+	viper.Set(keys.APIURL, ts.URL)
+	viper.Set(keys.APIToken, testAuthToken)
+	viper.Set(keys.InventoryFile, filepath.Join(dir, "inventory.yaml"))
+
+	defer func() {
+		viper.Set(keys.APIURL, "")
+		viper.Set(keys.APIToken, "")
+		viper.Set(keys.InventoryFile, "")
+	}()
+
+	fooBinary := filepath.Join(dir, "foo")
+	barBinary := filepath.Join(dir, "bar")
+	bazBinary := filepath.Join(dir, "baz")
+
+	if err := os.WriteFile(fooBinary, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	inventory := func(fooVersion string) {
+		t.Helper()
+
+		err := SaveAgents(Agents{env.GetPlatform(): {
+			"foo": {Binary: fooBinary, Version: "echo " + fooVersion},
+			"bar": {Binary: barBinary, Version: "echo 2.0"},
+			"baz": {Binary: bazBinary, Version: "echo 3.1"},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// baz was registered, but is no longer installed
+	err := registration.SaveInstalledAgents(registration.Agents{
+		{AgentID: "abc", AgentTypeID: "foo", Version: "1.0"},
+		{AgentID: "xyz", AgentTypeID: "baz", Version: "3.0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		setup        func()
+		name         string
+		wantReported InstalledAgents
+		wantAgents   registration.Agents
+	}{
+		{
+			name:  "missed once",
+			setup: func() { inventory("1.0") },
+			wantAgents: registration.Agents{
+				{AgentID: "abc", AgentTypeID: "foo", Version: "1.0", Path: fooBinary},
+				{AgentID: "xyz", AgentTypeID: "baz", Version: "3.0"},
+			},
+		},
+		{
+			name: "missed twice",
+			wantAgents: registration.Agents{
+				{AgentID: "abc", AgentTypeID: "foo", Version: "1.0", Path: fooBinary},
+				{AgentID: "xyz", AgentTypeID: "baz", Version: "3.0"},
+			},
+		},
+		{
+			name:         "removed",
+			wantReported: InstalledAgents{{AgentTypeID: "baz", Version: "3.0", Removed: true}},
+			wantAgents: registration.Agents{
+				{AgentID: "xyz", AgentTypeID: "baz", Version: "3.0", Removed: true},
+				{AgentID: "abc", AgentTypeID: "foo", Version: "1.0", Path: fooBinary},
+			},
+		},
+		{
+			name: "added and version changed",
+			setup: func() {
+				inventory("1.1")
+
+				if err := os.WriteFile(barBinary, nil, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantReported: InstalledAgents{
+				{AgentTypeID: "bar", Version: "2.0", State: StateInstalled},
+				{AgentTypeID: "foo", Version: "1.1", State: StateInstalled},
+			},
+			wantAgents: registration.Agents{
+				{AgentID: "id-bar", AgentTypeID: "bar", Version: "2.0", Path: barBinary},
+				{AgentID: "xyz", AgentTypeID: "baz", Version: "3.0", Removed: true},
+				{AgentID: "abc", AgentTypeID: "foo", Version: "1.1", Path: fooBinary},
+			},
+		},
+		{
+			name: "unchanged",
+			wantAgents: registration.Agents{
+				{AgentID: "id-bar", AgentTypeID: "bar", Version: "2.0", Path: barBinary},
+				{AgentID: "xyz", AgentTypeID: "baz", Version: "3.0", Removed: true},
+				{AgentID: "abc", AgentTypeID: "foo", Version: "1.1", Path: fooBinary},
+			},
+		},
+		{
+			name: "reinstalled",
+			setup: func() {
+				if err := os.WriteFile(bazBinary, nil, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantReported: InstalledAgents{{AgentTypeID: "baz", Version: "3.1", State: StateInstalled}},
+			wantAgents: registration.Agents{
+				{AgentID: "id-bar", AgentTypeID: "bar", Version: "2.0", Path: barBinary},
+				{AgentID: "xyz", AgentTypeID: "baz", Version: "3.1", Path: bazBinary},
+				{AgentID: "abc", AgentTypeID: "foo", Version: "1.1", Path: fooBinary},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			reported = nil
+
+			if tt.setup != nil {
+				tt.setup()
+			}
+
+			if err := Discover(context.Background()); err != nil {
+				t.Fatalf("Discover() %s", err)
+			}
+
+			if !reflect.DeepEqual(reported, tt.wantReported) {
+				t.Fatalf("reported = %+v, want %+v", reported, tt.wantReported)
+			}
+
+			got, err := registration.LoadRegisteredAgents()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.wantAgents) {
+				t.Fatalf("installed agents = %+v, want %+v", got, tt.wantAgents)
+			}
+		})
+	}
+}
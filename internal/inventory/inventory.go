@@ -7,15 +7,21 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/alecthomas/units"
 	"github.com/circonus/agent-manager/internal/config/keys"
 	"github.com/circonus/agent-manager/internal/env"
+	"github.com/circonus/agent-manager/internal/metrics"
 	"github.com/circonus/agent-manager/internal/registration"
+	"github.com/circonus/agent-manager/internal/tracing"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
@@ -32,14 +38,78 @@ const (
 type Agents map[string]map[string]Agent
 
 type Agent struct {
-	ConfigFiles map[string]string `json:"config_files" yaml:"config_files"`
-	Binary      string            `json:"binary"       yaml:"binary"`
-	Start       string            `json:"start"        yaml:"start"`
-	Stop        string            `json:"stop"         yaml:"stop"`
-	Restart     string            `json:"restart"      yaml:"restart"`
-	Reload      string            `json:"reload"       yaml:"reload"`
-	Status      string            `json:"status"       yaml:"status"`
-	Version     string            `json:"version"      yaml:"version"`
+	ConfigFiles map[string]string `json:"config_files"           yaml:"config_files"`
+	Binary      string            `json:"binary"                 yaml:"binary"`
+	Start       string            `json:"start"                  yaml:"start"`
+	Stop        string            `json:"stop"                   yaml:"stop"`
+	Restart     string            `json:"restart"                yaml:"restart"`
+	Reload      string            `json:"reload"                 yaml:"reload"`
+	Status      string            `json:"status"                 yaml:"status"`
+	Version     string            `json:"version"                yaml:"version"`
+	HealthCheck *HealthCheck      `json:"health_check,omitempty" yaml:"health_check,omitempty"`
+	Package     *Package          `json:"package,omitempty"      yaml:"package,omitempty"`
+	Detect      *Detect           `json:"detect,omitempty"       yaml:"detect,omitempty"`
+}
+
+// Package defines how the agent is installed, upgraded and uninstalled on the platform,
+// either a repository package (apt/dnf/yum) or a downloaded deb, rpm or tarball which
+// is verified with its checksum.
+type Package struct {
+	Name            string `json:"name,omitempty"             yaml:"name,omitempty"`             // repository package name, required to uninstall a deb/rpm
+	Version         string `json:"version,omitempty"          yaml:"version,omitempty"`          // repository package version, default latest
+	URL             string `json:"url,omitempty"              yaml:"url,omitempty"`              // .deb, .rpm or .tar.gz download
+	SHA256          string `json:"sha256,omitempty"           yaml:"sha256,omitempty"`           // checksum of the download, required with url
+	Manager         string `json:"manager,omitempty"          yaml:"manager,omitempty"`          // apt, dnf or yum, default detected
+	Prefix          string `json:"prefix,omitempty"           yaml:"prefix,omitempty"`           // tarball extract directory
+	StripComponents int    `json:"strip_components,omitempty" yaml:"strip_components,omitempty"` // leading tarball path elements removed
+}
+
+// HealthCheck defines optional process level checks, independent of the service
+// manager, to catch agents which are "active" but not actually working.
+type HealthCheck struct {
+	Process string  `json:"process,omitempty"  yaml:"process,omitempty"`  // process name expected to be running
+	PIDFile string  `json:"pid_file,omitempty" yaml:"pid_file,omitempty"` // pid file of running process
+	TCP     string  `json:"tcp,omitempty"      yaml:"tcp,omitempty"`      // host:port liveness probe
+	HTTP    string  `json:"http,omitempty"     yaml:"http,omitempty"`     // url liveness probe, expects 2xx
+	MaxRSS  string  `json:"max_rss,omitempty"  yaml:"max_rss,omitempty"`  // e.g. 512MiB
+	Timeout string  `json:"timeout,omitempty"  yaml:"timeout,omitempty"`  // probe timeout, default 5s
+	MaxCPU  float64 `json:"max_cpu,omitempty"  yaml:"max_cpu,omitempty"`  // percent
+}
+
+// Validate checks the health check definition, an invalid definition is ignored
+// rather than reported as the agent being unhealthy on every check.
+func (hc *HealthCheck) Validate() error {
+	var errs []error
+
+	if hc.Timeout != "" {
+		if d, err := time.ParseDuration(hc.Timeout); err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("timeout: invalid duration (%s)", hc.Timeout))
+		}
+	}
+
+	if hc.MaxRSS != "" {
+		if n, err := units.ParseBase2Bytes(hc.MaxRSS); err != nil || n <= 0 {
+			errs = append(errs, fmt.Errorf("max_rss: invalid size (%s)", hc.MaxRSS))
+		}
+	}
+
+	if hc.MaxCPU < 0 {
+		errs = append(errs, fmt.Errorf("max_cpu: %v is negative", hc.MaxCPU))
+	}
+
+	if hc.TCP != "" {
+		if _, _, err := net.SplitHostPort(hc.TCP); err != nil {
+			errs = append(errs, fmt.Errorf("tcp: %w", err))
+		}
+	}
+
+	if hc.HTTP != "" {
+		if u, err := url.Parse(hc.HTTP); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("http: invalid url (%s)", hc.HTTP))
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
 type InstalledAgents []InstalledAgent
@@ -47,6 +117,9 @@ type InstalledAgents []InstalledAgent
 type InstalledAgent struct {
 	AgentTypeID string `json:"agent_type_id"`
 	Version     string `json:"version"`
+	State       string `json:"state,omitempty"`   // installed, disabled or running
+	Path        string `json:"-"`                 // detected binary
+	Removed     bool   `json:"removed,omitempty"` // discovery, no longer installed
 }
 
 func FetchAgents(ctx context.Context) error {
@@ -66,11 +139,14 @@ func FetchAgents(ctx context.Context) error {
 	}
 
 	req.Header.Add("Authorization", token)
+	tracing.Inject(ctx, req.Header)
 
 	client := &http.Client{}
 
 	resp, err := client.Do(req)
 	if err != nil {
+		metrics.APIError("agent_types", 0)
+
 		return fmt.Errorf("calling actions endpoint: %w", err)
 	}
 
@@ -82,6 +158,8 @@ func FetchAgents(ctx context.Context) error {
 	}
 
 	if resp.StatusCode != http.StatusOK {
+		metrics.APIError("agent_types", resp.StatusCode)
+
 		return fmt.Errorf("non-200 response -- status: %s, body: %s", resp.Status, string(body))
 	}
 
@@ -147,39 +225,104 @@ func GetAgent(agentType string) (Agent, error) {
 
 	for name, a := range gaa {
 		if name == agentType {
-			a := a
-
-			return a, nil
+			return a.withBinary(detectedPaths()[agentType]), nil
 		}
 	}
 
 	return Agent{}, fmt.Errorf("no agent found for type [%s]", agentType)
 }
 
-func CheckForAgents(ctx context.Context) error {
+// PlatformAgents returns the agents for this platform, with the detected binaries in
+// place of the inventory binaries (see DetectAgent).
+func PlatformAgents() (map[string]Agent, error) {
 	aa, err := LoadAgents()
+	if err != nil {
+		return nil, err
+	}
+
+	paths := detectedPaths()
+	agents := make(map[string]Agent, len(aa[env.GetPlatform()]))
+
+	for name, a := range aa[env.GetPlatform()] {
+		agents[name] = a.withBinary(paths[name])
+	}
+
+	return agents, nil
+}
+
+// registerMu serializes registering agents and saving the registered agents (agents.yaml).
+var registerMu sync.Mutex
+
+// CheckForAgents reports all of the agents installed locally, the registered agents
+// (agents.yaml) are replaced with the API response.
+func CheckForAgents(ctx context.Context) error {
+	found, err := installedAgents(ctx, viper.GetString(keys.Register) != "")
 	if err != nil {
 		return err
 	}
 
+	if len(found) == 0 {
+		return nil
+	}
+
+	versions := make(map[string]string, len(found))
+
+	for _, f := range found {
+		log.Info().Str("agent", f.AgentTypeID).Str("version", f.Version).Str("state", f.State).Msg("found")
+
+		versions[f.AgentTypeID] = f.Version
+	}
+
+	registerMu.Lock()
+	defer registerMu.Unlock()
+
+	// contact api and report what agents were found
+	a, err := registerAgents(ctx, found)
+	if err != nil {
+		return err
+	}
+
+	for i := range a {
+		a[i].Version = versions[a[i].AgentTypeID]
+	}
+
+	setPaths(a, found)
+
+	if err := registration.SaveInstalledAgents(a); err != nil {
+		return fmt.Errorf("saving installed agents: %w", err)
+	}
+
+	return nil
+}
+
+// installedAgents returns the agents in the inventory which are installed locally,
+// backing up their current configs if this is a registration.
+func installedAgents(ctx context.Context, backup bool) (InstalledAgents, error) {
+	aa, err := LoadAgents()
+	if err != nil {
+		return nil, err
+	}
+
 	platform := env.GetPlatform()
 
 	gaa, ok := aa[platform]
 	if !ok {
-		return fmt.Errorf("no agents found for platform %s", platform)
+		return nil, fmt.Errorf("no agents found for platform %s", platform)
 	}
 
 	found := InstalledAgents{}
 
 	for name, a := range gaa {
-		if _, err := os.Stat(a.Binary); errors.Is(err, os.ErrNotExist) {
-			log.Warn().Str("file", a.Binary).Msg("agent binary not found, skipping")
+		d := DetectAgent(ctx, a)
+		if !d.Installed() {
+			log.Debug().Str("agent", name).Str("file", a.Binary).Msg("agent not found, skipping")
 
 			continue
 		}
 
-		if viper.GetString(keys.Register) != "" {
-			// if this is a registration, backup current configs
+		a = a.withBinary(d.Path)
+
+		if backup {
 			backupConfigs(name, a.ConfigFiles)
 		}
 
@@ -188,8 +331,8 @@ func CheckForAgents(ctx context.Context) error {
 			log.Warn().Err(err).Str("agent", name).Msg("getting agent version")
 		}
 
-		log.Info().Str("agent", name).Msg("found")
-		found = append(found, InstalledAgent{AgentTypeID: name, Version: ver})
+		log.Debug().Str("agent", name).Str("state", d.State).Strs("rules", d.Rules).Str("path", d.Path).Msg("found")
+		found = append(found, InstalledAgent{AgentTypeID: name, Version: ver, State: d.State, Path: d.Path})
 	}
 
 	if env.IsRunningInDocker() && len(viper.GetStringSlice(keys.Agents)) > 0 {
@@ -201,22 +344,16 @@ func CheckForAgents(ctx context.Context) error {
 				continue
 			}
 
-			if viper.GetString(keys.Register) != "" {
-				// if this is a registration, backup current configs
+			if backup {
 				backupConfigs(name, a.ConfigFiles)
 			}
 
-			log.Info().Str("agent", name).Msg("force add agent from --agents")
+			log.Debug().Str("agent", name).Msg("force add agent from --agents")
 			found = append(found, InstalledAgent{AgentTypeID: name, Version: noVersion})
 		}
 	}
 
-	if len(found) > 0 {
-		// contact api and report what agents were found
-		return registerAgents(ctx, found)
-	}
-
-	return nil
+	return found, nil
 }
 
 func getAgentVersion(vercmd string) (string, error) {
@@ -244,57 +381,59 @@ type RegisteredAgents struct {
 	AgentID string `json:"agent_id"`
 }
 
-func registerAgents(ctx context.Context, c InstalledAgents) error {
+// registerAgents reports the agents to the API, returning the registered agents (ids).
+func registerAgents(ctx context.Context, c InstalledAgents) (registration.Agents, error) {
 	token := viper.GetString(keys.APIToken)
 	if token == "" {
-		return fmt.Errorf("invalid api token (empty)")
+		return nil, fmt.Errorf("invalid api token (empty)")
 	}
 
 	reqURL, err := url.JoinPath(viper.GetString(keys.APIURL), "agent", "manager")
 	if err != nil {
-		return fmt.Errorf("req url: %w", err)
+		return nil, fmt.Errorf("req url: %w", err)
 	}
 
 	data, err := json.Marshal(c)
 	if err != nil {
-		return fmt.Errorf("marshal claims: %w", err)
+		return nil, fmt.Errorf("marshal claims: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, bytes.NewReader(data))
 	if err != nil {
-		return fmt.Errorf("creating request: %w", err)
+		return nil, fmt.Errorf("creating request: %w", err)
 	}
 
 	req.Header.Add("Authorization", token)
+	tracing.Inject(ctx, req.Header)
 
 	client := &http.Client{}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("calling actions endpoint: %w", err)
+		metrics.APIError("manager_agents", 0)
+
+		return nil, fmt.Errorf("calling actions endpoint: %w", err)
 	}
 
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("reading response body: %w", err)
+		return nil, fmt.Errorf("reading response body: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("non-200 response -- status: %s, body: %s", resp.Status, string(body))
+		metrics.APIError("manager_agents", resp.StatusCode)
+
+		return nil, fmt.Errorf("non-200 response -- status: %s, body: %s", resp.Status, string(body))
 	}
 
 	var a registration.Agents
 	if err := json.Unmarshal(body, &a); err != nil {
-		return fmt.Errorf("unmarshal register response: %w", err)
-	}
-
-	if err := registration.SaveInstalledAgents(a); err != nil {
-		return fmt.Errorf("saving installed agents: %w", err)
+		return nil, fmt.Errorf("unmarshal register response: %w", err)
 	}
 
 	log.Debug().RawJSON("resp", body).Msg("response")
 
-	return nil
+	return a, nil
 }
@@ -327,3 +327,50 @@ func TestCheckForAgents(t *testing.T) {
 		})
 	}
 }
+
+func TestHealthCheckValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		hc      HealthCheck
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			hc:   HealthCheck{Process: "telegraf", TCP: "127.0.0.1:8125", HTTP: "http://127.0.0.1:8080/health", MaxRSS: "512MiB", MaxCPU: 50, Timeout: "3s"},
+		},
+		{
+			name:    "invalid timeout",
+			hc:      HealthCheck{HTTP: "http://127.0.0.1:8080/health", Timeout: "soon"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid max rss",
+			hc:      HealthCheck{Process: "telegraf", MaxRSS: "lots"},
+			wantErr: true,
+		},
+		{
+			name:    "negative max cpu",
+			hc:      HealthCheck{Process: "telegraf", MaxCPU: -1},
+			wantErr: true,
+		},
+		{
+			name:    "tcp without port",
+			hc:      HealthCheck{TCP: "127.0.0.1"},
+			wantErr: true,
+		},
+		{
+			name:    "http without scheme",
+			hc:      HealthCheck{HTTP: "127.0.0.1:8080/health"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.hc.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -24,6 +24,9 @@ type Platform struct {
 	Status      string       `json:"status"        yaml:"status"`
 	Version     string       `json:"version"       yaml:"version"`
 	ConfigFiles []ConfigFile `json:"config_files"  yaml:"config_files"`
+	HealthCheck *HealthCheck `json:"health_check"  yaml:"health_check"`
+	Package     *Package     `json:"package"       yaml:"package"`
+	Detect      *Detect      `json:"detect"        yaml:"detect"`
 }
 
 type Commands struct {
@@ -49,6 +52,9 @@ func ParseAPIAgents(data []byte) (Agents, error) {
 			col := Agent{
 				Binary:      platform.Executable,
 				ConfigFiles: make(map[string]string, len(platform.ConfigFiles)),
+				HealthCheck: platform.HealthCheck,
+				Package:     platform.Package,
+				Detect:      platform.Detect,
 			}
 
 			for _, c := range platform.Commands {
@@ -74,6 +80,14 @@ func ParseAPIAgents(data []byte) (Agents, error) {
 				col.ConfigFiles[f.ConfigFileID] = f.Path
 			}
 
+			if col.HealthCheck != nil {
+				if err := col.HealthCheck.Validate(); err != nil {
+					log.Warn().Err(err).Str("agent", platform.AgentTypeID).Str("platform", platform.ID).Msg("invalid health check definition, ignoring")
+
+					col.HealthCheck = nil
+				}
+			}
+
 			if _, ok := agents[platform.ID]; !ok {
 				agents[platform.ID] = make(map[string]Agent)
 			}
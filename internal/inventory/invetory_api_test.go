@@ -33,6 +33,7 @@ func TestParseAPIAgents(t *testing.T) {
 					ConfigFiles: map[string]string{
 						"d81c7650-19ae-4bf3-98df-5d24d53f5756": "/etc/telegraf/telegraf.conf",
 					},
+					Package: &Package{Name: "telegraf", Version: "1.28.5-1"},
 				},
 			}},
 			wantErr: false,
@@ -0,0 +1,282 @@
+// Package maintenance is the host maintenance switch. While maintenance is on the
+// manager keeps reporting status, but changes to the host (config installs, agent
+// start/stop/restart/reload, remediation) are deferred and config drift is not
+// reported, so the platform does not fight manual work on the host.
+//
+// Maintenance is on when enabled in the configuration (maintenance.enable, e.g.
+// --maintenance) or when the marker file exists (maintenance.file, written by the
+// admin API or created by hand, e.g. `touch`). Either may have an expiry.
+package maintenance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/audit"
+	"github.com/circonus/agent-manager/internal/config/defaults"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// sources, how maintenance was turned on.
+const (
+	SourceConfig = "config"
+	SourceFile   = "file"
+)
+
+// ErrConfigured is returned when turning off maintenance enabled in the configuration.
+var ErrConfigured = errors.New("maintenance enabled in the configuration (maintenance.enable), disable it there and reload")
+
+// Status is the current maintenance state.
+type Status struct {
+	Since  time.Time `json:"since,omitempty"  yaml:"since,omitempty"`
+	Until  time.Time `json:"until,omitempty"  yaml:"until,omitempty"` // zero, until turned off
+	Reason string    `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Source string    `json:"source,omitempty" yaml:"source,omitempty"`
+	Active bool      `json:"active"           yaml:"active"`
+}
+
+// configured tracks when maintenance was enabled in the configuration, a relative
+// maintenance.until is from then.
+var configured struct {
+	since time.Time
+	sync.Mutex
+}
+
+// settings are the reloaded settings, the global settings until the first reload.
+var settings atomic.Pointer[viper.Viper]
+
+// Reconfigure applies the maintenance settings from v (e.g. after a config reload).
+func Reconfigure(v *viper.Viper) {
+	settings.Store(v)
+}
+
+func conf() *viper.Viper {
+	if v := settings.Load(); v != nil {
+		return v
+	}
+
+	return viper.GetViper()
+}
+
+// File returns the maintenance marker file path.
+func File() string {
+	if f := conf().GetString(keys.MaintenanceFile); f != "" {
+		return f
+	}
+
+	return defaults.MaintenanceFile
+}
+
+// Active returns true if the host is in maintenance.
+func Active() bool {
+	return Get().Active
+}
+
+// Get returns the current maintenance state. An expired marker file is removed.
+func Get() Status {
+	now := time.Now()
+
+	if s := fromConfig(now); s.Active {
+		return s
+	}
+
+	s, err := fromFile(File(), now)
+	if err != nil {
+		// fail safe, a marker which cannot be read still means maintenance
+		log.Warn().Err(err).Str("file", File()).Msg("reading maintenance marker, assuming maintenance")
+
+		return Status{Active: true, Source: SourceFile, Reason: err.Error()}
+	}
+
+	return s
+}
+
+func fromConfig(now time.Time) Status {
+	configured.Lock()
+	defer configured.Unlock()
+
+	if !conf().GetBool(keys.MaintenanceEnable) {
+		configured.since = time.Time{}
+
+		return Status{}
+	}
+
+	if configured.since.IsZero() {
+		configured.since = now
+	}
+
+	s := Status{
+		Since:  configured.since,
+		Reason: conf().GetString(keys.MaintenanceReason),
+		Source: SourceConfig,
+		Active: true,
+	}
+
+	until, err := ParseUntil(conf().GetString(keys.MaintenanceUntil), configured.since)
+	if err != nil {
+		// rejected by config validation, no expiry rather than no maintenance
+		log.Warn().Err(err).Msg("maintenance until, ignoring")
+	}
+
+	s.Until = until
+
+	if !s.Until.IsZero() && !now.Before(s.Until) {
+		s.Active = false
+	}
+
+	return s
+}
+
+func fromFile(file string, now time.Time) (Status, error) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Status{}, nil
+		}
+
+		return Status{}, fmt.Errorf("maintenance marker: %w", err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return Status{}, fmt.Errorf("maintenance marker: %w", err)
+	}
+
+	s := Status{Since: fi.ModTime(), Source: SourceFile}
+
+	if len(strings.TrimSpace(string(data))) > 0 {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return Status{}, fmt.Errorf("parsing maintenance marker: %w", err)
+		}
+	}
+
+	if !s.Until.IsZero() && !now.Before(s.Until) {
+		log.Info().Time("until", s.Until).Msg("maintenance expired")
+
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warn().Err(err).Str("file", file).Msg("removing expired maintenance marker")
+		}
+
+		audit.Record(context.Background(), audit.Entry{
+			Event:  audit.EventMaintenance,
+			Detail: "maintenance expired",
+		})
+
+		return Status{}, nil
+	}
+
+	s.Active = true
+
+	return s, nil
+}
+
+// Enable turns maintenance on by writing the marker file, until may be zero (no expiry).
+func Enable(ctx context.Context, until time.Time, reason string) (Status, error) {
+	file := File()
+
+	s := Status{
+		Since:  time.Now().UTC().Truncate(time.Second),
+		Reason: reason,
+		Source: audit.Source(ctx),
+		Active: true,
+	}
+
+	if !until.IsZero() {
+		if !until.After(s.Since) {
+			return Status{}, fmt.Errorf("until (%s) is not in the future", until.Format(time.RFC3339))
+		}
+
+		s.Until = until.UTC()
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return Status{}, fmt.Errorf("marshal maintenance marker: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil { //nolint:gosec
+		return Status{}, fmt.Errorf("maintenance marker dir: %w", err)
+	}
+
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		return Status{}, fmt.Errorf("writing maintenance marker: %w", err)
+	}
+
+	log.Info().Time("until", s.Until).Str("reason", reason).Msg("maintenance on")
+
+	audit.Record(ctx, audit.Entry{
+		Event:  audit.EventMaintenance,
+		Detail: describe("maintenance on", s),
+	})
+
+	return s, nil
+}
+
+// Disable turns maintenance off by removing the marker file.
+func Disable(ctx context.Context) error {
+	if fromConfig(time.Now()).Active {
+		return ErrConfigured
+	}
+
+	if err := os.Remove(File()); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("removing maintenance marker: %w", err)
+	}
+
+	log.Info().Msg("maintenance off")
+
+	audit.Record(ctx, audit.Entry{
+		Event:  audit.EventMaintenance,
+		Detail: "maintenance off",
+	})
+
+	return nil
+}
+
+// ParseUntil parses an expiry, either a duration from start (e.g. 2h) or an RFC3339
+// time. Empty is no expiry (zero time).
+func ParseUntil(until string, start time.Time) (time.Time, error) {
+	if until == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(until); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("until duration (%s) must be positive", until)
+		}
+
+		return start.Add(d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, until)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("until (%s) is not a duration or RFC3339 time", until)
+	}
+
+	return t, nil
+}
+
+func describe(msg string, s Status) string {
+	if !s.Until.IsZero() {
+		msg += ", until " + s.Until.Format(time.RFC3339)
+	}
+
+	if s.Reason != "" {
+		msg += ", reason: " + s.Reason
+	}
+
+	return msg
+}
@@ -0,0 +1,153 @@
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestGet(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		enable     bool
+		until      string
+		marker     string // contents, "-" no marker
+		wantActive bool
+		wantSource string
+		wantMarker bool // marker still exists
+	}{
+		{name: "off", marker: "-"},
+		{name: "config", enable: true, marker: "-", wantActive: true, wantSource: SourceConfig},
+		{name: "config until", enable: true, until: "1h", marker: "-", wantActive: true, wantSource: SourceConfig},
+		{name: "config expired", enable: true, until: now.Add(-time.Minute).Format(time.RFC3339), marker: "-"},
+		{name: "empty marker", marker: "", wantActive: true, wantSource: SourceFile, wantMarker: true},
+		{
+			name:       "marker until",
+			marker:     `{"until":"` + now.Add(time.Hour).Format(time.RFC3339) + `","reason":"upgrade","source":"admin_api"}`,
+			wantActive: true,
+			wantSource: "admin_api",
+			wantMarker: true,
+		},
+		{
+			name:   "marker expired",
+			marker: `{"until":"` + now.Add(-time.Minute).Format(time.RFC3339) + `"}`,
+		},
+		{name: "marker invalid", marker: "{", wantActive: true, wantSource: SourceFile, wantMarker: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "maintenance")
+
+			viper.Set(keys.MaintenanceFile, file)
+			viper.Set(keys.MaintenanceEnable, tt.enable)
+			viper.Set(keys.MaintenanceUntil, tt.until)
+
+			defer func() {
+				viper.Set(keys.MaintenanceFile, "")
+				viper.Set(keys.MaintenanceEnable, false)
+				viper.Set(keys.MaintenanceUntil, "")
+				fromConfig(now) // reset
+			}()
+
+			if tt.marker != "-" {
+				if err := os.WriteFile(file, []byte(tt.marker), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			s := Get()
+			if s.Active != tt.wantActive {
+				t.Fatalf("active = %t, want %t", s.Active, tt.wantActive)
+			}
+
+			if tt.wantActive && s.Source != tt.wantSource {
+				t.Fatalf("source = %q, want %q", s.Source, tt.wantSource)
+			}
+
+			_, err := os.Stat(file)
+			if exists := err == nil; exists != tt.wantMarker {
+				t.Fatalf("marker exists = %t, want %t", exists, tt.wantMarker)
+			}
+		})
+	}
+}
+
+func TestEnableDisable(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	viper.Set(keys.MaintenanceFile, filepath.Join(t.TempDir(), "etc", "maintenance"))
+	defer viper.Set(keys.MaintenanceFile, "")
+
+	ctx := context.Background()
+
+	if _, err := Enable(ctx, time.Now().Add(-time.Hour), ""); err == nil {
+		t.Fatal("expected error for until in the past")
+	}
+
+	s, err := Enable(ctx, time.Now().Add(time.Hour), "upgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := Get(); !got.Active || got.Reason != "upgrade" || !got.Until.Equal(s.Until) {
+		t.Fatalf("unexpected status %+v", got)
+	}
+
+	if err := Disable(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if Active() {
+		t.Fatal("expected maintenance off")
+	}
+
+	viper.Set(keys.MaintenanceEnable, true)
+	defer viper.Set(keys.MaintenanceEnable, false)
+
+	if err := Disable(ctx); !errors.Is(err, ErrConfigured) {
+		t.Fatalf("expected ErrConfigured, got %v", err)
+	}
+}
+
+func TestParseUntil(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		until   string
+		want    time.Time
+		wantErr bool
+	}{
+		{until: ""},
+		{until: "2h", want: start.Add(2 * time.Hour)},
+		{until: "2024-01-02T00:00:00Z", want: start.Add(24 * time.Hour)},
+		{until: "-1h", wantErr: true},
+		{until: "tomorrow", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.until, func(t *testing.T) {
+			got, err := ParseUntil(tt.until, start)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseUntil() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !got.Equal(tt.want) {
+				t.Fatalf("ParseUntil() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/audit"
+	"github.com/circonus/agent-manager/internal/registration"
+)
+
+// auditAnchorInterval is how often the audit log position is sent to the API, when
+// new entries have been recorded.
+const auditAnchorInterval = 15 * time.Minute
+
+// anchorAudit sends the newest audit log entry's position to the API, at start and
+// after new entries, so a local audit log which has been cut back can be detected.
+func (m *Manager) anchorAudit(ctx context.Context) {
+	var sent audit.Anchor
+
+	ticker := time.NewTicker(auditAnchorInterval)
+	defer ticker.Stop()
+
+	for {
+		if head, ok := audit.Head(); ok && head != sent {
+			if err := registration.UpdateAuditAnchor(ctx, head); err != nil {
+				m.logger.Warn().Err(err).Msg("sending audit log anchor via API")
+			} else {
+				sent = head
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
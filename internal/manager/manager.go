@@ -2,10 +2,15 @@ package manager
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/circonus/agent-manager/internal/admin"
 	"github.com/circonus/agent-manager/internal/agents"
 	"github.com/circonus/agent-manager/internal/config"
 	"github.com/circonus/agent-manager/internal/config/keys"
@@ -13,9 +18,12 @@ import (
 	"github.com/circonus/agent-manager/internal/decommission"
 	"github.com/circonus/agent-manager/internal/env"
 	"github.com/circonus/agent-manager/internal/inventory"
+	"github.com/circonus/agent-manager/internal/maintenance"
 	"github.com/circonus/agent-manager/internal/registration"
 	"github.com/circonus/agent-manager/internal/release"
+	"github.com/circonus/agent-manager/internal/selfupdate"
 	"github.com/circonus/agent-manager/internal/server"
+	"github.com/circonus/agent-manager/internal/tracing"
 	"github.com/circonus/agent-manager/internal/tracker"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -25,12 +33,22 @@ import (
 
 // Manager holds the main manager process.
 type Manager struct {
-	group       *errgroup.Group
-	groupCtx    context.Context
-	groupCancel context.CancelFunc
-	signalCh    chan os.Signal
-	logger      zerolog.Logger
-	server      *server.Server
+	group         *errgroup.Group
+	groupCtx      context.Context
+	groupCancel   context.CancelFunc
+	signalCh      chan os.Signal
+	logger        zerolog.Logger
+	server        *server.Server // guarded by serverMu, replaced on reload
+	serverCfg     *viper.Viper   // the server's settings, guarded by serverMu
+	admin         *admin.Server
+	actionPoller  *agents.ActionPoller
+	trackerPoller *tracker.Poller
+	discovery     *inventory.Poller
+	statusPoller  *agents.StatusPoller
+	tracingStop   func(context.Context) error
+	actionCancel  context.CancelFunc
+	stopOnce      sync.Once
+	serverMu      sync.Mutex
 }
 
 // New returns a new manager instance.
@@ -66,17 +84,30 @@ func (m *Manager) Start() error {
 
 	if viper.GetBool(keys.Decommission) {
 		if err := decommission.Start(m.groupCtx); err != nil {
-			log.Fatal().Err(err).Msg("decommissioning agent manager")
-		} else {
-			m.logger.Info().Msg("decommission complete")
-			os.Exit(0)
+			return m.exit(fmt.Errorf("decommissioning agent manager: %w", err))
 		}
+
+		m.logger.Info().Msg("decommission complete")
+
+		return m.exit(nil)
 	}
 
 	if env.IsRunningInDocker() {
 		viper.Set(keys.UseMachineID, false)
 	}
 
+	if viper.GetString(keys.Register) == "" {
+		// a new binary which keeps failing to start after a self-update is rolled back,
+		// exiting so the service manager starts the previous binary
+		if _, err := selfupdate.Started(m.groupCtx); err != nil {
+			if errors.Is(err, selfupdate.ErrRolledBack) {
+				return m.exit(err)
+			}
+
+			m.logger.Error().Err(err).Msg("self-update state")
+		}
+	}
+
 	// initial registration status
 	isRegistered := registration.IsRegistered()
 
@@ -85,32 +116,32 @@ func (m *Manager) Start() error {
 			log.Info().Msg("agent manager already registered, see --force-register")
 		} else {
 			if err := registration.Start(m.groupCtx); err != nil {
-				log.Fatal().Err(err).Msg("registering agent manager")
+				return m.exit(fmt.Errorf("registering agent manager: %w", err))
 			}
 		}
 	}
 
 	// ensure manager is registered
 	if !registration.IsRegistered() {
-		log.Fatal().Msg("manager not registered, see instructions for registration")
+		return m.exit(fmt.Errorf("manager not registered, see instructions for registration"))
 	}
 
 	if err := credentials.LoadManagerID(); err != nil {
-		log.Fatal().Err(err).Msg("loading manager id")
+		return m.exit(fmt.Errorf("loading manager id: %w", err))
 	}
 
 	if err := credentials.LoadJWT(); err != nil {
-		log.Fatal().Err(err).Msg("loading API credentials")
+		return m.exit(fmt.Errorf("loading API credentials: %w", err))
 	}
 
 	if viper.GetString(keys.Register) != "" && env.IsRunningInDocker() {
 		// verify that --agents and --instance-id have been provided when running in docker
 		if len(viper.GetStringSlice(keys.Agents)) == 0 {
-			log.Fatal().Msg("--agents required to run in container")
+			return m.exit(fmt.Errorf("--agents required to run in container"))
 		}
 
 		if viper.GetString(keys.InstanceID) == "" {
-			log.Fatal().Msg("--instance-id required to run in a container")
+			return m.exit(fmt.Errorf("--instance-id required to run in a container"))
 		}
 	}
 
@@ -121,7 +152,8 @@ func (m *Manager) Start() error {
 		//
 		if viper.GetString(keys.Register) != "" {
 			m.logger.Info().Msg("registration complete")
-			os.Exit(0)
+
+			return m.exit(nil)
 		}
 	}
 
@@ -129,16 +161,24 @@ func (m *Manager) Start() error {
 	// these run every time the manager starts
 	//
 
+	// not fatal, the manager can run without tracing
+	tracingStop, err := tracing.Start(m.groupCtx)
+	if err != nil {
+		m.logger.Error().Err(err).Msg("starting tracing")
+	} else {
+		m.tracingStop = tracingStop
+	}
+
 	if err := registration.UpdateVersion(m.groupCtx); err != nil {
 		m.logger.Warn().Err(err).Msg("updating manager version via API")
 	}
 
 	if err := inventory.FetchAgents(m.groupCtx); err != nil {
-		log.Fatal().Err(err).Msg("fetching agents")
+		return m.exit(fmt.Errorf("fetching agents: %w", err))
 	}
 
 	if err := inventory.CheckForAgents(m.groupCtx); err != nil {
-		log.Fatal().Err(err).Msg("checking for installed agents")
+		return m.exit(fmt.Errorf("checking for installed agents: %w", err))
 	}
 
 	m.logger.Debug().
@@ -146,25 +186,55 @@ func (m *Manager) Start() error {
 		Str("name", release.NAME).
 		Str("ver", release.VERSION).Msg("starting wait")
 
+	if ms := maintenance.Get(); ms.Active {
+		m.logger.Warn().
+			Str("source", ms.Source).
+			Time("until", ms.Until).
+			Str("reason", ms.Reason).
+			Msg("host in maintenance, config installs and agent commands will be deferred")
+	}
+
 	actionPoller, err := agents.NewActionPoller()
 	if err != nil {
-		m.logger.Fatal().Err(err).Msg("unable to start action poller")
+		return m.exit(fmt.Errorf("unable to start action poller: %w", err))
 	}
 
 	trackerPoller, err := tracker.NewPoller()
 	if err != nil {
-		m.logger.Fatal().Err(err).Msg("unable to start config tracker poller")
+		return m.exit(fmt.Errorf("unable to start config tracker poller: %w", err))
 	}
 
-	server, err := server.New()
+	discovery, err := inventory.NewPoller()
 	if err != nil {
-		m.logger.Fatal().Err(err).Msg("unable to start server")
+		return m.exit(fmt.Errorf("unable to start agent discovery: %w", err))
 	}
 
+	server, err := server.New(viper.GetViper())
+	if err != nil {
+		return m.exit(fmt.Errorf("unable to start server: %w", err))
+	}
+
+	m.serverMu.Lock()
 	m.server = server
+	m.serverCfg = viper.GetViper()
+	m.serverMu.Unlock()
+
+	m.actionPoller = actionPoller
+	m.trackerPoller = trackerPoller
+	m.discovery = discovery
+
+	// cancelled first on shutdown, to stop taking new actions
+	actionCtx, actionCancel := context.WithCancel(m.groupCtx)
+	m.actionCancel = actionCancel
 
 	m.group.Go(func() error {
-		actionPoller.Start(m.groupCtx)
+		actionPoller.Start(actionCtx)
+
+		return nil
+	})
+
+	m.group.Go(func() error {
+		actionPoller.ConfirmSelfUpdate(actionCtx)
 
 		return nil
 	})
@@ -175,26 +245,67 @@ func (m *Manager) Start() error {
 		return nil
 	})
 
+	m.group.Go(func() error {
+		discovery.Start(m.groupCtx)
+
+		return nil
+	})
+
 	m.group.Go(func() error {
 		return server.Start(m.groupCtx)
 	})
 
-	// if not running in docker, start the agent status poller
-	if !env.IsRunningInDocker() {
-		m.logger.Info().Msg("starting agent status poller")
+	m.group.Go(func() error {
+		m.anchorAudit(m.groupCtx)
+
+		return nil
+	})
+
+	// in docker, agent status comes from the agents' reports to the server (/status/<agent>)
+	m.logger.Info().Bool("container", env.IsRunningInDocker()).Msg("starting agent status poller")
+
+	statusPoller, err := agents.NewStatusPoller()
+	if err != nil {
+		return m.exit(fmt.Errorf("unable to start agent status poller: %w", err))
+	}
 
-		statusPoller, err := agents.NewStatusPoller()
+	m.statusPoller = statusPoller
+
+	m.group.Go(func() error {
+		statusPoller.Start(m.groupCtx)
+
+		return nil
+	})
+
+	if viper.GetBool(keys.ConfigWatch) && viper.ConfigFileUsed() != "" {
+		// reloads are serialized through the signal handler
+		err := config.Watch(m.groupCtx, viper.ConfigFileUsed(), func() {
+			select {
+			case m.signalCh <- syscall.SIGHUP:
+			case <-m.groupCtx.Done():
+			}
+		})
 		if err != nil {
-			m.logger.Fatal().Err(err).Msg("unable to agent start status poller")
+			m.logger.Error().Err(err).Msg("config watch, reload with SIGHUP")
 		}
+	}
+
+	if viper.GetBool(keys.AdminEnable) {
+		adminServer, err := admin.New(actionPoller, statusPoller)
+		if err != nil {
+			return m.exit(fmt.Errorf("unable to start admin api: %w", err))
+		}
+
+		m.admin = adminServer
 
 		m.group.Go(func() error {
-			statusPoller.Start(m.groupCtx)
+			// not fatal, the manager can run without the admin api
+			if err := adminServer.Start(m.groupCtx); err != nil {
+				m.logger.Error().Err(err).Msg("admin api")
+			}
 
 			return nil
 		})
-	} else {
-		m.logger.Info().Msg("NOT starting agent status poller -- running in docker or container")
 	}
 
 	if err := m.group.Wait(); err != nil {
@@ -204,12 +315,65 @@ func (m *Manager) Start() error {
 	return nil
 }
 
-// Stop cleans up and shuts down the manager.
+// exit stops the manager (if started) and returns err, for command line actions
+// which complete (e.g. --register) and errors during start.
+func (m *Manager) exit(err error) error {
+	m.Stop()
+
+	_ = m.group.Wait() // signal handler
+
+	return err
+}
+
+// Stop cleans up and shuts down the manager. Actions in progress are given the
+// drain timeout to finish, and send their results, before anything else stops.
 func (m *Manager) Stop() {
+	m.stopOnce.Do(m.stop)
+}
+
+func (m *Manager) stop() {
 	m.stopSignalHandler()
 
-	if err := m.server.Stop(m.groupCtx); err != nil {
-		m.logger.Warn().Err(err).Msg("stopping server")
+	if m.actionPoller != nil {
+		m.actionCancel()
+
+		timeout, err := time.ParseDuration(viper.GetString(keys.DrainTimeout))
+		if err != nil {
+			m.logger.Warn().Err(err).Msg("parsing drain timeout, not waiting")
+		}
+
+		m.logger.Info().Str("timeout", timeout.String()).Msg("draining actions")
+
+		if err := m.actionPoller.Drain(timeout); err != nil {
+			m.logger.Warn().Err(err).Msg("draining actions")
+		}
+	}
+
+	// a reload in progress finishes first, a later one does not restart the server
+	m.serverMu.Lock()
+	if m.server != nil {
+		if err := m.server.Stop(m.groupCtx); err != nil {
+			m.logger.Warn().Err(err).Msg("stopping server")
+		}
+
+		m.server = nil
+	}
+	m.serverMu.Unlock()
+
+	if m.admin != nil {
+		if err := m.admin.Stop(m.groupCtx); err != nil {
+			m.logger.Warn().Err(err).Msg("stopping admin api")
+		}
+	}
+
+	if m.tracingStop != nil {
+		// flush any pending spans
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := m.tracingStop(ctx); err != nil {
+			m.logger.Warn().Err(err).Msg("stopping tracing")
+		}
+
+		cancel()
 	}
 
 	m.groupCancel()
@@ -0,0 +1,195 @@
+package manager
+
+import (
+	"strings"
+
+	"github.com/circonus/agent-manager/internal/config"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/maintenance"
+	"github.com/circonus/agent-manager/internal/registration"
+	"github.com/circonus/agent-manager/internal/server"
+	"github.com/circonus/agent-manager/internal/splay"
+	"github.com/circonus/agent-manager/internal/window"
+	"github.com/spf13/viper"
+)
+
+// reloadable are settings (prefixes) which are applied on reload, others are only
+// applied on start.
+var reloadable = []string{
+	"maintenance.",
+	"server.",
+	keys.ActionPollingInterval,
+	keys.ChangeWindows,
+	keys.Debug,
+	keys.DiscoveryPollingInterval,
+	keys.LogLevel,
+	keys.PollJitter,
+	keys.SplayMax,
+	keys.StatusCheckInterval,
+	keys.StatusPollingInterval,
+	keys.StatusReportTimeout,
+	keys.Tags,
+	keys.TrackerPollingInterval,
+}
+
+// reloadConfig re-reads the config file and applies the changed reloadable settings from
+// the new config, the global settings are not changed. An invalid config is not applied,
+// the running config is kept.
+func (m *Manager) reloadConfig() {
+	cfg, changed, err := config.Reload()
+	if err != nil {
+		m.logger.Error().Err(err).Msg("config reload failed, keeping running config")
+
+		return
+	}
+
+	if len(changed) == 0 {
+		m.logger.Info().Msg("config reloaded, no changes")
+
+		return
+	}
+
+	m.logger.Info().Strs("changed", changed).Msg("config reloaded")
+
+	if changedAny(changed, keys.Debug, keys.LogLevel) {
+		if err := config.SetLogLevel(cfg); err != nil {
+			m.logger.Error().Err(err).Msg("setting log level")
+		}
+	}
+
+	if changedAny(changed, keys.SplayMax, keys.PollJitter) {
+		splay.Reconfigure(cfg)
+	}
+
+	if changedAny(changed, keys.ChangeWindows) {
+		window.Reconfigure(cfg)
+	}
+
+	if changedAny(changed, "maintenance.") {
+		maintenance.Reconfigure(cfg)
+	}
+
+	if changedAny(changed, keys.ActionPollingInterval) && m.actionPoller != nil {
+		if err := m.actionPoller.Reconfigure(cfg); err != nil {
+			m.logger.Error().Err(err).Msg("reconfiguring action poller")
+		}
+	}
+
+	if changedAny(changed, keys.TrackerPollingInterval) && m.trackerPoller != nil {
+		if err := m.trackerPoller.Reconfigure(cfg); err != nil {
+			m.logger.Error().Err(err).Msg("reconfiguring config tracker")
+		}
+	}
+
+	if changedAny(changed, keys.DiscoveryPollingInterval) && m.discovery != nil {
+		if err := m.discovery.Reconfigure(cfg); err != nil {
+			m.logger.Error().Err(err).Msg("reconfiguring agent discovery")
+		}
+	}
+
+	if changedAny(changed, keys.StatusPollingInterval, keys.StatusCheckInterval, keys.StatusReportTimeout) &&
+		m.statusPoller != nil {
+		if err := m.statusPoller.Reconfigure(cfg); err != nil {
+			m.logger.Error().Err(err).Msg("reconfiguring status poller")
+		}
+	}
+
+	if changedAny(changed, keys.Tags) {
+		if err := registration.UpdateTags(m.groupCtx, cfg.GetStringSlice(keys.Tags)); err != nil {
+			m.logger.Warn().Err(err).Msg("updating manager tags via API")
+		}
+	}
+
+	m.serverMu.Lock()
+	if m.server != nil {
+		switch {
+		case changedAny(changed, "server."):
+			m.restartServer(cfg)
+		case changedAny(changed, keys.ActionPollingInterval, keys.StatusCheckInterval,
+			keys.TrackerPollingInterval, keys.DiscoveryPollingInterval):
+			// probe max ages follow the loop intervals
+			if err := m.server.Reconfigure(cfg); err != nil {
+				m.logger.Error().Err(err).Msg("reconfiguring server probes")
+			}
+		}
+	}
+	m.serverMu.Unlock()
+
+	var pending []string
+
+	for _, key := range changed {
+		if !changedAny([]string{key}, reloadable...) {
+			pending = append(pending, key)
+		}
+	}
+
+	if len(pending) > 0 {
+		m.logger.Warn().Strs("settings", pending).Msg("restart required to apply")
+	}
+}
+
+// restartServer replaces the server with one using the settings in cfg. A server on a new
+// address binds before the running server is stopped. On the same address the running
+// server is stopped first, if the new server then cannot bind, a server with the previous
+// settings is restored. The caller holds serverMu.
+func (m *Manager) restartServer(cfg *viper.Viper) {
+	s, err := server.New(cfg)
+	if err != nil {
+		m.logger.Error().Err(err).Msg("new server settings, keeping running server")
+
+		return
+	}
+
+	old := m.server
+
+	if s.Addr() != old.Addr() {
+		if err := s.Listen(m.groupCtx); err != nil {
+			m.logger.Error().Err(err).Msg("new server settings, keeping running server")
+
+			return
+		}
+	}
+
+	if err := old.Stop(m.groupCtx); err != nil {
+		m.logger.Warn().Err(err).Msg("stopping server")
+	}
+
+	m.server = nil
+
+	if err := s.Listen(m.groupCtx); err != nil {
+		m.logger.Error().Err(err).Msg("new server settings, restoring previous server")
+
+		s, err = server.New(m.serverCfg)
+		if err == nil {
+			err = s.Listen(m.groupCtx)
+		}
+
+		if err != nil {
+			m.logger.Error().Err(err).Msg("restoring previous server")
+
+			return
+		}
+
+		cfg = m.serverCfg
+	}
+
+	m.server = s
+	m.serverCfg = cfg
+
+	m.group.Go(func() error {
+		return s.Start(m.groupCtx)
+	})
+}
+
+// changedAny returns true if any of the changed keys match a key, or key prefix ending in ".".
+func changedAny(changed []string, match ...string) bool {
+	for _, c := range changed {
+		for _, k := range match {
+			if c == k || (strings.HasSuffix(k, ".") && strings.HasPrefix(c, k)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
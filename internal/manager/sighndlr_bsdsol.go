@@ -35,7 +35,7 @@ func (m *Manager) handleSignals() error {
 			case os.Interrupt, unix.SIGTERM:
 				m.Stop()
 			case unix.SIGHUP:
-				// Noop
+				m.reloadConfig()
 			case unix.SIGINFO:
 				stacklen := runtime.Stack(buf, true)
 				fmt.Printf("=== received SIGINFO ===\n*** goroutine dump...\n%s\n*** end\n", buf[:stacklen])
@@ -35,7 +35,7 @@ func (m *Manager) handleSignals() error {
 			case os.Interrupt, unix.SIGTERM:
 				m.Stop()
 			case unix.SIGHUP:
-				// Noop
+				m.reloadConfig()
 			case unix.SIGTRAP:
 				stacklen := runtime.Stack(buf, true)
 				fmt.Printf("=== received SIGTRAP ===\n*** goroutine dump...\n%s\n*** end\n", buf[:stacklen])
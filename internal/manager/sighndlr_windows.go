@@ -35,7 +35,7 @@ func (m *Manager) handleSignals() error {
 			case os.Interrupt, syscall.SIGTERM:
 				m.Stop()
 			case syscall.SIGHUP:
-				// Noop
+				m.reloadConfig()
 			case syscall.SIGTRAP:
 				stacklen := runtime.Stack(buf, true)
 				fmt.Printf("=== received SIGTRAP ===\n*** goroutine dump...\n%s\n*** end\n", buf[:stacklen])
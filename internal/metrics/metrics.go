@@ -0,0 +1,204 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/release"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics for the manager itself, exposed on /metrics.
+
+const namespace = "circonus_am"
+
+const (
+	resultOK    = "ok"
+	resultError = "error"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+	factory  = promauto.With(registry)
+
+	actionPolls = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "action_polls_total",
+		Help:      "Polls for actions by result.",
+	}, []string{"result"})
+
+	actionPollDuration = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "action_poll_duration_seconds",
+		Help:      "Time taken to poll for and perform actions.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	actions = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "actions_total",
+		Help:      "Actions performed by type and outcome.",
+	}, []string{"type", "outcome"})
+
+	deferredActions = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "deferred_actions",
+		Help:      "Actions deferred and waiting to be applied, by reason.",
+	}, []string{"reason"})
+
+	configWrites = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "config_writes_total",
+		Help:      "Agent config file writes by agent and result.",
+	}, []string{"agent", "result"})
+
+	configReloads = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "config_reloads_total",
+		Help:      "Agent config reloads by agent, method and result.",
+	}, []string{"agent", "method", "result"})
+
+	commands = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "command_executions_total",
+		Help:      "Agent command executions by agent, command and exit code.",
+	}, []string{"agent", "command", "exit_code"})
+
+	statusReports = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "status_reports_total",
+		Help:      "Agent status reports by kind (full or heartbeat) and result.",
+	}, []string{"kind", "result"})
+
+	trackerChecks = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tracker_checks_total",
+		Help:      "Config tracker checks by result.",
+	}, []string{"result"})
+
+	configDrift = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "config_drift_detections_total",
+		Help:      "Agent config files detected as modified outside of the manager.",
+	}, []string{"agent"})
+
+	agentDiscovery = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "agent_discovery_changes_total",
+		Help:      "Agent changes (added, removed, version) found by discovery.",
+	}, []string{"agent", "change"})
+
+	tokenRefreshes = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_refreshes_total",
+		Help:      "API token refreshes by result.",
+	}, []string{"result"})
+
+	apiErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_errors_total",
+		Help:      "API errors by endpoint and status code (0, no response).",
+	}, []string{"endpoint", "status_code"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "build_info",
+		Help:      "Build information, value is always 1.",
+		ConstLabels: prometheus.Labels{
+			"version": release.VERSION,
+			"commit":  release.COMMIT,
+			"date":    release.DATE,
+			"tag":     release.TAG,
+		},
+	}).Set(1)
+}
+
+// Handler returns the /metrics handler.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+func result(err error) string {
+	if err != nil {
+		return resultError
+	}
+
+	return resultOK
+}
+
+// ActionPoll records a poll for actions which started at start.
+func ActionPoll(start time.Time, err error) {
+	actionPolls.WithLabelValues(result(err)).Inc()
+	actionPollDuration.Observe(time.Since(start).Seconds())
+}
+
+// Action records an action performed, outcome is ok, error, skipped or deferred.
+func Action(actionType, outcome string) {
+	actions.WithLabelValues(actionType, outcome).Inc()
+}
+
+// DeferredActions records the number of actions deferred for reason.
+func DeferredActions(reason string, n int) {
+	deferredActions.WithLabelValues(reason).Set(float64(n))
+}
+
+// ActionResult records an action performed with the outcome derived from err.
+func ActionResult(actionType string, err error) {
+	Action(actionType, result(err))
+}
+
+// ConfigWrite records writing an agent config file.
+func ConfigWrite(agent string, err error) {
+	configWrites.WithLabelValues(agent, result(err)).Inc()
+}
+
+// ConfigReload records reloading an agent after a config change (or reload command).
+func ConfigReload(agent, method string, err error) {
+	configReloads.WithLabelValues(agent, method, result(err)).Inc()
+}
+
+// Command records an agent command execution.
+func Command(agent, command string, exitCode int) {
+	commands.WithLabelValues(agent, command, strconv.Itoa(exitCode)).Inc()
+}
+
+// StatusReport records sending an agent status, kind is full or heartbeat.
+func StatusReport(kind string, err error) {
+	statusReports.WithLabelValues(kind, result(err)).Inc()
+}
+
+// TrackerCheck records verifying a tracked config file.
+func TrackerCheck(err error) {
+	trackerChecks.WithLabelValues(result(err)).Inc()
+}
+
+// ConfigDrift records an agent config file modified outside of the manager.
+func ConfigDrift(agent string) {
+	configDrift.WithLabelValues(agent).Inc()
+}
+
+// AgentDiscovered records an agent change found by discovery.
+func AgentDiscovered(agent, change string) {
+	agentDiscovery.WithLabelValues(agent, change).Inc()
+}
+
+// TokenRefresh records refreshing the API token.
+func TokenRefresh(err error) {
+	tokenRefreshes.WithLabelValues(result(err)).Inc()
+}
+
+// APIError records a failed API call, statusCode is 0 if there was no response.
+func APIError(endpoint string, statusCode int) {
+	apiErrors.WithLabelValues(endpoint, strconv.Itoa(statusCode)).Inc()
+}
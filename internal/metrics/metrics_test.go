@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	ActionPoll(time.Now(), nil)
+	ActionResult("config", errors.New("failed"))
+	Command("telegraf", "restart", 1)
+	APIError("actions", 503)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []string{
+		`circonus_am_build_info{`,
+		`circonus_am_action_polls_total{result="ok"} 1`,
+		`circonus_am_action_poll_duration_seconds_count 1`,
+		`circonus_am_actions_total{outcome="error",type="config"} 1`,
+		`circonus_am_command_executions_total{agent="telegraf",command="restart",exit_code="1"} 1`,
+		`circonus_am_api_errors_total{endpoint="actions",status_code="503"} 1`,
+		`go_goroutines`,
+	}
+
+	for _, want := range tests {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
@@ -10,12 +10,34 @@ import (
 )
 
 type Agent struct {
-	AgentID     string `json:"agent_id"      yaml:"agent_id"`
-	AgentTypeID string `json:"agent_type_id" yaml:"agent_type_id"`
+	AgentID     string `json:"agent_id"          yaml:"agent_id"`
+	AgentTypeID string `json:"agent_type_id"     yaml:"agent_type_id"`
+	Version     string `json:"version,omitempty" yaml:"version,omitempty"` // last reported version
+	Path        string `json:"path,omitempty"    yaml:"path,omitempty"`    // detected binary
+	Removed     bool   `json:"removed,omitempty" yaml:"removed,omitempty"` // no longer installed, kept so a reinstall reuses the id
 }
 type Agents []Agent
 
+// LoadInstalledAgents returns the registered agents which are installed.
 func LoadInstalledAgents() (Agents, error) {
+	all, err := LoadRegisteredAgents()
+	if err != nil {
+		return nil, err
+	}
+
+	installed := make(Agents, 0, len(all))
+
+	for _, a := range all {
+		if !a.Removed {
+			installed = append(installed, a)
+		}
+	}
+
+	return installed, nil
+}
+
+// LoadRegisteredAgents returns all of the registered agents, including removed agents.
+func LoadRegisteredAgents() (Agents, error) {
 	agentFile := filepath.Join(defaults.EtcPath, "agents.yaml")
 
 	data, err := os.ReadFile(agentFile)
@@ -31,10 +53,27 @@ func LoadInstalledAgents() (Agents, error) {
 	return a, nil
 }
 
+// SaveInstalledAgents saves the registered agents. Removed agents already saved are
+// kept, unless a has the agent type.
 func SaveInstalledAgents(a Agents) error {
 	agentFile := filepath.Join(defaults.EtcPath, "agents.yaml")
 
-	data, err := yaml.Marshal(a)
+	types := make(map[string]bool, len(a))
+	for _, agent := range a {
+		types[agent.AgentTypeID] = true
+	}
+
+	agents := append(Agents{}, a...)
+
+	if prev, err := LoadRegisteredAgents(); err == nil {
+		for _, agent := range prev {
+			if agent.Removed && !types[agent.AgentTypeID] {
+				agents = append(agents, agent)
+			}
+		}
+	}
+
+	data, err := yaml.Marshal(agents)
 	if err != nil {
 		return err
 	}
@@ -11,6 +11,8 @@ import (
 
 	"github.com/circonus/agent-manager/internal/config/keys"
 	"github.com/circonus/agent-manager/internal/credentials"
+	"github.com/circonus/agent-manager/internal/metrics"
+	"github.com/circonus/agent-manager/internal/tracing"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 )
@@ -21,6 +23,8 @@ func RefreshRegistration(ctx context.Context) error {
 	log.Info().Msg("refreshing token")
 
 	reg, err := getNewJWT(ctx)
+	metrics.TokenRefresh(err)
+
 	if err != nil {
 		return fmt.Errorf("refreshing token: %w", err)
 	}
@@ -67,11 +71,14 @@ func getNewJWT(ctx context.Context) (*Response, error) {
 	}
 
 	req.Header.Add("Authorization", token)
+	tracing.Inject(ctx, req.Header)
 
 	client := &http.Client{}
 
 	resp, err := client.Do(req)
 	if err != nil {
+		metrics.APIError("token_refresh", 0)
+
 		return nil, fmt.Errorf("calling registration endpoint: %w", err)
 	}
 
@@ -83,6 +90,8 @@ func getNewJWT(ctx context.Context) (*Response, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
+		metrics.APIError("token_refresh", resp.StatusCode)
+
 		return nil, fmt.Errorf("non-200 response -- status: %d %s, body: %s", resp.StatusCode, resp.Status, string(body))
 	}
 
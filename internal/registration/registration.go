@@ -16,6 +16,8 @@ import (
 
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/circonus/agent-manager/internal/audit"
+	"github.com/circonus/agent-manager/internal/config"
 	"github.com/circonus/agent-manager/internal/config/keys"
 	"github.com/circonus/agent-manager/internal/credentials"
 	"github.com/circonus/agent-manager/internal/release"
@@ -67,11 +69,6 @@ type Response struct {
 	RefreshToken string `json:"refresh_token" yaml:"refresh_token"`
 }
 
-const (
-	maxTags   = 32
-	maxTagLen = 256
-)
-
 // Start the registration process.
 func Start(ctx context.Context) error {
 	log.Info().Msg("starting registration")
@@ -80,7 +77,7 @@ func Start(ctx context.Context) error {
 
 	hn, err := os.Hostname()
 	if err != nil {
-		log.Fatal().Err(err).Msg("getting hostname")
+		return fmt.Errorf("getting hostname: %w", err)
 	}
 
 	if viper.GetString(keys.InstanceID) != "" {
@@ -88,17 +85,17 @@ func Start(ctx context.Context) error {
 	}
 
 	if hn == "" {
-		log.Fatal().Str("hostname", hn).Msg("empty hostname")
+		return fmt.Errorf("invalid hostname (empty)")
 	}
 
 	mid, err := getMachineID()
 	if err != nil {
-		log.Fatal().Err(err).Str("mid", mid).Msg("invalid machine id")
+		return fmt.Errorf("invalid machine id (%s): %w", mid, err)
 	}
 
 	reg, err := getHostInfo()
 	if err != nil {
-		log.Fatal().Err(err).Msg("unable to retrieve host info")
+		return fmt.Errorf("retrieving host info: %w", err)
 	}
 
 	reg.Hostname = hn
@@ -109,7 +106,7 @@ func Start(ctx context.Context) error {
 	if len(awstags) > 0 {
 		at, err := getAWSTags(ctx, awstags)
 		if err != nil {
-			log.Fatal().Err(err).Msg("adding AWS EC2 tags")
+			return fmt.Errorf("adding AWS EC2 tags: %w", err)
 		}
 
 		reg.Data.AWSMeta = at
@@ -122,21 +119,26 @@ func Start(ctx context.Context) error {
 
 	jwt, err := getJWT(ctx, token, reg)
 	if err != nil {
-		log.Fatal().Err(err).Msg("getting token")
+		return fmt.Errorf("getting token: %w", err)
 	}
 
 	if err := credentials.SaveJWT([]byte(jwt.AuthToken)); err != nil {
-		log.Fatal().Err(err).Msg("saving token")
+		return fmt.Errorf("saving token: %w", err)
 	}
 
 	if err := credentials.SaveRefreshToken([]byte(jwt.RefreshToken)); err != nil {
-		log.Fatal().Err(err).Msg("saving token")
+		return fmt.Errorf("saving refresh token: %w", err)
 	}
 
 	if err := credentials.SaveManagerID([]byte(jwt.ManagerID)); err != nil {
-		log.Fatal().Err(err).Msg("saving manager id")
+		return fmt.Errorf("saving manager id: %w", err)
 	}
 
+	audit.Record(ctx, audit.Entry{
+		Event:  audit.EventRegister,
+		Detail: fmt.Sprintf("manager id %s, hostname %s", jwt.ManagerID, reg.Hostname),
+	})
+
 	return nil
 }
 
@@ -327,15 +329,18 @@ func getAWSTags(ctx context.Context, tags []string) (AWSTags, error) {
 }
 
 func formatTags(tags []string) []string {
-	if len(tags) > maxTags {
-		log.Fatal().Int("max_tags", maxTags).Int("num_tags", len(tags)).Msg("too many tags")
+	if len(tags) > config.MaxTags {
+		// rejected by config validation
+		log.Warn().Int("max_tags", config.MaxTags).Int("num_tags", len(tags)).Msg("too many tags, ignoring extra tags")
+
+		tags = tags[:config.MaxTags]
 	}
 
 	t := make([]string, 0, len(tags))
 
 	for _, tag := range tags {
-		if len(tag) > maxTagLen {
-			log.Warn().Int("max_tag_len", maxTagLen).Int("tag_len", len(tag)).Str("tag", tag).Msg("tag too long, ignoring")
+		if len(tag) > config.MaxTagLen {
+			log.Warn().Int("max_tag_len", config.MaxTagLen).Int("tag_len", len(tag)).Str("tag", tag).Msg("tag too long, ignoring")
 
 			continue
 		}
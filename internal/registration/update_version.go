@@ -3,18 +3,59 @@ package registration
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 
+	"github.com/circonus/agent-manager/internal/audit"
+	"github.com/circonus/agent-manager/internal/config"
 	"github.com/circonus/agent-manager/internal/config/keys"
 	"github.com/circonus/agent-manager/internal/credentials"
+	"github.com/circonus/agent-manager/internal/metrics"
 	"github.com/circonus/agent-manager/internal/release"
+	"github.com/circonus/agent-manager/internal/tracing"
 	"github.com/spf13/viper"
 )
 
 func UpdateVersion(ctx context.Context) error {
+	data := []byte(`{"version":"v` + release.VERSION + `"}`)
+
+	return updateManager(ctx, "manager_version", data)
+}
+
+// UpdateTags sends the manager tags (e.g. after a config reload).
+func UpdateTags(ctx context.Context, tags []string) error {
+	if len(tags) > config.MaxTags {
+		return fmt.Errorf("too many tags (%d), max %d", len(tags), config.MaxTags)
+	}
+
+	data, err := json.Marshal(struct {
+		Tags []string `json:"tags"`
+	}{Tags: formatTags(tags)})
+	if err != nil {
+		return fmt.Errorf("marshal tags: %w", err)
+	}
+
+	return updateManager(ctx, "manager_tags", data)
+}
+
+// UpdateAuditAnchor sends the position of the newest audit log entry, an off host
+// record to verify the local audit log against (see audit.VerifyAnchor).
+func UpdateAuditAnchor(ctx context.Context, anchor audit.Anchor) error {
+	data, err := json.Marshal(struct {
+		Audit audit.Anchor `json:"audit"`
+	}{Audit: anchor})
+	if err != nil {
+		return fmt.Errorf("marshal audit anchor: %w", err)
+	}
+
+	return updateManager(ctx, "manager_audit", data)
+}
+
+// updateManager updates the manager record, endpoint identifies the call in metrics.
+func updateManager(ctx context.Context, endpoint string, data []byte) error {
 	token := viper.GetString(keys.APIToken)
 	if token == "" {
 		if err := credentials.LoadJWT(); err != nil {
@@ -44,19 +85,20 @@ func UpdateVersion(ctx context.Context) error {
 		return fmt.Errorf("req url: %w", err)
 	}
 
-	data := []byte(`{"version":"v` + release.VERSION + `"}`)
-
 	req, err := http.NewRequestWithContext(ctx, http.MethodPut, reqURL, bytes.NewReader(data))
 	if err != nil {
 		return fmt.Errorf("creating request: %w", err)
 	}
 
 	req.Header.Add("Authorization", token)
+	tracing.Inject(ctx, req.Header)
 
 	client := &http.Client{}
 
 	resp, err := client.Do(req)
 	if err != nil {
+		metrics.APIError(endpoint, 0)
+
 		return fmt.Errorf("calling registration endpoint: %w", err)
 	}
 
@@ -68,6 +110,8 @@ func UpdateVersion(ctx context.Context) error {
 	}
 
 	if resp.StatusCode != http.StatusOK {
+		metrics.APIError(endpoint, resp.StatusCode)
+
 		return fmt.Errorf("non-200 response -- status: %d %s, body: %s", resp.StatusCode, resp.Status, string(body))
 	}
 
@@ -0,0 +1,81 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/circonus/agent-manager/internal/config/defaults"
+)
+
+// EnvProvider resolves references from environment variables, only variables matching
+// one of the allow patterns (path.Match syntax, e.g. SECRET_*) are used.
+type EnvProvider struct {
+	allow []string
+}
+
+func NewEnvProvider(allow []string) *EnvProvider {
+	return &EnvProvider{allow: allow}
+}
+
+func (EnvProvider) Name() string { return "env" }
+
+func (p EnvProvider) Get(_ context.Context, ref string) (string, error) {
+	if !p.allowed(ref) {
+		return "", fmt.Errorf("environment variable %s not allowed (see secrets.env.allow)", ref)
+	}
+
+	val, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s not set", ref)
+	}
+
+	return val, nil
+}
+
+func (p EnvProvider) allowed(name string) bool {
+	for _, pattern := range p.allow {
+		if ok, err := path.Match(pattern, name); err == nil && ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FileProvider resolves references from the contents of local files, trailing
+// newlines are removed. Files must be within basePath.
+type FileProvider struct {
+	basePath string
+}
+
+// NewFileProvider returns a file provider restricted to basePath, the default secrets
+// directory (etc/secrets) if empty. Use "/" to allow any file.
+func NewFileProvider(basePath string) *FileProvider {
+	if basePath == "" {
+		basePath = defaults.SecretsPath
+	}
+
+	return &FileProvider{basePath: basePath}
+}
+
+func (FileProvider) Name() string { return "file" }
+
+func (p FileProvider) Get(_ context.Context, ref string) (string, error) {
+	file := filepath.Clean(ref)
+
+	rel, err := filepath.Rel(filepath.Clean(p.basePath), file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not within %s (see secrets.file.base_path)", file, p.basePath)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,130 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// VaultConfig defines the settings for a Vault KV v2 compatible endpoint.
+type VaultConfig struct {
+	Address   string
+	Token     string
+	TokenFile string // used if Token is empty, re-read on each request (e.g. vault agent sink)
+	Mount     string
+	Namespace string
+}
+
+// VaultProvider resolves references from a Vault KV v2 compatible HTTP API.
+// Reference format: <path>#<key> e.g. telegraf/outputs#password.
+type VaultProvider struct {
+	client *http.Client
+	cfg    VaultConfig
+}
+
+func NewVaultProvider(cfg VaultConfig) *VaultProvider {
+	if cfg.Mount == "" {
+		cfg.Mount = "secret"
+	}
+
+	return &VaultProvider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (VaultProvider) Name() string { return "vault" }
+
+type vaultKVResponse struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+}
+
+func (p *VaultProvider) Get(ctx context.Context, ref string) (string, error) {
+	secretPath, key, found := strings.Cut(ref, "#")
+	if !found || secretPath == "" || key == "" {
+		return "", fmt.Errorf("invalid vault reference (%s), expected <path>#<key>", ref)
+	}
+
+	token, err := p.token()
+	if err != nil {
+		return "", err
+	}
+
+	reqURL, err := url.JoinPath(p.cfg.Address, "v1", p.cfg.Mount, "data", secretPath)
+	if err != nil {
+		return "", fmt.Errorf("req url: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Add("X-Vault-Token", token)
+
+	if p.cfg.Namespace != "" {
+		req.Header.Add("X-Vault-Namespace", p.cfg.Namespace)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("calling vault: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("reading response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("non-200 response -- status: %s, body: %s", resp.Status, string(body))
+	}
+
+	var kv vaultKVResponse
+	if err := json.Unmarshal(body, &kv); err != nil {
+		return "", fmt.Errorf("parsing response body: %w", err)
+	}
+
+	val, ok := kv.Data.Data[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in %s", key, secretPath)
+	}
+
+	if s, ok := val.(string); ok {
+		return s, nil
+	}
+
+	return fmt.Sprint(val), nil
+}
+
+func (p *VaultProvider) token() (string, error) {
+	if p.cfg.Token != "" {
+		return p.cfg.Token, nil
+	}
+
+	if p.cfg.TokenFile == "" {
+		return "", fmt.Errorf("invalid vault token (empty)")
+	}
+
+	data, err := os.ReadFile(p.cfg.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("reading vault token file: %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("invalid vault token (empty)")
+	}
+
+	return token, nil
+}
@@ -0,0 +1,405 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"golang.org/x/sync/singleflight"
+)
+
+/*
+  Secrets are referenced in pushed configs (and http reload settings) and resolved
+  locally, at apply time, so they never have to be stored in the platform.
+
+  Reference syntax: ${secret:<provider>:<ref>}
+
+    ${secret:env:TELEGRAF_PASSWORD}           environment variable
+    ${secret:file:/etc/telegraf/api.key}      contents of a local file
+    ${secret:vault:telegraf/outputs#password} key from a Vault KV v2 secret
+*/
+
+// SecretProvider resolves a reference to a secret value.
+type SecretProvider interface {
+	// Name is the provider name used in references (e.g. env, file, vault).
+	Name() string
+	// Get returns the secret value for the reference.
+	Get(ctx context.Context, ref string) (string, error)
+}
+
+// lookupTimeout limits a provider lookup shared by concurrent callers.
+const lookupTimeout = 30 * time.Second
+
+const (
+	// minRedactLen is the shortest secret value looked for in edited lines (see Redact).
+	minRedactLen = 6
+	// redactedLine replaces an edited line which may contain a secret.
+	redactedLine = "<redacted>"
+)
+
+// detached keeps the values of a context (e.g. the trace) without its cancellation.
+type detached struct{ context.Context }
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
+type cacheEntry struct {
+	expires time.Time
+	value   string
+}
+
+// Resolver expands secret references using a set of providers, caching values for ttl.
+type Resolver struct {
+	providers map[string]SecretProvider
+	cache     map[string]cacheEntry
+	calls     singleflight.Group
+	ttl       time.Duration
+	mu        sync.Mutex // protects cache
+}
+
+var (
+	refRx = regexp.MustCompile(`\$\{secret:([a-z0-9_]+):([^}]+)\}`)
+
+	defaultResolver *Resolver
+	drm             sync.Mutex
+)
+
+// NewResolver returns a resolver using the supplied providers.
+func NewResolver(ttl time.Duration, providers ...SecretProvider) *Resolver {
+	r := &Resolver{
+		providers: make(map[string]SecretProvider, len(providers)),
+		cache:     make(map[string]cacheEntry),
+		ttl:       ttl,
+	}
+
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+	}
+
+	return r
+}
+
+// HasRefs reports whether data contains any secret references.
+func HasRefs(data []byte) bool {
+	return refRx.Match(data)
+}
+
+// Resolve expands all secret references in data using the default resolver.
+func Resolve(ctx context.Context, data []byte) ([]byte, error) {
+	if !HasRefs(data) {
+		return data, nil
+	}
+
+	r, err := getDefaultResolver()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Resolve(ctx, data)
+}
+
+// ResolveString expands all secret references in s using the default resolver.
+func ResolveString(ctx context.Context, s string) (string, error) {
+	data, err := Resolve(ctx, []byte(s))
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// Redact replaces the secret values in data (e.g. a config file as written) with the
+// references in tmpl (the config as applied, references unresolved) using the default
+// resolver, so the two can be compared without exposing secrets.
+func Redact(ctx context.Context, data, tmpl []byte) ([]byte, error) {
+	if !HasRefs(tmpl) {
+		return data, nil
+	}
+
+	r, err := getDefaultResolver()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Redact(ctx, data, tmpl)
+}
+
+// Reset discards the default resolver (and its cache), it will be
+// rebuilt from the current settings on next use.
+func Reset() {
+	drm.Lock()
+	defer drm.Unlock()
+
+	defaultResolver = nil
+}
+
+func getDefaultResolver() (*Resolver, error) {
+	drm.Lock()
+	defer drm.Unlock()
+
+	if defaultResolver != nil {
+		return defaultResolver, nil
+	}
+
+	ttl, err := time.ParseDuration(viper.GetString(keys.SecretsCacheTTL))
+	if err != nil {
+		return nil, fmt.Errorf("parsing secrets cache ttl (%s): %w", viper.GetString(keys.SecretsCacheTTL), err)
+	}
+
+	providers := []SecretProvider{
+		NewEnvProvider(viper.GetStringSlice(keys.SecretsEnvAllow)),
+		NewFileProvider(viper.GetString(keys.SecretsFileBasePath)),
+	}
+
+	if viper.GetString(keys.SecretsVaultAddress) != "" {
+		providers = append(providers, NewVaultProvider(VaultConfig{
+			Address:   viper.GetString(keys.SecretsVaultAddress),
+			Token:     viper.GetString(keys.SecretsVaultToken),
+			TokenFile: viper.GetString(keys.SecretsVaultTokenFile),
+			Mount:     viper.GetString(keys.SecretsVaultMount),
+			Namespace: viper.GetString(keys.SecretsVaultNamespace),
+		}))
+	}
+
+	defaultResolver = NewResolver(ttl, providers...)
+
+	return defaultResolver, nil
+}
+
+// Resolve expands all secret references in data.
+func (r *Resolver) Resolve(ctx context.Context, data []byte) ([]byte, error) {
+	var rerr error
+
+	out := refRx.ReplaceAllFunc(data, func(m []byte) []byte {
+		if rerr != nil {
+			return m
+		}
+
+		parts := refRx.FindSubmatch(m)
+
+		val, err := r.get(ctx, string(parts[1]), string(parts[2]))
+		if err != nil {
+			rerr = err
+
+			return m
+		}
+
+		return []byte(val)
+	})
+
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	return out, nil
+}
+
+// tmplLine is a line of a config with references, see Redact.
+type tmplLine struct {
+	rx      *regexp.Regexp // nil if the line has no references
+	line    []byte
+	refOnly bool // only references, matches any line with the same literal text (e.g. indentation)
+}
+
+// Redact replaces the secret values in data with the references in tmpl, by position.
+// Lines of data which only differ from the corresponding line of tmpl in place of its
+// references (e.g. a secret rotated since the config was written) are replaced with the
+// tmpl line. Other (edited) lines are masked whole where tmpl has references, or if they
+// contain a current secret value of at least minRedactLen bytes. Values are never
+// replaced within a line, a short value would match unrelated text.
+func (r *Resolver) Redact(ctx context.Context, data, tmpl []byte) ([]byte, error) {
+	var (
+		values [][]byte
+		seen   = make(map[string]bool)
+		tl     []tmplLine
+	)
+
+	for _, line := range bytes.Split(tmpl, []byte("\n")) {
+		matches := refRx.FindAllSubmatchIndex(line, -1)
+		if len(matches) == 0 {
+			tl = append(tl, tmplLine{line: line})
+
+			continue
+		}
+
+		var (
+			pattern strings.Builder
+			literal []byte
+			last    int
+		)
+
+		pattern.WriteString("^")
+
+		for _, m := range matches {
+			ref := line[m[0]:m[1]]
+			if !seen[string(ref)] {
+				seen[string(ref)] = true
+
+				val, err := r.get(ctx, string(line[m[2]:m[3]]), string(line[m[4]:m[5]]))
+				if err != nil {
+					return nil, err
+				}
+
+				if len(val) >= minRedactLen {
+					values = append(values, []byte(val))
+				}
+			}
+
+			literal = append(literal, line[last:m[0]]...)
+			pattern.WriteString(regexp.QuoteMeta(string(line[last:m[0]])))
+			pattern.WriteString("(.*)")
+
+			last = m[1]
+		}
+
+		literal = append(literal, line[last:]...)
+		pattern.WriteString(regexp.QuoteMeta(string(line[last:])))
+		pattern.WriteString("$")
+
+		tl = append(tl, tmplLine{
+			rx:      regexp.MustCompile(pattern.String()),
+			line:    line,
+			refOnly: len(bytes.TrimSpace(literal)) == 0,
+		})
+	}
+
+	if len(seen) == 0 {
+		return data, nil
+	}
+
+	matches := func(t tmplLine, l []byte) bool {
+		if t.rx == nil {
+			return bytes.Equal(t.line, l)
+		}
+
+		return t.rx.Match(l)
+	}
+
+	out := bytes.Split(data, []byte("\n"))
+
+	// lines in the same position from the start and the end
+	prefix := 0
+	for prefix < len(out) && prefix < len(tl) && matches(tl[prefix], out[prefix]) {
+		out[prefix] = tl[prefix].line
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(out)-prefix && suffix < len(tl)-prefix {
+		t := tl[len(tl)-1-suffix]
+		if !matches(t, out[len(out)-1-suffix]) {
+			break
+		}
+
+		out[len(out)-1-suffix] = t.line
+		suffix++
+	}
+
+	// the edited lines in between
+	edited := tl[prefix : len(tl)-suffix]
+
+	hasRefs := false
+
+	for _, t := range edited {
+		if t.rx != nil {
+			hasRefs = true
+
+			break
+		}
+	}
+
+	for i := prefix; i < len(out)-suffix; i++ {
+		out[i] = redactLine(out[i], edited, values, hasRefs, matches)
+	}
+
+	return bytes.Join(out, []byte("\n")), nil
+}
+
+// redactLine returns an edited line of data: the corresponding tmpl line if it matches
+// one, the line if it is unchanged text, otherwise masked if it may contain a secret.
+func redactLine(l []byte, edited []tmplLine, values [][]byte, hasRefs bool, matches func(tmplLine, []byte) bool) []byte {
+	for _, t := range edited {
+		if !t.refOnly && matches(t, l) {
+			return t.line
+		}
+	}
+
+	mask := hasRefs
+
+	for _, v := range values {
+		if bytes.Contains(l, v) {
+			mask = true
+
+			break
+		}
+	}
+
+	if !mask {
+		return l
+	}
+
+	indent := len(l) - len(bytes.TrimLeft(l, " \t"))
+
+	return append(l[:indent:indent], redactedLine...)
+}
+
+func (r *Resolver) get(ctx context.Context, provider, ref string) (string, error) {
+	key := provider + ":" + ref
+
+	r.mu.Lock()
+	e, cached := r.cache[key]
+	r.mu.Unlock()
+
+	if cached && time.Now().Before(e.expires) {
+		return e.value, nil
+	}
+
+	p, ok := r.providers[provider]
+	if !ok {
+		return "", fmt.Errorf("unknown secret provider (%s)", provider)
+	}
+
+	// the provider may be a network call (e.g. vault), concurrent lookups of a reference
+	// share one call and lookups of other references are not blocked.
+	ch := r.calls.DoChan(key, func() (any, error) {
+		// shared, not cancelled when the caller which started it gives up
+		lctx, cancel := context.WithTimeout(detached{ctx}, lookupTimeout)
+		defer cancel()
+
+		val, err := p.Get(lctx, ref)
+		if err != nil {
+			return "", fmt.Errorf("secret %s: %w", key, err)
+		}
+
+		if r.ttl > 0 {
+			r.mu.Lock()
+			r.cache[key] = cacheEntry{value: val, expires: time.Now().Add(r.ttl)}
+			r.mu.Unlock()
+		}
+
+		log.Debug().Str("provider", provider).Str("ref", ref).Msg("resolved secret")
+
+		return val, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return "", fmt.Errorf("secret %s: %w", key, ctx.Err())
+	case res := <-ch:
+		if res.Err != nil {
+			return "", res.Err
+		}
+
+		val, _ := res.Val.(string)
+
+		return val, nil
+	}
+}
@@ -0,0 +1,380 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/config/defaults"
+)
+
+const (
+	testVaultToken = "s.test"
+)
+
+func testVaultServer(t *testing.T, hits *int) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != testVaultToken {
+			http.Error(w, "permission denied", http.StatusForbidden)
+
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/secret/data/telegraf/outputs":
+			*hits++
+
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"data":{"data":{"password":"hunter2","port":8443},"metadata":{"version":3}}}`))
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+}
+
+func TestResolver_Resolve(t *testing.T) {
+	t.Setenv("CAM_TEST_SECRET", "from-env")
+	t.Setenv("CAM_SECRETS_VAULT_TOKEN_TEST", "not-allowed")
+
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "api.key")
+
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	hits := 0
+	ts := testVaultServer(t, &hits)
+
+	defer ts.Close()
+
+	r := NewResolver(time.Minute,
+		NewEnvProvider([]string{"CAM_TEST_*"}),
+		NewFileProvider(dir),
+		NewVaultProvider(VaultConfig{Address: ts.URL, Token: testVaultToken}),
+	)
+
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "no refs",
+			data: "password = \"plain\"",
+			want: "password = \"plain\"",
+		},
+		{
+			name: "env",
+			data: "password = \"${secret:env:CAM_TEST_SECRET}\"",
+			want: "password = \"from-env\"",
+		},
+		{
+			name: "file",
+			data: "key = \"${secret:file:" + secretFile + "}\"",
+			want: "key = \"from-file\"",
+		},
+		{
+			name: "vault",
+			data: "password = \"${secret:vault:telegraf/outputs#password}\"\nport = ${secret:vault:telegraf/outputs#port}",
+			want: "password = \"hunter2\"\nport = 8443",
+		},
+		{
+			name:    "invalid (unknown provider)",
+			data:    "${secret:foo:bar}",
+			wantErr: true,
+		},
+		{
+			name:    "invalid (missing env)",
+			data:    "${secret:env:CAM_TEST_SECRET_MISSING}",
+			wantErr: true,
+		},
+		{
+			name:    "invalid (env not allowed)",
+			data:    "${secret:env:CAM_SECRETS_VAULT_TOKEN_TEST}",
+			wantErr: true,
+		},
+		{
+			name:    "invalid (file outside base path)",
+			data:    "${secret:file:/etc/passwd}",
+			wantErr: true,
+		},
+		{
+			name:    "invalid (vault missing key)",
+			data:    "${secret:vault:telegraf/outputs#username}",
+			wantErr: true,
+		},
+		{
+			name:    "invalid (vault missing secret)",
+			data:    "${secret:vault:telegraf/inputs#password}",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Resolve(context.Background(), []byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && string(got) != tt.want {
+				t.Fatalf("Resolve() = %q, want %q", string(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestResolver_cache(t *testing.T) {
+	hits := 0
+	ts := testVaultServer(t, &hits)
+
+	defer ts.Close()
+
+	data := []byte("${secret:vault:telegraf/outputs#password}")
+
+	r := NewResolver(time.Minute, NewVaultProvider(VaultConfig{Address: ts.URL, Token: testVaultToken}))
+
+	for i := 0; i < 3; i++ {
+		if _, err := r.Resolve(context.Background(), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if hits != 1 {
+		t.Fatalf("expected 1 vault request with caching, got %d", hits)
+	}
+
+	hits = 0
+	r = NewResolver(0, NewVaultProvider(VaultConfig{Address: ts.URL, Token: testVaultToken}))
+
+	for i := 0; i < 3; i++ {
+		if _, err := r.Resolve(context.Background(), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if hits != 3 {
+		t.Fatalf("expected 3 vault requests without caching, got %d", hits)
+	}
+}
+
+// blockingProvider blocks lookups of "slow" until released, counting calls.
+type blockingProvider struct {
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (*blockingProvider) Name() string { return "test" }
+
+func (p *blockingProvider) Get(ctx context.Context, ref string) (string, error) {
+	p.calls.Add(1)
+
+	if ref == "slow" {
+		select {
+		case <-p.release:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	return ref + "-value", nil
+}
+
+func TestResolver_concurrent(t *testing.T) {
+	p := &blockingProvider{release: make(chan struct{})}
+	r := NewResolver(time.Minute, p)
+
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+
+	results := make(chan string, 3)
+
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			val, err := r.get(ctx, "test", "slow")
+			if err != nil {
+				results <- err.Error()
+
+				return
+			}
+
+			results <- val
+		}()
+	}
+
+	// other references are resolved while the slow lookup is in progress
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		if _, err := r.get(ctx, "test", "fast"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lookup blocked by another reference")
+	}
+
+	// a caller gives up waiting when its context is done
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := r.get(cctx, "test", "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	close(p.release)
+	wg.Wait()
+	close(results)
+
+	for val := range results {
+		if val != "slow-value" {
+			t.Fatalf("get() = %q", val)
+		}
+	}
+
+	// 1 call for slow (shared), 1 for fast
+	if n := p.calls.Load(); n != 2 {
+		t.Fatalf("provider calls = %d, want 2", n)
+	}
+}
+
+func TestFileProvider_default(t *testing.T) {
+	origSecrets := defaults.SecretsPath
+	defaults.SecretsPath = t.TempDir()
+
+	defer func() { defaults.SecretsPath = origSecrets }()
+
+	inside := filepath.Join(defaults.SecretsPath, "api.key")
+	outside := filepath.Join(t.TempDir(), "api.key")
+
+	for _, file := range []string{inside, outside} {
+		if err := os.WriteFile(file, []byte("key\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := NewFileProvider("")
+
+	if got, err := p.Get(context.Background(), inside); err != nil || got != "key" {
+		t.Fatalf("Get(%s) = %q, %v", inside, got, err)
+	}
+
+	if _, err := p.Get(context.Background(), outside); err == nil {
+		t.Fatalf("expected error for %s outside the default secrets directory", outside)
+	}
+
+	// explicitly widened
+	if _, err := NewFileProvider("/").Get(context.Background(), outside); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+}
+
+func TestResolver_Redact(t *testing.T) {
+	t.Setenv("CAM_TEST_SECRET", "from-env")
+	t.Setenv("CAM_TEST_TOKEN", "tok")
+
+	r := NewResolver(time.Minute, NewEnvProvider([]string{"CAM_TEST_*"}))
+
+	tmpl := `[[outputs.http]]
+  url = "https://example.com"
+  password = "${secret:env:CAM_TEST_SECRET}"
+  ${secret:env:CAM_TEST_TOKEN}
+`
+
+	tests := []struct {
+		name    string
+		tmpl    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "unchanged",
+			data: "[[outputs.http]]\n  url = \"https://example.com\"\n  password = \"from-env\"\n  tok\n",
+			want: tmpl,
+		},
+		{
+			name: "edited",
+			data: "[[outputs.http]]\n  url = \"https://example.org\"\n  password = \"from-env\"\n  tok\n",
+			want: "[[outputs.http]]\n  url = \"https://example.org\"\n  password = \"${secret:env:CAM_TEST_SECRET}\"\n  ${secret:env:CAM_TEST_TOKEN}\n",
+		},
+		{
+			name: "rotated",
+			data: "[[outputs.http]]\n  url = \"https://example.com\"\n  password = \"old-secret\"\n  tok\n",
+			want: tmpl,
+		},
+		{
+			name: "moved",
+			data: "[[outputs.http]]\n  url = \"https://example.com\"\n  passwd = \"from-env\"\n  tok\n",
+			want: "[[outputs.http]]\n  url = \"https://example.com\"\n  <redacted>\n  ${secret:env:CAM_TEST_TOKEN}\n",
+		},
+		{
+			name: "edited and rotated",
+			data: "[[outputs.http]]\n  url = \"https://example.com\"\n  password = \"old-secret\" # rotated\n  tok\n",
+			want: "[[outputs.http]]\n  url = \"https://example.com\"\n  <redacted>\n  ${secret:env:CAM_TEST_TOKEN}\n",
+		},
+		{
+			name: "added with secret",
+			data: "[[outputs.http]]\n  url = \"https://example.com\"\n  header = \"from-env\"\n  password = \"from-env\"\n  tok\n",
+			want: "[[outputs.http]]\n  url = \"https://example.com\"\n  <redacted>\n  password = \"${secret:env:CAM_TEST_SECRET}\"\n  ${secret:env:CAM_TEST_TOKEN}\n",
+		},
+		{
+			name: "short value not replaced",
+			data: "[[outputs.http]]\n  url = \"https://tok.example.com\"\n  password = \"from-env\"\n  tok\n",
+			want: "[[outputs.http]]\n  url = \"https://tok.example.com\"\n  password = \"${secret:env:CAM_TEST_SECRET}\"\n  ${secret:env:CAM_TEST_TOKEN}\n",
+		},
+		{
+			name: "no refs",
+			tmpl: "password = \"from-env\"\n",
+			data: "password = \"from-env\"\n",
+			want: "password = \"from-env\"\n",
+		},
+		{
+			name:    "unresolvable",
+			tmpl:    "password = \"${secret:env:CAM_TEST_MISSING}\"\n",
+			data:    "password = \"from-env\"\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tl := tt.tmpl
+			if tl == "" {
+				tl = tmpl
+			}
+
+			got, err := r.Redact(context.Background(), []byte(tt.data), []byte(tl))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Redact() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if string(got) != tt.want {
+				t.Fatalf("Redact() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,451 @@
+// Package selfupdate replaces the manager binary with a signed release. The artifact
+// is downloaded and verified (sha256 checksum and ed25519 signature, with the configured
+// public key), the new binary is checked by running it, then swapped in atomically,
+// keeping the previous binary. After the restart the new binary has to pass a startup
+// health check, otherwise the previous binary is restored.
+package selfupdate
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/audit"
+	"github.com/circonus/agent-manager/internal/config/defaults"
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/env"
+	"github.com/circonus/agent-manager/internal/release"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// update states.
+const (
+	StatePending    = "pending"     // swapped, the new binary has not passed the health check
+	StateRolledBack = "rolled_back" // the previous binary was restored
+)
+
+// MaxAttempts is how many times the new binary may start without passing the health
+// check before the previous binary is restored (e.g. it fails during start up).
+const MaxAttempts = 3
+
+const (
+	maxArtifactSize = 256 << 20
+	checkTimeout    = 30 * time.Second
+)
+
+var (
+	// ErrDisabled is returned when self-update is not enabled.
+	ErrDisabled = errors.New("self-update disabled")
+	// ErrRolledBack is returned by Started when the previous binary was restored, the
+	// manager exits so the service manager starts it.
+	ErrRolledBack = errors.New("self-update rolled back")
+)
+
+// Release is the release artifact to update to.
+type Release struct {
+	Version   string `json:"version"   yaml:"version"`
+	URL       string `json:"url"       yaml:"url"`       // the binary, or a .tar.gz containing it
+	SHA256    string `json:"sha256"    yaml:"sha256"`    // checksum of the artifact
+	Signature string `json:"signature" yaml:"signature"` // base64 ed25519 signature of the artifact
+}
+
+// State is an update in progress, kept in the state file across the restart.
+type State struct {
+	Swapped   time.Time `json:"swapped"`
+	CommandID string    `json:"command_id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	State     string    `json:"state"`
+	Error     string    `json:"error,omitempty"`
+	Attempts  int       `json:"attempts"`
+}
+
+// binary is the manager binary which is replaced.
+var binary = func() string {
+	return filepath.Join(defaults.BasePath, "sbin", release.NAME)
+}
+
+func previous() string {
+	return binary() + ".prev"
+}
+
+func stateFile() string {
+	if f := viper.GetString(keys.SelfUpdateFile); f != "" {
+		return f
+	}
+
+	return defaults.SelfUpdateFile
+}
+
+// ParsePublicKey decodes a base64 ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid ed25519 public key, expected %d base64 encoded bytes", ed25519.PublicKeySize)
+	}
+
+	return ed25519.PublicKey(key), nil
+}
+
+// Enabled returns an error if self-update is not enabled or possible.
+func Enabled() error {
+	if !viper.GetBool(keys.SelfUpdateEnable) {
+		return ErrDisabled
+	}
+
+	if env.IsRunningInDocker() {
+		return fmt.Errorf("self-update not supported in a container, update the image")
+	}
+
+	if _, err := ParsePublicKey(viper.GetString(keys.SelfUpdatePublicKey)); err != nil {
+		return fmt.Errorf("%s: %w", keys.SelfUpdatePublicKey, err)
+	}
+
+	return nil
+}
+
+// Prepare downloads and verifies the release and checks the new binary runs (its
+// version and the current config). Returns the new binary, next to the current one,
+// which is removed on error.
+func Prepare(ctx context.Context, r Release) (string, error) {
+	if r.Version == "" || r.URL == "" || r.SHA256 == "" || r.Signature == "" {
+		return "", fmt.Errorf("release version, url, sha256 and signature required")
+	}
+
+	key, err := ParsePublicKey(viper.GetString(keys.SelfUpdatePublicKey))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", keys.SelfUpdatePublicKey, err)
+	}
+
+	data, err := download(ctx, r.URL)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != strings.ToLower(r.SHA256) {
+		return "", fmt.Errorf("release checksum mismatch, expected %s got %s", r.SHA256, got)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil || !ed25519.Verify(key, data, sig) {
+		return "", fmt.Errorf("release signature not valid")
+	}
+
+	if u, err := url.Parse(r.URL); err == nil && (strings.HasSuffix(u.Path, ".tar.gz") || strings.HasSuffix(u.Path, ".tgz")) {
+		if data, err = extract(data); err != nil {
+			return "", err
+		}
+	}
+
+	file := filepath.Join(filepath.Dir(binary()), "."+release.NAME+".new")
+
+	if err := writeFile(file, data); err != nil {
+		return "", err
+	}
+
+	if err := check(ctx, file, r.Version); err != nil {
+		os.Remove(file)
+
+		return "", err
+	}
+
+	return file, nil
+}
+
+func download(ctx context.Context, artifactURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, artifactURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("downloading release: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading release: non-200 response -- status: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxArtifactSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("downloading release: %w", err)
+	}
+
+	if len(data) > maxArtifactSize {
+		return nil, fmt.Errorf("release larger than %d bytes", maxArtifactSize)
+	}
+
+	return data, nil
+}
+
+// extract returns the manager binary from a release tarball.
+func extract(data []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("reading release: %w", err)
+	}
+
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s not found in release", release.NAME)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("reading release: %w", err)
+		}
+
+		if hdr.Typeflag == tar.TypeReg && path.Base(hdr.Name) == release.NAME {
+			bin, err := io.ReadAll(io.LimitReader(tr, maxArtifactSize))
+			if err != nil {
+				return nil, fmt.Errorf("reading release: %w", err)
+			}
+
+			return bin, nil
+		}
+	}
+}
+
+func writeFile(file string, data []byte) error {
+	if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing new binary: %w", err)
+	}
+
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o755) //nolint:gosec
+	if err != nil {
+		return fmt.Errorf("creating new binary: %w", err)
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(file)
+
+		return fmt.Errorf("writing new binary: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(file)
+
+		return fmt.Errorf("syncing new binary: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(file)
+
+		return fmt.Errorf("closing new binary: %w", err)
+	}
+
+	return nil
+}
+
+// check runs the new binary, it must report the release version and accept the
+// current configuration.
+func check(ctx context.Context, file, version string) error {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, file, "--version").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("new binary --version: %s: %w", strings.TrimSpace(string(output)), err)
+	}
+
+	if !strings.Contains(string(output), " v"+strings.TrimPrefix(version, "v")+" ") { // see --version
+		return fmt.Errorf("new binary is not version %s (%s)", version, strings.TrimSpace(string(output)))
+	}
+
+	args := []string{"--check-config"}
+	if cfg := viper.ConfigFileUsed(); cfg != "" {
+		args = append(args, "--config", cfg)
+	}
+
+	output, err = exec.CommandContext(ctx, file, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("new binary --check-config: %s: %w", strings.TrimSpace(string(output)), err)
+	}
+
+	return nil
+}
+
+// Install swaps the prepared binary in, keeping the previous binary, and records the
+// update as pending (for the command which requested it) until the new binary passes
+// the health check.
+func Install(ctx context.Context, file string, r Release, commandID string) error {
+	bin := binary()
+	prev := previous()
+
+	if err := os.Remove(prev); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing previous binary: %w", err)
+	}
+
+	if err := os.Link(bin, prev); err != nil {
+		return fmt.Errorf("keeping previous binary: %w", err)
+	}
+
+	s := &State{
+		Swapped:   time.Now().UTC(),
+		CommandID: commandID,
+		From:      release.VERSION,
+		To:        r.Version,
+		State:     StatePending,
+	}
+
+	if err := Save(s); err != nil {
+		return err
+	}
+
+	if err := os.Rename(file, bin); err != nil {
+		_ = Remove()
+
+		return fmt.Errorf("replacing binary: %w", err)
+	}
+
+	log.Info().Str("from", s.From).Str("to", s.To).Str("binary", bin).Msg("self-update installed")
+
+	record(ctx, s, "installed "+r.URL, nil)
+
+	return nil
+}
+
+// Complete removes the update state and the previous binary, once the new binary has
+// passed the health check.
+func Complete(ctx context.Context, s *State) error {
+	record(ctx, s, "completed", nil)
+
+	return Remove()
+}
+
+// Rollback restores the previous binary and records why.
+func Rollback(ctx context.Context, s *State, reason error) error {
+	if err := os.Rename(previous(), binary()); err != nil {
+		err = fmt.Errorf("restoring previous binary: %w", err)
+		record(ctx, s, "rollback", err)
+
+		return err
+	}
+
+	s.State = StateRolledBack
+	s.Error = reason.Error()
+
+	log.Warn().Err(reason).Str("from", s.To).Str("to", s.From).Msg("self-update rolled back")
+
+	record(ctx, s, "rolled back", reason)
+
+	return Save(s)
+}
+
+func record(ctx context.Context, s *State, detail string, err error) {
+	e := audit.Entry{
+		Event:  audit.EventSelfUpdate,
+		Detail: fmt.Sprintf("%s to %s: %s", s.From, s.To, detail),
+	}
+
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	audit.Record(ctx, e)
+}
+
+// Started records a start of the new binary after an update. If it has already
+// started MaxAttempts times without passing the health check the previous binary is
+// restored and ErrRolledBack returned.
+func Started(ctx context.Context) (*State, error) {
+	s, err := Load()
+	if err != nil || s == nil || s.State != StatePending || !Running(s.To) {
+		return s, err
+	}
+
+	s.Attempts++
+
+	if s.Attempts > MaxAttempts {
+		if err := Rollback(ctx, s, fmt.Errorf("%s started %d times without passing the health check", s.To, MaxAttempts)); err != nil {
+			return s, err
+		}
+
+		return s, ErrRolledBack
+	}
+
+	return s, Save(s)
+}
+
+// Running returns true if version is the running version.
+func Running(version string) bool {
+	return strings.TrimPrefix(version, "v") == strings.TrimPrefix(release.VERSION, "v")
+}
+
+// Load returns the update in progress, nil if there is none.
+func Load() (*State, error) {
+	data, err := os.ReadFile(stateFile())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("reading self-update state: %w", err)
+	}
+
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing self-update state: %w", err)
+	}
+
+	return &s, nil
+}
+
+// Save writes the update state.
+func Save(s *State) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("marshal self-update state: %w", err)
+	}
+
+	if err := os.WriteFile(stateFile(), data, 0o600); err != nil {
+		return fmt.Errorf("saving self-update state: %w", err)
+	}
+
+	return nil
+}
+
+// Remove removes the update state and the previous binary, once the update is complete.
+func Remove() error {
+	var errs []error
+
+	for _, f := range []string{stateFile(), previous()} {
+		if err := os.Remove(f); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("removing self-update state: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
@@ -0,0 +1,266 @@
+package selfupdate
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/release"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+// script is a fake manager binary reporting version, --check-config exits with checkExit.
+func script(version, checkExit string) []byte {
+	return []byte("#!/bin/sh\n" +
+		"case \"$1\" in\n" +
+		"  --version) echo \"" + release.NAME + " v" + version + " - commit: none\" ;;\n" +
+		"  --check-config) exit " + checkExit + " ;;\n" +
+		"esac\n")
+}
+
+func tarball(t *testing.T, name string, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o755, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatalf("tar header: %s", err)
+	}
+
+	if _, err := tw.Write(data); err != nil {
+		t.Fatalf("tar write: %s", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar close: %s", err)
+	}
+
+	if err := gz.Close(); err != nil {
+		t.Fatalf("gzip close: %s", err)
+	}
+
+	return buf.Bytes()
+}
+
+// setup points the binary and state file at a temp dir, with an installed "old" binary.
+func setup(t *testing.T) (string, ed25519.PrivateKey) {
+	t.Helper()
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %s", err)
+	}
+
+	dir := t.TempDir()
+	bin := filepath.Join(dir, release.NAME)
+
+	if err := os.WriteFile(bin, script("1.0.0", "0"), 0o755); err != nil { //nolint:gosec
+		t.Fatalf("writing binary: %s", err)
+	}
+
+	origBinary, origVersion := binary, release.VERSION
+
+	binary = func() string { return bin }
+	release.VERSION = "1.0.0"
+
+	viper.Set(keys.SelfUpdatePublicKey, base64.StdEncoding.EncodeToString(pub))
+	viper.Set(keys.SelfUpdateFile, filepath.Join(dir, "selfupdate.json"))
+
+	t.Cleanup(func() {
+		binary, release.VERSION = origBinary, origVersion
+
+		viper.Set(keys.SelfUpdatePublicKey, "")
+		viper.Set(keys.SelfUpdateFile, "")
+	})
+
+	return bin, priv
+}
+
+func TestPrepare(t *testing.T) {
+	_, priv := setup(t)
+
+	artifacts := map[string][]byte{
+		"/circonus-am":        script("1.2.3", "0"),
+		"/circonus-am.tar.gz": tarball(t, "sbin/circonus-am", script("1.2.3", "0")),
+		"/wrong-version":      script("1.2.4", "0"),
+		"/bad-config":         script("1.2.3", "1"),
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(artifacts[r.URL.Path])
+	}))
+	defer ts.Close()
+
+	signed := func(name string) Release {
+		data := artifacts[name]
+		sum := sha256.Sum256(data)
+
+		return Release{
+			Version:   "1.2.3",
+			URL:       ts.URL + name,
+			SHA256:    hex.EncodeToString(sum[:]),
+			Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data)),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		release func() Release
+		wantErr string
+	}{
+		{name: "binary", release: func() Release { return signed("/circonus-am") }},
+		{name: "tarball", release: func() Release { return signed("/circonus-am.tar.gz") }},
+		{
+			name: "checksum mismatch",
+			release: func() Release {
+				r := signed("/circonus-am")
+				r.SHA256 = strings.Repeat("0", 64)
+
+				return r
+			},
+			wantErr: "checksum mismatch",
+		},
+		{
+			name: "signature invalid",
+			release: func() Release {
+				r := signed("/circonus-am")
+				r.Signature = signed("/wrong-version").Signature
+
+				return r
+			},
+			wantErr: "signature not valid",
+		},
+		{name: "wrong version", release: func() Release { return signed("/wrong-version") }, wantErr: "not version 1.2.3"},
+		{name: "config rejected", release: func() Release { return signed("/bad-config") }, wantErr: "--check-config"},
+		{name: "incomplete", release: func() Release { return Release{Version: "1.2.3"} }, wantErr: "required"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := Prepare(context.Background(), tt.release())
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Prepare() error = %v, want %q", err, tt.wantErr)
+				}
+
+				if file != "" {
+					t.Fatalf("Prepare() file = %s, want none", file)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Prepare() unexpected error %s", err)
+			}
+
+			defer os.Remove(file)
+
+			data, err := os.ReadFile(file)
+			if err != nil || !bytes.Equal(data, script("1.2.3", "0")) {
+				t.Fatalf("Prepare() new binary %q (%v)", data, err)
+			}
+		})
+	}
+}
+
+func TestInstallRollback(t *testing.T) {
+	bin, _ := setup(t)
+	ctx := context.Background()
+
+	install := func() {
+		t.Helper()
+
+		file := filepath.Join(filepath.Dir(bin), "new")
+		if err := os.WriteFile(file, script("1.2.3", "0"), 0o755); err != nil { //nolint:gosec
+			t.Fatalf("writing new binary: %s", err)
+		}
+
+		if err := Install(ctx, file, Release{Version: "1.2.3"}, "cmd-1"); err != nil {
+			t.Fatalf("Install() %s", err)
+		}
+	}
+
+	running := func(want string) {
+		t.Helper()
+
+		data, err := os.ReadFile(bin)
+		if err != nil || !bytes.Equal(data, script(want, "0")) {
+			t.Fatalf("binary is not %s (%v)", want, err)
+		}
+	}
+
+	install()
+	running("1.2.3")
+
+	s, err := Load()
+	if err != nil || s == nil || s.State != StatePending || s.From != "1.0.0" || s.To != "1.2.3" || s.CommandID != "cmd-1" {
+		t.Fatalf("Load() = %+v, %v", s, err)
+	}
+
+	// the new binary starts, but does not pass the health check
+	release.VERSION = "1.2.3"
+
+	for i := 1; i <= MaxAttempts; i++ {
+		if s, err = Started(ctx); err != nil || s.Attempts != i {
+			t.Fatalf("Started() attempt %d = %+v, %v", i, s, err)
+		}
+	}
+
+	if _, err := Started(ctx); !errors.Is(err, ErrRolledBack) {
+		t.Fatalf("Started() error = %v, want %s", err, ErrRolledBack)
+	}
+
+	running("1.0.0")
+
+	if s, _ := Load(); s == nil || s.State != StateRolledBack || s.Error == "" {
+		t.Fatalf("Load() after rollback = %+v", s)
+	}
+
+	// the previous binary does not count starts
+	release.VERSION = "1.0.0"
+
+	if s, err := Started(ctx); err != nil || s.Attempts != MaxAttempts+1 {
+		t.Fatalf("Started() previous binary = %+v, %v", s, err)
+	}
+
+	// passes the health check
+	install()
+
+	s, _ = Load()
+	if err := Complete(ctx, s); err != nil {
+		t.Fatalf("Complete() %s", err)
+	}
+
+	running("1.2.3")
+
+	if s, err := Load(); s != nil || err != nil {
+		t.Fatalf("Load() after complete = %+v, %v", s, err)
+	}
+
+	if _, err := os.Stat(previous()); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("previous binary not removed (%v)", err)
+	}
+}
@@ -1,40 +1,377 @@
 package server
 
 import (
+	"crypto/subtle"
+	"errors"
+	"net"
 	"net/http"
+	"os"
 	"path"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/circonus/agent-manager/internal/config/defaults"
 	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
 )
 
+// how long pending changes and replicas are kept.
+const (
+	// pendingTTL after which a change is no longer signaled, containers started since
+	// load the current config anyway.
+	pendingTTL = time.Hour
+	// replicaTTL after which a replica which has not checked in is forgotten (e.g. a
+	// container which was removed or rescheduled with a new address).
+	replicaTTL = 10 * time.Minute
+)
+
+// PendingConfig is a config change waiting to be picked up by an agent's containers,
+// each replica acknowledges separately.
+type PendingConfig struct {
+	Created   time.Time            `json:"created"   yaml:"created"`
+	Acks      map[string]time.Time `json:"acks"      yaml:"acks"`
+	Agent     string               `json:"agent"     yaml:"agent"`
+	Checksums []string             `json:"checksums" yaml:"checksums"`
+}
+
+// configUpdates is the persisted config change state.
+type configUpdates struct {
+	Pending  map[string]*PendingConfig       `yaml:"pending"`  // by agent and checksums, see pendingKey
+	Replicas map[string]map[string]time.Time `yaml:"replicas"` // last seen, by agent and replica
+}
+
 var (
-	configs = make(map[string]bool)
-	cm      sync.Mutex
+	updates     configUpdates
+	pendingOnce sync.Once
+	cm          sync.Mutex
 )
 
-type configHandler struct{}
+// pendingKey identifies a config change by the agent and the checksums of its config(s).
+func pendingKey(agent string, checksums []string) string {
+	sums := make([]string, len(checksums))
+	for i, c := range checksums {
+		sums[i] = strings.ToLower(c)
+	}
+
+	sort.Strings(sums)
+
+	return agent + "@" + strings.Join(sums, ",")
+}
+
+// AddConfigUpdate records a config change for the agent, checksums are the sha256
+// of the config file(s) written. Replicas will be signaled to reload until they
+// acknowledge the change or report loading configs with matching checksums. A new
+// change replaces any pending change for the agent, the same change again keeps the
+// acknowledgements.
+func AddConfigUpdate(agent string, checksums ...string) {
+	cm.Lock()
+	defer cm.Unlock()
+
+	loadPending()
+
+	key := pendingKey(agent, checksums)
+
+	if _, ok := updates.Pending[key]; !ok {
+		for k, pc := range updates.Pending {
+			if pc.Agent == agent {
+				delete(updates.Pending, k)
+			}
+		}
+
+		updates.Pending[key] = &PendingConfig{
+			Created:   time.Now(),
+			Agent:     agent,
+			Checksums: checksums,
+			Acks:      make(map[string]time.Time),
+		}
+	}
+
+	if err := savePending(); err != nil {
+		log.Warn().Err(err).Str("agent", agent).Msg("saving pending config updates")
+	}
+}
+
+// PendingConfigs returns the pending config changes by agent.
+func PendingConfigs() map[string]PendingConfig {
+	cm.Lock()
+	defer cm.Unlock()
+
+	loadPending()
+	prune(time.Now())
+
+	p := make(map[string]PendingConfig, len(updates.Pending))
+
+	for _, pc := range updates.Pending {
+		c := *pc
+		c.Acks = make(map[string]time.Time, len(pc.Acks))
+
+		for k, v := range pc.Acks {
+			c.Acks[k] = v
+		}
+
+		p[pc.Agent] = c
+	}
+
+	return p
+}
+
+// agentPending returns the pending change for the agent, if any. Must hold cm.
+func agentPending(agent string) *PendingConfig {
+	for _, pc := range updates.Pending {
+		if pc.Agent == agent {
+			return pc
+		}
+	}
+
+	return nil
+}
+
+// prune forgets replicas which have not checked in, and drops changes which have expired
+// or been acknowledged by every known replica of the agent. Must hold cm.
+func prune(now time.Time) bool {
+	changed := false
+
+	for agent, replicas := range updates.Replicas {
+		for id, seen := range replicas {
+			if now.Sub(seen) > replicaTTL {
+				delete(replicas, id)
+
+				changed = true
+			}
+		}
+
+		if len(replicas) == 0 {
+			delete(updates.Replicas, agent)
+		}
+	}
+
+	for k, pc := range updates.Pending {
+		if now.Sub(pc.Created) > pendingTTL {
+			log.Info().Str("agent", pc.Agent).Msg("config change expired")
+			delete(updates.Pending, k)
+
+			changed = true
+
+			continue
+		}
+
+		replicas := updates.Replicas[pc.Agent]
+		if len(pc.Acks) == 0 || len(replicas) == 0 {
+			continue
+		}
+
+		complete := true
+
+		for id := range replicas {
+			if _, acked := pc.Acks[id]; !acked {
+				complete = false
+
+				break
+			}
+		}
+
+		if complete {
+			log.Info().Str("agent", pc.Agent).Int("replicas", len(pc.Acks)).Msg("config change acknowledged by all replicas")
+			delete(updates.Pending, k)
+
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// loadPending loads the persisted pending config changes, once. Must hold cm.
+func loadPending() {
+	pendingOnce.Do(func() {
+		updates = configUpdates{}
+
+		data, err := os.ReadFile(defaults.ConfigUpdatesFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warn().Err(err).Str("file", defaults.ConfigUpdatesFile).Msg("reading pending config updates")
+		}
+
+		if err == nil {
+			if err := yaml.Unmarshal(data, &updates); err != nil {
+				log.Warn().Err(err).Str("file", defaults.ConfigUpdatesFile).Msg("parsing pending config updates")
+
+				updates = configUpdates{}
+			}
+		}
+
+		if updates.Pending == nil {
+			updates.Pending = make(map[string]*PendingConfig)
+		}
 
-func AddConfigUpdate(agent string) {
-	configs[agent] = true
+		if updates.Replicas == nil {
+			updates.Replicas = make(map[string]map[string]time.Time)
+		}
+
+		for _, pc := range updates.Pending {
+			if pc.Acks == nil {
+				pc.Acks = make(map[string]time.Time)
+			}
+		}
+	})
+}
+
+// savePending persists the pending config changes. Must hold cm.
+func savePending() error {
+	data, err := yaml.Marshal(updates)
+	if err != nil {
+		return err
+	}
+
+	tmp := defaults.ConfigUpdatesFile + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Clean(defaults.ConfigUpdatesFile))
 }
 
-func (configHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+type configHandler struct {
+	token string
+}
+
+// ServeHTTP returns a 409 (conflict) if the agent replica should reload its config(s).
+//
+//	GET /config/<agent>[?replica=<id>][&checksum=<sha256 of loaded config>...]
+//
+// Replicas are identified by the remote address, qualified by the replica parameter
+// (e.g. replicas sharing the host network), so a caller cannot acknowledge for another.
+// A replica which has been signaled, or which reports the current checksum(s), is
+// acknowledged and receives a 200 until the next change. If server.config_token is
+// set, it must be provided as a bearer token (Authorization header) or token query
+// parameter.
+func (h configHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, h.token) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+		return
+	}
+
+	targetAgent := path.Base(r.URL.Path)
+
+	q := r.URL.Query()
+	replica := replicaID(r.RemoteAddr, q.Get("replica"))
+
+	// the config check is the agent container's health check, it is alive
+	touchReport(targetAgent, replica)
+	now := time.Now()
+
 	cm.Lock()
 	defer cm.Unlock()
 
-	targetAgent := path.Base(r.URL.String())
+	loadPending()
+
+	if updates.Replicas[targetAgent] == nil {
+		updates.Replicas[targetAgent] = make(map[string]time.Time)
+	}
+
+	_, known := updates.Replicas[targetAgent][replica]
+	updates.Replicas[targetAgent][replica] = now
+
+	changed := prune(now) || !known
+
+	defer func() {
+		if !changed {
+			return
+		}
+
+		if err := savePending(); err != nil {
+			log.Warn().Err(err).Str("agent", targetAgent).Msg("saving pending config updates")
+		}
+	}()
+
+	pc := agentPending(targetAgent)
+	if pc == nil {
+		_, _ = w.Write([]byte("OK"))
+
+		return
+	}
+
+	if _, acked := pc.Acks[replica]; acked {
+		_, _ = w.Write([]byte("OK"))
+
+		return
+	}
+
+	pc.Acks[replica] = now
+	changed = true
+
+	current := loaded(pc.Checksums, q["checksum"])
+
+	// this may have been the last replica to acknowledge
+	prune(now)
+
+	if current {
+		log.Info().Str("agent", targetAgent).Str("replica", replica).Msg("config change already loaded")
 
-	hasNewConfigs, found := configs[targetAgent]
-	if !found || !hasNewConfigs {
 		_, _ = w.Write([]byte("OK"))
 
 		return
 	}
 
-	log.Info().Str("agent", targetAgent).Msg("signal config changed")
+	log.Info().Str("agent", targetAgent).Str("replica", replica).Msg("signal config changed")
 
 	http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+}
+
+// replicaID identifies the caller by its address, qualified by the replica it reports.
+func replicaID(remoteAddr, replica string) string {
+	host := remoteAddr
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		host = h
+	}
+
+	if replica == "" {
+		return host
+	}
+
+	return host + "/" + replica
+}
+
+// loaded reports whether all of the pending checksums are in the reported checksums.
+func loaded(pendingChecksums, reported []string) bool {
+	if len(pendingChecksums) == 0 || len(reported) == 0 {
+		return false
+	}
+
+	for _, p := range pendingChecksums {
+		found := false
+
+		for _, r := range reported {
+			if strings.EqualFold(p, r) {
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// authorized verifies the shared token, if one is configured.
+func authorized(r *http.Request, token string) bool {
+	if token == "" {
+		return true
+	}
+
+	provided := r.URL.Query().Get("token")
+
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		provided = strings.TrimPrefix(auth, "Bearer ")
+	}
 
-	delete(configs, targetAgent)
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
 }
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/config/defaults"
+)
+
+func resetPending(t *testing.T) {
+	t.Helper()
+
+	cm.Lock()
+	updates = configUpdates{}
+	pendingOnce = sync.Once{}
+	cm.Unlock()
+}
+
+func TestConfigHandler(t *testing.T) {
+	defaults.ConfigUpdatesFile = filepath.Join(t.TempDir(), "config_updates.yaml")
+
+	resetPending(t)
+
+	// replicas are identified by their address
+	addrs := map[string]string{
+		"a": "10.0.0.1:40000",
+		"b": "10.0.0.2:40000",
+		"c": "10.0.0.3:40000",
+		"x": "10.0.0.9:40000",
+	}
+
+	var handler configHandler
+
+	get := func(replica, url, token string) int {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.RemoteAddr = addrs[replica]
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		return w.Code
+	}
+
+	pending := func() bool {
+		t.Helper()
+
+		_, ok := PendingConfigs()["telegraf"]
+
+		return ok
+	}
+
+	// age moves the pending change and the replicas' last check back in time
+	age := func(d time.Duration, replicas ...string) {
+		t.Helper()
+
+		cm.Lock()
+		defer cm.Unlock()
+
+		for _, pc := range updates.Pending {
+			pc.Created = pc.Created.Add(-d)
+		}
+
+		for _, r := range replicas {
+			id := replicaID(addrs[r], "")
+			updates.Replicas["telegraf"][id] = updates.Replicas["telegraf"][id].Add(-d)
+		}
+	}
+
+	type step struct {
+		name    string
+		replica string
+		url     string
+		want    int
+	}
+
+	run := func(steps []step) {
+		t.Helper()
+
+		for _, s := range steps {
+			if code := get(s.replica, s.url, ""); code != s.want {
+				t.Fatalf("%s: got %d, want %d", s.name, code, s.want)
+			}
+		}
+	}
+
+	run([]step{
+		{"no pending change a", "a", "/config/telegraf", http.StatusOK},
+		{"no pending change b", "b", "/config/telegraf", http.StatusOK},
+		{"no pending change c", "c", "/config/telegraf", http.StatusOK},
+	})
+
+	AddConfigUpdate("telegraf", "abc")
+
+	run([]step{
+		{"replica a signaled", "a", "/config/telegraf", http.StatusConflict},
+		{"replica a acknowledged", "a", "/config/telegraf", http.StatusOK},
+		{"replica b signaled", "b", "/config/telegraf", http.StatusConflict},
+		{"other agent", "a", "/config/fluent-bit", http.StatusOK},
+	})
+
+	if !pending() {
+		t.Fatal("change dropped before all replicas acknowledged")
+	}
+
+	run([]step{{"replica c already current", "c", "/config/telegraf?checksum=ABC", http.StatusOK}})
+
+	if pending() {
+		t.Fatal("change not dropped after all replicas acknowledged")
+	}
+
+	// pending changes survive a restart
+	AddConfigUpdate("telegraf", "def")
+	resetPending(t)
+
+	run([]step{{"persisted change", "a", "/config/telegraf?checksum=abc", http.StatusConflict}})
+
+	resetPending(t)
+
+	run([]step{
+		{"persisted ack", "a", "/config/telegraf", http.StatusOK},
+		{"replicas persisted", "b", "/config/telegraf", http.StatusConflict},
+	})
+
+	// the same change again keeps the acknowledgements
+	AddConfigUpdate("telegraf", "DEF")
+
+	run([]step{{"same change", "a", "/config/telegraf", http.StatusOK}})
+
+	// a replica which stopped checking in is forgotten
+	age(replicaTTL+time.Minute, "c")
+
+	run([]step{{"stale replica", "b", "/config/telegraf", http.StatusOK}})
+
+	if pending() {
+		t.Fatal("change not dropped, waiting on stale replica")
+	}
+
+	// a caller cannot acknowledge for another replica
+	AddConfigUpdate("telegraf", "ghi")
+
+	run([]step{
+		{"other caller as a", "x", "/config/telegraf?replica=" + replicaID(addrs["a"], ""), http.StatusConflict},
+		{"replica a still signaled", "a", "/config/telegraf", http.StatusConflict},
+	})
+
+	// changes expire
+	age(pendingTTL + time.Minute)
+
+	run([]step{{"expired change", "b", "/config/telegraf", http.StatusOK}})
+
+	if pending() {
+		t.Fatal("expired change not dropped")
+	}
+
+	// shared token
+	AddConfigUpdate("telegraf", "jkl")
+
+	handler.token = "secret"
+
+	if code := get("a", "/config/telegraf", ""); code != http.StatusUnauthorized {
+		t.Fatalf("no token, got %d", code)
+	}
+
+	if code := get("a", "/config/telegraf", "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("wrong token, got %d", code)
+	}
+
+	if code := get("a", "/config/telegraf", "secret"); code != http.StatusConflict {
+		t.Fatalf("bearer token, got %d", code)
+	}
+
+	if code := get("b", "/config/telegraf?token=secret", ""); code != http.StatusConflict {
+		t.Fatalf("query token, got %d", code)
+	}
+}
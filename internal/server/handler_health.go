@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -16,6 +17,19 @@ import (
 type healthHandler struct{}
 
 func (healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	dur, err := checkAPI(r.Context())
+	if err != nil {
+		log.Error().Err(err).Str("api_url", viper.GetString(keys.APIURL)).Msg("checking API health")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+		return
+	}
+
+	_, _ = w.Write([]byte(`{"status":"ok","dur":"` + dur.String() + `"}`))
+}
+
+// checkAPI requests the API health endpoint, returning the round trip time.
+func checkAPI(ctx context.Context) (time.Duration, error) {
 	client := &http.Client{
 		Transport: &http.Transport{
 			Proxy: http.ProxyFromEnvironment,
@@ -34,21 +48,15 @@ func (healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	reqURL, err := url.JoinPath(viper.GetString(keys.APIURL), "health")
 	if err != nil {
-		log.Error().Err(err).Str("api_url", viper.GetString(keys.APIURL)).Msg("creating API health URL")
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-
-		return
+		return 0, fmt.Errorf("creating API health URL: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
 	if err != nil {
-		log.Error().Err(err).Str("api_url", viper.GetString(keys.APIURL)).Msg("creating API health request")
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-
-		return
+		return 0, fmt.Errorf("creating API health request: %w", err)
 	}
 
 	req.Header.Set("Accept", "application/json")
@@ -59,33 +67,19 @@ func (healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Error().Err(err).Str("api_url", viper.GetString(keys.APIURL)).Msg("requesting API health URL")
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-
-		return
+		return 0, fmt.Errorf("requesting API health URL: %w", err)
 	}
 
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Error().Err(err).Str("api_url", viper.GetString(keys.APIURL)).Msg("reading response from API health URL")
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-
-		return
+		return 0, fmt.Errorf("reading response from API health URL: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		log.Error().Err(err).
-			Str("api_url", viper.GetString(keys.APIURL)).
-			Int("status_code", resp.StatusCode).
-			Str("status", resp.Status).
-			Str("body", string(body)).
-			Msg("requesting API health URL")
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-
-		return
+		return 0, fmt.Errorf("non-200 response -- status: %s, body: %s", resp.Status, string(body))
 	}
 
-	_, _ = w.Write([]byte(`{"status":"ok","dur":"` + time.Since(start).String() + `"}`))
+	return time.Since(start), nil
 }
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/heartbeat"
+	"github.com/circonus/agent-manager/internal/inventory"
+	"github.com/circonus/agent-manager/internal/splay"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/viper"
+)
+
+const (
+	probeOK   = "ok"
+	probeFail = "fail"
+
+	// a loop is stale after missing this many intervals.
+	staleIntervals = 3
+	minStaleAge    = time.Minute
+
+	apiCheckTTL = time.Minute
+)
+
+// ProbeCheck is the result of a single component check.
+type ProbeCheck struct {
+	Status    string `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Age       string `json:"age,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// ProbeResult is the /livez and /readyz response.
+type ProbeResult struct {
+	Checks map[string]ProbeCheck `json:"checks"`
+	Status string                `json:"status"`
+}
+
+// probeHandler serves /livez (background loops are running) and /readyz (the
+// manager is able to do its job). /readyz?api=true adds the (cached) upstream API check.
+type probeHandler struct {
+	ages  *probeAges
+	ready bool
+}
+
+func newProbeHandler(v *viper.Viper, ready bool) (probeHandler, error) {
+	ages := &probeAges{}
+	if err := ages.set(v); err != nil {
+		return probeHandler{}, err
+	}
+
+	return probeHandler{ages: ages, ready: ready}, nil
+}
+
+// probeAges are the max ages of the background loops, derived from their intervals.
+type probeAges struct {
+	maxAge map[string]time.Duration
+	mu     sync.RWMutex
+}
+
+// set derives the max ages from the interval settings in v.
+func (a *probeAges) set(v *viper.Viper) error {
+	maxAge := make(map[string]time.Duration)
+
+	for name, key := range map[string]string{
+		heartbeat.ActionPoll:   keys.ActionPollingInterval,
+		heartbeat.StatusReport: keys.StatusCheckInterval,
+		heartbeat.Tracker:      keys.TrackerPollingInterval,
+		heartbeat.Discovery:    keys.DiscoveryPollingInterval,
+	} {
+		i, err := time.ParseDuration(v.GetString(key))
+		if err != nil {
+			return fmt.Errorf("parsing %s (%s): %w", key, v.GetString(key), err)
+		}
+
+		maxAge[name] = i * staleIntervals
+		if maxAge[name] < minStaleAge {
+			maxAge[name] = minStaleAge
+		}
+	}
+
+	a.mu.Lock()
+	a.maxAge = maxAge
+	a.mu.Unlock()
+
+	return nil
+}
+
+func (a *probeAges) get(name string) time.Duration {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.maxAge[name]
+}
+
+func (a *probeAges) names() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	names := make([]string, 0, len(a.maxAge))
+	for name := range a.maxAge {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+func (h probeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	result := ProbeResult{Status: probeOK, Checks: make(map[string]ProbeCheck)}
+
+	if h.ready {
+		result.Checks["credentials"] = checkCredentials()
+		result.Checks["inventory"] = checkInventory()
+		result.Checks[heartbeat.ActionPoll] = h.checkLoop(heartbeat.ActionPoll, true)
+		result.Checks[heartbeat.StatusReport] = h.checkLoop(heartbeat.StatusReport, true)
+		result.Checks[heartbeat.Tracker] = h.checkLoop(heartbeat.Tracker, false)
+		result.Checks[heartbeat.Discovery] = h.checkLoop(heartbeat.Discovery, false)
+
+		if api, _ := strconv.ParseBool(r.URL.Query().Get("api")); api {
+			result.Checks["api"] = checkAPICached(r.Context())
+		}
+	} else {
+		for _, name := range h.ages.names() {
+			result.Checks[name] = h.checkLoop(name, false)
+		}
+	}
+
+	for _, c := range result.Checks {
+		if c.Status != probeOK {
+			result.Status = probeFail
+
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if result.Status != probeOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// checkLoop verifies the loop has run (or succeeded, if success is set) recently, loops
+// which have not run yet are given until the max age since the manager started.
+func (h probeHandler) checkLoop(name string, success bool) ProbeCheck {
+	last := heartbeat.Started()
+	c, ran := heartbeat.Get(name)
+
+	switch {
+	case success && !c.LastOK.IsZero():
+		last = c.LastOK
+	case !success && ran:
+		last = c.LastRun
+	}
+
+	age := time.Since(last)
+
+	maxAge := h.ages.get(name)
+	if name == heartbeat.ActionPoll {
+		// a poll with actions waits for the splay before performing them
+		maxAge += splay.Max()
+	}
+
+	check := ProbeCheck{Status: probeOK, Age: age.Truncate(time.Second).String(), LastError: c.LastError}
+
+	if age > maxAge {
+		check.Status = probeFail
+		check.Detail = fmt.Sprintf("older than %s", maxAge)
+	}
+
+	if !ran {
+		check.Detail = "not run yet"
+		if check.Status == probeFail {
+			check.Detail = fmt.Sprintf("not run in %s", maxAge)
+		}
+	}
+
+	return check
+}
+
+// checkCredentials verifies the api token is loaded and not expired, the signature
+// is verified by the api.
+func checkCredentials() ProbeCheck {
+	token := viper.GetString(keys.APIToken)
+	if token == "" {
+		return ProbeCheck{Status: probeFail, Detail: "api token not loaded"}
+	}
+
+	claims := jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil {
+		return ProbeCheck{Status: probeFail, Detail: fmt.Sprintf("parsing api token: %s", err)}
+	}
+
+	if claims.ExpiresAt == nil {
+		return ProbeCheck{Status: probeOK, Detail: "no expiration"}
+	}
+
+	ttl := time.Until(claims.ExpiresAt.Time).Truncate(time.Second)
+	if ttl <= 0 {
+		// refreshed on the next api call which is rejected
+		return ProbeCheck{Status: probeFail, Detail: fmt.Sprintf("api token expired %s ago", -ttl)}
+	}
+
+	return ProbeCheck{Status: probeOK, Detail: fmt.Sprintf("api token expires in %s", ttl)}
+}
+
+func checkInventory() ProbeCheck {
+	agents, err := inventory.LoadAgents()
+	if err != nil {
+		return ProbeCheck{Status: probeFail, Detail: err.Error()}
+	}
+
+	return ProbeCheck{Status: probeOK, Detail: fmt.Sprintf("%d platform(s)", len(agents))}
+}
+
+var apiCheck struct {
+	checked time.Time
+	result  ProbeCheck
+	sync.Mutex
+}
+
+// checkAPICached checks the upstream api health endpoint at most once per apiCheckTTL.
+func checkAPICached(ctx context.Context) ProbeCheck {
+	apiCheck.Lock()
+	defer apiCheck.Unlock()
+
+	if !apiCheck.checked.IsZero() && time.Since(apiCheck.checked) < apiCheckTTL {
+		return apiCheck.result
+	}
+
+	dur, err := checkAPI(ctx)
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		// client went away, don't cache
+		return ProbeCheck{Status: probeFail, Detail: err.Error()}
+	case err != nil:
+		apiCheck.result = ProbeCheck{Status: probeFail, Detail: err.Error()}
+	default:
+		apiCheck.result = ProbeCheck{Status: probeOK, Detail: dur.String()}
+	}
+
+	apiCheck.checked = time.Now()
+
+	return apiCheck.result
+}
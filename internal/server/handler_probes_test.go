@@ -0,0 +1,156 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/heartbeat"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/viper"
+)
+
+func testToken(t *testing.T, exp time.Duration) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(exp)),
+	})
+
+	s, err := token.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestProbeHandler(t *testing.T) {
+	inv := filepath.Join(t.TempDir(), "inventory.yaml")
+	if err := os.WriteFile(inv, []byte("linux:\n  telegraf:\n    binary: /usr/bin/telegraf\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	viper.Set(keys.InventoryFile, inv)
+	viper.Set(keys.ActionPollingInterval, "60s")
+	viper.Set(keys.StatusCheckInterval, "15s")
+	viper.Set(keys.TrackerPollingInterval, "15m")
+	viper.Set(keys.DiscoveryPollingInterval, "10m")
+
+	defer func() {
+		viper.Set(keys.InventoryFile, "")
+		viper.Set(keys.APIToken, "")
+	}()
+
+	tests := []struct {
+		setup  func()
+		failed map[string]bool
+		name   string
+		ready  bool
+		stale  bool
+		want   int
+	}{
+		{
+			name: "live",
+			want: http.StatusOK,
+		},
+		{
+			name:  "live (stale)",
+			stale: true,
+			setup: func() {
+				heartbeat.Ran(heartbeat.ActionPoll, nil)
+			},
+			want:   http.StatusServiceUnavailable,
+			failed: map[string]bool{heartbeat.ActionPoll: true, heartbeat.StatusReport: true, heartbeat.Tracker: true, heartbeat.Discovery: true},
+		},
+		{
+			name:  "ready",
+			ready: true,
+			setup: func() {
+				viper.Set(keys.APIToken, testToken(t, time.Hour))
+				heartbeat.Ran(heartbeat.ActionPoll, nil)
+			},
+			want: http.StatusOK,
+		},
+		{
+			name:  "ready (expired token)",
+			ready: true,
+			setup: func() {
+				viper.Set(keys.APIToken, testToken(t, -time.Hour))
+			},
+			want:   http.StatusServiceUnavailable,
+			failed: map[string]bool{"credentials": true},
+		},
+		{
+			name:  "ready (no token)",
+			ready: true,
+			setup: func() {
+				viper.Set(keys.APIToken, "")
+			},
+			want:   http.StatusServiceUnavailable,
+			failed: map[string]bool{"credentials": true},
+		},
+		{
+			name:  "ready (action poll failing)",
+			ready: true,
+			stale: true,
+			setup: func() {
+				viper.Set(keys.APIToken, testToken(t, time.Hour))
+				heartbeat.Ran(heartbeat.ActionPoll, errors.New("401 Unauthorized"))
+				heartbeat.Ran(heartbeat.StatusReport, nil)
+				heartbeat.Ran(heartbeat.Tracker, nil)
+				heartbeat.Ran(heartbeat.Discovery, nil)
+			},
+			want:   http.StatusServiceUnavailable,
+			failed: map[string]bool{heartbeat.ActionPoll: true, heartbeat.StatusReport: true, heartbeat.Tracker: true, heartbeat.Discovery: true},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			heartbeat.Reset()
+
+			if tt.setup != nil {
+				tt.setup()
+			}
+
+			h, err := newProbeHandler(viper.GetViper(), tt.ready)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.stale {
+				time.Sleep(time.Millisecond)
+
+				for _, name := range h.ages.names() {
+					h.ages.maxAge[name] = time.Nanosecond
+				}
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if w.Code != tt.want {
+				t.Fatalf("status code = %d, want %d (%s)", w.Code, tt.want, w.Body.String())
+			}
+
+			var result ProbeResult
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatal(err)
+			}
+
+			for name, c := range result.Checks {
+				if failed := c.Status != probeOK; failed != tt.failed[name] {
+					t.Errorf("check %s status = %s (%s)", name, c.Status, c.Detail)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxStatusBody is the largest status report accepted.
+const maxStatusBody = 64 << 10
+
+// AgentReport is the latest status reported by an agent replica (or its container health
+// check) when the manager is running in a container.
+type AgentReport struct {
+	Received  time.Time `json:"received"`
+	Agent     string    `json:"agent"`
+	Replica   string    `json:"replica"` // see replicaID
+	Status    string    `json:"status"`
+	Info      string    `json:"info,omitempty"`
+	Checksums []string  `json:"checksums,omitempty"`
+}
+
+// statuses agents may report, the statuses reported to the api.
+var statuses = map[string]bool{
+	"running": true,
+	"stopped": true,
+	"failed":  true,
+}
+
+var (
+	reports = make(map[string]map[string]AgentReport) // by agent, then replica
+	rm      sync.Mutex
+)
+
+// AgentReports returns the latest report received from each replica of each agent, by
+// agent, sorted by replica.
+func AgentReports() map[string][]AgentReport {
+	rm.Lock()
+	defer rm.Unlock()
+
+	r := make(map[string][]AgentReport, len(reports))
+
+	for agent, replicas := range reports {
+		rr := make([]AgentReport, 0, len(replicas))
+		for _, v := range replicas {
+			rr = append(rr, v)
+		}
+
+		sort.Slice(rr, func(i, j int) bool { return rr[i].Replica < rr[j].Replica })
+
+		r[agent] = rr
+	}
+
+	return r
+}
+
+// replicaReports returns the agent's reports by replica, replicas which have not reported
+// within replicaTTL (e.g. scaled down or replaced) are dropped, other than the latest.
+// The caller holds rm.
+func replicaReports(agent string, now time.Time) map[string]AgentReport {
+	replicas, ok := reports[agent]
+	if !ok {
+		replicas = make(map[string]AgentReport)
+		reports[agent] = replicas
+	}
+
+	var latest time.Time
+
+	for _, r := range replicas {
+		if r.Received.After(latest) {
+			latest = r.Received
+		}
+	}
+
+	for id, r := range replicas {
+		if r.Received.Before(latest) && now.Sub(r.Received) > replicaTTL {
+			delete(replicas, id)
+		}
+	}
+
+	return replicas
+}
+
+func addReport(r AgentReport) {
+	r.Received = time.Now()
+
+	if r.Status == "" {
+		r.Status = "running"
+	}
+
+	rm.Lock()
+	replicaReports(r.Agent, r.Received)[r.Replica] = r
+	rm.Unlock()
+}
+
+// touchReport records liveness for the agent replica, keeping any previously reported details.
+func touchReport(agent, replica string) {
+	rm.Lock()
+	defer rm.Unlock()
+
+	now := time.Now()
+	replicas := replicaReports(agent, now)
+
+	r, ok := replicas[replica]
+	if !ok {
+		r = AgentReport{Agent: agent, Replica: replica, Status: "running"}
+	}
+
+	r.Received = now
+	replicas[replica] = r
+}
+
+type statusHandler struct {
+	token string
+}
+
+// ServeHTTP accepts agent status reports, either a GET (simple for container health checks)
+// with query parameters or a POST/PUT with a JSON body.
+//
+//	GET  /status/<agent>[?replica=<id>]&status=running&checksum=<sha256 of config file>[&checksum=...]
+//	POST /status/<agent>[?replica=<id>] {"status":"running","info":"...","checksums":["<sha256>"]}
+//
+// Status is running (default), stopped or failed. Reports are kept per replica, identified
+// as for /config/<agent>. If server.config_token is set, it must be provided as for
+// /config/<agent>.
+func (h statusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, h.token) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+		return
+	}
+
+	targetAgent := path.Base(r.URL.Path)
+	if targetAgent == "" || targetAgent == "/" || targetAgent == "status" {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+
+		return
+	}
+
+	report := AgentReport{}
+	q := r.URL.Query()
+
+	switch r.Method {
+	case http.MethodGet:
+		report.Status = q.Get("status")
+		report.Info = q.Get("info")
+		report.Checksums = q["checksum"]
+	case http.MethodPost, http.MethodPut:
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxStatusBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+
+				return
+			}
+
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+
+			return
+		}
+
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &report); err != nil {
+				log.Warn().Err(err).Str("agent", targetAgent).Msg("invalid status report")
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+
+				return
+			}
+		}
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	if report.Status != "" && !statuses[report.Status] {
+		log.Warn().Str("agent", targetAgent).Str("status", report.Status).Msg("invalid status report")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+
+		return
+	}
+
+	report.Agent = targetAgent
+	report.Replica = replicaID(r.RemoteAddr, q.Get("replica"))
+
+	addReport(report)
+
+	_, _ = w.Write([]byte("OK"))
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStatusHandler(t *testing.T) {
+	tests := []struct {
+		want       *AgentReport
+		name       string
+		method     string
+		url        string
+		body       string
+		token      string // server token configured
+		statusCode int
+	}{
+		{
+			name:       "get",
+			method:     http.MethodGet,
+			url:        "/status/telegraf?checksum=abc&checksum=def",
+			statusCode: http.StatusOK,
+			want:       &AgentReport{Agent: "telegraf", Replica: "192.0.2.1", Status: "running", Checksums: []string{"abc", "def"}},
+		},
+		{
+			name:       "get (replica)",
+			method:     http.MethodGet,
+			url:        "/status/telegraf?replica=b&status=failed",
+			statusCode: http.StatusOK,
+			want:       &AgentReport{Agent: "telegraf", Replica: "192.0.2.1/b", Status: "failed"},
+		},
+		{
+			name:       "post",
+			method:     http.MethodPost,
+			url:        "/status/fluent-bit",
+			body:       `{"status":"failed","info":"output retrying","checksums":["abc"]}`,
+			statusCode: http.StatusOK,
+			want:       &AgentReport{Agent: "fluent-bit", Replica: "192.0.2.1", Status: "failed", Info: "output retrying", Checksums: []string{"abc"}},
+		},
+		{
+			name:       "invalid (body too large)",
+			method:     http.MethodPost,
+			url:        "/status/fluent-bit",
+			body:       `{"info":"` + strings.Repeat("x", maxStatusBody) + `"}`,
+			statusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "invalid (status)",
+			method:     http.MethodGet,
+			url:        "/status/foo?status=degraded",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "no token",
+			method:     http.MethodGet,
+			url:        "/status/foo",
+			token:      "secret",
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "token",
+			method:     http.MethodGet,
+			url:        "/status/foo?token=secret&status=stopped",
+			token:      "secret",
+			statusCode: http.StatusOK,
+			want:       &AgentReport{Agent: "foo", Replica: "192.0.2.1", Status: "stopped"},
+		},
+		{
+			name:       "invalid (body)",
+			method:     http.MethodPost,
+			url:        "/status/foo",
+			body:       `{"status":`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid (method)",
+			method:     http.MethodDelete,
+			url:        "/status/bar",
+			statusCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "invalid (no agent)",
+			method:     http.MethodGet,
+			url:        "/status/",
+			statusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			statusHandler{token: tt.token}.ServeHTTP(w, req)
+
+			if w.Code != tt.statusCode {
+				t.Fatalf("status code = %d, want %d", w.Code, tt.statusCode)
+			}
+
+			if tt.want == nil {
+				return
+			}
+
+			var (
+				got AgentReport
+				ok  bool
+			)
+
+			for _, r := range AgentReports()[tt.want.Agent] {
+				if r.Replica == tt.want.Replica {
+					got, ok = r, true
+				}
+			}
+
+			if !ok {
+				t.Fatalf("no report for %s (%s)", tt.want.Agent, tt.want.Replica)
+			}
+
+			if got.Received.IsZero() {
+				t.Fatal("expected received time")
+			}
+
+			got.Received = tt.want.Received
+			if !reflect.DeepEqual(&got, tt.want) {
+				t.Fatalf("report = %+v, want %+v", got, *tt.want)
+			}
+		})
+	}
+}
@@ -2,13 +2,16 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/circonus/agent-manager/internal/config/keys"
 	"github.com/circonus/agent-manager/internal/env"
+	"github.com/circonus/agent-manager/internal/metrics"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 )
@@ -17,37 +20,45 @@ import (
   1. provide generic /health endpoint.
   2. provide docker containers a health check endpoint /config/<agent>
      used to trigger container process reloads on configuration file changes.
+  3. provide docker containers a status endpoint /status/<agent> used to
+     report agent liveness and the checksum(s) of the loaded config(s).
+  4. provide /metrics for the manager itself (prometheus format).
+  5. provide /livez and /readyz reflecting the manager's own subsystems.
 */
 
 type Server struct {
 	srv             *http.Server
+	ln              net.Listener
+	probes          *probeAges
+	tlsConfig       *tls.Config
 	idleConnsClosed chan struct{}
 }
 
-func New() (*Server, error) {
-	readTimeout, err := time.ParseDuration(viper.GetString(keys.ServerReadTimeout))
+// New creates a server using the settings in v.
+func New(v *viper.Viper) (*Server, error) {
+	readTimeout, err := time.ParseDuration(v.GetString(keys.ServerReadTimeout))
 	if err != nil {
-		return nil, fmt.Errorf("parsing read timeout (%s): %w", viper.GetString(keys.ServerReadTimeout), err)
+		return nil, fmt.Errorf("parsing read timeout (%s): %w", v.GetString(keys.ServerReadTimeout), err)
 	}
 
-	writeTimeout, err := time.ParseDuration(viper.GetString(keys.ServerWriteTimeout))
+	writeTimeout, err := time.ParseDuration(v.GetString(keys.ServerWriteTimeout))
 	if err != nil {
-		return nil, fmt.Errorf("parsing write timeout (%s): %w", viper.GetString(keys.ServerWriteTimeout), err)
+		return nil, fmt.Errorf("parsing write timeout (%s): %w", v.GetString(keys.ServerWriteTimeout), err)
 	}
 
-	idleTimeout, err := time.ParseDuration(viper.GetString(keys.ServerIdleTimeout))
+	idleTimeout, err := time.ParseDuration(v.GetString(keys.ServerIdleTimeout))
 	if err != nil {
-		return nil, fmt.Errorf("parsing idle timeout (%s): %w", viper.GetString(keys.ServerIdleTimeout), err)
+		return nil, fmt.Errorf("parsing idle timeout (%s): %w", v.GetString(keys.ServerIdleTimeout), err)
 	}
 
-	readHeaderTimeout, err := time.ParseDuration(viper.GetString(keys.ServerReadHeaderTimeout))
+	readHeaderTimeout, err := time.ParseDuration(v.GetString(keys.ServerReadHeaderTimeout))
 	if err != nil {
-		return nil, fmt.Errorf("parsing read header timeout (%s): %w", viper.GetString(keys.ServerReadHeaderTimeout), err)
+		return nil, fmt.Errorf("parsing read header timeout (%s): %w", v.GetString(keys.ServerReadHeaderTimeout), err)
 	}
 
-	handlerTimeout, err := time.ParseDuration(viper.GetString(keys.ServerHandlerTimeout))
+	handlerTimeout, err := time.ParseDuration(v.GetString(keys.ServerHandlerTimeout))
 	if err != nil {
-		return nil, fmt.Errorf("parsing handler timeout (%s): %w", viper.GetString(keys.ServerHandlerTimeout), err)
+		return nil, fmt.Errorf("parsing handler timeout (%s): %w", v.GetString(keys.ServerHandlerTimeout), err)
 	}
 
 	mux := http.NewServeMux()
@@ -55,51 +66,123 @@ func New() (*Server, error) {
 	mux.Handle("/health", reqLogger(http.TimeoutHandler(
 		healthHandler{}, handlerTimeout, "health handler timeout")))
 
+	livez, err := newProbeHandler(v, false)
+	if err != nil {
+		return nil, err
+	}
+
+	readyz := probeHandler{ages: livez.ages, ready: true}
+
+	// not logged, probed and scraped frequently
+	mux.Handle("/livez", http.TimeoutHandler(livez, handlerTimeout, "livez handler timeout"))
+	mux.Handle("/readyz", http.TimeoutHandler(readyz, handlerTimeout, "readyz handler timeout"))
+
+	mux.Handle("/metrics", http.TimeoutHandler(
+		metrics.Handler(), handlerTimeout, "metrics handler timeout"))
+
 	if env.IsRunningInDocker() {
+		token := v.GetString(keys.ServerConfigToken)
+
 		// e.g. Docker, when a config has changed, /config will return a 409 (conflict),
 		//      indicating that the agent should reload its config(s)
 		//
 		//   HEALTHCHECK --interval=90s --timeout=3s \
 		//     CMD curl --silent --fail "http://<cam-container-ip>:43285/config/<agent_type>" || exit 1
 		//     CMD wget --quiet "http://<cam-container-ip>:43285/config/<agent_type>" || exit 1
+		//
+		// each replica is signaled once per change (identified by ?replica=<id>, default remote
+		// address), ?checksum=<sha256> of the loaded config skips the signal if already current.
 		mux.Handle("/config/", reqLogger(http.TimeoutHandler(
-			configHandler{}, handlerTimeout, "config handler timeout")))
+			configHandler{token: token}, handlerTimeout, "config handler timeout")))
+
+		// agents report status and the checksum(s) of the config(s) they loaded
+		//
+		//   HEALTHCHECK --interval=90s --timeout=3s \
+		//     CMD curl --silent --fail "http://<cam-container-ip>:43285/status/<agent_type>?checksum=$(sha256sum <config> | cut -d' ' -f1)" || exit 1
+		mux.Handle("/status/", reqLogger(http.TimeoutHandler(
+			statusHandler{token: token}, handlerTimeout, "status handler timeout")))
+	}
+
+	var tlsConfig *tls.Config
+
+	if v.GetBool(keys.ServerTLSEnable) &&
+		v.GetString(keys.ServerTLSCertFile) != "" &&
+		v.GetString(keys.ServerTLSKeyFile) != "" {
+		cert, err := tls.LoadX509KeyPair(v.GetString(keys.ServerTLSCertFile), v.GetString(keys.ServerTLSKeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("loading tls cert: %w", err)
+		}
+
+		tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+			NextProtos:   []string{"h2", "http/1.1"},
+		}
 	}
 
 	return &Server{
 		srv: &http.Server{
-			Addr:              viper.GetString(keys.ServerAddress),
+			Addr:              v.GetString(keys.ServerAddress),
 			ReadTimeout:       readTimeout,
 			WriteTimeout:      writeTimeout,
 			IdleTimeout:       idleTimeout,
 			ReadHeaderTimeout: readHeaderTimeout,
 			Handler:           mux,
 		},
+		probes:          livez.ages,
+		tlsConfig:       tlsConfig,
 		idleConnsClosed: make(chan struct{}),
 	}, nil
 }
 
+// Reconfigure applies the loop interval settings from v to the probes (e.g. after a config reload).
+func (s *Server) Reconfigure(v *viper.Viper) error {
+	return s.probes.set(v)
+}
+
+// Addr returns the server's listen address.
+func (s *Server) Addr() string {
+	return s.srv.Addr
+}
+
+// Listen binds the server address, so a replacement server on another address can be
+// bound before the running server is stopped. Start listens if not already bound.
+func (s *Server) Listen(ctx context.Context) error {
+	if s.ln != nil {
+		return nil
+	}
+
+	var lc net.ListenConfig
+
+	ln, err := lc.Listen(ctx, "tcp", s.srv.Addr)
+	if err != nil {
+		return fmt.Errorf("listen (%s): %w", s.srv.Addr, err)
+	}
+
+	if s.tlsConfig != nil {
+		ln = tls.NewListener(ln, s.tlsConfig)
+	}
+
+	s.ln = ln
+
+	return nil
+}
+
 func (s *Server) Start(ctx context.Context) error {
 	if done(ctx) {
 		return ctx.Err()
 	}
 
-	if viper.GetBool(keys.ServerTLSEnable) &&
-		viper.GetString(keys.ServerTLSCertFile) != "" &&
-		viper.GetString(keys.ServerTLSKeyFile) != "" {
-		log.Info().Str("listen", s.srv.Addr).Msg("starting TLS server")
-
-		if err := s.srv.ListenAndServeTLS(
-			viper.GetString(keys.ServerTLSCertFile),
-			viper.GetString(keys.ServerTLSKeyFile)); err != nil {
-			if !errors.Is(err, http.ErrServerClosed) {
-				log.Error().Err(err).Msg("listen and serve tls")
-			}
-		}
+	if err := s.Listen(ctx); err != nil {
+		log.Error().Err(err).Msg("listen and serve")
 	} else {
-		log.Info().Str("listen", s.srv.Addr).Msg("starting server")
+		if s.tlsConfig != nil {
+			log.Info().Str("listen", s.srv.Addr).Msg("starting TLS server")
+		} else {
+			log.Info().Str("listen", s.srv.Addr).Msg("starting server")
+		}
 
-		if err := s.srv.ListenAndServe(); err != nil {
+		if err := s.srv.Serve(s.ln); err != nil {
 			if !errors.Is(err, http.ErrServerClosed) {
 				log.Error().Err(err).Msg("listen and serve")
 			}
@@ -121,6 +204,11 @@ func (s *Server) Stop(ctx context.Context) error {
 		log.Error().Err(err).Msg("server shutdown")
 	}
 
+	if s.ln != nil {
+		// bound but not yet serving
+		_ = s.ln.Close()
+	}
+
 	close(s.idleConnsClosed)
 
 	// if no error, check the ctx and return that error
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestServerReplace(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	ctx := context.Background()
+
+	newServer := func(addr, body string) *Server {
+		return &Server{
+			srv: &http.Server{ //nolint:gosec
+				Addr: addr,
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					_, _ = w.Write([]byte(body))
+				}),
+			},
+			idleConnsClosed: make(chan struct{}),
+		}
+	}
+
+	get := func(addr string) string {
+		t.Helper()
+
+		resp, err := http.Get("http://" + addr) //nolint:noctx
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(body)
+	}
+
+	old := newServer("127.0.0.1:0", "old")
+	if err := old.Listen(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	addr := old.ln.Addr().String()
+	oldDone := make(chan error, 1)
+
+	go func() { oldDone <- old.Start(ctx) }()
+
+	if got := get(addr); got != "old" {
+		t.Fatalf("old server = %q", got)
+	}
+
+	// the address is bound by another process, the running server is kept
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	if err := newServer(taken.Addr().String(), "new").Listen(ctx); err == nil {
+		t.Fatal("expected error binding an address in use")
+	}
+
+	// same address, not bound until the running server is stopped
+	s := newServer(addr, "new")
+	if err := s.Listen(ctx); err == nil {
+		t.Fatal("expected error binding the address of the running server")
+	}
+
+	if err := old.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-oldDone; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Listen(ctx); err != nil {
+		t.Fatalf("binding replacement server: %s", err)
+	}
+
+	newDone := make(chan error, 1)
+
+	go func() { newDone <- s.Start(ctx) }()
+
+	if got := get(addr); got != "new" {
+		t.Fatalf("replacement server = %q", got)
+	}
+
+	if err := s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-newDone; err != nil {
+		t.Fatal(err)
+	}
+}
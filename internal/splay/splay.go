@@ -0,0 +1,138 @@
+// Package splay spreads work across a fleet of managers: a random delay before
+// applying changes, so hosts receiving the same config push do not all reload (and
+// reconnect to shared backends) at once, and jitter on the poll timers. The random
+// source is seeded with the manager id, so each host's sequence is deterministic.
+package splay
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// MaxJitter is the largest poll jitter fraction.
+const MaxJitter = 0.5
+
+// ErrStopped is returned when a wait is ended by the stop channel (see WithStop).
+var ErrStopped = errors.New("splay stopped")
+
+type stopKey struct{}
+
+// WithStop returns a context with a channel which ends splay waits when closed (e.g.
+// shutting down) without cancelling the context, the changes are then not applied.
+func WithStop(ctx context.Context, stop <-chan struct{}) context.Context {
+	return context.WithValue(ctx, stopKey{}, stop)
+}
+
+// settings are the reloaded settings, the global settings until the first reload.
+var settings atomic.Pointer[viper.Viper]
+
+// Reconfigure applies the splay and jitter settings from v (e.g. after a config reload).
+func Reconfigure(v *viper.Viper) {
+	settings.Store(v)
+}
+
+func conf() *viper.Viper {
+	if v := settings.Load(); v != nil {
+		return v
+	}
+
+	return viper.GetViper()
+}
+
+var src struct {
+	rng *rand.Rand
+	sync.Mutex
+}
+
+// next returns the next value in [0.0,1.0), the source is seeded with the manager
+// id (loaded before the pollers start) on first use.
+func next() float64 {
+	src.Lock()
+	defer src.Unlock()
+
+	if src.rng == nil {
+		src.rng = rand.New(rand.NewSource(seed(viper.GetString(keys.ManagerID)))) //nolint:gosec
+	}
+
+	return src.rng.Float64()
+}
+
+func seed(managerID string) int64 {
+	if managerID == "" {
+		return time.Now().UnixNano()
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(managerID))
+
+	return int64(h.Sum64()) //nolint:gosec
+}
+
+// Max returns the splay maximum, zero if splay is disabled.
+func Max() time.Duration {
+	max, err := time.ParseDuration(conf().GetString(keys.SplayMax))
+	if err != nil || max < 0 {
+		return 0
+	}
+
+	return max
+}
+
+// Delay returns a random delay up to the splay maximum, zero if splay is disabled.
+func Delay() time.Duration {
+	max := Max()
+	if max == 0 {
+		return 0
+	}
+
+	return time.Duration(next() * float64(max))
+}
+
+// Wait waits for a random delay up to the splay maximum before applying changes.
+// Returns the context error, or ErrStopped, if it is done or stopped first.
+func Wait(ctx context.Context) error {
+	d := Delay()
+	if d == 0 {
+		return nil
+	}
+
+	log.Debug().Str("delay", d.String()).Msg("splay before applying changes")
+
+	stop, _ := ctx.Value(stopKey{}).(<-chan struct{})
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-stop:
+		return ErrStopped
+	case <-t.C:
+		return nil
+	}
+}
+
+// Jitter returns the interval adjusted by a random amount, up to plus or minus the
+// poll jitter fraction of it.
+func Jitter(interval time.Duration) time.Duration {
+	j := conf().GetFloat64(keys.PollJitter)
+	if j <= 0 || interval <= 0 {
+		return interval
+	}
+
+	if j > MaxJitter {
+		j = MaxJitter
+	}
+
+	return interval + time.Duration((next()*2-1)*j*float64(interval))
+}
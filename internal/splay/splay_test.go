@@ -0,0 +1,143 @@
+package splay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/spf13/viper"
+)
+
+// reset clears the random source, so it is seeded again on next use.
+func reset() {
+	src.Lock()
+	src.rng = nil
+	src.Unlock()
+}
+
+func TestDelay(t *testing.T) {
+	defer viper.Set(keys.SplayMax, "")
+	defer viper.Set(keys.ManagerID, "")
+
+	tests := []struct {
+		name string
+		max  string
+		want time.Duration // upper bound, zero disabled
+	}{
+		{name: "empty", max: ""},
+		{name: "disabled", max: "0s"},
+		{name: "invalid", max: "foo"},
+		{name: "5m", max: "5m", want: 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set(keys.SplayMax, tt.max)
+
+			for i := 0; i < 100; i++ {
+				d := Delay()
+				if d < 0 || (tt.want == 0 && d != 0) || (tt.want > 0 && d >= tt.want) {
+					t.Fatalf("Delay() = %s, want [0,%s)", d, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSeeded(t *testing.T) {
+	defer viper.Set(keys.SplayMax, "")
+	defer viper.Set(keys.ManagerID, "")
+
+	viper.Set(keys.SplayMax, "1h")
+
+	sequence := func(managerID string) []time.Duration {
+		viper.Set(keys.ManagerID, managerID)
+		reset()
+
+		s := make([]time.Duration, 5)
+		for i := range s {
+			s[i] = Delay()
+		}
+
+		return s
+	}
+
+	a, b, c := sequence("abc"), sequence("abc"), sequence("def")
+
+	same := func(x, y []time.Duration) bool {
+		for i := range x {
+			if x[i] != y[i] {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	if !same(a, b) {
+		t.Fatalf("same manager id, sequences differ %v %v", a, b)
+	}
+
+	if same(a, c) {
+		t.Fatalf("different manager ids, same sequence %v", a)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	defer viper.Set(keys.PollJitter, 0)
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		jitter   float64
+		min      time.Duration
+		max      time.Duration
+	}{
+		{name: "disabled", interval: time.Minute, jitter: 0, min: time.Minute, max: time.Minute},
+		{name: "10%", interval: time.Minute, jitter: 0.1, min: 54 * time.Second, max: 66 * time.Second},
+		{name: "capped", interval: time.Minute, jitter: 2, min: 30 * time.Second, max: 90 * time.Second},
+		{name: "zero interval", interval: 0, jitter: 0.1},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set(keys.PollJitter, tt.jitter)
+
+			for i := 0; i < 100; i++ {
+				if got := Jitter(tt.interval); got < tt.min || got > tt.max {
+					t.Fatalf("Jitter(%s) = %s, want [%s,%s]", tt.interval, got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestWait(t *testing.T) {
+	defer viper.Set(keys.SplayMax, "")
+
+	viper.Set(keys.SplayMax, "")
+
+	if err := Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() disabled, error %s", err)
+	}
+
+	viper.Set(keys.SplayMax, "1h")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait() cancelled, error %v, want %s", err, context.Canceled)
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+
+	if err := Wait(WithStop(context.Background(), stop)); !errors.Is(err, ErrStopped) {
+		t.Fatalf("Wait() stopped, error %v, want %s", err, ErrStopped)
+	}
+}
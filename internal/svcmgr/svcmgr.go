@@ -0,0 +1,108 @@
+package svcmgr
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+/*
+  Native service manager integration (e.g. systemd via D-Bus). Agent inventory
+  commands are still shell strings, simple service manager commands
+  (e.g. "systemctl restart telegraf") are mapped onto the native API and
+  anything else falls back to executing the command string.
+*/
+
+// ErrNotSupported is returned when there is no native service manager on the platform.
+var ErrNotSupported = errors.New("native service manager not supported")
+
+// ErrJobFailed is returned when a unit job ran but did not complete (e.g. failed, timeout),
+// the command must not be run again another way.
+var ErrJobFailed = errors.New("unit job did not complete")
+
+// UnitState is the state of a service unit as reported by the service manager.
+type UnitState struct {
+	Unit          string `json:"unit"`
+	LoadState     string `json:"load_state"`
+	ActiveState   string `json:"active_state"`
+	SubState      string `json:"sub_state"`
+	UnitFileState string `json:"unit_file_state"`
+	MemoryCurrent uint64 `json:"memory_current"`
+	MainPID       uint32 `json:"main_pid"`
+	NRestarts     uint32 `json:"n_restarts"`
+}
+
+// ServiceManager controls and reports on service units.
+type ServiceManager interface {
+	Start(ctx context.Context, unit string) error
+	Stop(ctx context.Context, unit string) error
+	Restart(ctx context.Context, unit string) error
+	Reload(ctx context.Context, unit string) error
+	State(ctx context.Context, unit string) (UnitState, error)
+	// Subscribe sends the state of any of the units when it changes, until ctx is done or
+	// the next Subscribe, which replaces the watched units.
+	Subscribe(ctx context.Context, units []string) (<-chan UnitState, error)
+	Close()
+}
+
+const (
+	VerbStart   = "start"
+	VerbStop    = "stop"
+	VerbRestart = "restart"
+	VerbReload  = "reload"
+	VerbStatus  = "status"
+)
+
+// ParseSystemctl extracts the verb and unit from a simple systemctl command string,
+// e.g. "sudo systemctl restart telegraf". Anything more complex (multiple units,
+// options, pipes, compound commands) is not parsed so it will be run as-is.
+func ParseSystemctl(cmd string) (string, string, bool) {
+	if strings.ContainsAny(cmd, ";&|<>$`()") {
+		return "", "", false
+	}
+
+	fields := strings.Fields(cmd)
+	if len(fields) > 0 && fields[0] == "sudo" {
+		fields = fields[1:]
+	}
+
+	if len(fields) == 0 || filepath.Base(fields[0]) != "systemctl" {
+		return "", "", false
+	}
+
+	args := make([]string, 0, 2)
+
+	for _, f := range fields[1:] {
+		switch {
+		case f == "--no-pager", f == "-q", f == "--quiet":
+			continue
+		case strings.HasPrefix(f, "-"):
+			return "", "", false
+		default:
+			args = append(args, f)
+		}
+	}
+
+	if len(args) != 2 {
+		return "", "", false
+	}
+
+	switch args[0] {
+	case VerbStart, VerbStop, VerbRestart, VerbReload, VerbStatus:
+	default:
+		return "", "", false
+	}
+
+	return args[0], UnitName(args[1]), true
+}
+
+// UnitName returns the name with a .service suffix if it has no unit type suffix.
+func UnitName(name string) string {
+	switch filepath.Ext(name) {
+	case ".service", ".socket", ".target", ".timer", ".path", ".mount":
+		return name
+	}
+
+	return name + ".service"
+}
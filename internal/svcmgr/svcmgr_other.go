@@ -0,0 +1,10 @@
+//go:build !linux
+
+package svcmgr
+
+import "context"
+
+// New returns ErrNotSupported on platforms without a native service manager integration.
+func New(_ context.Context) (ServiceManager, error) {
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,39 @@
+package svcmgr
+
+import "testing"
+
+func TestParseSystemctl(t *testing.T) {
+	tests := []struct {
+		name     string
+		cmd      string
+		wantVerb string
+		wantUnit string
+		wantOK   bool
+	}{
+		{name: "start", cmd: "systemctl start telegraf", wantVerb: VerbStart, wantUnit: "telegraf.service", wantOK: true},
+		{name: "sudo restart", cmd: "sudo systemctl restart fluent-bit.service", wantVerb: VerbRestart, wantUnit: "fluent-bit.service", wantOK: true},
+		{name: "full path", cmd: "/usr/bin/systemctl stop telegraf", wantVerb: VerbStop, wantUnit: "telegraf.service", wantOK: true},
+		{name: "status no pager", cmd: "systemctl --no-pager status telegraf", wantVerb: VerbStatus, wantUnit: "telegraf.service", wantOK: true},
+		{name: "reload", cmd: "systemctl reload telegraf", wantVerb: VerbReload, wantUnit: "telegraf.service", wantOK: true},
+		{name: "compound", cmd: "systemctl daemon-reload && systemctl restart telegraf"},
+		{name: "multiple units", cmd: "systemctl restart telegraf fluent-bit"},
+		{name: "unknown option", cmd: "systemctl --user restart telegraf"},
+		{name: "unsupported verb", cmd: "systemctl enable telegraf"},
+		{name: "not systemctl", cmd: "brew services restart telegraf"},
+		{name: "empty", cmd: ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			verb, unit, ok := ParseSystemctl(tt.cmd)
+			if ok != tt.wantOK {
+				t.Fatalf("ParseSystemctl() ok = %v, want %v", ok, tt.wantOK)
+			}
+
+			if verb != tt.wantVerb || unit != tt.wantUnit {
+				t.Fatalf("ParseSystemctl() = %s %s, want %s %s", verb, unit, tt.wantVerb, tt.wantUnit)
+			}
+		})
+	}
+}
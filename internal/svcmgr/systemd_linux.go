@@ -0,0 +1,216 @@
+//go:build linux
+
+package svcmgr
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+)
+
+// Systemd is a ServiceManager using the systemd D-Bus API.
+type Systemd struct {
+	conn      *dbus.Conn
+	subErr    error
+	subs      chan *subscriber // new subscriptions, see dispatch
+	closed    chan struct{}
+	subOnce   sync.Once
+	closeOnce sync.Once
+}
+
+// New connects to systemd via D-Bus.
+func New(ctx context.Context) (ServiceManager, error) {
+	conn, err := dbus.NewWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to systemd: %w", err)
+	}
+
+	return newSystemd(conn), nil
+}
+
+func newSystemd(conn *dbus.Conn) *Systemd {
+	return &Systemd{conn: conn, subs: make(chan *subscriber), closed: make(chan struct{})}
+}
+
+func (s *Systemd) Start(ctx context.Context, unit string) error {
+	return s.job(ctx, unit, s.conn.StartUnitContext)
+}
+
+func (s *Systemd) Stop(ctx context.Context, unit string) error {
+	return s.job(ctx, unit, s.conn.StopUnitContext)
+}
+
+func (s *Systemd) Restart(ctx context.Context, unit string) error {
+	return s.job(ctx, unit, s.conn.RestartUnitContext)
+}
+
+func (s *Systemd) Reload(ctx context.Context, unit string) error {
+	return s.job(ctx, unit, s.conn.ReloadUnitContext)
+}
+
+type jobFunc func(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+
+// job queues a unit job and waits for it to complete.
+func (s *Systemd) job(ctx context.Context, unit string, fn jobFunc) error {
+	ch := make(chan string, 1)
+
+	if _, err := fn(ctx, unit, "replace", ch); err != nil {
+		return fmt.Errorf("%s: %w", unit, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("%s: waiting for job: %w", unit, ctx.Err())
+	case result := <-ch:
+		if result != "done" {
+			return fmt.Errorf("%s: job %s: %w", unit, result, ErrJobFailed)
+		}
+	}
+
+	return nil
+}
+
+func (s *Systemd) State(ctx context.Context, unit string) (UnitState, error) {
+	state := UnitState{Unit: unit}
+
+	props, err := s.conn.GetUnitPropertiesContext(ctx, unit)
+	if err != nil {
+		return state, fmt.Errorf("%s unit properties: %w", unit, err)
+	}
+
+	state.LoadState, _ = props["LoadState"].(string)
+	state.ActiveState, _ = props["ActiveState"].(string)
+	state.SubState, _ = props["SubState"].(string)
+	state.UnitFileState, _ = props["UnitFileState"].(string)
+
+	svcProps, err := s.conn.GetUnitTypePropertiesContext(ctx, unit, "Service")
+	if err != nil {
+		// not a service unit, or not loaded
+		return state, nil //nolint:nilerr
+	}
+
+	state.MainPID, _ = svcProps["MainPID"].(uint32)
+	state.NRestarts, _ = svcProps["NRestarts"].(uint32)
+
+	// MemoryCurrent is max uint64 when accounting is not enabled
+	if mem, ok := svcProps["MemoryCurrent"].(uint64); ok && mem != math.MaxUint64 {
+		state.MemoryCurrent = mem
+	}
+
+	return state, nil
+}
+
+// Subscribe replaces the watched units. The connection subscribes to systemd once, a
+// new subscription replaces the previous one (its channel is closed) rather than
+// unsubscribing, which would race with the new subscription.
+func (s *Systemd) Subscribe(ctx context.Context, units []string) (<-chan UnitState, error) {
+	s.subOnce.Do(func() {
+		if err := s.conn.Subscribe(); err != nil {
+			s.subErr = fmt.Errorf("subscribing to systemd: %w", err)
+
+			return
+		}
+
+		updateCh := make(chan *dbus.SubStateUpdate, 32)
+		errCh := make(chan error, 32)
+
+		s.conn.SetSubStateSubscriber(updateCh, errCh)
+
+		go s.dispatch(updateCh, errCh, s.State)
+	})
+
+	if s.subErr != nil {
+		return nil, s.subErr
+	}
+
+	sub := &subscriber{
+		ctx:   ctx,
+		watch: make(map[string]bool, len(units)),
+		ch:    make(chan UnitState, 32),
+	}
+
+	for _, u := range units {
+		sub.watch[u] = true
+	}
+
+	select {
+	case s.subs <- sub:
+	case <-s.closed:
+		return nil, fmt.Errorf("subscribing to systemd: connection closed")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return sub.ch, nil
+}
+
+// subscriber is the current subscription, receiving the state of the watched units.
+type subscriber struct {
+	ctx   context.Context // subscription ends when done
+	watch map[string]bool
+	ch    chan UnitState
+}
+
+// dispatch sends unit state changes to the current subscriber, until the connection is
+// closed. Subscribers are only changed, and their channels closed, here.
+func (s *Systemd) dispatch(updateCh <-chan *dbus.SubStateUpdate, errCh <-chan error, state func(context.Context, string) (UnitState, error)) {
+	var sub *subscriber
+
+	// done is the current subscriber's ctx, nil (never ready) without a subscriber
+	var done <-chan struct{}
+
+	replace := func(next *subscriber) {
+		if sub != nil {
+			close(sub.ch)
+		}
+
+		sub, done = next, nil
+		if next != nil {
+			done = next.ctx.Done()
+		}
+	}
+
+	defer replace(nil)
+
+	for {
+		select {
+		case <-s.closed:
+			return
+		case next := <-s.subs:
+			replace(next)
+		case <-done:
+			replace(nil)
+		case <-errCh:
+			continue
+		case u := <-updateCh:
+			if u == nil || sub == nil || !sub.watch[u.UnitName] {
+				continue
+			}
+
+			st, err := state(sub.ctx, u.UnitName)
+			if err != nil {
+				st = UnitState{Unit: u.UnitName, SubState: u.SubState}
+			}
+
+			select {
+			case sub.ch <- st:
+			case <-done:
+				replace(nil)
+			case next := <-s.subs:
+				replace(next)
+			case <-s.closed:
+				return
+			}
+		}
+	}
+}
+
+func (s *Systemd) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.conn.Close()
+	})
+}
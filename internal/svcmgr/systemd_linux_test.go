@@ -0,0 +1,74 @@
+//go:build linux
+
+package svcmgr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+)
+
+func TestSubscribeReplace(t *testing.T) {
+	s := newSystemd(nil)
+	s.subOnce.Do(func() {}) // no systemd connection, updates are sent by the test
+
+	updateCh := make(chan *dbus.SubStateUpdate)
+	errCh := make(chan error)
+
+	go s.dispatch(updateCh, errCh, func(_ context.Context, unit string) (UnitState, error) {
+		return UnitState{Unit: unit, ActiveState: "active"}, nil
+	})
+
+	receive := func(ch <-chan UnitState) (UnitState, bool) {
+		t.Helper()
+
+		select {
+		case st, ok := <-ch:
+			return st, ok
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for unit state")
+		}
+
+		return UnitState{}, false
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+
+	ch1, err := s.Subscribe(ctx1, []string{"a.service"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updateCh <- &dbus.SubStateUpdate{UnitName: "a.service", SubState: "running"}
+
+	if st, ok := receive(ch1); !ok || st.Unit != "a.service" {
+		t.Fatalf("first subscription = %+v, %t", st, ok)
+	}
+
+	// resubscribing straight after cancelling, as the status poller does
+	cancel1()
+
+	ch2, err := s.Subscribe(context.Background(), []string{"b.service"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := receive(ch1); ok {
+		t.Fatal("first subscription not closed")
+	}
+
+	updateCh <- &dbus.SubStateUpdate{UnitName: "a.service", SubState: "dead"}
+	updateCh <- &dbus.SubStateUpdate{UnitName: "b.service", SubState: "running"}
+
+	if st, ok := receive(ch2); !ok || st.Unit != "b.service" {
+		t.Fatalf("second subscription = %+v, %t", st, ok)
+	}
+
+	close(s.closed)
+
+	if _, ok := receive(ch2); ok {
+		t.Fatal("subscription not closed with the connection")
+	}
+}
@@ -0,0 +1,163 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/release"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OpenTelemetry spans for the action lifecycle, without an exporter configured
+// the global (no-op) tracer provider is used and spans cost next to nothing.
+
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+
+	tracerName = "github.com/circonus/agent-manager"
+)
+
+// span attributes.
+const (
+	AttrAgentType    = attribute.Key("circonus.agent.type")
+	AttrAssignmentID = attribute.Key("circonus.config.assignment_id")
+	AttrConfigPath   = attribute.Key("circonus.config.path")
+	AttrActionType   = attribute.Key("circonus.action.type")
+	AttrActionID     = attribute.Key("circonus.action.id")
+	AttrActionCount  = attribute.Key("circonus.action.count")
+	AttrCommand      = attribute.Key("circonus.command")
+	AttrExitCode     = attribute.Key("circonus.command.exit_code")
+)
+
+// Start configures the tracer provider from the tracing settings, the returned
+// function flushes and stops the exporter.
+func Start(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter, err := newExporter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(release.NAME),
+		semconv.ServiceVersion(release.VERSION),
+		attribute.String("circonus.manager.id", viper.GetString(keys.ManagerID)),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("tracing resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(viper.GetFloat64(keys.TracingSampleRatio)))),
+	)
+
+	otel.SetTracerProvider(tp)
+
+	log.Info().Str("exporter", viper.GetString(keys.TracingExporter)).Msg("tracing enabled")
+
+	return tp.Shutdown, nil
+}
+
+func newExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	switch exp := strings.ToLower(viper.GetString(keys.TracingExporter)); exp {
+	case "", ExporterNone:
+		return nil, nil //nolint:nilnil
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if endpoint := viper.GetString(keys.TracingEndpoint); endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+		}
+
+		e, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("otlp trace exporter: %w", err)
+		}
+
+		return e, nil
+	case ExporterStdout:
+		e, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("stdout trace exporter: %w", err)
+		}
+
+		return e, nil
+	case ExporterFile:
+		file := viper.GetString(keys.TracingFile)
+		if file == "" {
+			return nil, errors.New("file trace exporter: tracing file not set")
+		}
+
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("file trace exporter: %w", err)
+		}
+
+		e, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+
+			return nil, fmt.Errorf("file trace exporter: %w", err)
+		}
+
+		return fileExporter{SpanExporter: e, f: f}, nil
+	default:
+		return nil, fmt.Errorf("unknown trace exporter (%s)", exp)
+	}
+}
+
+// fileExporter closes the file when the exporter is shut down.
+type fileExporter struct {
+	sdktrace.SpanExporter
+	f *os.File
+}
+
+func (e fileExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(e.SpanExporter.Shutdown(ctx), e.f.Close())
+}
+
+// StartSpan starts a span using the global tracer provider.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err (if any) on the span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// Inject adds the trace context of ctx to the outgoing request headers.
+func Inject(ctx context.Context, h http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(h))
+}
@@ -0,0 +1,87 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/spf13/viper"
+)
+
+func TestStart(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spans.json")
+
+	tests := []struct {
+		name     string
+		exporter string
+		file     string
+		wantErr  bool
+	}{
+		{name: "none", exporter: ExporterNone},
+		{name: "file", exporter: ExporterFile, file: file},
+		{name: "file (not set)", exporter: ExporterFile, wantErr: true},
+		{name: "unknown", exporter: "zipkin", wantErr: true},
+	}
+
+	defer func() {
+		viper.Set(keys.TracingExporter, "")
+		viper.Set(keys.TracingFile, "")
+	}()
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set(keys.TracingExporter, tt.exporter)
+			viper.Set(keys.TracingFile, tt.file)
+			viper.Set(keys.TracingSampleRatio, 1.0)
+
+			stop, err := Start(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, span := StartSpan(context.Background(), "config.install", AttrAgentType.String("telegraf"))
+
+			h := http.Header{}
+			Inject(ctx, h)
+
+			End(span, errors.New("write failed"))
+
+			if err := stop(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.file == "" {
+				return
+			}
+
+			if h.Get("traceparent") == "" {
+				t.Error("expected traceparent header")
+			}
+
+			data, err := os.ReadFile(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range []string{`"Name":"config.install"`, `"telegraf"`, `write failed`} {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("exported span missing %s", want)
+				}
+			}
+		})
+	}
+}
@@ -6,32 +6,64 @@ import (
 	"time"
 
 	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/heartbeat"
 	"github.com/circonus/agent-manager/internal/inventory"
+	"github.com/circonus/agent-manager/internal/maintenance"
+	"github.com/circonus/agent-manager/internal/metrics"
 	"github.com/circonus/agent-manager/internal/registration"
+	"github.com/circonus/agent-manager/internal/splay"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 )
 
 type Poller struct {
-	interval time.Duration
+	intervals chan time.Duration // new interval, applied by the poll loop
+	interval  time.Duration
 }
 
 func NewPoller() (*Poller, error) {
-	pi := viper.GetString(keys.TrackerPollingInterval)
+	i, err := pollingInterval(viper.GetViper())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Poller{interval: i, intervals: make(chan time.Duration, 1)}, nil
+}
+
+func pollingInterval(v *viper.Viper) (time.Duration, error) {
+	pi := v.GetString(keys.TrackerPollingInterval)
 
 	i, err := time.ParseDuration(pi)
 	if err != nil {
-		return nil, fmt.Errorf("parsing tracker polling interval: %w", err)
+		return 0, fmt.Errorf("parsing tracker polling interval: %w", err)
 	}
 
-	return &Poller{interval: i}, nil
+	return i, nil
+}
+
+// Reconfigure applies the polling interval setting from v (e.g. after a config reload).
+func (p *Poller) Reconfigure(v *viper.Viper) error {
+	i, err := pollingInterval(v)
+	if err != nil {
+		return err
+	}
+
+	// only the latest setting matters
+	select {
+	case <-p.intervals:
+	default:
+	}
+
+	p.intervals <- i
+
+	return nil
 }
 
 func (p *Poller) Start(ctx context.Context) {
 	log.Info().Str("interval", p.interval.String()).Msg("starting config tracker")
 
 	for {
-		t := time.NewTimer(p.interval)
+		t := time.NewTimer(splay.Jitter(p.interval))
 		select {
 		case <-ctx.Done():
 			if !t.Stop() {
@@ -39,10 +71,30 @@ func (p *Poller) Start(ctx context.Context) {
 			}
 
 			return
+		case i := <-p.intervals:
+			if !t.Stop() {
+				<-t.C
+			}
+
+			if i != p.interval {
+				log.Info().Str("interval", i.String()).Msg("config tracker interval changed")
+			}
+
+			p.interval = i
 		case <-t.C:
+			if maintenance.Active() {
+				// changes made during maintenance are not reported as drift
+				log.Debug().Msg("host in maintenance, not tracking installed configs")
+				heartbeat.Ran(heartbeat.Tracker, nil)
+
+				continue
+			}
+
 			log.Debug().Msg("tracking installed configs")
 
 			agents, err := registration.LoadInstalledAgents()
+			heartbeat.Ran(heartbeat.Tracker, err)
+
 			if err != nil {
 				log.Error().Err(err).Msg("loading installed agents, restart to inventory installed agents")
 
@@ -58,7 +110,10 @@ func (p *Poller) Start(ctx context.Context) {
 				}
 
 				for cfgID, path := range agent.ConfigFiles {
-					if err := VerifyConfig(ctx, a.AgentTypeID, path); err != nil {
+					err := VerifyConfig(ctx, a.AgentTypeID, path)
+					metrics.TrackerCheck(err)
+
+					if err != nil {
 						log.Error().Err(err).
 							Str("agent", a.AgentTypeID).
 							Str("id", cfgID).
@@ -16,7 +16,9 @@ import (
 
 	"github.com/circonus/agent-manager/internal/config/defaults"
 	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/circonus/agent-manager/internal/metrics"
 	"github.com/circonus/agent-manager/internal/registration"
+	"github.com/circonus/agent-manager/internal/tracing"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
@@ -28,6 +30,7 @@ type Tracker struct {
 	S            string `json:"s"             yaml:"s"`
 	D            string `json:"d"             yaml:"d"`
 	Modified     bool   `json:"modified"      yaml:"modified"`
+	Applied      bool   `json:"applied"       yaml:"applied"`
 }
 
 func VerifyConfig(ctx context.Context, agentName, cfgFile string) error {
@@ -65,6 +68,8 @@ func VerifyConfig(ctx context.Context, agentName, cfgFile string) error {
 	}
 
 	if s != t.S {
+		metrics.ConfigDrift(agentName)
+
 		if err := UpdateAssignmentStatus(ctx, t); err != nil {
 			return err
 		}
@@ -80,7 +85,40 @@ func VerifyConfig(ctx context.Context, agentName, cfgFile string) error {
 	return nil
 }
 
+// ConfirmApplied reports the config assignment as applied when the checksum of the config
+// loaded by the agent matches the current config. Returns true if it was reported.
+func ConfirmApplied(ctx context.Context, agentName, cfgFile, checksum string) (bool, error) {
+	trackerFile, err := getTrackerFile(agentName, cfgFile)
+	if err != nil {
+		return false, err
+	}
+
+	t, err := loadTracker(trackerFile)
+	if err != nil {
+		return false, err
+	}
+
+	if t.Applied || t.Modified || t.AgentID == "" || t.AssignmentID == "" || t.S != checksum {
+		return false, nil
+	}
+
+	if err := updateAssignmentStatus(ctx, t, "applied"); err != nil {
+		return false, err
+	}
+
+	t.Applied = true
+	if err := saveTracker(trackerFile, t); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
 func UpdateAssignmentStatus(ctx context.Context, t *Tracker) error {
+	return updateAssignmentStatus(ctx, t, "modified")
+}
+
+func updateAssignmentStatus(ctx context.Context, t *Tracker, assignmentStatus string) error {
 	token := viper.GetString(keys.APIToken)
 	if token == "" {
 		return fmt.Errorf("invalid api token (empty)")
@@ -96,7 +134,7 @@ func UpdateAssignmentStatus(ctx context.Context, t *Tracker) error {
 		return fmt.Errorf("req url: %w", err)
 	}
 
-	status := []byte(`{"status":"modified"}`)
+	status := []byte(`{"status":"` + assignmentStatus + `"}`)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPut, reqURL, bytes.NewReader(status))
 	if err != nil {
@@ -104,11 +142,14 @@ func UpdateAssignmentStatus(ctx context.Context, t *Tracker) error {
 	}
 
 	req.Header.Add("Authorization", token)
+	tracing.Inject(ctx, req.Header)
 
 	client := &http.Client{}
 
 	resp, err := client.Do(req)
 	if err != nil {
+		metrics.APIError("config_assignment", 0)
+
 		return fmt.Errorf("calling actions endpoint: %w", err)
 	}
 
@@ -119,6 +160,10 @@ func UpdateAssignmentStatus(ctx context.Context, t *Tracker) error {
 		return fmt.Errorf("reading response body: %w", err)
 	}
 
+	if resp.StatusCode != http.StatusOK {
+		metrics.APIError("config_assignment", resp.StatusCode)
+	}
+
 	if resp.StatusCode == http.StatusUnauthorized {
 		if err := registration.RefreshRegistration(ctx); err != nil {
 			return fmt.Errorf("new token: %w", err)
@@ -156,6 +201,7 @@ func UpdateConfig(agentName, cfgAssignmentID, cfgFile string, data []byte) error
 
 	t.AssignmentID = cfgAssignmentID
 	t.Modified = false
+	t.Applied = false
 
 	s, err := generateChecksum(cfgFile)
 	if err != nil {
@@ -172,6 +218,21 @@ func UpdateConfig(agentName, cfgAssignmentID, cfgFile string, data []byte) error
 	return nil
 }
 
+// Load returns the tracking information for the agent's config file.
+func Load(agentName, cfgFile string) (*Tracker, error) {
+	trackerFile, err := getTrackerFile(agentName, cfgFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadTracker(trackerFile)
+}
+
+// Checksum returns the checksum of the config file as it is currently on disk.
+func Checksum(cfgFile string) (string, error) {
+	return generateChecksum(cfgFile)
+}
+
 func getTrackerFile(agentName, cfgFile string) (string, error) {
 	baseDir, err := getBasePath(agentName)
 	if err != nil {
@@ -0,0 +1,185 @@
+package window
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule is a parsed 5 field cron expression (minute hour day-of-month month
+// day-of-week). Fields support *, values, ranges (1-5), lists (1,15) and steps
+// (*/15, 0-30/10). Months and days of the week may be names (jan, mon), Sunday is
+// 0 or 7. As with cron, when both day fields are restricted either may match.
+type schedule struct {
+	minute [60]bool
+	hour   [24]bool
+	dom    [32]bool
+	month  [13]bool
+	dow    [7]bool
+	anyDOM bool
+	anyDOW bool
+}
+
+var (
+	monthNames = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+	dowNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+func parseSchedule(expr string) (*schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q: expected 5 fields (minute hour day-of-month month day-of-week)", expr)
+	}
+
+	s := &schedule{anyDOM: fields[2] == "*", anyDOW: fields[4] == "*"}
+
+	for _, f := range []struct {
+		set   func(int)
+		names map[string]int
+		name  string
+		expr  string
+		min   int
+		max   int
+	}{
+		{name: "minute", expr: fields[0], min: 0, max: 59, set: func(v int) { s.minute[v] = true }},
+		{name: "hour", expr: fields[1], min: 0, max: 23, set: func(v int) { s.hour[v] = true }},
+		{name: "day-of-month", expr: fields[2], min: 1, max: 31, set: func(v int) { s.dom[v] = true }},
+		{name: "month", expr: fields[3], min: 1, max: 12, names: monthNames, set: func(v int) { s.month[v] = true }},
+		{name: "day-of-week", expr: fields[4], min: 0, max: 7, names: dowNames, set: func(v int) { s.dow[v%7] = true }},
+	} {
+		if err := parseField(f.expr, f.min, f.max, f.names, f.set); err != nil {
+			return nil, fmt.Errorf("schedule %q: %s: %w", expr, f.name, err)
+		}
+	}
+
+	return s, nil
+}
+
+func parseField(expr string, min, max int, names map[string]int, set func(int)) error {
+	value := func(v string) (int, error) {
+		if n, ok := names[strings.ToLower(v)]; ok {
+			return n, nil
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value %q", v)
+		}
+
+		if n < min || n > max {
+			return 0, fmt.Errorf("%d out of range %d-%d", n, min, max)
+		}
+
+		return n, nil
+	}
+
+	for _, part := range strings.Split(expr, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+
+		step := 1
+
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid step %q", stepStr)
+			}
+
+			step = n
+		}
+
+		lo, hi := min, max
+
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			l, h, _ := strings.Cut(rng, "-")
+
+			var err error
+
+			if lo, err = value(l); err != nil {
+				return err
+			}
+
+			if hi, err = value(h); err != nil {
+				return err
+			}
+
+			if lo > hi {
+				return fmt.Errorf("invalid range %q", rng)
+			}
+		default:
+			n, err := value(rng)
+			if err != nil {
+				return err
+			}
+
+			lo, hi = n, n
+			if hasStep {
+				hi = max
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set(v)
+		}
+	}
+
+	return nil
+}
+
+func (s *schedule) dayMatches(t time.Time) bool {
+	dom := s.dom[t.Day()]
+	dow := s.dow[t.Weekday()]
+
+	switch {
+	case s.anyDOM && s.anyDOW:
+		return true
+	case s.anyDOM:
+		return dow
+	case s.anyDOW:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// next returns the first time after t matching the schedule, in loc. Zero if there
+// is none within 5 years (e.g. Feb 30).
+func (s *schedule) next(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !s.month[t.Month()]:
+			t = advance(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+		case !s.dayMatches(t):
+			t = advance(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+		case !s.hour[t.Hour()]:
+			t = advance(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc))
+		case !s.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// advance returns next, or the start of the next hour when next is not after t. A
+// local time in a daylight saving gap (e.g. 02:00 when clocks go forward) is
+// normalized to before the gap.
+func advance(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+
+	return t.Add(time.Duration(60-t.Minute()) * time.Minute)
+}
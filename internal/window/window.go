@@ -0,0 +1,171 @@
+// Package window implements change windows, the local schedule of when config
+// assignments may be applied to the host. Outside a window config actions are
+// deferred until the next window opens. With no windows configured changes may be
+// applied at any time.
+package window
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+	_ "time/tzdata" // time zones on hosts without a zoneinfo database
+
+	"github.com/circonus/agent-manager/internal/config/keys"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// MaxDuration is the longest a window may stay open.
+const MaxDuration = 7 * 24 * time.Hour
+
+// Spec is a change window as configured.
+type Spec struct {
+	Name     string `json:"name"     yaml:"name"`
+	Schedule string `json:"schedule" yaml:"schedule"` // cron expression, when the window opens
+	Duration string `json:"duration" yaml:"duration"` // how long it stays open
+	Timezone string `json:"timezone" yaml:"timezone"` // IANA name, default UTC
+}
+
+// Window is a parsed change window.
+type Window struct {
+	sched    *schedule
+	loc      *time.Location
+	Name     string
+	duration time.Duration
+}
+
+// State is whether changes may be applied now and, if not, when the next window opens.
+type State struct {
+	Next       time.Time `json:"next,omitempty"`
+	Configured bool      `json:"configured"`
+	Open       bool      `json:"open"`
+}
+
+// Parse parses the windows setting (e.g. viper.Get(keys.ChangeWindows)).
+func Parse(raw any) ([]Window, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	var specs []Spec
+
+	data, err := yaml.Marshal(raw)
+	if err == nil {
+		err = yaml.Unmarshal(data, &specs)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", keys.ChangeWindows, err)
+	}
+
+	windows := make([]Window, 0, len(specs))
+
+	for i, spec := range specs {
+		w, err := New(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s[%d]: %w", keys.ChangeWindows, i, err)
+		}
+
+		windows = append(windows, w)
+	}
+
+	return windows, nil
+}
+
+// New returns the window for the spec.
+func New(spec Spec) (Window, error) {
+	sched, err := parseSchedule(spec.Schedule)
+	if err != nil {
+		return Window{}, err
+	}
+
+	d, err := time.ParseDuration(spec.Duration)
+	if err != nil {
+		return Window{}, fmt.Errorf("duration: %w", err)
+	}
+
+	if d < time.Minute || d > MaxDuration {
+		return Window{}, fmt.Errorf("duration %s not between 1m and %s", d, MaxDuration)
+	}
+
+	loc := time.UTC
+
+	if spec.Timezone != "" {
+		loc, err = time.LoadLocation(spec.Timezone)
+		if err != nil {
+			return Window{}, fmt.Errorf("timezone: %w", err)
+		}
+	}
+
+	name := spec.Name
+	if name == "" {
+		name = spec.Schedule
+	}
+
+	return Window{Name: name, sched: sched, loc: loc, duration: d}, nil
+}
+
+// Open returns true if the window is open at t.
+func (w Window) Open(t time.Time) bool {
+	start := w.sched.next(t.Add(-w.duration), w.loc)
+
+	return !start.IsZero() && !start.After(t)
+}
+
+// Next returns when the window next opens after t, zero if never.
+func (w Window) Next(t time.Time) time.Time {
+	return w.sched.next(t, w.loc)
+}
+
+// settings are the reloaded settings, the global settings until the first reload.
+var settings atomic.Pointer[viper.Viper]
+
+// Reconfigure applies the change windows setting from v (e.g. after a config reload).
+func Reconfigure(v *viper.Viper) {
+	settings.Store(v)
+}
+
+func conf() *viper.Viper {
+	if v := settings.Load(); v != nil {
+		return v
+	}
+
+	return viper.GetViper()
+}
+
+// Current returns the change window state at t for the configured windows. Windows
+// which cannot be parsed (rejected by config validation) are treated as closed.
+func Current(t time.Time) State {
+	windows, err := Parse(conf().Get(keys.ChangeWindows))
+	if err != nil {
+		log.Warn().Err(err).Msg("invalid change windows, changes deferred")
+
+		return State{Configured: true}
+	}
+
+	return stateAt(windows, t)
+}
+
+func stateAt(windows []Window, t time.Time) State {
+	if len(windows) == 0 {
+		return State{Open: true}
+	}
+
+	s := State{Configured: true}
+
+	for _, w := range windows {
+		if w.Open(t) {
+			s.Open = true
+			s.Next = time.Time{}
+
+			return s
+		}
+
+		if n := w.Next(t); !n.IsZero() && (s.Next.IsZero() || n.Before(s.Next)) {
+			s.Next = n
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,183 @@
+package window
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{expr: "0 2 * * *"},
+		{expr: "*/15 1-5 * * mon-fri"},
+		{expr: "30 22 1,15 jan,jul 0"},
+		{expr: "0 0 * * 7"},
+		{expr: "5/10 * * * *"},
+		{expr: "0 2 * *", wantErr: true},
+		{expr: "60 2 * * *", wantErr: true},
+		{expr: "0 2 * * fun", wantErr: true},
+		{expr: "0 5-1 * * *", wantErr: true},
+		{expr: "*/0 * * * *", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.expr, func(t *testing.T) {
+			if _, err := parseSchedule(tt.expr); (err != nil) != tt.wantErr {
+				t.Fatalf("parseSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWindow(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Saturday 2024-03-02
+	sat := func(hour, min int, loc *time.Location) time.Time {
+		return time.Date(2024, 3, 2, hour, min, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name     string
+		spec     Spec
+		at       time.Time
+		wantOpen bool
+		wantNext time.Time
+	}{
+		{
+			name:     "before",
+			spec:     Spec{Schedule: "0 2 * * sat", Duration: "2h"},
+			at:       sat(1, 59, time.UTC),
+			wantNext: sat(2, 0, time.UTC),
+		},
+		{
+			name:     "opening",
+			spec:     Spec{Schedule: "0 2 * * sat", Duration: "2h"},
+			at:       sat(2, 0, time.UTC),
+			wantOpen: true,
+			wantNext: sat(2, 0, time.UTC).AddDate(0, 0, 7),
+		},
+		{
+			name:     "open",
+			spec:     Spec{Schedule: "0 2 * * sat", Duration: "2h"},
+			at:       sat(3, 59, time.UTC),
+			wantOpen: true,
+			wantNext: sat(2, 0, time.UTC).AddDate(0, 0, 7),
+		},
+		{
+			name:     "closed",
+			spec:     Spec{Schedule: "0 2 * * sat", Duration: "2h"},
+			at:       sat(4, 0, time.UTC),
+			wantNext: sat(2, 0, time.UTC).AddDate(0, 0, 7),
+		},
+		{
+			name:     "timezone",
+			spec:     Spec{Schedule: "0 2 * * sat", Duration: "2h", Timezone: "America/New_York"},
+			at:       sat(3, 0, time.UTC), // 22:00 friday in New York
+			wantNext: sat(2, 0, ny),
+		},
+		{
+			name:     "timezone open",
+			spec:     Spec{Schedule: "0 2 * * sat", Duration: "2h", Timezone: "America/New_York"},
+			at:       sat(8, 0, time.UTC), // 03:00 in New York
+			wantOpen: true,
+			wantNext: sat(2, 0, ny).AddDate(0, 0, 7),
+		},
+		{
+			name:     "spans midnight",
+			spec:     Spec{Schedule: "0 23 * * fri", Duration: "3h"},
+			at:       sat(1, 30, time.UTC),
+			wantOpen: true,
+			wantNext: sat(23, 0, time.UTC).AddDate(0, 0, 6),
+		},
+		{
+			name:     "dst",
+			spec:     Spec{Schedule: "30 2 * * *", Duration: "1h", Timezone: "America/New_York"},
+			at:       time.Date(2024, 3, 10, 0, 0, 0, 0, ny), // 02:30 does not exist on 2024-03-10
+			wantNext: time.Date(2024, 3, 11, 2, 30, 0, 0, ny),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := New(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if open := w.Open(tt.at); open != tt.wantOpen {
+				t.Errorf("Open() = %t, want %t", open, tt.wantOpen)
+			}
+
+			if next := w.Next(tt.at); !next.Equal(tt.wantNext) {
+				t.Errorf("Next() = %s, want %s", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		raw     any
+		name    string
+		want    int
+		wantErr bool
+	}{
+		{name: "none", raw: nil},
+		{
+			name: "valid",
+			raw: []any{
+				map[string]any{"name": "weekend", "schedule": "0 2 * * sat", "duration": "4h", "timezone": "Europe/London"},
+				map[string]any{"schedule": "0 12 * * 3", "duration": "30m"},
+			},
+			want: 2,
+		},
+		{name: "duration", raw: []any{map[string]any{"schedule": "0 2 * * *", "duration": "8d"}}, wantErr: true},
+		{name: "duration too long", raw: []any{map[string]any{"schedule": "0 2 * * *", "duration": "200h"}}, wantErr: true},
+		{name: "timezone", raw: []any{map[string]any{"schedule": "0 2 * * *", "duration": "1h", "timezone": "Mars/Base"}}, wantErr: true},
+		{name: "not a list", raw: "0 2 * * *", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			windows, err := Parse(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if len(windows) != tt.want {
+				t.Fatalf("Parse() = %d windows, want %d", len(windows), tt.want)
+			}
+		})
+	}
+}
+
+func TestStateAt(t *testing.T) {
+	at := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	if s := stateAt(nil, at); !s.Open || s.Configured {
+		t.Fatalf("expected open with no windows, got %+v", s)
+	}
+
+	early, _ := New(Spec{Schedule: "0 13 * * *", Duration: "1h"})
+	late, _ := New(Spec{Schedule: "0 18 * * *", Duration: "1h"})
+
+	s := stateAt([]Window{late, early}, at)
+	if s.Open || !s.Next.Equal(at.Add(time.Hour)) {
+		t.Fatalf("expected closed until 13:00, got %+v", s)
+	}
+
+	now, _ := New(Spec{Schedule: "0 11 * * *", Duration: "2h"})
+
+	if s := stateAt([]Window{late, now}, at); !s.Open {
+		t.Fatalf("expected open, got %+v", s)
+	}
+}